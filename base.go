@@ -0,0 +1,85 @@
+package objectsync
+
+import (
+	"bytes"
+	"context"
+)
+
+// BaseStorage keeps the content of objects as they were at the last sync, so
+// that conflicting changes can be merged against their common base.
+type BaseStorage interface {
+	Set(ctx context.Context, object *GenericObject) error
+	Get(ctx context.Context, id string, hash Hash) (*GenericObject, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// InMemoryBaseStorage ...
+type InMemoryBaseStorage struct {
+	db map[string]*GenericObject
+}
+
+// NewInMemoryBaseStorage ...
+func NewInMemoryBaseStorage() *InMemoryBaseStorage {
+	db := make(map[string]*GenericObject)
+	return &InMemoryBaseStorage{db: db}
+}
+
+// Set will replace the base of the object
+func (s *InMemoryBaseStorage) Set(ctx context.Context, object *GenericObject) error {
+	base := *object
+	s.db[object.ID] = &base
+	return nil
+}
+
+// Get will return the base of an object if it has the given hash
+func (s *InMemoryBaseStorage) Get(ctx context.Context, id string, hash Hash) (*GenericObject, error) {
+	object, ok := s.db[id]
+	if !ok || !bytes.Equal(object.Hash, hash) {
+		return nil, ErrorNotFound
+	}
+
+	return object, nil
+}
+
+// Delete ...
+func (s *InMemoryBaseStorage) Delete(ctx context.Context, id string) error {
+	delete(s.db, id)
+	return nil
+}
+
+// getBase will return the base recorded for the status, or nil if there is none
+func getBase(ctx context.Context, syncStatus *SyncStatus, o *options) (*GenericObject, error) {
+	if o.bases == nil || syncStatus == nil {
+		return nil, nil
+	}
+
+	base, err := o.bases.Get(ctx, syncStatus.ID, syncStatus.LocalHash)
+	found, err := wasFound(err)
+	if err != nil || !found {
+		return nil, err
+	}
+	return base, nil
+}
+
+// setBase will record the object as the base for its status.  It is kept
+// under the local hash of the status, which getBase looks it up by.
+func setBase(ctx context.Context, object *GenericObject, syncStatus *SyncStatus, o *options) error {
+	if o.bases == nil || object == nil {
+		return nil
+	}
+
+	err := loadValue(ctx, object)
+	if err != nil {
+		return err
+	}
+	base := *object
+	base.Hash = syncStatus.LocalHash
+	return o.bases.Set(ctx, &base)
+}
+
+func deleteBase(ctx context.Context, id string, o *options) error {
+	if o.bases == nil {
+		return nil
+	}
+	return o.bases.Delete(ctx, id)
+}
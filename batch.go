@@ -0,0 +1,136 @@
+package objectsync
+
+import (
+	"context"
+	"fmt"
+)
+
+// BatchWriter is implemented by a Storage that can write many objects at
+// once, such as in one transaction or over one stream.  Sync gathers the
+// objects it sets in and deletes from such a storage, and writes them in a
+// batch of each before their statuses.
+type BatchWriter interface {
+	// SetBatch will set the objects, giving each its hash
+	SetBatch(ctx context.Context, objects []*GenericObject) error
+	DeleteBatch(ctx context.Context, ids []string) error
+}
+
+// writeBatch holds the changes gathered for a BatchWriter
+type writeBatch struct {
+	sets    []*Change
+	objects []*GenericObject
+	deletes []*Change
+	ids     []string
+}
+
+// writeBatches will apply the set and delete changes of the storages that
+// are BatchWriters, and return the changes left to apply one by one.  Writes
+// that need more than the object, such as those sharing a transaction with
+// their status or leaving a tombstone, are left.
+func writeBatches(ctx context.Context, changes []*Change, local, remote Storage, status StatusStorage, o *options) ([]*Change, error) {
+	batches := map[Storage]*writeBatch{}
+	var stores []Storage
+	rest := make([]*Change, 0, len(changes))
+	for _, change := range changes {
+		if !batchable(change, status, o) {
+			rest = append(rest, change)
+			continue
+		}
+
+		batch, ok := batches[change.Store]
+		if !ok {
+			batch = &writeBatch{}
+			batches[change.Store] = batch
+			stores = append(stores, change.Store)
+		}
+		if change.Type == ChangeTypeDelete {
+			batch.deletes = append(batch.deletes, change)
+			batch.ids = append(batch.ids, change.Object.ID)
+			continue
+		}
+
+		object, err := changedObject(ctx, change)
+		if err != nil {
+			return nil, err
+		}
+		batch.sets = append(batch.sets, change)
+		batch.objects = append(batch.objects, object)
+	}
+
+	for _, store := range stores {
+		origin := remote
+		if store == remote {
+			origin = local
+		}
+		err := batches[store].write(WithOrigin(ctx, origin.GetName()), store, status, o)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rest, nil
+}
+
+// batchable will return true if the change can be written in a batch
+func batchable(change *Change, status StatusStorage, o *options) bool {
+	if change.Type != ChangeTypeSet && change.Type != ChangeTypeDelete {
+		return false
+	}
+	if _, ok := change.Store.(BatchWriter); !ok {
+		return false
+	}
+	if ts, ok := change.Store.(TransactionalStorage); ok && ts.SupportsStatus(status) {
+		return false
+	}
+	_, tombstones := change.Store.(TombstoneStorage)
+	return change.Type == ChangeTypeSet || !(o.tombstones && tombstones && change.Tombstone != nil)
+}
+
+// write will write the batch to store, then the statuses of its objects
+func (b *writeBatch) write(ctx context.Context, store Storage, status StatusStorage, o *options) error {
+	writer := store.(BatchWriter)
+	if len(b.objects) > 0 {
+		fmt.Printf("Adding %v objects To: %s\n", len(b.objects), store.GetName())
+		err := writer.SetBatch(ctx, b.objects)
+		if err != nil {
+			return err
+		}
+	}
+	for i, change := range b.sets {
+		object := b.objects[i]
+		err := status.Set(ctx, change.SyncStatus)
+		if err != nil {
+			return err
+		}
+		err = setStatusHash(ctx, status, change, object.Hash)
+		if err != nil {
+			return err
+		}
+		err = setBase(ctx, object, change.SyncStatus, o)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Added: %v To: %s\n", change.Object.ID, store.GetName())
+	}
+
+	if len(b.ids) > 0 {
+		fmt.Printf("Deleting %v objects From: %s\n", len(b.ids), store.GetName())
+		err := writer.DeleteBatch(ctx, b.ids)
+		if err != nil {
+			return err
+		}
+	}
+	for _, change := range b.deletes {
+		err := status.Delete(ctx, change.Object.ID)
+		if err != nil {
+			return err
+		}
+		err = deleteBase(ctx, change.Object.ID, o)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Deleted: %v From: %s\n", change.Object.ID, store.GetName())
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package objectsync
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Check the interfaces
+var _ BatchWriter = &batchingStorage{}
+
+// batchingStorage writes in batches, and counts the batches and single writes
+type batchingStorage struct {
+	*InMemoryStorage
+	batches, writes int
+}
+
+func (s *batchingStorage) Set(ctx context.Context, object *GenericObject) error {
+	s.writes++
+	return s.InMemoryStorage.Set(ctx, object)
+}
+
+func (s *batchingStorage) Delete(ctx context.Context, id string) error {
+	s.writes++
+	return s.InMemoryStorage.Delete(ctx, id)
+}
+
+func (s *batchingStorage) SetBatch(ctx context.Context, objects []*GenericObject) error {
+	s.batches++
+	for _, object := range objects {
+		err := s.InMemoryStorage.Set(ctx, object)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *batchingStorage) DeleteBatch(ctx context.Context, ids []string) error {
+	s.batches++
+	for _, id := range ids {
+		err := s.InMemoryStorage.Delete(ctx, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestBatch(t *testing.T) {
+
+	ctx := context.TODO()
+
+	t.Run("Sync", func(t *testing.T) {
+		store1 := NewInMemoryStorage("local")
+		store2 := &batchingStorage{InMemoryStorage: NewInMemoryStorage("remote")}
+		status := NewInMemoryStatusStorage()
+		for i := 0; i < 100; i++ {
+			store1.Set(ctx, &GenericObject{ID: fmt.Sprintf("object%v", i), Value: fmt.Sprintf("value%v", i), Modified: time.Now().UTC()})
+		}
+
+		err := Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if store2.batches != 1 || store2.writes != 0 {
+			t.Errorf("Unexpected writes = %v batches and %v single", store2.batches, store2.writes)
+		}
+
+		for i := 0; i < 10; i++ {
+			store1.Delete(ctx, fmt.Sprintf("object%v", i))
+		}
+		store1.Set(ctx, &GenericObject{ID: "object10", Value: "changed", Modified: time.Now().UTC()})
+		store2.batches = 0
+		err = Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if store2.batches != 2 || store2.writes != 0 {
+			t.Errorf("Unexpected writes = %v batches and %v single", store2.batches, store2.writes)
+		}
+		checkStore(ctx, store2, 90, nil, t)
+
+		// The statuses are written with the batches
+		stati, _ := status.GetAll(ctx)
+		if len(stati) != 90 {
+			t.Errorf("Incorrect status len = %v, want 90", len(stati))
+		}
+		object, _ := store2.Get(ctx, "object10")
+		if object.Value != "changed" {
+			t.Errorf("Unexpected value = %s", object.Value)
+		}
+	})
+}
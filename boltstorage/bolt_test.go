@@ -0,0 +1,395 @@
+package boltstorage
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/keithballdotnet/objectsync"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Check the interfaces
+var _ objectsync.TransactionalStorage = &BoltStorage{}
+var _ objectsync.StatusStorage = &BoltStatusStorage{}
+var _ objectsync.Merkler = &BoltStorage{}
+var _ objectsync.Sketcher = &BoltStorage{}
+var _ objectsync.TokenStorage = &BoltStatusStorage{}
+var _ objectsync.VersionStorage = &BoltVersionStorage{}
+
+func TestBoltStorage(t *testing.T) {
+
+	ctx := context.TODO()
+	path := filepath.Join(t.TempDir(), "objectsync.db")
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	store1, err := db.Storage("local")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	store2, err := db.Storage("remote")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	status, err := db.StatusStorage("local_remote")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if !store1.SupportsStatus(status) || store1.SupportsStatus(objectsync.NewInMemoryStatusStorage()) {
+		t.Errorf("Unexpected status support")
+	}
+
+	for i := 0; i < 3; i++ {
+		err = store1.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("local%v", i), Value: fmt.Sprintf("Object%v", i), Modified: time.Now().UTC()})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = store2.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("remote%v", i), Value: fmt.Sprintf("Object%v", i), Modified: time.Now().UTC()})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+
+	opts := []objectsync.Option{objectsync.WithCausality("local", "remote")}
+	err = objectsync.Sync(ctx, store1, store2, status, opts...)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	err = store1.Delete(ctx, "remote0")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	err = objectsync.Sync(ctx, store1, store2, status, opts...)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	err = db.Close()
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	// Everything survives reopening the file
+	db, err = Open(path)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer db.Close()
+
+	store1, _ = db.Storage("local")
+	store2, _ = db.Storage("remote")
+	status, _ = db.StatusStorage("local_remote")
+
+	for _, store := range []*BoltStorage{store1, store2} {
+		all, err := store.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 5 {
+			t.Errorf("Incorrect len = %v, want 5 in %s", len(all), store.GetName())
+		}
+	}
+
+	object, err := store2.Get(ctx, "local1")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if object.Value != "Object1" || object.Version["local"] != 1 {
+		t.Errorf("Unexpected object = %+v", object)
+	}
+
+	stati, err := status.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(stati) != 5 {
+		t.Errorf("Incorrect status len = %v, want 5", len(stati))
+	}
+	_, err = status.Get(ctx, "remote0")
+	if !objectsync.IsNotFoundError(err) {
+		t.Errorf("Unexpected error = %v", err)
+	}
+
+	// Nothing changes if we change nothing
+	err = objectsync.Sync(ctx, store1, store2, status, opts...)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	all, _ := store1.GetAll(ctx)
+	if len(all) != 5 {
+		t.Errorf("Incorrect len = %v, want 5", len(all))
+	}
+
+	// The trees kept are the ones over the objects, and are built for
+	// storages kept before they had one
+	root := merkleRoot(t, store1)
+	err = db.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(storageBucket).Bucket([]byte("local"))
+		for _, name := range [][]byte{merkleBucket, bucketsBucket} {
+			err := bucket.DeleteBucket(name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	store1, err = db.Storage("local")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if !bytes.Equal(merkleRoot(t, store1), root) || !bytes.Equal(merkleRoot(t, store2), root) {
+		t.Errorf("Expected roots to match")
+	}
+
+	// Syncing with sketches finds the changes too
+	err = store2.Set(ctx, &objectsync.GenericObject{ID: "local2", Value: "changed", Modified: time.Now().UTC()})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	err = objectsync.Sync(ctx, store1, store2, status, append(opts, objectsync.WithSketches(60))...)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	object, err = store1.Get(ctx, "local2")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if object.Value != "changed" {
+		t.Errorf("Unexpected value = %s", object.Value)
+	}
+
+	// The sketches are the ones over the objects
+	for _, store := range []*BoltStorage{store1, store2} {
+		all, err := store.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		want := objectsync.NewIBLT(60)
+		for _, object := range all {
+			want.Insert(object.ID, object.Hash)
+		}
+		sketch, err := store.Sketch(ctx, 60)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if !reflect.DeepEqual(sketch, want) {
+			t.Errorf("Unexpected sketch of %s", store.GetName())
+		}
+	}
+
+	t.Run("Signed", func(t *testing.T) {
+		store, err := db.Storage("signed")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		public, key, _ := ed25519.GenerateKey(nil)
+		modified := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+		signer := objectsync.NewSignedStorage(store, "local", key, nil)
+		err = signer.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "value", Modified: modified, Version: objectsync.VersionVector{"local": 1}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// The signature is kept, with the time it covers, so the object
+		// verifies when read again
+		verifier := func() *objectsync.SignedStorage {
+			reader, _ := db.Storage("signed")
+			return objectsync.NewSignedStorage(reader, "remote", nil, map[string]ed25519.PublicKey{"local": public})
+		}
+		got, err := verifier().Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if got.Signature == nil || got.Signature.Replica != "local" || !got.Modified.Equal(modified) {
+			t.Errorf("Unexpected object = %+v", got)
+		}
+		all, err := verifier().GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 1 {
+			t.Errorf("Incorrect len = %v, want 1", len(all))
+		}
+
+		// Written again without one, it no longer verifies
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "unsigned", Modified: modified, Version: objectsync.VersionVector{"local": 2}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = verifier().Get(ctx, "a")
+		if !objectsync.IsVerificationError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+}
+
+func TestBoltStatusStorage(t *testing.T) {
+
+	ctx := context.TODO()
+
+	t.Run("Tokens", func(t *testing.T) {
+		db, err := Open(filepath.Join(t.TempDir(), "objectsync.db"))
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		defer db.Close()
+		status, err := db.StatusStorage("local_remote")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = status.GetToken(ctx, objectsync.SideLocal)
+		if !objectsync.IsNotFoundError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+		for _, token := range []string{"token1", "token2"} {
+			err = status.SetToken(ctx, objectsync.SideLocal, token)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+		}
+		err = status.SetToken(ctx, objectsync.SideRemote, "remote")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		token, err := status.GetToken(ctx, objectsync.SideLocal)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if token != "token2" {
+			t.Errorf("Unexpected token = %s", token)
+		}
+
+		// The tokens are kept apart from the status
+		stati, err := status.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(stati) != 0 {
+			t.Errorf("Unexpected status = %v", stati)
+		}
+	})
+}
+
+func TestBoltVersionStorage(t *testing.T) {
+
+	ctx := context.TODO()
+	path := filepath.Join(t.TempDir(), "objectsync.db")
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	inner, err := db.Storage("local")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	status, err := db.StatusStorage("local_remote")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	versions, err := db.VersionStorage("local")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	store1 := objectsync.NewVersionedStorage(inner, versions)
+	store2 := objectsync.NewInMemoryStorage("remote")
+
+	// The status shares the transactions of the storage versioned
+	if !store1.SupportsStatus(status) || store1.SupportsStatus(objectsync.NewInMemoryStatusStorage()) {
+		t.Errorf("Unexpected status support")
+	}
+
+	store2.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "first", Modified: time.Now().UTC()})
+	err = objectsync.Sync(ctx, store1, store2, status)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	store2.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "second", Modified: time.Now().UTC()})
+	err = objectsync.Sync(ctx, store1, store2, status)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	_, err = status.Get(ctx, "a")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	// The versions outlive the DB being closed
+	db.Close()
+	db, err = Open(path)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer db.Close()
+	versions, err = db.VersionStorage("local")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	ids, err := versions.GetIDs(ctx)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []string{"a"}) {
+		t.Errorf("Unexpected ids = %v", ids)
+	}
+	all, err := versions.Get(ctx, "a")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(all) != 2 || all[0].Value != "first" || all[1].Value != "second" || all[1].Origin != "remote" {
+		t.Errorf("Unexpected versions = %+v", all)
+	}
+	if !bytes.Equal(all[1].Hash, objectsync.NewHash("second")) {
+		t.Errorf("Unexpected hash = %x", all[1].Hash)
+	}
+
+	err = versions.Set(ctx, "a", nil)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	all, err = versions.Get(ctx, "a")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(all) != 0 {
+		t.Errorf("Unexpected versions = %+v", all)
+	}
+}
+
+// merkleRoot will return the root hash of the tree of store, checking it is
+// the one of a tree over its objects
+func merkleRoot(t *testing.T, store *BoltStorage) objectsync.Hash {
+	ctx := context.TODO()
+	all, err := store.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	tree := objectsync.NewMerkleTree()
+	for _, object := range all {
+		tree.Set(object.ID, object.Hash)
+	}
+
+	node, err := store.MerkleNode(ctx, "")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if !reflect.DeepEqual(node, tree.Node("")) {
+		t.Errorf("Unexpected root = %+v, want %+v", node, tree.Node(""))
+	}
+	return node.Hash
+}
@@ -0,0 +1,123 @@
+package boltstorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/keithballdotnet/objectsync"
+	bolt "go.etcd.io/bbolt"
+)
+
+// merkleNode is the hash and number of objects of a node of a Merkle tree
+type merkleNode struct {
+	Hash  objectsync.Hash
+	Count int
+}
+
+// merkleNodes are the nodes of the Merkle tree of a BoltStorage, in a
+// transaction.  The nodes are kept by prefix after a /, as keys must not be
+// empty, and the hashes of the objects
+// by their bucket followed by their ID, so the objects of a node are found
+// together.
+type merkleNodes struct {
+	nodes, buckets *bolt.Bucket
+}
+
+func (s *BoltStorage) merkle(tx *bolt.Tx) *merkleNodes {
+	bucket := tx.Bucket(storageBucket).Bucket([]byte(s.name))
+	return &merkleNodes{nodes: bucket.Bucket(merkleBucket), buckets: bucket.Bucket(bucketsBucket)}
+}
+
+// buildMerkle will build the Merkle tree of the objects of a storage kept
+// before it had one
+func (s *BoltStorage) buildMerkle(tx *bolt.Tx) error {
+	bucket := tx.Bucket(storageBucket).Bucket([]byte(s.name))
+	for _, name := range [][]byte{merkleBucket, bucketsBucket} {
+		_, err := bucket.CreateBucketIfNotExists(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	n := s.merkle(tx)
+	_, meta := s.buckets(tx)
+	return meta.ForEach(func(id, data []byte) error {
+		m := &metadata{}
+		err := json.Unmarshal(data, m)
+		if err != nil {
+			return err
+		}
+		return n.setObject(string(id), m.Hash)
+	})
+}
+
+// setObject will keep the hash of the object with id, removing it if hash is
+// nil, and update the tree
+func (n *merkleNodes) setObject(id string, hash objectsync.Hash) error {
+	key := []byte(objectsync.MerkleBucket(id) + id)
+	var err error
+	if hash == nil {
+		err = n.buckets.Delete(key)
+	} else {
+		err = n.buckets.Put(key, hash)
+	}
+	if err != nil {
+		return err
+	}
+	return objectsync.UpdateMerkle(context.TODO(), n, id)
+}
+
+// GetMerkleHash ...
+func (n *merkleNodes) GetMerkleHash(ctx context.Context, prefix string) (objectsync.Hash, int, error) {
+	data := n.nodes.Get([]byte("/" + prefix))
+	if data == nil {
+		return nil, 0, nil
+	}
+	node := &merkleNode{}
+	err := json.Unmarshal(data, node)
+	if err != nil {
+		return nil, 0, err
+	}
+	return node.Hash, node.Count, nil
+}
+
+// SetMerkleHash ...
+func (n *merkleNodes) SetMerkleHash(ctx context.Context, prefix string, hash objectsync.Hash, count int) error {
+	if count == 0 {
+		return n.nodes.Delete([]byte("/" + prefix))
+	}
+	data, err := json.Marshal(&merkleNode{Hash: hash, Count: count})
+	if err != nil {
+		return err
+	}
+	return n.nodes.Put([]byte("/"+prefix), data)
+}
+
+// MerkleObjects ...
+func (n *merkleNodes) MerkleObjects(ctx context.Context, prefix string) (map[string]objectsync.Hash, error) {
+	objects := map[string]objectsync.Hash{}
+	bucketLength := len(objectsync.MerkleBucket(""))
+	c := n.buckets.Cursor()
+	for key, hash := c.Seek([]byte(prefix)); key != nil && bytes.HasPrefix(key, []byte(prefix)); key, hash = c.Next() {
+		objects[string(key[bucketLength:])] = append(objectsync.Hash(nil), hash...)
+	}
+	return objects, nil
+}
+
+// Sketch will summarize the IDs and hashes of the storage, read from the
+// objects of its Merkle tree
+func (s *BoltStorage) Sketch(ctx context.Context, cells int) (*objectsync.IBLT, error) {
+	sketch := objectsync.NewIBLT(cells)
+	bucketLength := len(objectsync.MerkleBucket(""))
+	err := s.db.db.View(func(tx *bolt.Tx) error {
+		return s.merkle(tx).buckets.ForEach(func(key, hash []byte) error {
+			sketch.Insert(string(key[bucketLength:]), hash)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sketch, nil
+}
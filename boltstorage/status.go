@@ -0,0 +1,97 @@
+package boltstorage
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/keithballdotnet/objectsync"
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltStatusStorage is an objectsync.StatusStorage keeping the sync status in
+// a DB.  It is an objectsync.TokenStorage, keeping the tokens of the change
+// feeds apart from the status.
+type BoltStatusStorage struct {
+	db   *DB
+	name string
+}
+
+func (s *BoltStatusStorage) bucket(tx *bolt.Tx) *bolt.Bucket {
+	return tx.Bucket(statusBucket).Bucket([]byte(s.name))
+}
+
+// Set ...
+func (s *BoltStatusStorage) Set(ctx context.Context, object *objectsync.SyncStatus) error {
+	return s.db.db.Update(func(tx *bolt.Tx) error {
+		return s.set(tx, object)
+	})
+}
+
+func (s *BoltStatusStorage) set(tx *bolt.Tx, object *objectsync.SyncStatus) error {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	return s.bucket(tx).Put([]byte(object.ID), data)
+}
+
+// Get ...
+func (s *BoltStatusStorage) Get(ctx context.Context, id string) (*objectsync.SyncStatus, error) {
+	status := &objectsync.SyncStatus{}
+	err := s.db.db.View(func(tx *bolt.Tx) error {
+		data := s.bucket(tx).Get([]byte(id))
+		if data == nil {
+			return objectsync.ErrorNotFound
+		}
+		return json.Unmarshal(data, status)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// GetAll ...
+func (s *BoltStatusStorage) GetAll(ctx context.Context) ([]*objectsync.SyncStatus, error) {
+	stati := []*objectsync.SyncStatus{}
+	err := s.db.db.View(func(tx *bolt.Tx) error {
+		return s.bucket(tx).ForEach(func(id, data []byte) error {
+			status := &objectsync.SyncStatus{}
+			err := json.Unmarshal(data, status)
+			if err != nil {
+				return err
+			}
+			stati = append(stati, status)
+			return nil
+		})
+	})
+	return stati, err
+}
+
+// Delete ...
+func (s *BoltStatusStorage) Delete(ctx context.Context, id string) error {
+	return s.db.db.Update(func(tx *bolt.Tx) error {
+		return s.bucket(tx).Delete([]byte(id))
+	})
+}
+
+// GetToken ...
+func (s *BoltStatusStorage) GetToken(ctx context.Context, side string) (string, error) {
+	token := ""
+	err := s.db.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(tokensBucket).Bucket([]byte(s.name)).Get([]byte(side))
+		if data == nil {
+			return objectsync.ErrorNotFound
+		}
+		token = string(data)
+		return nil
+	})
+	return token, err
+}
+
+// SetToken ...
+func (s *BoltStatusStorage) SetToken(ctx context.Context, side, token string) error {
+	return s.db.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(tokensBucket).Bucket([]byte(s.name)).Put([]byte(side), []byte(token))
+	})
+}
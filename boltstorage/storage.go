@@ -0,0 +1,291 @@
+// Package boltstorage implements objectsync storage in a single bbolt file.
+// Any number of storages, status storages and version storages can share one
+// file, and the status is written in the same transaction as the objects it
+// describes.
+package boltstorage
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/keithballdotnet/objectsync"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	storageBucket  = []byte("storage")
+	statusBucket   = []byte("status")
+	tokensBucket   = []byte("tokens")
+	objectsBucket  = []byte("objects")
+	metadataBucket = []byte("metadata")
+	merkleBucket   = []byte("merkle")
+	bucketsBucket  = []byte("buckets")
+	versionsBucket = []byte("versions")
+)
+
+// DB is a bbolt file holding storages, status storages and version storages
+type DB struct {
+	db *bolt.DB
+}
+
+// Open will open the file at path, creating it if needed
+func Open(path string) (*DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{storageBucket, statusBucket, tokensBucket, versionsBucket} {
+			_, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &DB{db: db}, nil
+}
+
+// Close will close the file
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// Storage will return the storage with name, creating it if needed
+func (d *DB) Storage(name string) (*BoltStorage, error) {
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(storageBucket).CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return err
+		}
+		for _, name := range [][]byte{objectsBucket, metadataBucket} {
+			_, err := bucket.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+		}
+		if bucket.Bucket(merkleBucket) != nil {
+			return nil
+		}
+		return (&BoltStorage{db: d, name: name}).buildMerkle(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltStorage{db: d, name: name}, nil
+}
+
+// StatusStorage will return the status storage with name, creating it if
+// needed.  Each pair of synced storages needs its own status storage.
+func (d *DB) StatusStorage(name string) (*BoltStatusStorage, error) {
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.Bucket(statusBucket).CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Bucket(tokensBucket).CreateBucketIfNotExists([]byte(name))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltStatusStorage{db: d, name: name}, nil
+}
+
+// VersionStorage will return the version storage with name, creating it if
+// needed
+func (d *DB) VersionStorage(name string) (*BoltVersionStorage, error) {
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.Bucket(versionsBucket).CreateBucketIfNotExists([]byte(name))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltVersionStorage{db: d, name: name}, nil
+}
+
+// metadata is everything about an object except its value
+type metadata struct {
+	Hash        objectsync.Hash
+	Modified    time.Time
+	Version     objectsync.VersionVector    `json:",omitempty"`
+	VersionHash objectsync.Hash             `json:",omitempty"`
+	Signature   *objectsync.ObjectSignature `json:",omitempty"`
+}
+
+// BoltStorage is an objectsync.Storage keeping objects in a DB.  Values and
+// metadata live in separate buckets, so listing hashes does not read values.
+// It is an objectsync.Merkler, keeping the nodes of its Merkle tree in the
+// DB too, updated in the transaction of each write, and an
+// objectsync.Sketcher.
+type BoltStorage struct {
+	db   *DB
+	name string
+}
+
+// GetName ...
+func (s *BoltStorage) GetName() string {
+	return s.name
+}
+
+func (s *BoltStorage) buckets(tx *bolt.Tx) (objects, meta *bolt.Bucket) {
+	bucket := tx.Bucket(storageBucket).Bucket([]byte(s.name))
+	return bucket.Bucket(objectsBucket), bucket.Bucket(metadataBucket)
+}
+
+// Set ...
+func (s *BoltStorage) Set(ctx context.Context, object *objectsync.GenericObject) error {
+	return s.db.db.Update(func(tx *bolt.Tx) error {
+		return s.set(tx, object)
+	})
+}
+
+func (s *BoltStorage) set(tx *bolt.Tx, object *objectsync.GenericObject) error {
+	hash := objectsync.NewHash(object.Value)
+	data, err := json.Marshal(&metadata{
+		Hash:        hash,
+		Modified:    object.Modified,
+		Version:     object.Version,
+		VersionHash: object.VersionHash,
+		Signature:   object.Signature,
+	})
+	if err != nil {
+		return err
+	}
+
+	objects, meta := s.buckets(tx)
+	err = objects.Put([]byte(object.ID), []byte(object.Value))
+	if err != nil {
+		return err
+	}
+	err = meta.Put([]byte(object.ID), data)
+	if err != nil {
+		return err
+	}
+	err = s.merkle(tx).setObject(object.ID, hash)
+	if err != nil {
+		return err
+	}
+
+	object.Hash = hash
+	return nil
+}
+
+// Get ...
+func (s *BoltStorage) Get(ctx context.Context, id string) (*objectsync.GenericObject, error) {
+	var object *objectsync.GenericObject
+	err := s.db.db.View(func(tx *bolt.Tx) error {
+		objects, meta := s.buckets(tx)
+		data := meta.Get([]byte(id))
+		if data == nil {
+			return objectsync.ErrorNotFound
+		}
+
+		var err error
+		object, err = decodeObject([]byte(id), objects.Get([]byte(id)), data)
+		return err
+	})
+	return object, err
+}
+
+// GetAll will return all objects
+func (s *BoltStorage) GetAll(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	all := objectsync.GenericObjectCollection{}
+	err := s.db.db.View(func(tx *bolt.Tx) error {
+		objects, meta := s.buckets(tx)
+		return meta.ForEach(func(id, data []byte) error {
+			object, err := decodeObject(id, objects.Get(id), data)
+			if err != nil {
+				return err
+			}
+			all = append(all, object)
+			return nil
+		})
+	})
+	return all, err
+}
+
+// Delete will remove a entry from the storage
+func (s *BoltStorage) Delete(ctx context.Context, id string) error {
+	return s.db.db.Update(func(tx *bolt.Tx) error {
+		return s.delete(tx, id)
+	})
+}
+
+func (s *BoltStorage) delete(tx *bolt.Tx, id string) error {
+	objects, meta := s.buckets(tx)
+	err := objects.Delete([]byte(id))
+	if err != nil {
+		return err
+	}
+	err = meta.Delete([]byte(id))
+	if err != nil {
+		return err
+	}
+	return s.merkle(tx).setObject(id, nil)
+}
+
+// MerkleNode will return the node at prefix of the Merkle tree of the storage
+func (s *BoltStorage) MerkleNode(ctx context.Context, prefix string) (*objectsync.MerkleNode, error) {
+	var node *objectsync.MerkleNode
+	err := s.db.db.View(func(tx *bolt.Tx) error {
+		var err error
+		node, err = objectsync.ReadMerkleNode(ctx, s.merkle(tx), prefix)
+		return err
+	})
+	return node, err
+}
+
+// SupportsStatus will return true for status storages of the same DB
+func (s *BoltStorage) SupportsStatus(status objectsync.StatusStorage) bool {
+	boltStatus, ok := status.(*BoltStatusStorage)
+	return ok && boltStatus.db == s.db
+}
+
+// SetWithStatus will set the object and its sync status in one transaction
+func (s *BoltStorage) SetWithStatus(ctx context.Context, object *objectsync.GenericObject, status objectsync.StatusStorage, syncStatus *objectsync.SyncStatus) error {
+	return s.db.db.Update(func(tx *bolt.Tx) error {
+		err := s.set(tx, object)
+		if err != nil {
+			return err
+		}
+		return status.(*BoltStatusStorage).set(tx, syncStatus)
+	})
+}
+
+// DeleteWithStatus will delete the object and its sync status in one transaction
+func (s *BoltStorage) DeleteWithStatus(ctx context.Context, id string, status objectsync.StatusStorage) error {
+	return s.db.db.Update(func(tx *bolt.Tx) error {
+		err := s.delete(tx, id)
+		if err != nil {
+			return err
+		}
+		return status.(*BoltStatusStorage).bucket(tx).Delete([]byte(id))
+	})
+}
+
+func decodeObject(id, value, data []byte) (*objectsync.GenericObject, error) {
+	m := &metadata{}
+	err := json.Unmarshal(data, m)
+	if err != nil {
+		return nil, err
+	}
+
+	return &objectsync.GenericObject{
+		ID:          string(id),
+		Hash:        m.Hash,
+		Modified:    m.Modified,
+		Value:       string(value),
+		Version:     m.Version,
+		VersionHash: m.VersionHash,
+		Signature:   m.Signature,
+	}, nil
+}
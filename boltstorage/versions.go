@@ -0,0 +1,60 @@
+package boltstorage
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/keithballdotnet/objectsync"
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltVersionStorage is an objectsync.VersionStorage keeping the versions of
+// objects in a DB, so their history outlives the process
+type BoltVersionStorage struct {
+	db   *DB
+	name string
+}
+
+func (s *BoltVersionStorage) bucket(tx *bolt.Tx) *bolt.Bucket {
+	return tx.Bucket(versionsBucket).Bucket([]byte(s.name))
+}
+
+// Set ...
+func (s *BoltVersionStorage) Set(ctx context.Context, id string, versions []*objectsync.ObjectVersion) error {
+	return s.db.db.Update(func(tx *bolt.Tx) error {
+		if len(versions) == 0 {
+			return s.bucket(tx).Delete([]byte(id))
+		}
+
+		data, err := json.Marshal(versions)
+		if err != nil {
+			return err
+		}
+		return s.bucket(tx).Put([]byte(id), data)
+	})
+}
+
+// Get ...
+func (s *BoltVersionStorage) Get(ctx context.Context, id string) ([]*objectsync.ObjectVersion, error) {
+	var versions []*objectsync.ObjectVersion
+	err := s.db.db.View(func(tx *bolt.Tx) error {
+		data := s.bucket(tx).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &versions)
+	})
+	return versions, err
+}
+
+// GetIDs ...
+func (s *BoltVersionStorage) GetIDs(ctx context.Context) ([]string, error) {
+	ids := []string{}
+	err := s.db.db.View(func(tx *bolt.Tx) error {
+		return s.bucket(tx).ForEach(func(id, data []byte) error {
+			ids = append(ids, string(id))
+			return nil
+		})
+	})
+	return ids, err
+}
@@ -0,0 +1,127 @@
+package objectsync
+
+import "bytes"
+
+// VersionVector tracks the causal history of an object.  It holds a counter
+// per replica that is incremented each time that replica changes the object.
+type VersionVector map[string]uint64
+
+// Ordering is the causal relation between two version vectors
+type Ordering int
+
+// Possible orderings of two version vectors
+const (
+	OrderingEqual Ordering = iota
+	OrderingBefore
+	OrderingAfter
+	OrderingConcurrent
+)
+
+// Copy will return a copy of the vector
+func (v VersionVector) Copy() VersionVector {
+	if v == nil {
+		return nil
+	}
+	c := make(VersionVector, len(v))
+	for replica, counter := range v {
+		c[replica] = counter
+	}
+	return c
+}
+
+// Increment will return a copy of the vector with the counter of replica incremented
+func (v VersionVector) Increment(replica string) VersionVector {
+	c := v.Copy()
+	if c == nil {
+		c = VersionVector{}
+	}
+	c[replica]++
+	return c
+}
+
+// Merge will return a vector holding the highest counter of each replica in v and other
+func (v VersionVector) Merge(other VersionVector) VersionVector {
+	c := v.Copy()
+	for replica, counter := range other {
+		if c == nil {
+			c = VersionVector{}
+		}
+		if counter > c[replica] {
+			c[replica] = counter
+		}
+	}
+	return c
+}
+
+// Compare will return how v is ordered relative to other
+func (v VersionVector) Compare(other VersionVector) Ordering {
+	before, after := false, false
+	for replica, counter := range v {
+		if counter > other[replica] {
+			after = true
+		}
+	}
+	for replica, counter := range other {
+		if counter > v[replica] {
+			before = true
+		}
+	}
+
+	switch {
+	case before && after:
+		return OrderingConcurrent
+	case before:
+		return OrderingBefore
+	case after:
+		return OrderingAfter
+	}
+	return OrderingEqual
+}
+
+// advanceVersion will return object with a new version when its content has
+// changed since it was last versioned.  The new version descends from both the
+// current version of the object and base, the version seen at the last sync.
+// The content is unchanged if its hash is the one it was versioned with, or
+// the one its storage reported at the last sync, as storages whose hash is
+// not of the value, such as an ETag, can not be given the versioned hash.
+func advanceVersion(object *GenericObject, base VersionVector, synced Hash, replica string) *GenericObject {
+	if bytes.Equal(object.Hash, object.VersionHash) || (synced != nil && bytes.Equal(object.Hash, synced)) {
+		return object
+	}
+
+	advanced := *object
+	advanced.Version = object.Version.Merge(base).Increment(replica)
+	advanced.VersionHash = object.Hash
+	return &advanced
+}
+
+// advanceVersions will advance the versions of both objects of a pair
+func advanceVersions(localObject, remoteObject *GenericObject, syncStatus *SyncStatus, o *options) (*GenericObject, *GenericObject) {
+	var base VersionVector
+	var localHash, remoteHash Hash
+	if syncStatus != nil {
+		base = syncStatus.Version
+		localHash, remoteHash = syncStatus.LocalHash, syncStatus.RemoteHash
+	}
+
+	if localObject != nil {
+		localObject = advanceVersion(localObject, base, localHash, o.localReplica)
+	}
+	if remoteObject != nil {
+		remoteObject = advanceVersion(remoteObject, base, remoteHash, o.remoteReplica)
+	}
+
+	return localObject, remoteObject
+}
+
+// mergeVersions will return a copy of winner whose version descends from
+// the versions of all the given objects
+func mergeVersions(winner *GenericObject, objects ...*GenericObject) *GenericObject {
+	merged := *winner
+	for _, object := range objects {
+		if object != nil {
+			merged.Version = merged.Version.Merge(object.Version)
+		}
+	}
+	return &merged
+}
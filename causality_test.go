@@ -0,0 +1,255 @@
+package objectsync
+
+import (
+	"context"
+	"crypto/md5"
+	"testing"
+	"time"
+)
+
+func TestVersionVector(t *testing.T) {
+	a := VersionVector{"a": 2, "b": 1}
+
+	if got := a.Compare(a.Copy()); got != OrderingEqual {
+		t.Errorf("Compare = %v, want %v", got, OrderingEqual)
+	}
+	if got := a.Increment("b").Compare(a); got != OrderingAfter {
+		t.Errorf("Compare = %v, want %v", got, OrderingAfter)
+	}
+	if got := a.Compare(a.Increment("c")); got != OrderingBefore {
+		t.Errorf("Compare = %v, want %v", got, OrderingBefore)
+	}
+	if got := a.Increment("a").Compare(a.Increment("b")); got != OrderingConcurrent {
+		t.Errorf("Compare = %v, want %v", got, OrderingConcurrent)
+	}
+	if got := a.Merge(VersionVector{"a": 1, "c": 4}); got.Compare(VersionVector{"a": 2, "b": 1, "c": 4}) != OrderingEqual {
+		t.Errorf("Merge = %v", got)
+	}
+	if a["b"] != 1 {
+		t.Errorf("Increment modified the vector: %v", a)
+	}
+}
+
+func TestCausality(t *testing.T) {
+
+	ctx := context.TODO()
+
+	// Three replicas synced as a triangle, each pair having its own status
+	storeA := NewInMemoryStorage("a")
+	storeB := NewInMemoryStorage("b")
+	storeC := NewInMemoryStorage("c")
+	statusAB := NewInMemoryStatusStorage()
+	statusBC := NewInMemoryStatusStorage()
+	statusAC := NewInMemoryStatusStorage()
+
+	syncAll := func(t *testing.T, causality bool) {
+		t.Helper()
+		pairs := []struct {
+			local, remote Storage
+			status        StatusStorage
+		}{
+			{storeA, storeB, statusAB},
+			{storeB, storeC, statusBC},
+			{storeA, storeC, statusAC},
+		}
+		for _, p := range pairs {
+			opts := []Option{}
+			if causality {
+				opts = append(opts, WithCausality(p.local.GetName(), p.remote.GetName()))
+			}
+			err := Sync(ctx, p.local, p.remote, p.status, opts...)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+		}
+	}
+
+	edit := func(t *testing.T, store Storage, id, value string, modified time.Time) {
+		t.Helper()
+		object, err := store.Get(ctx, id)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		edited := *object
+		edited.Value = value
+		edited.Modified = modified
+		err = store.Set(ctx, &edited)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+
+	checkValue := func(t *testing.T, id, value string, stores ...Storage) {
+		t.Helper()
+		for _, store := range stores {
+			object, err := store.Get(ctx, id)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if object.Value != value {
+				t.Errorf("Unexpected value = %s in %s expected %s", object.Value, store.GetName(), value)
+			}
+		}
+	}
+
+	t.Run("ClockSkew", func(t *testing.T) {
+		now := time.Now().UTC()
+		err := storeA.Set(ctx, &GenericObject{ID: "skew", Value: "first", Modified: now})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		syncAll(t, true)
+		checkValue(t, "skew", "first", storeA, storeB, storeC)
+
+		// Edit on A and sync it only to B
+		edit(t, storeA, "skew", "second", now.Add(time.Minute))
+		err = Sync(ctx, storeA, storeB, statusAB, WithCausality("a", "b"))
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// B builds on the edit from A, but its clock is behind
+		edit(t, storeB, "skew", "third", now.Add(-time.Hour))
+		err = Sync(ctx, storeB, storeC, statusBC, WithCausality("b", "c"))
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// Both A and C changed since their last sync, but the edit on C descends
+		// from the one on A, so it must win despite the older timestamp
+		err = Sync(ctx, storeA, storeC, statusAC, WithCausality("a", "c"))
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		checkValue(t, "skew", "third", storeA, storeC)
+		syncAll(t, true)
+		checkValue(t, "skew", "third", storeA, storeB, storeC)
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		now := time.Now().UTC()
+		err := storeA.Set(ctx, &GenericObject{ID: "concurrent", Value: "first", Modified: now})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		syncAll(t, true)
+
+		edit(t, storeA, "concurrent", "older", now.Add(time.Minute))
+		edit(t, storeC, "concurrent", "newer", now.Add(time.Hour))
+
+		// Truly concurrent edits fall back to last write wins
+		err = Sync(ctx, storeA, storeC, statusAC, WithCausality("a", "c"))
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		checkValue(t, "concurrent", "newer", storeA, storeC)
+		syncAll(t, true)
+		checkValue(t, "concurrent", "newer", storeA, storeB, storeC)
+	})
+
+	t.Run("WithoutCausality", func(t *testing.T) {
+		now := time.Now().UTC()
+		err := storeA.Set(ctx, &GenericObject{ID: "lww", Value: "first", Modified: now})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		syncAll(t, false)
+
+		edit(t, storeA, "lww", "second", now.Add(time.Minute))
+		err = Sync(ctx, storeA, storeB, statusAB)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		edit(t, storeB, "lww", "third", now.Add(-time.Hour))
+		err = Sync(ctx, storeB, storeC, statusBC)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// Wall clock LWW drops the later edit made on B
+		err = Sync(ctx, storeA, storeC, statusAC)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		checkValue(t, "lww", "second", storeA, storeC)
+	})
+
+	t.Run("ForeignHash", func(t *testing.T) {
+		local := NewInMemoryStorage("local")
+		remote := &etagStorage{store: NewInMemoryStorage("remote")}
+		status := NewInMemoryStatusStorage()
+		opts := []Option{WithCausality("local", "remote")}
+
+		local.Set(ctx, &GenericObject{ID: "a", Value: "value", Modified: time.Now().UTC()})
+		err := Sync(ctx, local, remote, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		edit(t, local, "a", "edited", time.Now().UTC())
+		err = Sync(ctx, local, remote, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// The ETag the remote reports is not taken as a change, so the edit
+		// descends from it rather than being concurrent
+		for _, store := range []Storage{local, remote} {
+			object, err := store.Get(ctx, "a")
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if object.Version.Compare(VersionVector{"local": 2}) != OrderingEqual {
+				t.Errorf("Unexpected version in %s = %v", store.GetName(), object.Version)
+			}
+		}
+	})
+}
+
+// etagStorage reports hashes that are not of the value, as ETags are
+type etagStorage struct {
+	store *InMemoryStorage
+}
+
+func etag(object *GenericObject) *GenericObject {
+	tagged := *object
+	sum := md5.Sum([]byte(object.Value))
+	tagged.Hash = sum[:]
+	return &tagged
+}
+
+func (s *etagStorage) GetName() string {
+	return s.store.GetName()
+}
+
+func (s *etagStorage) Set(ctx context.Context, object *GenericObject) error {
+	err := s.store.Set(ctx, object)
+	if err != nil {
+		return err
+	}
+	object.Hash = etag(object).Hash
+	return nil
+}
+
+func (s *etagStorage) Get(ctx context.Context, id string) (*GenericObject, error) {
+	object, err := s.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return etag(object), nil
+}
+
+func (s *etagStorage) GetAll(ctx context.Context) (GenericObjectCollection, error) {
+	all, err := s.store.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tagged := make(GenericObjectCollection, len(all))
+	for i, object := range all {
+		tagged[i] = etag(object)
+	}
+	return tagged, nil
+}
+
+func (s *etagStorage) Delete(ctx context.Context, id string) error {
+	return s.store.Delete(ctx, id)
+}
@@ -0,0 +1,544 @@
+package objectsync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Default sizes of the chunks of a ChunkedStorage
+const (
+	DefaultMinChunkSize = 2 << 10
+	DefaultChunkSize    = 8 << 10
+	DefaultMaxChunkSize = 64 << 10
+)
+
+// ChunkStore keeps chunks of values by their hash
+type ChunkStore interface {
+	HasChunk(ctx context.Context, hash Hash) (bool, error)
+	GetChunk(ctx context.Context, hash Hash) ([]byte, error)
+	SetChunk(ctx context.Context, hash Hash, chunk []byte) error
+}
+
+// ChunkSweeper is implemented by a ChunkStore that can list and remove its
+// chunks, so CollectChunks can remove the ones no manifest names
+type ChunkSweeper interface {
+	ChunkStore
+	ListChunks(ctx context.Context) ([]Hash, error)
+	DeleteChunk(ctx context.Context, hash Hash) error
+}
+
+// InMemoryChunkStore ...
+type InMemoryChunkStore struct {
+	db map[string][]byte
+}
+
+// NewInMemoryChunkStore ...
+func NewInMemoryChunkStore() *InMemoryChunkStore {
+	db := make(map[string][]byte)
+	return &InMemoryChunkStore{db: db}
+}
+
+// HasChunk ...
+func (s *InMemoryChunkStore) HasChunk(ctx context.Context, hash Hash) (bool, error) {
+	_, ok := s.db[string(hash)]
+	return ok, nil
+}
+
+// GetChunk ...
+func (s *InMemoryChunkStore) GetChunk(ctx context.Context, hash Hash) ([]byte, error) {
+	chunk, ok := s.db[string(hash)]
+	if !ok {
+		return nil, ErrorNotFound
+	}
+
+	return chunk, nil
+}
+
+// SetChunk ...
+func (s *InMemoryChunkStore) SetChunk(ctx context.Context, hash Hash, chunk []byte) error {
+	s.db[string(hash)] = chunk
+	return nil
+}
+
+// ListChunks ...
+func (s *InMemoryChunkStore) ListChunks(ctx context.Context) ([]Hash, error) {
+	hashes := make([]Hash, 0, len(s.db))
+	for hash := range s.db {
+		hashes = append(hashes, Hash(hash))
+	}
+	return hashes, nil
+}
+
+// DeleteChunk ...
+func (s *InMemoryChunkStore) DeleteChunk(ctx context.Context, hash Hash) error {
+	delete(s.db, string(hash))
+	return nil
+}
+
+// FileChunkStore is a ChunkStore that keeps each chunk as a file in a
+// directory, named by the hex of its hash under a directory of its first
+// two digits
+type FileChunkStore struct {
+	dir string
+}
+
+// NewFileChunkStore will return a FileChunkStore keeping its files in dir,
+// which is created if needed
+func NewFileChunkStore(dir string) (*FileChunkStore, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &FileChunkStore{dir: dir}, nil
+}
+
+func (s *FileChunkStore) path(hash Hash) string {
+	name := hex.EncodeToString(hash)
+	return filepath.Join(s.dir, name[:2], name)
+}
+
+// HasChunk ...
+func (s *FileChunkStore) HasChunk(ctx context.Context, hash Hash) (bool, error) {
+	_, err := os.Stat(s.path(hash))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetChunk ...
+func (s *FileChunkStore) GetChunk(ctx context.Context, hash Hash) ([]byte, error) {
+	chunk, err := os.ReadFile(s.path(hash))
+	if os.IsNotExist(err) {
+		return nil, ErrorNotFound
+	}
+	return chunk, err
+}
+
+// SetChunk will write the chunk to its file atomically
+func (s *FileChunkStore) SetChunk(ctx context.Context, hash Hash, chunk []byte) error {
+	path := s.path(hash)
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".chunk")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(chunk)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// ListChunks will return the hashes of the chunk files, leaving out the
+// temporary files of writes
+func (s *FileChunkStore) ListChunks(ctx context.Context) ([]Hash, error) {
+	hashes := []Hash{}
+	err := filepath.WalkDir(s.dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			return err
+		}
+		hash, err := hex.DecodeString(entry.Name())
+		if err != nil {
+			return nil
+		}
+		hashes = append(hashes, hash)
+		return nil
+	})
+	return hashes, err
+}
+
+// DeleteChunk ...
+func (s *FileChunkStore) DeleteChunk(ctx context.Context, hash Hash) error {
+	err := os.Remove(s.path(hash))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// StorageChunkStore is a ChunkStore keeping each chunk as an object of a
+// Storage, with the hex of its hash as the ID.  Over a remote storage, such
+// as one of httpstorage or s3storage, a ChunkedStorage sends only the chunks
+// the remote storage is missing.
+type StorageChunkStore struct {
+	store Storage
+}
+
+// NewStorageChunkStore will return a StorageChunkStore keeping its chunks in
+// store
+func NewStorageChunkStore(store Storage) *StorageChunkStore {
+	return &StorageChunkStore{store: store}
+}
+
+// HasChunk will read the chunk, as a Storage can not look an object up
+// without it
+func (s *StorageChunkStore) HasChunk(ctx context.Context, hash Hash) (bool, error) {
+	_, err := s.store.Get(ctx, hex.EncodeToString(hash))
+	if err != nil {
+		if IsNotFoundError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// GetChunk ...
+func (s *StorageChunkStore) GetChunk(ctx context.Context, hash Hash) ([]byte, error) {
+	object, err := s.store.Get(ctx, hex.EncodeToString(hash))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(object.Value), nil
+}
+
+// SetChunk ...
+func (s *StorageChunkStore) SetChunk(ctx context.Context, hash Hash, chunk []byte) error {
+	return s.store.Set(ctx, &GenericObject{ID: hex.EncodeToString(hash), Value: string(chunk)})
+}
+
+// ListChunks will return the hashes of the chunks, from the listing of the
+// storage if it is a Lister
+func (s *StorageChunkStore) ListChunks(ctx context.Context) ([]Hash, error) {
+	var objects GenericObjectCollection
+	var err error
+	if lister, ok := s.store.(Lister); ok {
+		objects, err = lister.List(ctx)
+	} else {
+		objects, err = s.store.GetAll(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]Hash, 0, len(objects))
+	for _, object := range objects {
+		hash, err := hex.DecodeString(object.ID)
+		if err != nil {
+			continue
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
+
+// DeleteChunk ...
+func (s *StorageChunkStore) DeleteChunk(ctx context.Context, hash Hash) error {
+	err := s.store.Delete(ctx, hex.EncodeToString(hash))
+	if err != nil && !IsNotFoundError(err) {
+		return err
+	}
+	return nil
+}
+
+// ChunkOption configures a ChunkedStorage
+type ChunkOption func(*ChunkedStorage)
+
+// WithChunkSizes will set the smallest, average and largest size of chunks,
+// which must be positive and in order
+func WithChunkSizes(min, avg, max int) ChunkOption {
+	return func(s *ChunkedStorage) {
+		s.minSize, s.avgSize, s.maxSize = min, avg, max
+	}
+}
+
+// ChunkedStorage is a Storage that splits values into chunks where their
+// content says, with FastCDC, and keeps each chunk once by its hash in a
+// ChunkStore.  The storage it wraps keeps a manifest of the chunks of each
+// object in place of its value.  As an edit only changes the chunks around
+// it, versions and copies of a value share most chunks, and only the chunks
+// missing from the ChunkStore are written.
+//
+// The Hash of an object is the SHA-256 of its value, and objects are listed
+// from their manifests without reading their chunks.  Sync reads and writes
+// whole values, so chunks are only shared between the storages of one
+// ChunkStore.  A FileChunkStore dedups on one host, and a StorageChunkStore
+// over a remote storage sends a value only as the chunks it is missing.
+// Deleting an object keeps its chunks, which CollectChunks removes once no
+// manifest names them.
+type ChunkedStorage struct {
+	store  Storage
+	chunks ChunkStore
+
+	minSize, avgSize, maxSize int
+}
+
+// chunkManifest is what a ChunkedStorage keeps in place of a value
+type chunkManifest struct {
+	Hash   Hash
+	Size   int
+	Chunks []Hash
+}
+
+// NewChunkedStorage will return a ChunkedStorage keeping manifests in store
+// and chunks in chunks, or an error if the sizes of chunks are invalid
+func NewChunkedStorage(store Storage, chunks ChunkStore, opts ...ChunkOption) (*ChunkedStorage, error) {
+	s := &ChunkedStorage{
+		store:   store,
+		chunks:  chunks,
+		minSize: DefaultMinChunkSize,
+		avgSize: DefaultChunkSize,
+		maxSize: DefaultMaxChunkSize,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.minSize <= 0 || s.minSize > s.avgSize || s.avgSize > s.maxSize {
+		return nil, fmt.Errorf("invalid chunk sizes %v, %v and %v", s.minSize, s.avgSize, s.maxSize)
+	}
+	return s, nil
+}
+
+// GetName ...
+func (s *ChunkedStorage) GetName() string {
+	return s.store.GetName()
+}
+
+// Set will write the chunks of the value missing from the ChunkStore, then
+// the manifest
+func (s *ChunkedStorage) Set(ctx context.Context, object *GenericObject) error {
+	value := []byte(object.Value)
+	manifest := &chunkManifest{Hash: NewHash(object.Value), Size: len(value)}
+	for _, chunk := range splitChunks(value, s.minSize, s.avgSize, s.maxSize) {
+		hash := sha256.Sum256(chunk)
+		manifest.Chunks = append(manifest.Chunks, hash[:])
+
+		found, err := s.chunks.HasChunk(ctx, hash[:])
+		if err != nil {
+			return err
+		}
+		if !found {
+			err = s.chunks.SetChunk(ctx, hash[:], chunk)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	stored := *object
+	stored.Value = string(data)
+	err = s.store.Set(ctx, &stored)
+	if err != nil {
+		return err
+	}
+
+	object.Hash = manifest.Hash
+	return nil
+}
+
+// Get will read the manifest of the object, and join its chunks
+func (s *ChunkedStorage) Get(ctx context.Context, id string) (*GenericObject, error) {
+	stored, err := s.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.join(ctx, stored)
+}
+
+// GetAll will return all objects
+func (s *ChunkedStorage) GetAll(ctx context.Context) (GenericObjectCollection, error) {
+	all, err := s.store.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make(GenericObjectCollection, len(all))
+	for i, stored := range all {
+		objects[i], err = s.join(ctx, stored)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return objects, nil
+}
+
+// List will return all objects without their values, from their manifests
+func (s *ChunkedStorage) List(ctx context.Context) (GenericObjectCollection, error) {
+	all, err := s.store.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make(GenericObjectCollection, len(all))
+	for i, stored := range all {
+		manifest, err := parseManifest(stored)
+		if err != nil {
+			return nil, err
+		}
+		objects[i] = manifestObject(stored, manifest)
+	}
+	return objects, nil
+}
+
+// Delete will remove the manifest of the object.  Its chunks are kept, as
+// other objects may share them, until CollectChunks.
+func (s *ChunkedStorage) Delete(ctx context.Context, id string) error {
+	return s.store.Delete(ctx, id)
+}
+
+// CollectChunks will remove the chunks of chunks that no manifest of the
+// storages names, and return how many were removed.  The storages are all
+// the ones keeping chunks in chunks, and none may be written to until it
+// returns, or the chunks of a write may be removed before its manifest is
+// kept.
+func CollectChunks(ctx context.Context, chunks ChunkSweeper, storages ...*ChunkedStorage) (int, error) {
+	marked := make(map[string]bool)
+	for _, s := range storages {
+		all, err := s.store.GetAll(ctx)
+		if err != nil {
+			return 0, err
+		}
+		for _, stored := range all {
+			manifest, err := parseManifest(stored)
+			if err != nil {
+				return 0, err
+			}
+			for _, hash := range manifest.Chunks {
+				marked[string(hash)] = true
+			}
+		}
+	}
+
+	hashes, err := chunks.ListChunks(ctx)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, hash := range hashes {
+		if marked[string(hash)] {
+			continue
+		}
+		err = chunks.DeleteChunk(ctx, hash)
+		if err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// join will return the object of the manifest stored, with the value joined
+// from its chunks
+func (s *ChunkedStorage) join(ctx context.Context, stored *GenericObject) (*GenericObject, error) {
+	manifest, err := parseManifest(stored)
+	if err != nil {
+		return nil, err
+	}
+
+	value := make([]byte, 0, manifest.Size)
+	for _, hash := range manifest.Chunks {
+		chunk, err := s.chunks.GetChunk(ctx, hash)
+		if err != nil {
+			if IsNotFoundError(err) {
+				return nil, fmt.Errorf("missing chunk %x of [%s]", hash, stored.ID)
+			}
+			return nil, err
+		}
+		value = append(value, chunk...)
+	}
+
+	object := manifestObject(stored, manifest)
+	object.Value = string(value)
+	return object, nil
+}
+
+func parseManifest(stored *GenericObject) (*chunkManifest, error) {
+	manifest := &chunkManifest{}
+	err := json.Unmarshal([]byte(stored.Value), manifest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest of [%s]: %v", stored.ID, err)
+	}
+	return manifest, nil
+}
+
+// manifestObject will return the object stored without its value, with the
+// hash of the value of the manifest
+func manifestObject(stored *GenericObject, manifest *chunkManifest) *GenericObject {
+	object := *stored
+	object.Value = ""
+	object.Hash = manifest.Hash
+	return &object
+}
+
+// gear holds the random values FastCDC rolls over the bytes of a value
+var gear = func() [256]uint64 {
+	var table [256]uint64
+	for i := range table {
+		hash := sha256.Sum256([]byte{byte(i)})
+		table[i] = binary.BigEndian.Uint64(hash[:])
+	}
+	return table
+}()
+
+// splitChunks will split data into chunks with FastCDC.  A chunk is cut where
+// the top bits of the gear hash over the last bytes are zero, with more bits
+// before the average size and fewer after it, so chunks stay near it.
+func splitChunks(data []byte, min, avg, max int) [][]byte {
+	avgBits := bits.Len(uint(avg)) - 1
+	maskSmall := ^uint64(0) << (64 - avgBits - 1)
+	maskLarge := ^uint64(0) << (64 - avgBits + 1)
+
+	chunks := [][]byte{}
+	for len(data) > 0 {
+		size := len(data)
+		if size > min {
+			size = chunkBoundary(data, min, avg, max, maskSmall, maskLarge)
+		}
+		chunks = append(chunks, data[:size])
+		data = data[size:]
+	}
+	return chunks
+}
+
+// chunkBoundary will return the size of the first chunk of data
+func chunkBoundary(data []byte, min, avg, max int, maskSmall, maskLarge uint64) int {
+	end := len(data)
+	if end > max {
+		end = max
+	}
+	normal := avg
+	if normal > end {
+		normal = end
+	}
+
+	var fingerprint uint64
+	i := min
+	for ; i < normal; i++ {
+		fingerprint = fingerprint<<1 + gear[data[i]]
+		if fingerprint&maskSmall == 0 {
+			return i + 1
+		}
+	}
+	for ; i < end; i++ {
+		fingerprint = fingerprint<<1 + gear[data[i]]
+		if fingerprint&maskLarge == 0 {
+			return i + 1
+		}
+	}
+	return end
+}
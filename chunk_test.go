@@ -0,0 +1,285 @@
+package objectsync
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// Check the interfaces
+var _ Storage = &ChunkedStorage{}
+var _ Lister = &ChunkedStorage{}
+var _ ChunkStore = &InMemoryChunkStore{}
+var _ ChunkStore = &FileChunkStore{}
+var _ ChunkSweeper = &InMemoryChunkStore{}
+var _ ChunkSweeper = &FileChunkStore{}
+var _ ChunkSweeper = &StorageChunkStore{}
+
+// countingChunkStore counts the chunks written
+type countingChunkStore struct {
+	ChunkStore
+	written int
+}
+
+func (s *countingChunkStore) SetChunk(ctx context.Context, hash Hash, chunk []byte) error {
+	s.written++
+	return s.ChunkStore.SetChunk(ctx, hash, chunk)
+}
+
+func TestChunks(t *testing.T) {
+
+	ctx := context.TODO()
+	random := rand.New(rand.NewSource(1))
+	value := randomValue(random, 1<<20)
+
+	t.Run("Split", func(t *testing.T) {
+		chunks := splitChunks([]byte(value), DefaultMinChunkSize, DefaultChunkSize, DefaultMaxChunkSize)
+		joined := ""
+		for i, chunk := range chunks {
+			if len(chunk) > DefaultMaxChunkSize || (len(chunk) < DefaultMinChunkSize && i < len(chunks)-1) {
+				t.Errorf("Unexpected chunk size = %v", len(chunk))
+			}
+			joined += string(chunk)
+		}
+		if joined != value {
+			t.Fatalf("Unexpected joined value")
+		}
+		if len(chunks) < 64 || len(chunks) > 256 {
+			t.Errorf("Unexpected chunks = %v", len(chunks))
+		}
+
+		// An insertion only changes the chunks around it
+		edited := splitChunks([]byte(value[:500000]+"inserted"+value[500000:]), DefaultMinChunkSize, DefaultChunkSize, DefaultMaxChunkSize)
+		seen := make(map[string]bool)
+		for _, chunk := range chunks {
+			seen[string(chunk)] = true
+		}
+		changed := 0
+		for _, chunk := range edited {
+			if !seen[string(chunk)] {
+				changed++
+			}
+		}
+		if changed > 2 {
+			t.Errorf("Unexpected changed chunks = %v", changed)
+		}
+	})
+
+	t.Run("SetGet", func(t *testing.T) {
+		files, err := NewFileChunkStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		chunks := &countingChunkStore{ChunkStore: files}
+		store, err := NewChunkedStorage(NewInMemoryStorage("local"), chunks)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		modified := time.Now().UTC()
+		signature := &ObjectSignature{Replica: "local", Hash: NewHash(value), Signature: []byte("signature")}
+		object := &GenericObject{ID: "a", Value: value, Modified: modified, Version: VersionVector{"local": 1}, Signature: signature}
+		err = store.Set(ctx, object)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if string(object.Hash) != string(NewHash(value)) {
+			t.Errorf("Unexpected hash")
+		}
+		written := chunks.written
+
+		// A copy shares all chunks
+		err = store.Set(ctx, &GenericObject{ID: "b", Value: value, Modified: modified})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if chunks.written != written {
+			t.Errorf("Unexpected chunks written = %v", chunks.written-written)
+		}
+
+		got, err := store.Get(ctx, "b")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if got.Value != value || string(got.Hash) != string(object.Hash) || !got.Modified.Equal(modified) {
+			t.Errorf("Unexpected object")
+		}
+
+		// The metadata of the object is kept with its manifest
+		got, err = store.Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if got.Signature == nil || string(got.Signature.Signature) != "signature" || got.Version["local"] != 1 {
+			t.Errorf("Unexpected object = %+v", got.Signature)
+		}
+		listed, err := store.List(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(listed) != 2 || listed[0].Value != "" || string(listed[0].Hash) != string(object.Hash) {
+			t.Errorf("Unexpected list = %+v", listed)
+		}
+		for _, object := range listed {
+			if object.ID == "a" && object.Signature == nil {
+				t.Errorf("Unexpected list without signature")
+			}
+		}
+
+		_, err = store.Get(ctx, "missing")
+		if err == nil || !IsNotFoundError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		chunks1 := &countingChunkStore{ChunkStore: NewInMemoryChunkStore()}
+		chunks2 := &countingChunkStore{ChunkStore: NewInMemoryChunkStore()}
+		store1, err := NewChunkedStorage(NewInMemoryStorage("local"), chunks1)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		store2, err := NewChunkedStorage(NewInMemoryStorage("remote"), chunks2)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		status := NewInMemoryStatusStorage()
+
+		store1.Set(ctx, &GenericObject{ID: "a", Value: value, Modified: time.Now().UTC()})
+		err = Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if chunks2.written != chunks1.written {
+			t.Errorf("Unexpected chunks written = %v, want %v", chunks2.written, chunks1.written)
+		}
+
+		edited := value[:700000] + "edited" + value[700006:]
+		store1.Set(ctx, &GenericObject{ID: "a", Value: edited, Modified: time.Now().UTC()})
+		chunks2.written = 0
+		err = Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if chunks2.written > 2 {
+			t.Errorf("Unexpected chunks written = %v", chunks2.written)
+		}
+		object, err := store2.Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != edited {
+			t.Errorf("Unexpected value")
+		}
+	})
+	t.Run("Collect", func(t *testing.T) {
+		files, err := NewFileChunkStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		for _, chunks := range []ChunkSweeper{NewInMemoryChunkStore(), files, NewStorageChunkStore(NewInMemoryStorage("chunks"))} {
+			// Two storages share the chunks
+			store1, err := NewChunkedStorage(NewInMemoryStorage("local"), chunks)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			store2, err := NewChunkedStorage(NewInMemoryStorage("versions"), chunks)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			other := randomValue(random, 100000)
+			store1.Set(ctx, &GenericObject{ID: "a", Value: value})
+			store1.Set(ctx, &GenericObject{ID: "b", Value: other})
+			store2.Set(ctx, &GenericObject{ID: "a", Value: value})
+			all, err := chunks.ListChunks(ctx)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+
+			// Nothing is removed while the chunks are named
+			removed, err := CollectChunks(ctx, chunks, store1, store2)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if removed != 0 {
+				t.Errorf("Unexpected removed = %v", removed)
+			}
+
+			// The chunks of b alone are removed, and the ones a shares kept
+			store1.Delete(ctx, "a")
+			store1.Delete(ctx, "b")
+			removed, err = CollectChunks(ctx, chunks, store1, store2)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			left, err := chunks.ListChunks(ctx)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if removed == 0 || len(left) != len(all)-removed {
+				t.Errorf("Unexpected removed = %v of %v, with %v left", removed, len(all), len(left))
+			}
+			object, err := store2.Get(ctx, "a")
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if object.Value != value {
+				t.Errorf("Unexpected value")
+			}
+
+			store2.Delete(ctx, "a")
+			_, err = CollectChunks(ctx, chunks, store1, store2)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			left, _ = chunks.ListChunks(ctx)
+			if len(left) != 0 {
+				t.Errorf("Unexpected chunks left = %v", len(left))
+			}
+		}
+	})
+
+	t.Run("Remote", func(t *testing.T) {
+		// The chunks of both storages are kept in one remote storage, so
+		// only the ones it is missing are sent
+		remote := &patchingStorage{InMemoryStorage: NewInMemoryStorage("chunks")}
+		chunks := NewStorageChunkStore(remote)
+		store1, err := NewChunkedStorage(NewInMemoryStorage("local"), chunks)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		store2, err := NewChunkedStorage(NewInMemoryStorage("remote"), chunks)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		store1.Set(ctx, &GenericObject{ID: "a", Value: value, Modified: time.Now().UTC()})
+		if remote.set < len(value) {
+			t.Errorf("Unexpected bytes sent = %v", remote.set)
+		}
+		sent := remote.set
+		err = Sync(ctx, store1, store2, NewInMemoryStatusStorage())
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if remote.set != sent {
+			t.Errorf("Unexpected bytes sent = %v", remote.set-sent)
+		}
+		object, err := store2.Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != value {
+			t.Errorf("Unexpected value")
+		}
+	})
+	t.Run("InvalidSizes", func(t *testing.T) {
+		for _, sizes := range [][3]int{{0, 8, 64}, {16, 8, 64}, {2, 64, 8}} {
+			_, err := NewChunkedStorage(NewInMemoryStorage("local"), NewInMemoryChunkStore(), WithChunkSizes(sizes[0], sizes[1], sizes[2]))
+			if err == nil {
+				t.Errorf("Expected error for sizes %v", sizes)
+			}
+		}
+	})
+}
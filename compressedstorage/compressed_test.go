@@ -0,0 +1,208 @@
+package compressedstorage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keithballdotnet/objectsync"
+	"github.com/keithballdotnet/objectsync/httpstorage"
+)
+
+// Check the interfaces
+var _ objectsync.Storage = &CompressedStorage{}
+var _ objectsync.Lister = &CompressedStorage{}
+var _ io.Closer = &CompressedStorage{}
+
+// countingStorage counts the objects set
+type countingStorage struct {
+	*objectsync.InMemoryStorage
+	sets int
+}
+
+func (s *countingStorage) Set(ctx context.Context, object *objectsync.GenericObject) error {
+	s.sets++
+	return s.InMemoryStorage.Set(ctx, object)
+}
+
+func TestCompressedStorage(t *testing.T) {
+
+	ctx := context.TODO()
+
+	values := map[string]string{
+		"none": "small",
+		"gzip": strings.Repeat("gzip ", 1000),
+		"zstd": strings.Repeat("zstd ", 100000),
+		"incompressible": func() string {
+			var b strings.Builder
+			for i := 0; b.Len() < 2000; i++ {
+				b.WriteString(string(objectsync.NewHash(fmt.Sprint(i))))
+			}
+			return b.String()
+		}(),
+	}
+
+	t.Run("SetGet", func(t *testing.T) {
+		inner := objectsync.NewInMemoryStorage("local")
+		store, err := NewCompressedStorage(inner)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// Written before compression was turned on
+		inner.Set(ctx, &objectsync.GenericObject{ID: "raw", Value: "raw value"})
+
+		for id, value := range values {
+			object := &objectsync.GenericObject{ID: id, Value: value, Modified: time.Now().UTC()}
+			err = store.Set(ctx, object)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if string(object.Hash) != string(objectsync.NewHash(value)) {
+				t.Errorf("Unexpected hash for [%s]", id)
+			}
+		}
+
+		wantCodecs := map[string]byte{"none": codecNone, "gzip": codecGzip, "zstd": codecZstd, "incompressible": codecNone}
+		for id, codec := range wantCodecs {
+			stored, _ := inner.Get(ctx, id)
+			if stored.Value[len(magic)] != codec {
+				t.Errorf("Unexpected codec for [%s] = %q", id, stored.Value[len(magic)])
+			}
+			if codec != codecNone && len(stored.Value) >= len(values[id])/10 {
+				t.Errorf("Unexpected size for [%s] = %v", id, len(stored.Value))
+			}
+		}
+
+		values["raw"] = "raw value"
+		for id, value := range values {
+			object, err := store.Get(ctx, id)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if object.Value != value || string(object.Hash) != string(objectsync.NewHash(value)) {
+				t.Errorf("Unexpected object [%s]", id)
+			}
+		}
+		delete(values, "raw")
+
+		listed, err := store.List(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		all, err := store.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(listed) != 5 || len(all) != 5 {
+			t.Fatalf("Incorrect len = %v and %v, want 5", len(listed), len(all))
+		}
+		for _, object := range listed {
+			if object.Value != "" {
+				t.Errorf("Expected no value for [%s]", object.ID)
+			}
+		}
+	})
+
+	t.Run("HTTP", func(t *testing.T) {
+		server := httptest.NewServer(httpstorage.NewHandler(objectsync.NewInMemoryStorage("remote")))
+		t.Cleanup(server.Close)
+		inner, err := httpstorage.NewHTTPStorage(server.Client(), server.URL)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		store, err := NewCompressedStorage(inner)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// Compressed values are binary, and must come back intact
+		for id, value := range values {
+			err = store.Set(ctx, &objectsync.GenericObject{ID: id, Value: value, Modified: time.Now().UTC()})
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+		}
+		for id, value := range values {
+			object, err := store.Get(ctx, id)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if object.Value != value {
+				t.Errorf("Unexpected value of [%s]", id)
+			}
+		}
+
+		err = store.Close()
+		if err != nil {
+			t.Errorf("Error: %v", err)
+		}
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		store1 := objectsync.NewInMemoryStorage("local")
+		inner := &countingStorage{InMemoryStorage: objectsync.NewInMemoryStorage("remote")}
+		status := objectsync.NewInMemoryStatusStorage()
+		for id, value := range values {
+			store1.Set(ctx, &objectsync.GenericObject{ID: id, Value: value, Modified: time.Now().UTC()})
+		}
+
+		err := objectsync.Sync(ctx, store1, inner, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// Turning compression on changes nothing to sync
+		store2, err := NewCompressedStorage(inner)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		inner.sets = 0
+		err = objectsync.Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if inner.sets != 0 {
+			t.Errorf("Unexpected sets = %v", inner.sets)
+		}
+
+		store1.Set(ctx, &objectsync.GenericObject{ID: "zstd", Value: "changed", Modified: time.Now().UTC()})
+		store2.Set(ctx, &objectsync.GenericObject{ID: "gzip", Value: strings.Repeat("changed ", 1000), Modified: time.Now().UTC()})
+		err = objectsync.Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		object, err := store1.Get(ctx, "gzip")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != strings.Repeat("changed ", 1000) {
+			t.Errorf("Unexpected value")
+		}
+
+		// Nor does turning it off again, as values are still read through it
+		store3, err := NewCompressedStorage(inner, WithMinSize(1<<30), WithZstdSize(1<<30))
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		inner.sets = 0
+		err = objectsync.Sync(ctx, store1, store3, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if inner.sets != 0 {
+			t.Errorf("Unexpected sets = %v", inner.sets)
+		}
+		object, err = store3.Get(ctx, "zstd")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != "changed" {
+			t.Errorf("Unexpected value = %s", object.Value)
+		}
+	})
+}
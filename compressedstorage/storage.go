@@ -0,0 +1,252 @@
+// Package compressedstorage implements an objectsync storage that compresses
+// the values of the objects it keeps in another storage.
+package compressedstorage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/keithballdotnet/objectsync"
+	"github.com/klauspost/compress/zstd"
+)
+
+// magic starts the header of every value written, so values written before
+// compression was turned on can be told apart and read as they are
+const magic = "\x00osc"
+
+// Codecs of the values, as marked in the header
+const (
+	codecNone = 'n'
+	codecGzip = 'g'
+	codecZstd = 'z'
+)
+
+// headerSize is the size of the magic, the codec and the hash of the
+// uncompressed value
+const headerSize = len(magic) + 1 + sha256.Size
+
+// Default sizes from which values are compressed
+const (
+	DefaultMinSize  = 512
+	DefaultZstdSize = 64 << 10
+)
+
+// Option configures a CompressedStorage
+type Option func(*CompressedStorage)
+
+// WithMinSize will set the size under which values are kept uncompressed
+func WithMinSize(size int) Option {
+	return func(s *CompressedStorage) {
+		s.minSize = size
+	}
+}
+
+// WithZstdSize will set the size from which values are compressed with zstd
+// rather than gzip
+func WithZstdSize(size int) Option {
+	return func(s *CompressedStorage) {
+		s.zstdSize = size
+	}
+}
+
+// CompressedStorage is an objectsync.Storage that compresses values before
+// keeping them in another storage.
+//
+// Small values are kept as they are, larger ones are compressed with gzip,
+// and the largest with zstd.  Each value starts with a header marking its
+// codec, so values of all codecs, and values written without compression,
+// can be read back.  The Hash of an object is the SHA-256 of its uncompressed
+// value, also kept in the header, so syncing is the same with or without
+// compression, and objects are listed without decompressing them.  Values
+// are binary, so the other storage must keep values as bytes, as sqlstorage
+// and httpstorage do.  Close releases the zstd codecs.
+type CompressedStorage struct {
+	store    objectsync.Storage
+	minSize  int
+	zstdSize int
+
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+// NewCompressedStorage will return a CompressedStorage keeping its objects
+// in store
+func NewCompressedStorage(store objectsync.Storage, opts ...Option) (*CompressedStorage, error) {
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &CompressedStorage{
+		store:    store,
+		minSize:  DefaultMinSize,
+		zstdSize: DefaultZstdSize,
+		encoder:  encoder,
+		decoder:  decoder,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// GetName ...
+func (s *CompressedStorage) GetName() string {
+	return s.store.GetName()
+}
+
+// Set will compress the value, and set the object in the storage
+func (s *CompressedStorage) Set(ctx context.Context, object *objectsync.GenericObject) error {
+	value, err := s.encode(object.Value)
+	if err != nil {
+		return err
+	}
+
+	stored := *object
+	stored.Value = value
+	err = s.store.Set(ctx, &stored)
+	if err != nil {
+		return err
+	}
+
+	object.Hash = objectsync.NewHash(object.Value)
+	return nil
+}
+
+// Get ...
+func (s *CompressedStorage) Get(ctx context.Context, id string) (*objectsync.GenericObject, error) {
+	stored, err := s.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.decode(stored, true)
+}
+
+// GetAll will return all objects
+func (s *CompressedStorage) GetAll(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	return s.all(ctx, true)
+}
+
+// List will return all objects without their values, reading their hashes
+// from the headers
+func (s *CompressedStorage) List(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	return s.all(ctx, false)
+}
+
+// Delete will remove a entry from the storage
+func (s *CompressedStorage) Delete(ctx context.Context, id string) error {
+	return s.store.Delete(ctx, id)
+}
+
+// Close will release the zstd encoder and decoder.  The storage can not be
+// used after.
+func (s *CompressedStorage) Close() error {
+	s.decoder.Close()
+	return s.encoder.Close()
+}
+
+func (s *CompressedStorage) all(ctx context.Context, values bool) (objectsync.GenericObjectCollection, error) {
+	all, err := s.store.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make(objectsync.GenericObjectCollection, len(all))
+	for i, stored := range all {
+		objects[i], err = s.decode(stored, values)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return objects, nil
+}
+
+// encode will return the value compressed with the codec for its size,
+// after the header.  Values that do not get smaller are kept as they are.
+func (s *CompressedStorage) encode(value string) (string, error) {
+	codec := byte(codecNone)
+	data := []byte(value)
+	switch {
+	case len(value) >= s.zstdSize:
+		codec, data = codecZstd, s.encoder.EncodeAll([]byte(value), nil)
+	case len(value) >= s.minSize:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		_, err := w.Write(data)
+		if err == nil {
+			err = w.Close()
+		}
+		if err != nil {
+			return "", err
+		}
+		codec, data = codecGzip, buf.Bytes()
+	}
+	if len(data) >= len(value) {
+		codec, data = codecNone, []byte(value)
+	}
+
+	hash := sha256.Sum256([]byte(value))
+	var encoded strings.Builder
+	encoded.Grow(headerSize + len(data))
+	encoded.WriteString(magic)
+	encoded.WriteByte(codec)
+	encoded.Write(hash[:])
+	encoded.Write(data)
+	return encoded.String(), nil
+}
+
+// decode will return the object of the one stored, with the hash of its
+// uncompressed value, and the value itself if value is true
+func (s *CompressedStorage) decode(stored *objectsync.GenericObject, value bool) (*objectsync.GenericObject, error) {
+	object := *stored
+	object.Value = ""
+
+	// Written without compression
+	if !strings.HasPrefix(stored.Value, magic) || len(stored.Value) < headerSize {
+		object.Hash = objectsync.NewHash(stored.Value)
+		if value {
+			object.Value = stored.Value
+		}
+		return &object, nil
+	}
+
+	codec := stored.Value[len(magic)]
+	object.Hash = objectsync.Hash(stored.Value[len(magic)+1 : headerSize])
+	if !value {
+		return &object, nil
+	}
+
+	data := stored.Value[headerSize:]
+	switch codec {
+	case codecNone:
+		object.Value = data
+	case codecGzip:
+		r, err := gzip.NewReader(strings.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		decoded, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		object.Value = string(decoded)
+	case codecZstd:
+		decoded, err := s.decoder.DecodeAll([]byte(data), nil)
+		if err != nil {
+			return nil, err
+		}
+		object.Value = string(decoded)
+	default:
+		return nil, fmt.Errorf("unknown codec %q of [%s]", codec, stored.ID)
+	}
+	return &object, nil
+}
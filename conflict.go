@@ -0,0 +1,71 @@
+package objectsync
+
+import (
+	"context"
+	"fmt"
+)
+
+// Conflict is an object that has been changed on both sides since the last
+// sync, or deleted on one side and changed on the other.  The deleted side
+// has a nil object and, if the storage keeps them, a tombstone.
+type Conflict struct {
+	ID     string
+	Local  *GenericObject
+	Remote *GenericObject
+	// Base is the object as it was at the last sync.  It is only known when
+	// Sync is given a BaseStorage, and is nil otherwise.
+	Base            *GenericObject
+	LocalTombstone  *Tombstone
+	RemoteTombstone *Tombstone
+}
+
+// ConflictResolver decides the state of an object that is in conflict.  The
+// returned object is written to both sides, while nil deletes the object.
+type ConflictResolver interface {
+	Resolve(ctx context.Context, conflict *Conflict) (*GenericObject, error)
+}
+
+// ConflictResolverFunc is a function that can be used as a ConflictResolver
+type ConflictResolverFunc func(ctx context.Context, conflict *Conflict) (*GenericObject, error)
+
+// Resolve will call f
+func (f ConflictResolverFunc) Resolve(ctx context.Context, conflict *Conflict) (*GenericObject, error) {
+	return f(ctx, conflict)
+}
+
+// LastWriteWins is a ConflictResolver that preserves the most recently modified
+// object.  A deletion wins over a change only if its tombstone is more recent.
+var LastWriteWins ConflictResolver = ConflictResolverFunc(func(ctx context.Context, conflict *Conflict) (*GenericObject, error) {
+	if conflict.Local == nil {
+		return resolveDeleteConflict(ctx, conflict.Remote, conflict.LocalTombstone), nil
+	}
+	if conflict.Remote == nil {
+		return resolveDeleteConflict(ctx, conflict.Local, conflict.RemoteTombstone), nil
+	}
+	return resolveConflict(ctx, conflict.Local, conflict.Remote), nil
+})
+
+// resolveConflict will return the object that should be considered
+// the object state to preserve
+// Last Write Wins (LWW) conflict resolution
+func resolveConflict(ctx context.Context, localObject, remoteObject *GenericObject) *GenericObject {
+	// local object is older than remote object.  We preserve this object
+	if localObject.Modified.After(remoteObject.Modified) {
+		fmt.Printf("We should add local [%s] to remote\n", remoteObject.ID)
+		return localObject
+	}
+	// remote object is older than local object.  Preserve older object.
+	fmt.Printf("We should add remote [%s] to local\n", remoteObject.ID)
+	return remoteObject
+}
+
+// resolveDeleteConflict will return object if it was changed after the
+// deletion recorded by tombstone, or nil if the deletion should be preserved
+func resolveDeleteConflict(ctx context.Context, object *GenericObject, tombstone *Tombstone) *GenericObject {
+	if tombstone != nil && tombstone.Deleted.After(object.Modified) {
+		fmt.Printf("We should delete [%s] from both\n", object.ID)
+		return nil
+	}
+	fmt.Printf("We should restore [%s]\n", object.ID)
+	return object
+}
@@ -0,0 +1,324 @@
+package objectsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DeferConflicts is a ConflictResolver that leaves every conflict untouched so
+// it can be resolved manually through a ConflictQueue.  Sync must be given a
+// ConflictStorage to record the conflicts in.
+var DeferConflicts ConflictResolver = ConflictResolverFunc(func(ctx context.Context, conflict *Conflict) (*GenericObject, error) {
+	return nil, ErrorConflictDeferred
+})
+
+// ErrorConflictChanged is returned when resolving a conflict whose objects
+// have changed since it was recorded.  The recorded conflict is updated, and
+// should be reviewed again.
+var ErrorConflictChanged = errors.New("conflict changed")
+
+// ConflictStorage keeps conflicts deferred for manual resolution
+type ConflictStorage interface {
+	Set(ctx context.Context, conflict *Conflict) error
+	Get(ctx context.Context, id string) (*Conflict, error)
+	GetAll(ctx context.Context) ([]*Conflict, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// InMemoryConflictStorage ...
+type InMemoryConflictStorage struct {
+	db map[string]*Conflict
+}
+
+// NewInMemoryConflictStorage ...
+func NewInMemoryConflictStorage() *InMemoryConflictStorage {
+	db := make(map[string]*Conflict)
+	return &InMemoryConflictStorage{db: db}
+}
+
+// Set ...
+func (s *InMemoryConflictStorage) Set(ctx context.Context, conflict *Conflict) error {
+	s.db[conflict.ID] = conflict
+	return nil
+}
+
+// Get ...
+func (s *InMemoryConflictStorage) Get(ctx context.Context, id string) (*Conflict, error) {
+	conflict, ok := s.db[id]
+	if !ok {
+		return nil, ErrorNotFound
+	}
+
+	return conflict, nil
+}
+
+// GetAll ...
+func (s *InMemoryConflictStorage) GetAll(ctx context.Context) ([]*Conflict, error) {
+	conflicts := make([]*Conflict, len(s.db))
+	i := 0
+	for _, conflict := range s.db {
+		conflicts[i] = conflict
+		i++
+	}
+
+	return conflicts, nil
+}
+
+// Delete ...
+func (s *InMemoryConflictStorage) Delete(ctx context.Context, id string) error {
+	delete(s.db, id)
+	return nil
+}
+
+// FileConflictStorage is a ConflictStorage that keeps each conflict as a JSON
+// file in a directory, so pending conflicts survive restarts
+type FileConflictStorage struct {
+	dir string
+}
+
+// NewFileConflictStorage will return a FileConflictStorage keeping its
+// files in dir, which is created if needed
+func NewFileConflictStorage(dir string) (*FileConflictStorage, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &FileConflictStorage{dir: dir}, nil
+}
+
+func (s *FileConflictStorage) path(id string) string {
+	return filepath.Join(s.dir, base64.RawURLEncoding.EncodeToString([]byte(id))+".json")
+}
+
+// Set will write the conflict to its file, replacing it atomically
+func (s *FileConflictStorage) Set(ctx context.Context, conflict *Conflict) error {
+	data, err := json.Marshal(conflict)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".conflict")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path(conflict.ID))
+}
+
+// Get ...
+func (s *FileConflictStorage) Get(ctx context.Context, id string) (*Conflict, error) {
+	data, err := os.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, ErrorNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	conflict := &Conflict{}
+	err = json.Unmarshal(data, conflict)
+	if err != nil {
+		return nil, err
+	}
+	return conflict, nil
+}
+
+// GetAll ...
+func (s *FileConflictStorage) GetAll(ctx context.Context) ([]*Conflict, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts := []*Conflict{}
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		id, err := base64.RawURLEncoding.DecodeString(strings.TrimSuffix(file.Name(), ".json"))
+		if err != nil {
+			continue
+		}
+		conflict, err := s.Get(ctx, string(id))
+		if err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, conflict)
+	}
+
+	return conflicts, nil
+}
+
+// Delete ...
+func (s *FileConflictStorage) Delete(ctx context.Context, id string) error {
+	err := os.Remove(s.path(id))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// pendingConflicts will return the IDs of the deferred conflicts recorded
+func pendingConflicts(ctx context.Context, o *options) (map[string]bool, error) {
+	pending := make(map[string]bool)
+	if o.conflicts == nil {
+		return pending, nil
+	}
+
+	conflicts, err := o.conflicts.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, conflict := range conflicts {
+		pending[conflict.ID] = true
+	}
+	return pending, nil
+}
+
+// ConflictQueue lists the conflicts deferred by Sync and resolves them
+// manually.  It should be given the same storages and options as Sync.
+type ConflictQueue struct {
+	local   Storage
+	remote  Storage
+	status  StatusStorage
+	options *options
+}
+
+// NewConflictQueue will return a ConflictQueue.  The options must include
+// WithConflictStorage.
+func NewConflictQueue(local, remote Storage, status StatusStorage, opts ...Option) (*ConflictQueue, error) {
+	o := newOptions(opts)
+	if o.conflicts == nil {
+		return nil, errors.New("a ConflictQueue requires a ConflictStorage")
+	}
+	return &ConflictQueue{local: local, remote: remote, status: status, options: o}, nil
+}
+
+// Pending will return the conflicts awaiting resolution
+func (q *ConflictQueue) Pending(ctx context.Context) ([]*Conflict, error) {
+	return q.options.conflicts.GetAll(ctx)
+}
+
+// ResolveLocal will resolve the conflict by keeping the local object, or
+// deleting the object if it was deleted locally
+func (q *ConflictQueue) ResolveLocal(ctx context.Context, id string) error {
+	return q.resolve(ctx, id, func(local, remote *GenericObject) *GenericObject {
+		return local
+	})
+}
+
+// ResolveRemote will resolve the conflict by keeping the remote object, or
+// deleting the object if it was deleted remotely
+func (q *ConflictQueue) ResolveRemote(ctx context.Context, id string) error {
+	return q.resolve(ctx, id, func(local, remote *GenericObject) *GenericObject {
+		return remote
+	})
+}
+
+// ResolveMerged will resolve the conflict by storing value on both sides
+func (q *ConflictQueue) ResolveMerged(ctx context.Context, id string, value string) error {
+	return q.resolve(ctx, id, func(local, remote *GenericObject) *GenericObject {
+		return &GenericObject{
+			ID:       id,
+			Hash:     NewHash(value),
+			Modified: time.Now().UTC(),
+			Value:    value,
+		}
+	})
+}
+
+// resolve will write the object chosen for the conflict to both sides.  The
+// objects are chosen from as read from the storages, not as recorded, as a
+// ConflictStorage need not keep values that are not valid UTF-8.  If either
+// side has changed since the conflict was recorded, the conflict is updated
+// and ErrorConflictChanged returned instead.
+func (q *ConflictQueue) resolve(ctx context.Context, id string, choose func(local, remote *GenericObject) *GenericObject) error {
+	o := q.options
+	conflict, err := o.conflicts.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	localObject, err := getObject(ctx, q.local, id)
+	if err != nil {
+		return err
+	}
+	remoteObject, err := getObject(ctx, q.remote, id)
+	if err != nil {
+		return err
+	}
+
+	if !sameHash(localObject, conflict.Local) || !sameHash(remoteObject, conflict.Remote) {
+		fmt.Printf("Conflict for [%s] has changed\n", id)
+		conflict.Local, conflict.Remote = localObject, remoteObject
+		err = o.conflicts.Set(ctx, conflict)
+		if err != nil {
+			return err
+		}
+		return ErrorConflictChanged
+	}
+
+	p := &pair{
+		local:           localObject,
+		remote:          remoteObject,
+		localStored:     localObject,
+		remoteStored:    remoteObject,
+		localTombstone:  conflict.LocalTombstone,
+		remoteTombstone: conflict.RemoteTombstone,
+	}
+	winner := choose(localObject, remoteObject)
+	if winner != nil {
+		winner = mergeVersions(winner, localObject, remoteObject)
+		if o.causality {
+			winner.VersionHash = winner.Hash
+		}
+	}
+
+	err = applyChanges(ctx, reconcile(winner, p, q.local, q.remote), q.local, q.remote, q.status, o)
+	if err != nil {
+		return err
+	}
+	err = commit(ctx, q.local, q.remote)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Resolved conflict for [%s]\n", id)
+	return o.conflicts.Delete(ctx, id)
+}
+
+// getObject will return the object with id from store, or nil if it does not exist
+func getObject(ctx context.Context, store Storage, id string) (*GenericObject, error) {
+	object, err := store.Get(ctx, id)
+	found, err := wasFound(err)
+	if err != nil || !found {
+		return nil, err
+	}
+	return object, nil
+}
+
+func sameHash(a, b *GenericObject) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return bytes.Equal(a.Hash, b.Hash)
+}
@@ -0,0 +1,207 @@
+package objectsync
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+// Check the interfaces
+var _ Committer = &committingStorage{}
+
+// committingStorage counts its commits
+type committingStorage struct {
+	*InMemoryStorage
+	commits int
+}
+
+func (s *committingStorage) Commit(ctx context.Context) error {
+	s.commits++
+	return nil
+}
+
+func TestConflictQueue(t *testing.T) {
+
+	ctx := context.TODO()
+
+	dir, err := os.MkdirTemp("", "conflicts")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fileConflicts, err := NewFileConflictStorage(dir)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	for name, conflicts := range map[string]ConflictStorage{"InMemory": NewInMemoryConflictStorage(), "File": fileConflicts} {
+		t.Run(name, func(t *testing.T) {
+			status := NewInMemoryStatusStorage()
+			store1 := NewInMemoryStorage("local")
+			store2 := NewInMemoryStorage("remote")
+			opts := []Option{WithConflictResolver(DeferConflicts), WithConflictStorage(conflicts)}
+
+			queue, err := NewConflictQueue(store1, store2, status, opts...)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+
+			now := time.Now().UTC()
+			ids := []string{"a/1", "b/2", "c/3"}
+			for _, id := range ids {
+				err = store1.Set(ctx, &GenericObject{ID: id, Value: "base", Modified: now})
+				if err != nil {
+					t.Fatalf("Error: %v", err)
+				}
+			}
+			err = Sync(ctx, store1, store2, status, opts...)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+
+			for _, id := range ids {
+				store1.Set(ctx, &GenericObject{ID: id, Value: "local " + id, Modified: now.Add(time.Minute)})
+				store2.Set(ctx, &GenericObject{ID: id, Value: "remote " + id, Modified: now.Add(time.Hour)})
+			}
+
+			// Conflicts are recorded and both sides left untouched
+			for i := 0; i < 2; i++ {
+				err = Sync(ctx, store1, store2, status, opts...)
+				if err != nil {
+					t.Fatalf("Error: %v", err)
+				}
+				pending, err := queue.Pending(ctx)
+				if err != nil {
+					t.Fatalf("Error: %v", err)
+				}
+				if len(pending) != len(ids) {
+					t.Fatalf("Incorrect pending len = %v, want %v", len(pending), len(ids))
+				}
+				checkValues(ctx, t, ids[0], "local "+ids[0], "remote "+ids[0], store1, store2)
+			}
+
+			err = queue.ResolveLocal(ctx, ids[0])
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			checkValues(ctx, t, ids[0], "local "+ids[0], "local "+ids[0], store1, store2)
+
+			err = queue.ResolveRemote(ctx, ids[1])
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			checkValues(ctx, t, ids[1], "remote "+ids[1], "remote "+ids[1], store1, store2)
+
+			// A changed conflict must be reviewed again
+			store2.Set(ctx, &GenericObject{ID: ids[2], Value: "remote again", Modified: now.Add(2 * time.Hour)})
+			err = queue.ResolveMerged(ctx, ids[2], "merged")
+			if err != ErrorConflictChanged {
+				t.Fatalf("Unexpected error = %v expected %v", err, ErrorConflictChanged)
+			}
+			conflict, err := conflicts.Get(ctx, ids[2])
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if conflict.Remote.Value != "remote again" {
+				t.Errorf("Unexpected value = %s expected %s", conflict.Remote.Value, "remote again")
+			}
+			err = queue.ResolveMerged(ctx, ids[2], "merged")
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			checkValues(ctx, t, ids[2], "merged", "merged", store1, store2)
+
+			pending, err := queue.Pending(ctx)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if len(pending) != 0 {
+				t.Fatalf("Incorrect pending len = %v, want 0", len(pending))
+			}
+
+			// Resolved objects are in sync
+			err = Sync(ctx, store1, store2, status, opts...)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			pending, _ = queue.Pending(ctx)
+			if len(pending) != 0 {
+				t.Fatalf("Incorrect pending len = %v, want 0", len(pending))
+			}
+
+			// A conflict is dropped once its object is gone from both sides
+			store1.Set(ctx, &GenericObject{ID: ids[0], Value: "local again", Modified: now.Add(3 * time.Hour)})
+			store2.Set(ctx, &GenericObject{ID: ids[0], Value: "remote again", Modified: now.Add(3 * time.Hour)})
+			err = Sync(ctx, store1, store2, status, opts...)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			pending, _ = queue.Pending(ctx)
+			if len(pending) != 1 {
+				t.Fatalf("Incorrect pending len = %v, want 1", len(pending))
+			}
+			store1.Delete(ctx, ids[0])
+			store2.Delete(ctx, ids[0])
+			err = Sync(ctx, store1, store2, status, opts...)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			pending, _ = queue.Pending(ctx)
+			if len(pending) != 0 {
+				t.Fatalf("Incorrect pending len = %v, want 0", len(pending))
+			}
+		})
+	}
+
+	// Conflicts are resolved with the values read from the storages, as
+	// they may not survive the ConflictStorage, and the storages committed
+	t.Run("Binary", func(t *testing.T) {
+		status := NewInMemoryStatusStorage()
+		store1 := &committingStorage{InMemoryStorage: NewInMemoryStorage("local")}
+		store2 := &committingStorage{InMemoryStorage: NewInMemoryStorage("remote")}
+		opts := []Option{WithConflictResolver(DeferConflicts), WithConflictStorage(fileConflicts)}
+		queue, err := NewConflictQueue(store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		now := time.Now().UTC()
+		binary := "\xff\xfe\x00\x80"
+		store1.Set(ctx, &GenericObject{ID: "binary", Value: "base", Modified: now})
+		err = Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		store1.Set(ctx, &GenericObject{ID: "binary", Value: binary, Modified: now.Add(time.Minute)})
+		store2.Set(ctx, &GenericObject{ID: "binary", Value: "remote", Modified: now.Add(time.Hour)})
+		err = Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		store1.commits, store2.commits = 0, 0
+		err = queue.ResolveLocal(ctx, "binary")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		checkValues(ctx, t, "binary", binary, binary, store1, store2)
+		if store1.commits != 1 || store2.commits != 1 {
+			t.Errorf("Unexpected commits = %v and %v", store1.commits, store2.commits)
+		}
+	})
+}
+
+func checkValues(ctx context.Context, t *testing.T, id, localValue, remoteValue string, local, remote Storage) {
+	t.Helper()
+	for store, value := range map[Storage]string{local: localValue, remote: remoteValue} {
+		object, err := store.Get(ctx, id)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != value {
+			t.Errorf("Unexpected value = %s in %s expected %s", object.Value, store.GetName(), value)
+		}
+	}
+}
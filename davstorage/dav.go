@@ -0,0 +1,810 @@
+// Package davstorage implements objectsync storage on CalDAV calendars and
+// CardDAV address books.  Items are keyed by their UID, and listed with
+// sync-collection (RFC 6578) where the server supports it, so only the items
+// changed since the last listing are reported.
+package davstorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keithballdotnet/objectsync"
+	"github.com/keithballdotnet/objectsync/internal/vobject"
+)
+
+// kind is what sets CalDAV and CardDAV apart
+type kind struct {
+	namespace    string
+	homeSet      string
+	resourceType string
+	data         string
+	multiget     string
+	contentType  string
+	extension    string
+}
+
+var (
+	calDAV = &kind{
+		namespace:    "urn:ietf:params:xml:ns:caldav",
+		homeSet:      "calendar-home-set",
+		resourceType: "calendar",
+		data:         "calendar-data",
+		multiget:     "calendar-multiget",
+		contentType:  "text/calendar; charset=utf-8",
+		extension:    ".ics",
+	}
+	cardDAV = &kind{
+		namespace:    "urn:ietf:params:xml:ns:carddav",
+		homeSet:      "addressbook-home-set",
+		resourceType: "addressbook",
+		data:         "address-data",
+		multiget:     "addressbook-multiget",
+		contentType:  "text/vcard; charset=utf-8",
+		extension:    ".vcf",
+	}
+)
+
+// errorSyncUnsupported is returned when the server does not support sync-collection
+var errorSyncUnsupported = errors.New("sync-collection not supported")
+
+// errorInvalidSyncToken is returned when the server no longer accepts the sync token
+var errorInvalidSyncToken = errors.New("invalid sync token")
+
+// CalDAVStorage is an objectsync.Storage keeping iCalendar items in a CalDAV
+// calendar
+type CalDAVStorage struct {
+	*davStorage
+}
+
+// NewCalDAVStorage will return a CalDAVStorage for the calendar at
+// collectionURL, which can be found with DiscoverCalendars.  Authentication
+// is left to the transport of client.
+func NewCalDAVStorage(client *http.Client, collectionURL string) (*CalDAVStorage, error) {
+	s, err := newDAVStorage(client, collectionURL, calDAV)
+	if err != nil {
+		return nil, err
+	}
+	return &CalDAVStorage{s}, nil
+}
+
+// CardDAVStorage is an objectsync.Storage keeping vCards in a CardDAV
+// address book
+type CardDAVStorage struct {
+	*davStorage
+}
+
+// NewCardDAVStorage will return a CardDAVStorage for the address book at
+// collectionURL, which can be found with DiscoverAddressBooks.
+// Authentication is left to the transport of client.
+func NewCardDAVStorage(client *http.Client, collectionURL string) (*CardDAVStorage, error) {
+	s, err := newDAVStorage(client, collectionURL, cardDAV)
+	if err != nil {
+		return nil, err
+	}
+	return &CardDAVStorage{s}, nil
+}
+
+// resource is an item of the collection as last seen
+type resource struct {
+	path        string
+	uid         string
+	etag        string
+	modified    time.Time
+	version     string
+	versionHash string
+	// signature is the signature of the item, and signed the modified time
+	// it covers
+	signature string
+	signed    string
+	// value is the data of the item, if it has been read at etag
+	value    string
+	hasValue bool
+}
+
+// davStorage is the storage shared by CalDAV and CardDAV.  The Hash of an
+// item is its ETag, and writes are conditional on the ETag last seen.  It is
+// an objectsync.ChangeFeed on the sync tokens of sync-collection.
+type davStorage struct {
+	client     *http.Client
+	collection *url.URL
+	kind       *kind
+
+	mu        sync.Mutex
+	resources map[string]*resource
+	uids      map[string]*resource
+	syncToken string
+	noSync    bool
+}
+
+func newDAVStorage(client *http.Client, collectionURL string, k *kind) (*davStorage, error) {
+	collection, err := url.Parse(collectionURL)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(collection.Path, "/") {
+		collection.Path += "/"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &davStorage{
+		client:     client,
+		collection: collection,
+		kind:       k,
+		resources:  make(map[string]*resource),
+		uids:       make(map[string]*resource),
+	}, nil
+}
+
+// GetName will return the collection URL
+func (s *davStorage) GetName() string {
+	return s.collection.String()
+}
+
+// Set will write the item, creating a resource named by its UID if it is new
+func (s *davStorage) Set(ctx context.Context, object *objectsync.GenericObject) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.uids[object.ID]
+	if !ok {
+		r = &resource{path: s.collection.Path + url.PathEscape(object.ID) + s.kind.extension, uid: object.ID}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.url(r.path), strings.NewReader(object.Value))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", s.kind.contentType)
+	if ok {
+		req.Header.Set("If-Match", r.etag)
+	} else {
+		req.Header.Set("If-None-Match", "*")
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	// A server that changed the item will not return an ETag for it
+	r.etag = resp.Header.Get("ETag")
+	r.value, r.hasValue = object.Value, r.etag != ""
+	if r.etag == "" {
+		err = s.stat(ctx, r)
+		if err != nil {
+			return err
+		}
+	}
+	s.add(r)
+
+	// The version belongs to this content, whose hash is now the ETag
+	if object.Version != nil || object.Signature != nil {
+		if bytes.Equal(object.VersionHash, objectsync.NewHash(object.Value)) {
+			object.VersionHash = objectsync.Hash(r.etag)
+		}
+		err = s.setProps(ctx, r, object)
+		if err != nil {
+			return err
+		}
+	}
+
+	object.Hash = objectsync.Hash(r.etag)
+	return nil
+}
+
+// setProps will set the dead properties of the item.  Those of a signature
+// are removed if it has none, so one left by an earlier write is not read.
+func (s *davStorage) setProps(ctx context.Context, r *resource, object *objectsync.GenericObject) error {
+	var props [][2]string
+	var remove []string
+	r.version, r.versionHash = "", ""
+	if object.Version != nil {
+		version, err := json.Marshal(object.Version)
+		if err != nil {
+			return err
+		}
+		r.version = string(version)
+		r.versionHash = base64.StdEncoding.EncodeToString(object.VersionHash)
+		props = append(props, [2]string{"version", r.version}, [2]string{"version-hash", r.versionHash})
+	}
+	r.signature, r.signed = "", ""
+	if object.Signature != nil {
+		signature, err := json.Marshal(object.Signature)
+		if err != nil {
+			return err
+		}
+		r.signature, r.signed = string(signature), object.Modified.Format(time.RFC3339Nano)
+		props = append(props, [2]string{"signature", r.signature}, [2]string{"modified", r.signed})
+	} else {
+		remove = []string{"signature", "modified"}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "PROPPATCH", s.url(r.path), strings.NewReader(proppatchBody(props, remove)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Get will read the item with the UID id
+func (s *davStorage) Get(ctx context.Context, id string) (*objectsync.GenericObject, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.lookup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url(r.path), nil)
+	if err != nil {
+		return nil, err
+	}
+	if r.hasValue {
+		req.Header.Set("If-None-Match", r.etag)
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		if objectsync.IsNotFoundError(err) {
+			s.remove(r.path)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotModified {
+		value, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		r.value, r.hasValue = string(value), true
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			r.etag = etag
+		}
+	}
+	return s.object(r, true)
+}
+
+// List will return all items without their values
+func (s *davStorage) List(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.objects(false)
+}
+
+// GetAll will return all items, reading the values not read before in one
+// multiget
+func (s *davStorage) GetAll(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []string{}
+	for p, r := range s.resources {
+		if !r.hasValue {
+			paths = append(paths, p)
+		}
+	}
+	err = s.multiget(ctx, paths)
+	if err != nil {
+		return nil, err
+	}
+	return s.objects(true)
+}
+
+// Delete will remove the item with the UID id
+func (s *davStorage) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.lookup(ctx, id)
+	if err != nil {
+		if objectsync.IsNotFoundError(err) {
+			return nil
+		}
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.url(r.path), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("If-Match", r.etag)
+
+	resp, err := s.do(req)
+	if err != nil && !objectsync.IsNotFoundError(err) {
+		return err
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+
+	s.remove(r.path)
+	return nil
+}
+
+// lookup will return the resource of the UID, listing the collection if it
+// is not known yet
+func (s *davStorage) lookup(ctx context.Context, uid string) (*resource, error) {
+	if r, ok := s.uids[uid]; ok {
+		return r, nil
+	}
+
+	err := s.refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := s.uids[uid]; ok {
+		return r, nil
+	}
+	return nil, objectsync.ErrorNotFound
+}
+
+// refresh will bring the resources up to date with the server
+func (s *davStorage) refresh(ctx context.Context) error {
+	var err error
+	if !s.noSync {
+		err = s.syncCollection(ctx)
+		if err == errorInvalidSyncToken {
+			s.syncToken = ""
+			err = s.syncCollection(ctx)
+		}
+		if err == errorSyncUnsupported {
+			s.noSync = true
+		}
+	}
+	if s.noSync {
+		err = s.propfind(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Read the UIDs of resources that were not written by us
+	paths := []string{}
+	for p, r := range s.resources {
+		if r.uid == "" {
+			paths = append(paths, p)
+		}
+	}
+	return s.multiget(ctx, paths)
+}
+
+// syncCollection will apply the changes reported since the last sync token.
+// Without a token all resources are reported.
+func (s *davStorage) syncCollection(ctx context.Context) error {
+	changed, deleted, token, err := s.changes(ctx, s.syncToken)
+	if err != nil {
+		return err
+	}
+
+	if s.syncToken == "" {
+		s.resources = make(map[string]*resource)
+	}
+	for p := range deleted {
+		delete(s.resources, p)
+	}
+	for p, props := range changed {
+		s.update(p, props)
+	}
+	s.syncToken = token
+	s.index()
+	return nil
+}
+
+// changes will return the properties of the resources changed since token,
+// and the paths of the ones deleted, along with the token after them
+func (s *davStorage) changes(ctx context.Context, token string) (changed map[string]*prop, deleted map[string]bool, next string, err error) {
+	changed, deleted = map[string]*prop{}, map[string]bool{}
+	for {
+		ms, err := s.report(ctx, s.collection.Path, syncCollectionBody(token, s.kind))
+		if err != nil {
+			return nil, nil, "", err
+		}
+
+		truncated := false
+		for i := range ms.Responses {
+			resp := &ms.Responses[i]
+			p, err := s.path(resp.Href)
+			if err != nil {
+				return nil, nil, "", err
+			}
+			switch {
+			case p == s.collection.Path:
+				// The server has more changes than it reported
+				truncated = strings.Contains(resp.Status, " 507 ")
+			case strings.Contains(resp.Status, " 404 "):
+				delete(changed, p)
+				deleted[p] = true
+			default:
+				props := resp.props()
+				if !props.is("DAV:", "collection") {
+					delete(deleted, p)
+					changed[p] = props
+				}
+			}
+		}
+
+		token = ms.SyncToken
+		if !truncated {
+			return changed, deleted, token, nil
+		}
+	}
+}
+
+// Changes will return the items changed since the sync token since, or all
+// items if it is empty.  Only the paths of deleted items are reported, so the
+// token has expired if an item deleted was not seen by the storage, as when
+// it was made after the token.  Servers without sync-collection give no
+// token, so they are read whole each time.
+func (s *davStorage) Changes(ctx context.Context, since string) (*objectsync.ChangeSet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if since == "" {
+		s.syncToken = ""
+		err := s.refresh(ctx)
+		if err != nil {
+			return nil, err
+		}
+		objects, err := s.objects(false)
+		if err != nil {
+			return nil, err
+		}
+		return &objectsync.ChangeSet{Changed: objects, Token: s.syncToken}, nil
+	}
+
+	changed, deleted, token, err := s.changes(ctx, since)
+	if err == errorInvalidSyncToken || err == errorSyncUnsupported {
+		return nil, objectsync.ErrorTokenExpired
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	uids := []string{}
+	for p := range deleted {
+		r, ok := s.resources[p]
+		if !ok || r.uid == "" {
+			return nil, objectsync.ErrorTokenExpired
+		}
+		uids = append(uids, r.uid)
+	}
+
+	// The resources were up to date at since if it is the token kept, so
+	// they are after the changes
+	for p := range deleted {
+		delete(s.resources, p)
+	}
+	paths := []string{}
+	for p, props := range changed {
+		if r := s.update(p, props); r.uid == "" {
+			paths = append(paths, p)
+		}
+	}
+	if since == s.syncToken {
+		s.syncToken = token
+	}
+	s.index()
+	err = s.multiget(ctx, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &objectsync.ChangeSet{Token: token}
+	for p := range changed {
+		r, ok := s.resources[p]
+		if !ok {
+			continue
+		}
+		object, err := s.object(r, false)
+		if err != nil {
+			return nil, err
+		}
+		set.Changed = append(set.Changed, object)
+	}
+	// An item moved to another path is changed, not deleted
+	for _, uid := range uids {
+		if _, ok := s.uids[uid]; !ok {
+			set.Deleted = append(set.Deleted, uid)
+		}
+	}
+	return set, nil
+}
+
+// propfind will list all resources, for servers without sync-collection
+func (s *davStorage) propfind(ctx context.Context) error {
+	ms, err := s.request(ctx, "PROPFIND", s.collection.Path, "1", propfindBody(itemProps, s.kind))
+	if err != nil {
+		return err
+	}
+
+	found := map[string]bool{}
+	for i := range ms.Responses {
+		p, err := s.path(ms.Responses[i].Href)
+		if err != nil {
+			return err
+		}
+		props := ms.Responses[i].props()
+		if p == s.collection.Path || props.is("DAV:", "collection") {
+			continue
+		}
+		s.update(p, props)
+		found[p] = true
+	}
+	for p := range s.resources {
+		if !found[p] {
+			delete(s.resources, p)
+		}
+	}
+	s.index()
+	return nil
+}
+
+// stat will read the properties of a single resource
+func (s *davStorage) stat(ctx context.Context, r *resource) error {
+	ms, err := s.request(ctx, "PROPFIND", r.path, "0", propfindBody(itemProps, s.kind))
+	if err != nil {
+		return err
+	}
+	if len(ms.Responses) == 0 {
+		return objectsync.ErrorNotFound
+	}
+	props := ms.Responses[0].props()
+	r.etag = props.ETag
+	r.modified, _ = http.ParseTime(props.LastModified)
+	return nil
+}
+
+// multiget will read the values of the resources at paths
+func (s *davStorage) multiget(ctx context.Context, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	hrefs := make([]string, len(paths))
+	for i, p := range paths {
+		hrefs[i] = (&url.URL{Path: p}).EscapedPath()
+	}
+	ms, err := s.report(ctx, s.collection.Path, multigetBody(hrefs, s.kind))
+	if err != nil {
+		return err
+	}
+
+	for i := range ms.Responses {
+		p, err := s.path(ms.Responses[i].Href)
+		if err != nil {
+			return err
+		}
+		if strings.Contains(ms.Responses[i].Status, " 404 ") {
+			delete(s.resources, p)
+			continue
+		}
+		props := ms.Responses[i].props()
+		r := s.update(p, props)
+		r.value, r.hasValue = props.data(), true
+		r.uid = vobject.UID(r.value)
+		// Items without a UID are known by their name
+		if r.uid == "" {
+			r.uid = strings.TrimSuffix(path.Base(p), s.kind.extension)
+		}
+	}
+	s.index()
+	return nil
+}
+
+// update will record the properties of the resource at p
+func (s *davStorage) update(p string, props *prop) *resource {
+	r, ok := s.resources[p]
+	if !ok {
+		r = &resource{path: p}
+		s.resources[p] = r
+	}
+	if r.etag != props.ETag {
+		r.value, r.hasValue = "", false
+	}
+	r.etag = props.ETag
+	r.modified, _ = http.ParseTime(props.LastModified)
+	r.version, r.versionHash = props.Version, props.VersionHash
+	r.signature, r.signed = props.Signature, props.Modified
+	return r
+}
+
+func (s *davStorage) add(r *resource) {
+	s.resources[r.path] = r
+	s.uids[r.uid] = r
+}
+
+func (s *davStorage) remove(p string) {
+	delete(s.resources, p)
+	s.index()
+}
+
+// index will rebuild the index of resources by UID
+func (s *davStorage) index() {
+	s.uids = make(map[string]*resource, len(s.resources))
+	for _, r := range s.resources {
+		if r.uid != "" {
+			s.uids[r.uid] = r
+		}
+	}
+}
+
+func (s *davStorage) objects(withValues bool) (objectsync.GenericObjectCollection, error) {
+	all := objectsync.GenericObjectCollection{}
+	for _, r := range s.uids {
+		object, err := s.object(r, withValues)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, object)
+	}
+	return all, nil
+}
+
+func (s *davStorage) object(r *resource, withValue bool) (*objectsync.GenericObject, error) {
+	object := &objectsync.GenericObject{
+		ID:       r.uid,
+		Hash:     objectsync.Hash(r.etag),
+		Modified: r.modified.UTC(),
+	}
+	if withValue {
+		object.Value = r.value
+	}
+	if r.version != "" {
+		err := json.Unmarshal([]byte(r.version), &object.Version)
+		if err != nil {
+			return nil, err
+		}
+		object.VersionHash, err = base64.StdEncoding.DecodeString(r.versionHash)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if r.signature != "" {
+		object.Signature = &objectsync.ObjectSignature{}
+		err := json.Unmarshal([]byte(r.signature), object.Signature)
+		if err != nil {
+			return nil, err
+		}
+		if r.signed != "" {
+			object.Modified, err = time.Parse(time.RFC3339Nano, r.signed)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return object, nil
+}
+
+func (s *davStorage) url(p string) string {
+	return s.collection.ResolveReference(&url.URL{Path: p}).String()
+}
+
+// path will return the path of href, which may be relative or absolute
+func (s *davStorage) path(href string) (string, error) {
+	u, err := s.collection.Parse(href)
+	if err != nil {
+		return "", err
+	}
+	return u.Path, nil
+}
+
+func (s *davStorage) report(ctx context.Context, p, body string) (*multistatus, error) {
+	ms, err := s.request(ctx, "REPORT", p, "1", body)
+	if err == nil || !strings.Contains(body, "sync-collection") {
+		return ms, err
+	}
+
+	switch err := err.(type) {
+	case *statusError:
+		if strings.Contains(err.body, "valid-sync-token") {
+			return nil, errorInvalidSyncToken
+		}
+		switch err.code {
+		case http.StatusBadRequest, http.StatusForbidden, http.StatusMethodNotAllowed, http.StatusNotImplemented, http.StatusUnsupportedMediaType:
+			return nil, errorSyncUnsupported
+		}
+	}
+	return nil, err
+}
+
+func (s *davStorage) request(ctx context.Context, method, p, depth, body string) (*multistatus, error) {
+	return request(ctx, s.client, method, s.url(p), depth, body)
+}
+
+func (s *davStorage) do(req *http.Request) (*http.Response, error) {
+	return do(s.client, req)
+}
+
+// statusError is a failed response
+type statusError struct {
+	method, url string
+	code        int
+	status      string
+	body        string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("dav: %s %s: %s", e.method, e.url, e.status)
+}
+
+// request will send a PROPFIND or REPORT and decode the multistatus response
+func request(ctx context.Context, client *http.Client, method, target, depth, body string) (*multistatus, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Depth", depth)
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+
+	resp, err := do(client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	ms := &multistatus{}
+	err = xml.NewDecoder(resp.Body).Decode(ms)
+	if err != nil {
+		return nil, err
+	}
+	return ms, nil
+}
+
+// do will send the request, mapping failed responses to errors
+func do(client *http.Client, req *http.Request) (*http.Response, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 || resp.StatusCode == http.StatusNotModified {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, objectsync.ErrorNotFound
+	case http.StatusPreconditionFailed:
+		return nil, objectsync.ErrorPreconditionFailed
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return nil, &statusError{
+		method: req.Method,
+		url:    req.URL.String(),
+		code:   resp.StatusCode,
+		status: resp.Status,
+		body:   string(body),
+	}
+}
@@ -0,0 +1,714 @@
+package davstorage
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/keithballdotnet/objectsync"
+)
+
+// Check the interfaces
+var _ objectsync.Storage = &CalDAVStorage{}
+var _ objectsync.Lister = &CalDAVStorage{}
+var _ objectsync.Storage = &CardDAVStorage{}
+var _ objectsync.Lister = &CardDAVStorage{}
+var _ objectsync.ChangeFeed = &CalDAVStorage{}
+var _ objectsync.ChangeFeed = &CardDAVStorage{}
+var _ objectsync.TokenStorage = &tokenStatusStorage{}
+
+// tokenStatusStorage keeps the tokens of the change feeds along with the
+// status
+type tokenStatusStorage struct {
+	*objectsync.InMemoryStatusStorage
+	tokens map[string]string
+}
+
+func (s *tokenStatusStorage) GetToken(ctx context.Context, side string) (string, error) {
+	token, ok := s.tokens[side]
+	if !ok {
+		return "", objectsync.ErrorNotFound
+	}
+	return token, nil
+}
+
+func (s *tokenStatusStorage) SetToken(ctx context.Context, side, token string) error {
+	s.tokens[side] = token
+	return nil
+}
+
+type fakeItem struct {
+	data        string
+	etag        string
+	modified    time.Time
+	changed     int
+	version     string
+	versionHash string
+	signature   string
+	signed      string
+}
+
+// fakeServer is a small CalDAV and CardDAV server, with a calendar at
+// /calendars/work/ and an address book at /contacts/friends/
+type fakeServer struct {
+	mu sync.Mutex
+	// syncCollection is true if sync-collection is supported
+	syncCollection bool
+	// minToken is the oldest sync token still accepted
+	minToken int
+	// reported is the number of items in the last sync-collection response
+	reported int
+
+	change  int
+	items   map[string]*fakeItem
+	deleted map[string]int
+}
+
+var fakeCollections = map[string]struct{ kind, name string }{
+	"/calendars/work/":   {"calendar", "Work"},
+	"/contacts/friends/": {"addressbook", "Friends"},
+}
+
+func newFakeServer(t *testing.T) (*fakeServer, *httptest.Server) {
+	f := &fakeServer{
+		syncCollection: true,
+		items:          make(map[string]*fakeItem),
+		deleted:        make(map[string]int),
+	}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, server
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p := r.URL.Path
+	body, _ := io.ReadAll(r.Body)
+	switch r.Method {
+	case "PROPFIND":
+		f.propfind(w, p, r.Header.Get("Depth"))
+	case "REPORT":
+		f.report(w, p, body)
+	case "PROPPATCH":
+		item, ok := f.items[p]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		update := struct {
+			Version     string `xml:"set>prop>version"`
+			VersionHash string `xml:"set>prop>version-hash"`
+			Signature   string `xml:"set>prop>signature"`
+			Modified    string `xml:"set>prop>modified"`
+		}{}
+		xml.Unmarshal(body, &update)
+		item.version, item.versionHash = update.Version, update.VersionHash
+		item.signature, item.signed = update.Signature, update.Modified
+		f.multistatus(w, "", "")
+	case http.MethodGet:
+		item, ok := f.items[p]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", item.etag)
+		if r.Header.Get("If-None-Match") == item.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		io.WriteString(w, item.data)
+	case http.MethodPut, http.MethodDelete:
+		item, exists := f.items[p]
+		ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+		if ifMatch != "" && (!exists || ifMatch != item.etag) || ifNoneMatch == "*" && exists {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if _, ok := fakeCollections[path.Dir(p)+"/"]; !ok {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		f.change++
+		if r.Method == http.MethodDelete {
+			if !exists {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			delete(f.items, p)
+			f.deleted[p] = f.change
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if !exists {
+			item = &fakeItem{}
+			f.items[p] = item
+		}
+		item.data = string(body)
+		item.etag = fmt.Sprintf(`"%d"`, f.change)
+		item.modified = time.Now().UTC()
+		item.changed = f.change
+		delete(f.deleted, p)
+		w.Header().Set("ETag", item.etag)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeServer) propfind(w http.ResponseWriter, p, depth string) {
+	var b strings.Builder
+	switch {
+	case p == "/" || p == "/principals/user/":
+		b.WriteString(fakeResponse(p, `<D:current-user-principal><D:href>/principals/user/</D:href></D:current-user-principal>
+<C:calendar-home-set><D:href>/calendars/</D:href></C:calendar-home-set>
+<A:addressbook-home-set><D:href>/contacts/</D:href></A:addressbook-home-set>`))
+	case p == "/calendars/" || p == "/contacts/":
+		b.WriteString(fakeResponse(p, `<D:resourcetype><D:collection/></D:resourcetype>`))
+		for cp, c := range fakeCollections {
+			if depth == "1" && strings.HasPrefix(cp, p) {
+				b.WriteString(f.collection(cp, c.kind, c.name))
+			}
+		}
+	case fakeCollections[p].kind != "":
+		b.WriteString(f.collection(p, fakeCollections[p].kind, fakeCollections[p].name))
+		if depth == "1" {
+			for _, ip := range f.paths(p) {
+				b.WriteString(f.item(ip, ""))
+			}
+		}
+	case f.items[p] != nil:
+		b.WriteString(f.item(p, ""))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	f.multistatus(w, b.String(), "")
+}
+
+func (f *fakeServer) report(w http.ResponseWriter, p string, body []byte) {
+	query := struct {
+		XMLName   xml.Name
+		SyncToken string   `xml:"sync-token"`
+		Hrefs     []string `xml:"href"`
+	}{}
+	err := xml.Unmarshal(body, &query)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var b strings.Builder
+	switch query.XMLName.Local {
+	case "sync-collection":
+		if !f.syncCollection {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		since := 0
+		if query.SyncToken != "" {
+			since, err = strconv.Atoi(strings.TrimPrefix(query.SyncToken, "urn:fake:"))
+			if err != nil || since < f.minToken {
+				w.WriteHeader(http.StatusForbidden)
+				io.WriteString(w, `<?xml version="1.0"?><D:error xmlns:D="DAV:"><D:valid-sync-token/></D:error>`)
+				return
+			}
+		}
+		f.reported = 0
+		for _, ip := range f.paths(p) {
+			if f.items[ip].changed > since {
+				b.WriteString(f.item(ip, ""))
+				f.reported++
+			}
+		}
+		for dp, change := range f.deleted {
+			if strings.HasPrefix(dp, p) && change > since && since > 0 {
+				fmt.Fprintf(&b, "<D:response><D:href>%s</D:href><D:status>HTTP/1.1 404 Not Found</D:status></D:response>\n", fakeHref(dp))
+				f.reported++
+			}
+		}
+		f.multistatus(w, b.String(), fmt.Sprintf("urn:fake:%d", f.change))
+	case "calendar-multiget", "addressbook-multiget":
+		data := "C:calendar-data"
+		if query.XMLName.Local == "addressbook-multiget" {
+			data = "A:address-data"
+		}
+		for _, h := range query.Hrefs {
+			u, _ := url.Parse(h)
+			if f.items[u.Path] == nil {
+				fmt.Fprintf(&b, "<D:response><D:href>%s</D:href><D:status>HTTP/1.1 404 Not Found</D:status></D:response>\n", h)
+				continue
+			}
+			b.WriteString(f.item(u.Path, data))
+		}
+		f.multistatus(w, b.String(), "")
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func (f *fakeServer) paths(collection string) []string {
+	paths := []string{}
+	for ip := range f.items {
+		if path.Dir(ip)+"/" == collection {
+			paths = append(paths, ip)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (f *fakeServer) collection(p, kind, name string) string {
+	space := "C"
+	if kind == "addressbook" {
+		space = "A"
+	}
+	return fakeResponse(p, fmt.Sprintf(`<D:resourcetype><D:collection/><%s:%s/></D:resourcetype>
+<D:displayname>%s</D:displayname>`, space, kind, name))
+}
+
+func (f *fakeServer) item(p, data string) string {
+	item := f.items[p]
+	props := fmt.Sprintf(`<D:resourcetype/>
+<D:getetag>%s</D:getetag>
+<D:getlastmodified>%s</D:getlastmodified>`, escape(item.etag), item.modified.Format(http.TimeFormat))
+	if item.version != "" {
+		props += fmt.Sprintf(`<O:version>%s</O:version><O:version-hash>%s</O:version-hash>`, escape(item.version), escape(item.versionHash))
+	}
+	if item.signature != "" {
+		props += fmt.Sprintf(`<O:signature>%s</O:signature><O:modified>%s</O:modified>`, escape(item.signature), escape(item.signed))
+	}
+	if data != "" {
+		props += fmt.Sprintf(`<%s>%s</%s>`, data, escape(item.data), data)
+	}
+	return fakeResponse(p, props)
+}
+
+func (f *fakeServer) multistatus(w http.ResponseWriter, responses, token string) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>
+<D:multistatus xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:A="urn:ietf:params:xml:ns:carddav" xmlns:O="%s">
+%s`, namespace, responses)
+	if token != "" {
+		fmt.Fprintf(w, "<D:sync-token>%s</D:sync-token>\n", token)
+	}
+	io.WriteString(w, "</D:multistatus>")
+}
+
+func fakeResponse(p, props string) string {
+	return fmt.Sprintf(`<D:response><D:href>%s</D:href><D:propstat><D:prop>%s</D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>
+`, fakeHref(p), props)
+}
+
+func fakeHref(p string) string {
+	return escape((&url.URL{Path: p}).EscapedPath())
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func event(uid, summary string) string {
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//objectsync//test//EN\r\nBEGIN:VEVENT\r\nUID:" + uid + "\r\nSUMMARY:" + summary + "\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+}
+
+func card(uid, name string) string {
+	return "BEGIN:VCARD\r\nVERSION:4.0\r\nUID:" + uid + "\r\nFN:" + name + "\r\nEND:VCARD\r\n"
+}
+
+// put will write data to the server as another client would
+func put(t *testing.T, target, data string) {
+	req, _ := http.NewRequest(http.MethodPut, target, strings.NewReader(data))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestDAVStorage(t *testing.T) {
+
+	ctx := context.TODO()
+
+	t.Run("Discover", func(t *testing.T) {
+		_, server := newFakeServer(t)
+
+		calendars, err := DiscoverCalendars(ctx, nil, server.URL+"/")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(calendars) != 1 || calendars[0].URL != server.URL+"/calendars/work/" || calendars[0].DisplayName != "Work" {
+			t.Errorf("Unexpected calendars = %+v", calendars)
+		}
+
+		addressBooks, err := DiscoverAddressBooks(ctx, nil, server.URL+"/")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(addressBooks) != 1 || addressBooks[0].URL != server.URL+"/contacts/friends/" || addressBooks[0].DisplayName != "Friends" {
+			t.Errorf("Unexpected address books = %+v", addressBooks)
+		}
+	})
+
+	t.Run("KeyedByUID", func(t *testing.T) {
+		_, server := newFakeServer(t)
+		store, err := NewCalDAVStorage(nil, server.URL+"/calendars/work/")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// Resources written by other clients may have any name
+		put(t, server.URL+"/calendars/work/external.ics", event("external@example.com", "External"))
+
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "meeting@example.com", Value: event("meeting@example.com", "Meeting")})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		listed, err := store.List(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		ids := []string{}
+		for _, object := range listed {
+			ids = append(ids, object.ID)
+			if object.Value != "" || len(object.Hash) == 0 {
+				t.Errorf("Unexpected object = %+v", object)
+			}
+		}
+		sort.Strings(ids)
+		if strings.Join(ids, ",") != "external@example.com,meeting@example.com" {
+			t.Errorf("Unexpected IDs = %v", ids)
+		}
+
+		object, err := store.Get(ctx, "external@example.com")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != event("external@example.com", "External") {
+			t.Errorf("Unexpected value = %s", object.Value)
+		}
+
+		err = store.Delete(ctx, "external@example.com")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		all, err := store.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 1 || all[0].Value != event("meeting@example.com", "Meeting") {
+			t.Errorf("Unexpected objects = %+v", all)
+		}
+	})
+
+	t.Run("SyncCollection", func(t *testing.T) {
+		f, server := newFakeServer(t)
+		store, _ := NewCardDAVStorage(nil, server.URL+"/contacts/friends/")
+
+		for i := 0; i < 5; i++ {
+			put(t, fmt.Sprintf("%s/contacts/friends/%d.vcf", server.URL, i), card(fmt.Sprintf("friend%d", i), "Friend"))
+		}
+		listed, err := store.List(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(listed) != 5 || f.reported != 5 {
+			t.Errorf("Incorrect len = %v and reported %v, want 5", len(listed), f.reported)
+		}
+
+		// Only the changes are reported
+		put(t, server.URL+"/contacts/friends/1.vcf", card("friend1", "Changed"))
+		req, _ := http.NewRequest(http.MethodDelete, server.URL+"/contacts/friends/2.vcf", nil)
+		http.DefaultClient.Do(req)
+
+		listed, err = store.List(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(listed) != 4 || f.reported != 2 {
+			t.Errorf("Incorrect len = %v and reported %v, want 4 and 2", len(listed), f.reported)
+		}
+		object, err := store.Get(ctx, "friend1")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != card("friend1", "Changed") {
+			t.Errorf("Unexpected value = %s", object.Value)
+		}
+
+		// An expired token starts over
+		f.minToken = f.change + 1
+		put(t, server.URL+"/contacts/friends/3.vcf", card("friend3", "Changed"))
+		listed, err = store.List(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(listed) != 4 || f.reported != 4 {
+			t.Errorf("Incorrect len = %v and reported %v, want 4", len(listed), f.reported)
+		}
+
+		// Servers without sync-collection are listed in full
+		f.syncCollection = false
+		store, _ = NewCardDAVStorage(nil, server.URL+"/contacts/friends/")
+		all, err := store.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 4 {
+			t.Errorf("Incorrect len = %v, want 4", len(all))
+		}
+	})
+
+	t.Run("Conditional", func(t *testing.T) {
+		_, server := newFakeServer(t)
+		store, _ := NewCalDAVStorage(nil, server.URL+"/calendars/work/")
+
+		err := store.Set(ctx, &objectsync.GenericObject{ID: "a", Value: event("a", "Ours")})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		put(t, server.URL+"/calendars/work/a.ics", event("a", "Theirs"))
+
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "a", Value: event("a", "Ours again")})
+		if err != objectsync.ErrorPreconditionFailed {
+			t.Errorf("Unexpected error = %v", err)
+		}
+		err = store.Delete(ctx, "a")
+		if err != objectsync.ErrorPreconditionFailed {
+			t.Errorf("Unexpected error = %v", err)
+		}
+
+		// Someone else created it first
+		put(t, server.URL+"/calendars/work/b.ics", event("b", "Theirs"))
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "b", Value: event("b", "Ours")})
+		if err != objectsync.ErrorPreconditionFailed {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		_, server := newFakeServer(t)
+		store1 := objectsync.NewInMemoryStorage("local")
+		store2, _ := NewCardDAVStorage(nil, server.URL+"/contacts/friends/")
+		status := objectsync.NewInMemoryStatusStorage()
+
+		for i := 0; i < 3; i++ {
+			store1.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("local%v", i), Value: card(fmt.Sprintf("local%v", i), "Local"), Modified: time.Now().UTC()})
+			put(t, fmt.Sprintf("%s/contacts/friends/remote%v.vcf", server.URL, i), card(fmt.Sprintf("remote%v", i), "Remote"))
+		}
+
+		opts := []objectsync.Option{objectsync.WithCausality("local", "remote")}
+		err := objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		store1.Delete(ctx, "remote0")
+		put(t, server.URL+"/contacts/friends/local1.vcf", card("local1", "Changed"))
+		err = objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		all, err := store2.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 5 {
+			t.Errorf("Incorrect len = %v, want 5", len(all))
+		}
+		object, err := store1.Get(ctx, "local1")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != card("local1", "Changed") {
+			t.Errorf("Unexpected value = %s", object.Value)
+		}
+
+		// Nothing changes if we change nothing
+		before, _ := store2.List(ctx)
+		err = objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		after, _ := store2.List(ctx)
+		hashes := map[string]string{}
+		for _, object := range before {
+			hashes[object.ID] = string(object.Hash)
+		}
+		for _, object := range after {
+			if hashes[object.ID] != string(object.Hash) {
+				t.Errorf("Unexpected write of [%s] to remote", object.ID)
+			}
+		}
+	})
+
+	t.Run("ChangeFeed", func(t *testing.T) {
+		f, server := newFakeServer(t)
+		store, _ := NewCardDAVStorage(nil, server.URL+"/contacts/friends/")
+		for i := 0; i < 3; i++ {
+			put(t, fmt.Sprintf("%s/contacts/friends/%d.vcf", server.URL, i), card(fmt.Sprintf("friend%d", i), "Friend"))
+		}
+
+		changes, err := store.Changes(ctx, "")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(changes.Changed) != 3 || len(changes.Deleted) != 0 || changes.Token == "" {
+			t.Errorf("Unexpected changes = %+v", changes)
+		}
+
+		put(t, server.URL+"/contacts/friends/1.vcf", card("friend1", "Changed"))
+		put(t, server.URL+"/contacts/friends/external.vcf", card("friend3", "External"))
+		req, _ := http.NewRequest(http.MethodDelete, server.URL+"/contacts/friends/2.vcf", nil)
+		http.DefaultClient.Do(req)
+		changes, err = store.Changes(ctx, changes.Token)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		ids := []string{}
+		for _, object := range changes.Changed {
+			ids = append(ids, object.ID)
+		}
+		sort.Strings(ids)
+		if strings.Join(ids, ",") != "friend1,friend3" || strings.Join(changes.Deleted, ",") != "friend2" {
+			t.Errorf("Unexpected changes = %v and deleted %v", ids, changes.Deleted)
+		}
+
+		// Another storage knows what changed, but not what was deleted
+		token := changes.Token
+		store, _ = NewCardDAVStorage(nil, server.URL+"/contacts/friends/")
+		put(t, server.URL+"/contacts/friends/0.vcf", card("friend0", "Changed"))
+		changes, err = store.Changes(ctx, token)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(changes.Changed) != 1 || changes.Changed[0].ID != "friend0" || f.reported != 1 {
+			t.Errorf("Unexpected changes = %+v", changes)
+		}
+		req, _ = http.NewRequest(http.MethodDelete, server.URL+"/contacts/friends/external.vcf", nil)
+		http.DefaultClient.Do(req)
+		store, _ = NewCardDAVStorage(nil, server.URL+"/contacts/friends/")
+		_, err = store.Changes(ctx, changes.Token)
+		if err != objectsync.ErrorTokenExpired {
+			t.Errorf("Unexpected error = %v", err)
+		}
+
+		// As do tokens the server no longer accepts
+		f.minToken = f.change + 1
+		_, err = store.Changes(ctx, changes.Token)
+		if err != objectsync.ErrorTokenExpired {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+
+	t.Run("SyncChanges", func(t *testing.T) {
+		f1, server1 := newFakeServer(t)
+		f2, server2 := newFakeServer(t)
+		store1, _ := NewCardDAVStorage(nil, server1.URL+"/contacts/friends/")
+		store2, _ := NewCardDAVStorage(nil, server2.URL+"/contacts/friends/")
+		status := &tokenStatusStorage{InMemoryStatusStorage: objectsync.NewInMemoryStatusStorage(), tokens: map[string]string{}}
+
+		for i := 0; i < 5; i++ {
+			put(t, fmt.Sprintf("%s/contacts/friends/local%v.vcf", server1.URL, i), card(fmt.Sprintf("local%v", i), "Local"))
+		}
+		err := objectsync.Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// Only the changes since the tokens kept are reported, which include
+		// the writes of the last sync
+		put(t, server2.URL+"/contacts/friends/local1.vcf", card("local1", "Changed"))
+		req, _ := http.NewRequest(http.MethodDelete, server1.URL+"/contacts/friends/local2.vcf", nil)
+		http.DefaultClient.Do(req)
+		err = objectsync.Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if f1.reported != 1 || f2.reported != 5 {
+			t.Errorf("Unexpected reported = %v and %v, want 1 and 5", f1.reported, f2.reported)
+		}
+
+		for _, store := range []*CardDAVStorage{store1, store2} {
+			all, err := store.GetAll(ctx)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if len(all) != 4 {
+				t.Errorf("Incorrect len = %v, want 4", len(all))
+			}
+		}
+		object, err := store1.Get(ctx, "local1")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != card("local1", "Changed") {
+			t.Errorf("Unexpected value = %s", object.Value)
+		}
+	})
+
+	t.Run("Signed", func(t *testing.T) {
+		_, server := newFakeServer(t)
+		store, err := NewCalDAVStorage(nil, server.URL+"/calendars/work/")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		public, key, _ := ed25519.GenerateKey(nil)
+		modified := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+		signer := objectsync.NewSignedStorage(store, "local", key, nil)
+		err = signer.Set(ctx, &objectsync.GenericObject{ID: "meeting@example.com", Value: event("meeting@example.com", "Meeting"), Modified: modified, Version: objectsync.VersionVector{"local": 1}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// The signature is kept, with the time it covers, so the object
+		// verifies when read again
+		verifier := func() *objectsync.SignedStorage {
+			reader, _ := NewCalDAVStorage(nil, server.URL+"/calendars/work/")
+			return objectsync.NewSignedStorage(reader, "remote", nil, map[string]ed25519.PublicKey{"local": public})
+		}
+		got, err := verifier().Get(ctx, "meeting@example.com")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if got.Signature == nil || got.Signature.Replica != "local" || !got.Modified.Equal(modified) {
+			t.Errorf("Unexpected object = %+v", got)
+		}
+		all, err := verifier().GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 1 {
+			t.Errorf("Incorrect len = %v, want 1", len(all))
+		}
+
+		// Written again without one, it no longer verifies
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "meeting@example.com", Value: event("meeting@example.com", "Moved"), Modified: modified, Version: objectsync.VersionVector{"local": 2}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = verifier().Get(ctx, "meeting@example.com")
+		if !objectsync.IsVerificationError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+}
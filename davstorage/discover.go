@@ -0,0 +1,84 @@
+package davstorage
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Collection is a calendar or address book found by discovery
+type Collection struct {
+	URL         string
+	DisplayName string
+}
+
+// DiscoverCalendars will return the calendars of the user at serverURL,
+// following the current user principal to its calendar home set
+func DiscoverCalendars(ctx context.Context, client *http.Client, serverURL string) ([]Collection, error) {
+	return discover(ctx, client, serverURL, calDAV)
+}
+
+// DiscoverAddressBooks will return the address books of the user at
+// serverURL, following the current user principal to its address book home set
+func DiscoverAddressBooks(ctx context.Context, client *http.Client, serverURL string) ([]Collection, error) {
+	return discover(ctx, client, serverURL, cardDAV)
+}
+
+func discover(ctx context.Context, client *http.Client, serverURL string, k *kind) ([]Collection, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	base, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Servers without a principal keep the home set at the URL given
+	principal, err := discoverHref(ctx, client, base, `<D:current-user-principal/>`, k, func(p *prop) string {
+		return p.CurrentUserPrincipal.Href
+	})
+	if err != nil {
+		return nil, err
+	}
+	home, err := discoverHref(ctx, client, principal, `<C:`+k.homeSet+`/>`, k, func(p *prop) string {
+		return p.homeSet(k)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ms, err := request(ctx, client, "PROPFIND", home.String(), "1", propfindBody(`<D:resourcetype/>
+<D:displayname/>`, k))
+	if err != nil {
+		return nil, err
+	}
+
+	collections := []Collection{}
+	for i := range ms.Responses {
+		props := ms.Responses[i].props()
+		if !props.is(k.namespace, k.resourceType) {
+			continue
+		}
+		u, err := home.Parse(ms.Responses[i].Href)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, Collection{URL: u.String(), DisplayName: props.DisplayName})
+	}
+	return collections, nil
+}
+
+// discoverHref will return the URL in the property of target, or target if
+// it has none
+func discoverHref(ctx context.Context, client *http.Client, target *url.URL, props string, k *kind, get func(p *prop) string) (*url.URL, error) {
+	ms, err := request(ctx, client, "PROPFIND", target.String(), "0", propfindBody(props, k))
+	if err != nil {
+		return nil, err
+	}
+	for i := range ms.Responses {
+		if href := get(ms.Responses[i].props()); href != "" {
+			return target.Parse(href)
+		}
+	}
+	return target, nil
+}
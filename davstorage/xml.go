@@ -0,0 +1,184 @@
+package davstorage
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// namespace of the dead properties keeping the version of an object
+const namespace = "https://github.com/keithballdotnet/objectsync/"
+
+// multistatus is the response to a PROPFIND or REPORT
+type multistatus struct {
+	XMLName   xml.Name   `xml:"DAV: multistatus"`
+	Responses []response `xml:"DAV: response"`
+	SyncToken string     `xml:"DAV: sync-token"`
+}
+
+type response struct {
+	Href     string     `xml:"DAV: href"`
+	Status   string     `xml:"DAV: status"`
+	Propstat []propstat `xml:"DAV: propstat"`
+}
+
+type propstat struct {
+	Prop   prop   `xml:"DAV: prop"`
+	Status string `xml:"DAV: status"`
+}
+
+type href struct {
+	Href string `xml:"DAV: href"`
+}
+
+type element struct {
+	XMLName xml.Name
+}
+
+type prop struct {
+	ResourceType struct {
+		Types []element `xml:",any"`
+	} `xml:"DAV: resourcetype"`
+	DisplayName          string `xml:"DAV: displayname"`
+	ETag                 string `xml:"DAV: getetag"`
+	LastModified         string `xml:"DAV: getlastmodified"`
+	CurrentUserPrincipal href   `xml:"DAV: current-user-principal"`
+	CalendarHomeSet      href   `xml:"urn:ietf:params:xml:ns:caldav calendar-home-set"`
+	AddressbookHomeSet   href   `xml:"urn:ietf:params:xml:ns:carddav addressbook-home-set"`
+	CalendarData         string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+	AddressData          string `xml:"urn:ietf:params:xml:ns:carddav address-data"`
+	Version              string `xml:"https://github.com/keithballdotnet/objectsync/ version"`
+	VersionHash          string `xml:"https://github.com/keithballdotnet/objectsync/ version-hash"`
+	Signature            string `xml:"https://github.com/keithballdotnet/objectsync/ signature"`
+	Modified             string `xml:"https://github.com/keithballdotnet/objectsync/ modified"`
+}
+
+// props will return the properties found for the response.  Properties a
+// server could not return are empty, so the first non empty value is kept.
+func (r *response) props() *prop {
+	found := &prop{}
+	for _, ps := range r.Propstat {
+		p := ps.Prop
+		found.ResourceType.Types = append(found.ResourceType.Types, p.ResourceType.Types...)
+		for _, field := range []struct{ to, from *string }{
+			{&found.DisplayName, &p.DisplayName},
+			{&found.ETag, &p.ETag},
+			{&found.LastModified, &p.LastModified},
+			{&found.CurrentUserPrincipal.Href, &p.CurrentUserPrincipal.Href},
+			{&found.CalendarHomeSet.Href, &p.CalendarHomeSet.Href},
+			{&found.AddressbookHomeSet.Href, &p.AddressbookHomeSet.Href},
+			{&found.CalendarData, &p.CalendarData},
+			{&found.AddressData, &p.AddressData},
+			{&found.Version, &p.Version},
+			{&found.VersionHash, &p.VersionHash},
+			{&found.Signature, &p.Signature},
+			{&found.Modified, &p.Modified},
+		} {
+			if *field.to == "" {
+				*field.to = *field.from
+			}
+		}
+	}
+	return found
+}
+
+// is will return true if the resource type includes space name
+func (p *prop) is(space, name string) bool {
+	for _, t := range p.ResourceType.Types {
+		if t.XMLName.Space == space && t.XMLName.Local == name {
+			return true
+		}
+	}
+	return false
+}
+
+// data will return the calendar or address data
+func (p *prop) data() string {
+	if p.CalendarData != "" {
+		return p.CalendarData
+	}
+	return p.AddressData
+}
+
+// homeSet will return the home set of the kind
+func (p *prop) homeSet(k *kind) string {
+	if k == calDAV {
+		return p.CalendarHomeSet.Href
+	}
+	return p.AddressbookHomeSet.Href
+}
+
+// itemProps are the properties needed to list items
+const itemProps = `<D:resourcetype/>
+<D:getetag/>
+<D:getlastmodified/>
+<O:version/>
+<O:version-hash/>
+<O:signature/>
+<O:modified/>`
+
+func propfindBody(props string, k *kind) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:" xmlns:C="%s" xmlns:O="%s">
+<D:prop>
+%s
+</D:prop>
+</D:propfind>`, k.namespace, namespace, props)
+}
+
+func syncCollectionBody(token string, k *kind) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(token))
+	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<D:sync-collection xmlns:D="DAV:" xmlns:O="%s">
+<D:sync-token>%s</D:sync-token>
+<D:sync-level>1</D:sync-level>
+<D:prop>
+%s
+</D:prop>
+</D:sync-collection>`, namespace, b.String(), itemProps)
+}
+
+func multigetBody(hrefs []string, k *kind) string {
+	var b strings.Builder
+	for _, h := range hrefs {
+		b.WriteString("<D:href>")
+		xml.EscapeText(&b, []byte(h))
+		b.WriteString("</D:href>\n")
+	}
+	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<C:%s xmlns:D="DAV:" xmlns:C="%s" xmlns:O="%s">
+<D:prop>
+%s
+<C:%s/>
+</D:prop>
+%s</C:%s>`, k.multiget, k.namespace, namespace, itemProps, k.data, b.String(), k.multiget)
+}
+
+// proppatchBody will return a PROPPATCH setting the dead properties of an
+// item, as pairs of name and value, and removing the ones named in remove
+func proppatchBody(props [][2]string, remove []string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>
+<D:propertyupdate xmlns:D="DAV:" xmlns:O="` + namespace + `">
+<D:set>
+<D:prop>
+`)
+	for _, prop := range props {
+		b.WriteString("<O:" + prop[0] + ">")
+		xml.EscapeText(&b, []byte(prop[1]))
+		b.WriteString("</O:" + prop[0] + ">\n")
+	}
+	b.WriteString(`</D:prop>
+</D:set>
+`)
+	if len(remove) > 0 {
+		b.WriteString("<D:remove>\n<D:prop>\n")
+		for _, name := range remove {
+			b.WriteString("<O:" + name + "/>\n")
+		}
+		b.WriteString("</D:prop>\n</D:remove>\n")
+	}
+	b.WriteString(`</D:propertyupdate>`)
+	return b.String()
+}
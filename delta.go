@@ -0,0 +1,233 @@
+package objectsync
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"strings"
+)
+
+// deltaBlockSize is the size of the blocks Sync asks signatures for.  Values
+// shorter than two blocks are set whole.
+const deltaBlockSize = 1024
+
+// ErrorDeltaMismatch is returned when a delta does not apply to a value, as
+// the value changed since its signature was made
+var ErrorDeltaMismatch = errors.New("delta mismatch")
+
+// DeltaStorage is implemented by a Storage that can patch the value of an
+// object, so only the blocks of the value that changed need to be sent.
+// Sync uses it to update objects with large values.
+type DeltaStorage interface {
+	// DeltaSignature will return the signature of the value of the object with id
+	DeltaSignature(ctx context.Context, id string, blockSize int) (*DeltaSignature, error)
+	// Patch will set the object, with the value made by applying delta to
+	// the current value.  It fails with ErrorDeltaMismatch if the result does
+	// not have the hash of the delta.
+	Patch(ctx context.Context, object *GenericObject, delta *Delta) error
+}
+
+// DeltaSignature holds the checksums of the blocks of a value
+type DeltaSignature struct {
+	BlockSize int
+	Blocks    []BlockSignature
+}
+
+// BlockSignature holds the checksums of a block of a value.  Weak is the
+// rolling checksum, and Strong the SHA-256 of the block.
+type BlockSignature struct {
+	Weak   uint32
+	Strong Hash
+}
+
+// Delta is the difference of a value from one with a DeltaSignature
+type Delta struct {
+	BlockSize int
+	Ops       []DeltaOp
+	// Hash is the hash of the value the delta makes
+	Hash Hash
+}
+
+// DeltaOp is an operation of a Delta.  It copies Block of the old value, or
+// inserts Data if Block is negative.
+type DeltaOp struct {
+	Block int
+	Data  string
+}
+
+// NewDeltaSignature will return the signature of value in blocks of blockSize
+func NewDeltaSignature(value string, blockSize int) *DeltaSignature {
+	signature := &DeltaSignature{BlockSize: blockSize}
+	for start := 0; start < len(value); start += blockSize {
+		end := start + blockSize
+		if end > len(value) {
+			end = len(value)
+		}
+		block := value[start:end]
+		strong := sha256.Sum256([]byte(block))
+		signature.Blocks = append(signature.Blocks, BlockSignature{Weak: newRollingChecksum(block).sum(), Strong: strong[:]})
+	}
+	return signature
+}
+
+// NewDelta will return the delta that makes value out of the value with
+// signature.  Blocks of value found anywhere in the old value are copied,
+// found by sliding a rolling checksum over value.
+func NewDelta(signature *DeltaSignature, value string) *Delta {
+	size := signature.BlockSize
+	delta := &Delta{BlockSize: size, Hash: NewHash(value)}
+	blocks := make(map[uint32][]int, len(signature.Blocks))
+	for i, block := range signature.Blocks {
+		blocks[block.Weak] = append(blocks[block.Weak], i)
+	}
+
+	// match will return the block of the old value equal to value[start:end]
+	match := func(weak uint32, start, end int) int {
+		candidates, ok := blocks[weak]
+		if !ok {
+			return -1
+		}
+		strong := sha256.Sum256([]byte(value[start:end]))
+		for _, i := range candidates {
+			if bytes.Equal(signature.Blocks[i].Strong, strong[:]) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	var literal strings.Builder
+	flush := func() {
+		if literal.Len() > 0 {
+			delta.Ops = append(delta.Ops, DeltaOp{Block: -1, Data: literal.String()})
+			literal.Reset()
+		}
+	}
+
+	start := 0
+	var checksum *rollingChecksum
+	for start+size <= len(value) {
+		if checksum == nil {
+			checksum = newRollingChecksum(value[start : start+size])
+		}
+		if block := match(checksum.sum(), start, start+size); block >= 0 {
+			flush()
+			delta.Ops = append(delta.Ops, DeltaOp{Block: block})
+			start += size
+			checksum = nil
+			continue
+		}
+
+		literal.WriteByte(value[start])
+		if start+size < len(value) {
+			checksum.roll(value[start], value[start+size])
+		}
+		start++
+	}
+
+	// The tail may be the short last block of the old value
+	if tail := value[start:]; len(tail) > 0 {
+		last := len(signature.Blocks) - 1
+		if last >= 0 && match(newRollingChecksum(tail).sum(), start, len(value)) == last {
+			flush()
+			delta.Ops = append(delta.Ops, DeltaOp{Block: last})
+		} else {
+			literal.WriteString(tail)
+		}
+	}
+	flush()
+	return delta
+}
+
+// ApplyDelta will return the value delta makes out of old.  It fails with
+// ErrorDeltaMismatch if delta was not made for old.
+func ApplyDelta(old string, delta *Delta) (string, error) {
+	var value strings.Builder
+	for _, op := range delta.Ops {
+		if op.Block < 0 {
+			value.WriteString(op.Data)
+			continue
+		}
+
+		start := op.Block * delta.BlockSize
+		if delta.BlockSize <= 0 || start >= len(old) {
+			return "", ErrorDeltaMismatch
+		}
+		end := start + delta.BlockSize
+		if end > len(old) {
+			end = len(old)
+		}
+		value.WriteString(old[start:end])
+	}
+
+	if !bytes.Equal(NewHash(value.String()), delta.Hash) {
+		return "", ErrorDeltaMismatch
+	}
+	return value.String(), nil
+}
+
+// Size will return the number of bytes of value the delta inserts
+func (d *Delta) Size() int {
+	size := 0
+	for _, op := range d.Ops {
+		size += len(op.Data)
+	}
+	return size
+}
+
+// rollingChecksum is the weak checksum of rsync over a window of a value,
+// which can be moved along the value a byte at a time
+type rollingChecksum struct {
+	a, b uint32
+	size uint32
+}
+
+func newRollingChecksum(window string) *rollingChecksum {
+	c := &rollingChecksum{size: uint32(len(window))}
+	for i := 0; i < len(window); i++ {
+		c.a += uint32(window[i])
+		c.b += uint32(len(window)-i) * uint32(window[i])
+	}
+	return c
+}
+
+// roll will move the window past out, and on to in
+func (c *rollingChecksum) roll(out, in byte) {
+	c.a = c.a - uint32(out) + uint32(in)
+	c.b = c.b - c.size*uint32(out) + c.a
+}
+
+func (c *rollingChecksum) sum() uint32 {
+	return c.a&0xffff | c.b<<16
+}
+
+// setValue will set the object.  If store can patch values and has a
+// version of the object, only the blocks of the value that changed are sent.
+func setValue(ctx context.Context, store Storage, object *GenericObject) error {
+	deltas, ok := store.(DeltaStorage)
+	if !ok || len(object.Value) < 2*deltaBlockSize {
+		return store.Set(ctx, object)
+	}
+
+	signature, err := deltas.DeltaSignature(ctx, object.ID, deltaBlockSize)
+	if err != nil {
+		if IsNotFoundError(err) {
+			return store.Set(ctx, object)
+		}
+		return err
+	}
+
+	patched := *object
+	patched.Value = ""
+	err = deltas.Patch(ctx, &patched, NewDelta(signature, object.Value))
+	if err == ErrorDeltaMismatch {
+		return store.Set(ctx, object)
+	}
+	if err != nil {
+		return err
+	}
+	object.Hash = patched.Hash
+	object.VersionHash = patched.VersionHash
+	return nil
+}
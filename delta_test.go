@@ -0,0 +1,141 @@
+package objectsync
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Check the interfaces
+var _ DeltaStorage = &patchingStorage{}
+
+// patchingStorage can be patched, and counts the bytes of values set whole
+// and patched
+type patchingStorage struct {
+	*InMemoryStorage
+	set, patched int
+}
+
+func (s *patchingStorage) DeltaSignature(ctx context.Context, id string, blockSize int) (*DeltaSignature, error) {
+	object, err := s.InMemoryStorage.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return NewDeltaSignature(object.Value, blockSize), nil
+}
+
+func (s *patchingStorage) Set(ctx context.Context, object *GenericObject) error {
+	s.set += len(object.Value)
+	return s.InMemoryStorage.Set(ctx, object)
+}
+
+func (s *patchingStorage) Patch(ctx context.Context, object *GenericObject, delta *Delta) error {
+	s.patched += delta.Size()
+	current, err := s.InMemoryStorage.Get(ctx, object.ID)
+	if err != nil {
+		return ErrorDeltaMismatch
+	}
+
+	value, err := ApplyDelta(current.Value, delta)
+	if err != nil {
+		return err
+	}
+	object.Value = value
+	return s.InMemoryStorage.Set(ctx, object)
+}
+
+func randomValue(random *rand.Rand, size int) string {
+	value := make([]byte, size)
+	random.Read(value)
+	return string(value)
+}
+
+func TestDelta(t *testing.T) {
+
+	ctx := context.TODO()
+	random := rand.New(rand.NewSource(1))
+	old := randomValue(random, 10000)
+
+	t.Run("Apply", func(t *testing.T) {
+		tests := map[string]string{
+			"Same":     old,
+			"Modified": old[:3000] + "changed" + old[3007:],
+			"Inserted": old[:5000] + "inserted" + old[5000:],
+			"Deleted":  old[:100] + old[2000:],
+			"Moved":    old[5120:] + old[:5120],
+			"Appended": old + "appended",
+			"Short":    old[:1500],
+			"Empty":    "",
+			"New":      randomValue(random, 3000),
+		}
+		signature := NewDeltaSignature(old, 512)
+		for name, value := range tests {
+			delta := NewDelta(signature, value)
+			got, err := ApplyDelta(old, delta)
+			if err != nil {
+				t.Fatalf("Error for %s: %v", name, err)
+			}
+			if got != value {
+				t.Errorf("Unexpected value for %s", name)
+			}
+		}
+
+		if size := NewDelta(signature, tests["Inserted"]).Size(); size > 512+8 {
+			t.Errorf("Unexpected delta size = %v", size)
+		}
+		// Only the short last block of the old value is not found when moved
+		if size := NewDelta(signature, tests["Moved"]).Size(); size != len(old)%512 {
+			t.Errorf("Unexpected delta size = %v", size)
+		}
+
+		_, err := ApplyDelta(old[1:], NewDelta(signature, tests["Modified"]))
+		if err != ErrorDeltaMismatch {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		store1 := NewInMemoryStorage("local")
+		store2 := &patchingStorage{InMemoryStorage: NewInMemoryStorage("remote")}
+		status := NewInMemoryStatusStorage()
+
+		store1.Set(ctx, &GenericObject{ID: "large", Value: old, Modified: time.Now().UTC()})
+		store1.Set(ctx, &GenericObject{ID: "small", Value: "small", Modified: time.Now().UTC()})
+		err := Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if store2.set != len(old)+len("small") || store2.patched != 0 {
+			t.Errorf("Unexpected bytes = %v set and %v patched", store2.set, store2.patched)
+		}
+
+		changed := strings.Replace(old, old[6000:6010], "0123456789", 1)
+		store1.Set(ctx, &GenericObject{ID: "large", Value: changed, Modified: time.Now().UTC()})
+		store2.set = 0
+		err = Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if store2.set != 0 || store2.patched > deltaBlockSize {
+			t.Errorf("Unexpected bytes = %v set and %v patched", store2.set, store2.patched)
+		}
+		object, err := store2.Get(ctx, "large")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != changed {
+			t.Errorf("Unexpected value")
+		}
+
+		// Nothing changed, so nothing is written
+		err = Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if store2.set != 0 || store2.patched > deltaBlockSize {
+			t.Errorf("Unexpected bytes = %v set and %v patched", store2.set, store2.patched)
+		}
+	})
+}
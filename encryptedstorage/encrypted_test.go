@@ -0,0 +1,295 @@
+package encryptedstorage
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keithballdotnet/objectsync"
+	"github.com/keithballdotnet/objectsync/httpstorage"
+)
+
+// Check the interfaces
+var _ objectsync.Storage = &EncryptedStorage{}
+var _ objectsync.Lister = &EncryptedStorage{}
+
+// countingStorage counts the objects set
+type countingStorage struct {
+	*objectsync.InMemoryStorage
+	sets int
+}
+
+func (s *countingStorage) Set(ctx context.Context, object *objectsync.GenericObject) error {
+	s.sets++
+	return s.InMemoryStorage.Set(ctx, object)
+}
+
+func key(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func TestEncryptedStorage(t *testing.T) {
+
+	ctx := context.TODO()
+	values := map[string]string{
+		"a": "secret value",
+		"b": strings.Repeat("secret ", 1000),
+		"c": "",
+	}
+
+	for _, c := range []byte{CipherAESGCM, CipherXChaCha20Poly1305} {
+		t.Run("SetGet "+string(c), func(t *testing.T) {
+			inner := objectsync.NewInMemoryStorage("remote")
+			store, err := NewEncryptedStorage(inner, &Keyring{HashKey: key(0), Keys: [][]byte{key(1)}}, WithCipher(c))
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+
+			for id, value := range values {
+				object := &objectsync.GenericObject{ID: id, Value: value, Modified: time.Now().UTC()}
+				err = store.Set(ctx, object)
+				if err != nil {
+					t.Fatalf("Error: %v", err)
+				}
+				if string(object.Hash) != string(store.hash(value)) {
+					t.Errorf("Unexpected hash for [%s]", id)
+				}
+
+				stored, err := inner.Get(ctx, id)
+				if err != nil {
+					t.Fatalf("Error: %v", err)
+				}
+				if value != "" && strings.Contains(stored.Value, value) {
+					t.Errorf("Plaintext of [%s] is stored", id)
+				}
+				if stored.Value[len(magic)] != c {
+					t.Errorf("Unexpected cipher for [%s] = %q", id, stored.Value[len(magic)])
+				}
+			}
+
+			for id, value := range values {
+				object, err := store.Get(ctx, id)
+				if err != nil {
+					t.Fatalf("Error: %v", err)
+				}
+				if object.Value != value || string(object.Hash) != string(store.hash(value)) {
+					t.Errorf("Unexpected object [%s]", id)
+				}
+			}
+
+			// Writing the same value again gives the same hash
+			object := &objectsync.GenericObject{ID: "a", Value: values["a"], Modified: time.Now().UTC()}
+			store.Set(ctx, object)
+			if string(object.Hash) != string(store.hash(values["a"])) {
+				t.Errorf("Unstable hash")
+			}
+
+			listed, err := store.List(ctx)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if len(listed) != 3 {
+				t.Fatalf("Incorrect len = %v, want 3", len(listed))
+			}
+			for _, object := range listed {
+				if object.Value != "" || string(object.Hash) != string(store.hash(values[object.ID])) {
+					t.Errorf("Unexpected listed [%s]", object.ID)
+				}
+			}
+		})
+	}
+
+	t.Run("EncryptedIDs", func(t *testing.T) {
+		inner := objectsync.NewInMemoryStorage("remote")
+		keyring := &Keyring{HashKey: key(0), Keys: [][]byte{key(1)}}
+		store, err := NewEncryptedStorage(inner, keyring, WithEncryptedIDs())
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "private/name", Value: "value", Modified: time.Now().UTC()})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		all, _ := inner.GetAll(ctx)
+		if len(all) != 1 || strings.Contains(all[0].ID, "private") {
+			t.Fatalf("Unexpected stored objects = %+v", all)
+		}
+
+		// The stored ID is the same with another instance
+		other, _ := NewEncryptedStorage(inner, keyring, WithEncryptedIDs())
+		object, err := other.Get(ctx, "private/name")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.ID != "private/name" || object.Value != "value" {
+			t.Errorf("Unexpected object = %+v", object)
+		}
+		listed, err := other.List(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(listed) != 1 || listed[0].ID != "private/name" {
+			t.Errorf("Unexpected listed = %+v", listed)
+		}
+
+		err = other.Delete(ctx, "private/name")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		all, _ = inner.GetAll(ctx)
+		if len(all) != 0 {
+			t.Errorf("Unexpected stored objects = %v", len(all))
+		}
+	})
+
+	t.Run("Rotate", func(t *testing.T) {
+		inner := objectsync.NewInMemoryStorage("remote")
+		old, err := NewEncryptedStorage(inner, &Keyring{HashKey: key(0), Keys: [][]byte{key(1)}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		for id, value := range values {
+			old.Set(ctx, &objectsync.GenericObject{ID: id, Value: value, Modified: time.Now().UTC()})
+		}
+
+		rotating, err := NewEncryptedStorage(inner, &Keyring{HashKey: key(0), Keys: [][]byte{key(1), key(2)}}, WithCipher(CipherXChaCha20Poly1305))
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = rotating.Rotate(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// The old key can be dropped once rotated
+		rotated, err := NewEncryptedStorage(inner, &Keyring{HashKey: key(0), Keys: [][]byte{key(2)}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		for id, value := range values {
+			object, err := rotated.Get(ctx, id)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if object.Value != value || string(object.Hash) != string(old.hash(value)) {
+				t.Errorf("Unexpected object [%s]", id)
+			}
+		}
+
+		// Values are not read without their key
+		_, err = old.Get(ctx, "a")
+		if err != ErrorDecrypt {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		inner := objectsync.NewInMemoryStorage("remote")
+		store, _ := NewEncryptedStorage(inner, &Keyring{HashKey: key(0), Keys: [][]byte{key(1)}})
+		store.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "value a", Modified: time.Now().UTC()})
+		store.Set(ctx, &objectsync.GenericObject{ID: "b", Value: "value b", Modified: time.Now().UTC()})
+
+		// A value moved to another ID
+		a, _ := inner.Get(ctx, "a")
+		inner.Set(ctx, &objectsync.GenericObject{ID: "b", Value: a.Value, Modified: a.Modified})
+		_, err := store.Get(ctx, "b")
+		if err != ErrorDecrypt {
+			t.Errorf("Unexpected error = %v", err)
+		}
+
+		// A flipped byte
+		value := []byte(a.Value)
+		value[len(value)-1] ^= 1
+		inner.Set(ctx, &objectsync.GenericObject{ID: "a", Value: string(value), Modified: a.Modified})
+		_, err = store.Get(ctx, "a")
+		if err != ErrorDecrypt {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+
+	t.Run("HTTP", func(t *testing.T) {
+		server := httptest.NewServer(httpstorage.NewHandler(objectsync.NewInMemoryStorage("remote")))
+		t.Cleanup(server.Close)
+		inner, err := httpstorage.NewHTTPStorage(server.Client(), server.URL)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		store, err := NewEncryptedStorage(inner, &Keyring{HashKey: key(0), Keys: [][]byte{key(1)}}, WithEncryptedIDs())
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// Sealed values are not valid UTF-8, and must come back intact
+		for id, value := range values {
+			err = store.Set(ctx, &objectsync.GenericObject{ID: id, Value: value, Modified: time.Now().UTC()})
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+		}
+		all, err := store.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != len(values) {
+			t.Fatalf("Incorrect len = %v, want %v", len(all), len(values))
+		}
+		for _, object := range all {
+			if object.Value != values[object.ID] {
+				t.Errorf("Unexpected value of [%s]", object.ID)
+			}
+		}
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		store1 := objectsync.NewInMemoryStorage("local")
+		inner := &countingStorage{InMemoryStorage: objectsync.NewInMemoryStorage("remote")}
+		status := objectsync.NewInMemoryStatusStorage()
+		store2, err := NewEncryptedStorage(inner, &Keyring{HashKey: key(0), Keys: [][]byte{key(1)}}, WithEncryptedIDs())
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		for id, value := range values {
+			store1.Set(ctx, &objectsync.GenericObject{ID: id, Value: value, Modified: time.Now().UTC()})
+		}
+
+		err = objectsync.Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// Rotating changes nothing to sync
+		store3, err := NewEncryptedStorage(inner, &Keyring{HashKey: key(0), Keys: [][]byte{key(1), key(2)}}, WithEncryptedIDs())
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = store3.Rotate(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		inner.sets = 0
+		err = objectsync.Sync(ctx, store1, store3, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if inner.sets != 0 {
+			t.Errorf("Unexpected sets = %v", inner.sets)
+		}
+
+		store3.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "changed", Modified: time.Now().UTC()})
+		err = objectsync.Sync(ctx, store1, store3, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		object, err := store1.Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != "changed" {
+			t.Errorf("Unexpected value = %s", object.Value)
+		}
+	})
+}
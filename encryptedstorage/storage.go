@@ -0,0 +1,369 @@
+// Package encryptedstorage implements an objectsync storage that encrypts
+// the objects it keeps in another storage, so they can be synced to storage
+// that is not trusted.
+package encryptedstorage
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/keithballdotnet/objectsync"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// magic starts every value written
+const magic = "\x00ose"
+
+// Ciphers of the values, as marked in the header
+const (
+	CipherAESGCM            = 'a'
+	CipherXChaCha20Poly1305 = 'x'
+)
+
+// keyIDSize is the size of the fingerprint of the key of a value
+const keyIDSize = 4
+
+// headerSize is the size of the magic, the cipher, the key fingerprint and
+// the keyed hash of the plaintext
+const headerSize = len(magic) + 1 + keyIDSize + sha256.Size
+
+// idPrefix starts the encrypted IDs
+const idPrefix = "e"
+
+// ErrorDecrypt is returned when a value or ID can not be decrypted, as it
+// was tampered with or its key is not in the Keyring
+var ErrorDecrypt = errors.New("can not decrypt")
+
+// Keyring holds the keys of an EncryptedStorage.
+//
+// HashKey keys the hashes of the values, and the encryption of the IDs.  It
+// must not change, or all objects would look changed to Sync.  Keys encrypt
+// the values.  The last is used for writing, and the others let values
+// written before a rotation be read until they are rotated.  Keys must be 32
+// bytes long.
+type Keyring struct {
+	HashKey []byte
+	Keys    [][]byte
+}
+
+// Option configures an EncryptedStorage
+type Option func(*EncryptedStorage)
+
+// WithCipher will set the cipher values are encrypted with, CipherAESGCM by
+// default.  Values are read whatever cipher they were written with.
+func WithCipher(c byte) Option {
+	return func(s *EncryptedStorage) {
+		s.cipher = c
+	}
+}
+
+// WithEncryptedIDs will encrypt the IDs too.  They are encrypted
+// deterministically under the HashKey, so objects can be found by ID, but
+// the storage only learns which IDs are the same.
+func WithEncryptedIDs() Option {
+	return func(s *EncryptedStorage) {
+		s.encryptIDs = true
+	}
+}
+
+// EncryptedStorage is an objectsync.Storage that encrypts values before
+// keeping them in another storage.
+//
+// Each value is sealed with an AEAD bound to the ID of its object, after a
+// header with the cipher, the fingerprint of its key and an HMAC-SHA256 of
+// the plaintext under the HashKey.  The HMAC is the Hash of the object, so it
+// stays the same when keys are rotated, and objects are listed without
+// decrypting them.  Modified and Version are kept in the clear.  Sealed
+// values are binary, so the other storage must keep values as bytes, as
+// sqlstorage and httpstorage do.
+type EncryptedStorage struct {
+	store      objectsync.Storage
+	cipher     byte
+	encryptIDs bool
+
+	hashKey []byte
+	// idKey makes the nonces of IDs, which idAEAD encrypts
+	idKey  []byte
+	idAEAD cipher.AEAD
+	// current is the fingerprint of the key values are written with
+	current string
+	keys    map[string][]byte
+}
+
+// NewEncryptedStorage will return an EncryptedStorage keeping its objects in
+// store, with the keys of keyring
+func NewEncryptedStorage(store objectsync.Storage, keyring *Keyring, opts ...Option) (*EncryptedStorage, error) {
+	if len(keyring.HashKey) == 0 || len(keyring.Keys) == 0 {
+		return nil, errors.New("keyring needs a hash key and a key")
+	}
+
+	s := &EncryptedStorage{
+		store:   store,
+		cipher:  CipherAESGCM,
+		hashKey: derive(keyring.HashKey, "hash"),
+		idKey:   derive(keyring.HashKey, "id nonce"),
+		keys:    make(map[string][]byte),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.cipher != CipherAESGCM && s.cipher != CipherXChaCha20Poly1305 {
+		return nil, fmt.Errorf("unknown cipher %q", s.cipher)
+	}
+
+	for _, key := range keyring.Keys {
+		if len(key) != 32 {
+			return nil, errors.New("keys must be 32 bytes long")
+		}
+		s.current = fingerprint(key)
+		s.keys[s.current] = key
+	}
+
+	var err error
+	s.idAEAD, err = newAEAD(CipherAESGCM, derive(keyring.HashKey, "id"))
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetName ...
+func (s *EncryptedStorage) GetName() string {
+	return s.store.GetName()
+}
+
+// Set will encrypt the object, and set it in the storage
+func (s *EncryptedStorage) Set(ctx context.Context, object *objectsync.GenericObject) error {
+	hash := s.hash(object.Value)
+	value, err := s.seal(object.ID, object.Value, hash)
+	if err != nil {
+		return err
+	}
+
+	stored := *object
+	stored.ID = s.storedID(object.ID)
+	stored.Value = value
+	// The version was assigned to the plaintext, so give it its keyed hash
+	// rather than leak the plain one
+	if bytes.Equal(object.VersionHash, objectsync.NewHash(object.Value)) {
+		stored.VersionHash = hash
+	}
+	err = s.store.Set(ctx, &stored)
+	if err != nil {
+		return err
+	}
+
+	object.Hash = hash
+	object.VersionHash = stored.VersionHash
+	return nil
+}
+
+// Get ...
+func (s *EncryptedStorage) Get(ctx context.Context, id string) (*objectsync.GenericObject, error) {
+	stored, err := s.store.Get(ctx, s.storedID(id))
+	if err != nil {
+		return nil, err
+	}
+	return s.open(stored, true)
+}
+
+// GetAll will return all objects
+func (s *EncryptedStorage) GetAll(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	return s.all(ctx, true)
+}
+
+// List will return all objects without decrypting their values
+func (s *EncryptedStorage) List(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	return s.all(ctx, false)
+}
+
+// Delete will remove a entry from the storage
+func (s *EncryptedStorage) Delete(ctx context.Context, id string) error {
+	return s.store.Delete(ctx, s.storedID(id))
+}
+
+// Rotate will encrypt the values not written with the last key of the
+// Keyring again with it.  Their hashes do not change, so Sync sees no
+// change.  Once rotated, earlier keys can be dropped.
+func (s *EncryptedStorage) Rotate(ctx context.Context) error {
+	all, err := s.store.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, stored := range all {
+		if len(stored.Value) >= headerSize && stored.Value[len(magic)+1:len(magic)+1+keyIDSize] == s.current {
+			continue
+		}
+
+		object, err := s.open(stored, true)
+		if err != nil {
+			return err
+		}
+		value, err := s.seal(object.ID, object.Value, object.Hash)
+		if err != nil {
+			return err
+		}
+		rotated := *stored
+		rotated.Value = value
+		err = s.store.Set(ctx, &rotated)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *EncryptedStorage) all(ctx context.Context, values bool) (objectsync.GenericObjectCollection, error) {
+	all, err := s.store.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make(objectsync.GenericObjectCollection, len(all))
+	for i, stored := range all {
+		objects[i], err = s.open(stored, values)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return objects, nil
+}
+
+// hash will return the keyed hash of the plaintext
+func (s *EncryptedStorage) hash(value string) objectsync.Hash {
+	mac := hmac.New(sha256.New, s.hashKey)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// seal will return the header and the value encrypted with the current key
+func (s *EncryptedStorage) seal(id, value string, hash objectsync.Hash) (string, error) {
+	aead, err := newAEAD(s.cipher, s.keys[s.current])
+	if err != nil {
+		return "", err
+	}
+
+	header := magic + string(s.cipher) + s.current + string(hash)
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), additionalData(id, header))
+	return header + string(sealed), nil
+}
+
+// open will return the object of the one stored, with the ID and hash of the
+// plaintext, and the plaintext itself if value is true
+func (s *EncryptedStorage) open(stored *objectsync.GenericObject, value bool) (*objectsync.GenericObject, error) {
+	id, err := s.plainID(stored.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(stored.Value, magic) || len(stored.Value) < headerSize {
+		return nil, fmt.Errorf("value of [%s] is not encrypted", id)
+	}
+
+	object := *stored
+	object.ID = id
+	object.Value = ""
+	object.Hash = objectsync.Hash(stored.Value[headerSize-sha256.Size : headerSize])
+	if !value {
+		return &object, nil
+	}
+
+	header := stored.Value[:headerSize]
+	key, ok := s.keys[header[len(magic)+1:len(magic)+1+keyIDSize]]
+	if !ok {
+		return nil, ErrorDecrypt
+	}
+	aead, err := newAEAD(header[len(magic)], key)
+	if err != nil {
+		return nil, err
+	}
+	sealed := stored.Value[headerSize:]
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrorDecrypt
+	}
+	plaintext, err := aead.Open(nil, []byte(sealed[:aead.NonceSize()]), []byte(sealed[aead.NonceSize():]), additionalData(id, header))
+	if err != nil {
+		return nil, ErrorDecrypt
+	}
+	object.Value = string(plaintext)
+	return &object, nil
+}
+
+// storedID will return the ID the object with id is stored under.  An
+// encrypted ID has a nonce made from the ID, so it is the same every time.
+func (s *EncryptedStorage) storedID(id string) string {
+	if !s.encryptIDs {
+		return id
+	}
+
+	mac := hmac.New(sha256.New, s.idKey)
+	mac.Write([]byte(id))
+	nonce := mac.Sum(nil)[:s.idAEAD.NonceSize()]
+	sealed := s.idAEAD.Seal(nonce, nonce, []byte(id), nil)
+	return idPrefix + base64.RawURLEncoding.EncodeToString(sealed)
+}
+
+// plainID will return the ID of the object stored under id
+func (s *EncryptedStorage) plainID(id string) (string, error) {
+	if !s.encryptIDs {
+		return id, nil
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(id, idPrefix))
+	if err != nil || !strings.HasPrefix(id, idPrefix) || len(sealed) < s.idAEAD.NonceSize() {
+		return "", ErrorDecrypt
+	}
+	nonce := sealed[:s.idAEAD.NonceSize()]
+	plain, err := s.idAEAD.Open(nil, nonce, sealed[len(nonce):], nil)
+	if err != nil {
+		return "", ErrorDecrypt
+	}
+	return string(plain), nil
+}
+
+// additionalData binds a value to its ID and header, so neither can be
+// swapped
+func additionalData(id, header string) []byte {
+	return []byte(header + id)
+}
+
+func newAEAD(c byte, key []byte) (cipher.AEAD, error) {
+	switch c {
+	case CipherAESGCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case CipherXChaCha20Poly1305:
+		return chacha20poly1305.NewX(key)
+	}
+	return nil, fmt.Errorf("unknown cipher %q", c)
+}
+
+// derive will return a key for purpose derived from key
+func derive(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("objectsync " + purpose))
+	return mac.Sum(nil)
+}
+
+// fingerprint will return the fingerprint of a key marking the values it
+// encrypted
+func fingerprint(key []byte) string {
+	return string(derive(key, "fingerprint")[:keyIDSize])
+}
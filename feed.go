@@ -0,0 +1,190 @@
+package objectsync
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrorTokenExpired is returned by a ChangeFeed when it can no longer tell
+// what changed since a token
+var ErrorTokenExpired = errors.New("token expired")
+
+// ChangeSet is what changed in a storage since a token
+type ChangeSet struct {
+	// Changed are the objects created or modified, without their values
+	Changed GenericObjectCollection
+	// Deleted are the IDs of the objects deleted
+	Deleted []string
+	// Token is the token to pass to get the changes after these
+	Token string
+}
+
+// ChangeFeed is implemented by a Storage that can tell what changed since an
+// opaque token.  When both storages implement it and the StatusStorage keeps
+// tokens, Sync only reads the objects changed since the last sync.
+type ChangeFeed interface {
+	// Changes will return what changed since the token, or all objects if
+	// the token is empty.  Each ID is either changed or deleted.  It fails
+	// with ErrorTokenExpired if the token is too old.
+	Changes(ctx context.Context, since string) (*ChangeSet, error)
+}
+
+// TokenStorage is implemented by a StatusStorage that keeps the tokens of
+// the ChangeFeed of each side along with the status
+type TokenStorage interface {
+	GetToken(ctx context.Context, side string) (string, error)
+	SetToken(ctx context.Context, side, token string) error
+}
+
+// Sides of a sync, as the tokens are kept
+const (
+	SideLocal  = "local"
+	SideRemote = "remote"
+)
+
+// feedTokens are the tokens to keep once a sync is done
+type feedTokens struct {
+	local, remote string
+}
+
+// feedObjects will read the objects changed in either storage since the
+// tokens kept, along with the IDs considered.  If a token is missing or has
+// expired, all objects of both storages are read instead, and the IDs are
+// nil.
+func feedObjects(ctx context.Context, local, remote Storage, tokens TokenStorage) (localSet, remoteSet GenericObjectCollection, ids map[string]bool, next *feedTokens, err error) {
+	localChanges, err := feedChanges(ctx, local.(ChangeFeed), tokens, SideLocal)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	remoteChanges, err := feedChanges(ctx, remote.(ChangeFeed), tokens, SideRemote)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	next = &feedTokens{local: localChanges.Token, remote: remoteChanges.Token}
+
+	// Both sides must be read whole if either is
+	if localChanges.full || remoteChanges.full {
+		if !localChanges.full {
+			localChanges, err = feedChanges(ctx, local.(ChangeFeed), nil, SideLocal)
+			if err != nil {
+				return nil, nil, nil, nil, err
+			}
+			next.local = localChanges.Token
+		}
+		if !remoteChanges.full {
+			remoteChanges, err = feedChanges(ctx, remote.(ChangeFeed), nil, SideRemote)
+			if err != nil {
+				return nil, nil, nil, nil, err
+			}
+			next.remote = remoteChanges.Token
+		}
+		return localChanges.sourced(local), remoteChanges.sourced(remote), nil, next, nil
+	}
+
+	ids = make(map[string]bool)
+	for _, changes := range []*feedChangeSet{localChanges, remoteChanges} {
+		for _, object := range changes.Changed {
+			ids[object.ID] = true
+		}
+		for _, id := range changes.Deleted {
+			ids[id] = true
+		}
+	}
+
+	localSet, err = localChanges.objects(ctx, local, ids)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	remoteSet, err = remoteChanges.objects(ctx, remote, ids)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return localSet, remoteSet, ids, next, nil
+}
+
+// feedChangeSet is a ChangeSet, and whether it holds all objects
+type feedChangeSet struct {
+	*ChangeSet
+	full bool
+}
+
+// feedChanges will return the changes of feed since the token kept for side,
+// or all its objects if there is none or it has expired
+func feedChanges(ctx context.Context, feed ChangeFeed, tokens TokenStorage, side string) (*feedChangeSet, error) {
+	token := ""
+	if tokens != nil {
+		kept, err := tokens.GetToken(ctx, side)
+		found, err := wasFound(err)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			token = kept
+		}
+	}
+
+	if token != "" {
+		changes, err := feed.Changes(ctx, token)
+		if err == nil {
+			return &feedChangeSet{ChangeSet: changes}, nil
+		}
+		if err != ErrorTokenExpired {
+			return nil, err
+		}
+	}
+
+	changes, err := feed.Changes(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	return &feedChangeSet{ChangeSet: changes, full: true}, nil
+}
+
+// sourced will return the changed objects, to be read from store
+func (c *feedChangeSet) sourced(store Storage) GenericObjectCollection {
+	for _, object := range c.Changed {
+		object.source = store
+	}
+	return c.Changed
+}
+
+// objects will return the objects with ids in store.  The ones not in the
+// changes have not changed, and are read from store.
+func (c *feedChangeSet) objects(ctx context.Context, store Storage, ids map[string]bool) (GenericObjectCollection, error) {
+	objects := c.sourced(store)
+	seen := make(map[string]bool, len(ids))
+	for _, object := range c.Changed {
+		seen[object.ID] = true
+	}
+	for _, id := range c.Deleted {
+		seen[id] = true
+	}
+
+	for id := range ids {
+		if seen[id] {
+			continue
+		}
+		object, err := store.Get(ctx, id)
+		if err != nil {
+			if IsNotFoundError(err) {
+				continue
+			}
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+// saveTokens will keep the tokens for the next sync
+func saveTokens(ctx context.Context, status StatusStorage, next *feedTokens) error {
+	if next == nil {
+		return nil
+	}
+	tokens := status.(TokenStorage)
+	err := tokens.SetToken(ctx, SideLocal, next.local)
+	if err != nil {
+		return err
+	}
+	return tokens.SetToken(ctx, SideRemote, next.remote)
+}
@@ -0,0 +1,228 @@
+package objectsync
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Check the interfaces
+var _ ChangeFeed = &feedStorage{}
+var _ TokenStorage = &tokenStatusStorage{}
+
+// feedStorage serves a change feed of a storage, and counts the objects read
+// from it.  seq counts the changes, and changed is the last change per ID.
+// Tokens before expired can no longer be served, as deletions were forgotten.
+type feedStorage struct {
+	*InMemoryTombstoneStorage
+	seq     uint64
+	changed map[string]uint64
+	expired uint64
+	gets    int
+}
+
+func newFeedStorage(name string) *feedStorage {
+	return &feedStorage{InMemoryTombstoneStorage: NewInMemoryTombstoneStorage(name), changed: make(map[string]uint64)}
+}
+
+func (s *feedStorage) Get(ctx context.Context, id string) (*GenericObject, error) {
+	s.gets++
+	return s.InMemoryTombstoneStorage.Get(ctx, id)
+}
+
+func (s *feedStorage) Set(ctx context.Context, object *GenericObject) error {
+	s.change(object.ID)
+	return s.InMemoryTombstoneStorage.Set(ctx, object)
+}
+
+func (s *feedStorage) Delete(ctx context.Context, id string) error {
+	if _, ok := s.idIndex[id]; ok {
+		s.change(id)
+	}
+	return s.InMemoryTombstoneStorage.Delete(ctx, id)
+}
+
+func (s *feedStorage) SetTombstone(ctx context.Context, tombstone *Tombstone) error {
+	if _, ok := s.idIndex[tombstone.ID]; ok {
+		s.change(tombstone.ID)
+	}
+	return s.InMemoryTombstoneStorage.SetTombstone(ctx, tombstone)
+}
+
+// DeleteTombstone will forget the deletion, so tokens from before it expire
+func (s *feedStorage) DeleteTombstone(ctx context.Context, id string) error {
+	if _, ok := s.tombstones[id]; !ok {
+		return nil
+	}
+
+	if seq := s.changed[id]; seq > s.expired {
+		s.expired = seq
+	}
+	delete(s.changed, id)
+	return s.InMemoryTombstoneStorage.DeleteTombstone(ctx, id)
+}
+
+func (s *feedStorage) Changes(ctx context.Context, since string) (*ChangeSet, error) {
+	changes := &ChangeSet{Changed: GenericObjectCollection{}, Token: strconv.FormatUint(s.seq, 10)}
+	var after uint64
+	if since != "" {
+		var err error
+		after, err = strconv.ParseUint(since, 10, 64)
+		if err != nil || after < s.expired || after > s.seq {
+			return nil, ErrorTokenExpired
+		}
+	}
+
+	for id, seq := range s.changed {
+		if since != "" && seq <= after {
+			continue
+		}
+		object, ok := s.idIndex[id]
+		if !ok {
+			if since != "" {
+				changes.Deleted = append(changes.Deleted, id)
+			}
+			continue
+		}
+		listed := *object
+		listed.Value = ""
+		changes.Changed = append(changes.Changed, &listed)
+	}
+	return changes, nil
+}
+
+func (s *feedStorage) change(id string) {
+	s.seq++
+	s.changed[id] = s.seq
+}
+
+// tokenStatusStorage keeps the tokens of the change feeds with the status
+type tokenStatusStorage struct {
+	*InMemoryStatusStorage
+	tokens map[string]string
+}
+
+func (s *tokenStatusStorage) GetToken(ctx context.Context, side string) (string, error) {
+	token, ok := s.tokens[side]
+	if !ok {
+		return "", ErrorNotFound
+	}
+
+	return token, nil
+}
+
+func (s *tokenStatusStorage) SetToken(ctx context.Context, side, token string) error {
+	s.tokens[side] = token
+	return nil
+}
+
+func TestChangeFeed(t *testing.T) {
+
+	ctx := context.TODO()
+
+	t.Run("Changes", func(t *testing.T) {
+		store := newFeedStorage("local")
+		store.Set(ctx, &GenericObject{ID: "a", Value: "a"})
+		store.Set(ctx, &GenericObject{ID: "b", Value: "b"})
+
+		all, err := store.Changes(ctx, "")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all.Changed) != 2 || len(all.Deleted) != 0 || all.Changed[0].Value != "" {
+			t.Errorf("Unexpected changes = %+v", all)
+		}
+
+		store.Set(ctx, &GenericObject{ID: "a", Value: "changed"})
+		store.Delete(ctx, "b")
+		changes, err := store.Changes(ctx, all.Token)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(changes.Changed) != 1 || changes.Changed[0].ID != "a" || len(changes.Deleted) != 1 || changes.Deleted[0] != "b" {
+			t.Errorf("Unexpected changes = %+v", changes)
+		}
+
+		changes, err = store.Changes(ctx, changes.Token)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(changes.Changed) != 0 || len(changes.Deleted) != 0 {
+			t.Errorf("Unexpected changes = %+v", changes)
+		}
+
+		// The deletion is forgotten, so older tokens can not be served
+		store.DeleteTombstone(ctx, "b")
+		_, err = store.Changes(ctx, all.Token)
+		if err != ErrorTokenExpired {
+			t.Errorf("Unexpected error = %v", err)
+		}
+		_, err = store.Changes(ctx, changes.Token)
+		if err != nil {
+			t.Errorf("Unexpected error = %v", err)
+		}
+		_, err = store.Changes(ctx, "token")
+		if err != ErrorTokenExpired {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		store1 := newFeedStorage("local")
+		store2 := newFeedStorage("remote")
+		status := &tokenStatusStorage{InMemoryStatusStorage: NewInMemoryStatusStorage(), tokens: make(map[string]string)}
+		for i := 0; i < 1000; i++ {
+			store1.Set(ctx, &GenericObject{ID: fmt.Sprintf("object%v", i), Value: fmt.Sprintf("value%v", i), Modified: time.Now().UTC()})
+		}
+
+		// The second sync sees the writes of the first
+		for i := 0; i < 3; i++ {
+			err := Sync(ctx, store1, store2, status)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+		}
+
+		store1.Set(ctx, &GenericObject{ID: "object1", Value: "changed", Modified: time.Now().UTC()})
+		store2.Set(ctx, &GenericObject{ID: "new", Value: "new", Modified: time.Now().UTC()})
+		store1.gets, store2.gets = 0, 0
+		err := Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if store1.gets > 2 || store2.gets > 2 {
+			t.Errorf("Unexpected gets = %v and %v", store1.gets, store2.gets)
+		}
+		object, err := store2.Get(ctx, "object1")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != "changed" {
+			t.Errorf("Unexpected value = %s", object.Value)
+		}
+		_, err = store1.Get(ctx, "new")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// The token of store2 expires, so both sides are listed
+		store2.Delete(ctx, "object2")
+		store2.DeleteTombstone(ctx, "object2")
+		err = Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = store1.Get(ctx, "object2")
+		if err == nil || !IsNotFoundError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+		for _, store := range []*feedStorage{store1, store2} {
+			all, _ := store.GetAll(ctx)
+			if len(all) != 1000 {
+				t.Errorf("Incorrect len = %v, want 1000", len(all))
+			}
+		}
+	})
+}
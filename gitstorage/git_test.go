@@ -0,0 +1,314 @@
+package gitstorage
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/keithballdotnet/objectsync"
+)
+
+// Check the interfaces
+var _ objectsync.Storage = &GitStorage{}
+var _ objectsync.Lister = &GitStorage{}
+var _ objectsync.Committer = &GitStorage{}
+
+// commits will return the commits of the repository at dir, newest first
+func commits(t *testing.T, dir string) []*object.Commit {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	iter, err := repo.Log(&git.LogOptions{})
+	if err != nil {
+		return nil
+	}
+	all := []*object.Commit{}
+	iter.ForEach(func(c *object.Commit) error {
+		all = append(all, c)
+		return nil
+	})
+	return all
+}
+
+func TestGitStorage(t *testing.T) {
+
+	ctx := context.TODO()
+
+	for _, bare := range []bool{false, true} {
+		t.Run(fmt.Sprintf("SetGet/bare=%v", bare), func(t *testing.T) {
+			dir := t.TempDir()
+			_, err := git.PlainInit(dir, bare)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			store, err := OpenGitStorage(dir, WithAuthor("Sync", "sync@example.com"))
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+
+			for _, id := range []string{"a", "config/b.json", "config/nested/c"} {
+				object := &objectsync.GenericObject{ID: id, Value: "value " + id}
+				err = store.Set(ctx, object)
+				if err != nil {
+					t.Fatalf("Error: %v", err)
+				}
+				// The hash is the one git hash-object gives
+				if id == "a" && fmt.Sprintf("%x", []byte(object.Hash)) != "ba2023a0af8495477199cdf9119cc3d3ac9d5c6c" {
+					t.Errorf("Unexpected hash = %x", []byte(object.Hash))
+				}
+			}
+			err = store.Set(ctx, &objectsync.GenericObject{ID: "../escape", Value: "x"})
+			if err == nil {
+				t.Errorf("Expected error for ID outside the repository")
+			}
+
+			// Writes are seen before they are committed
+			object, err := store.Get(ctx, "config/b.json")
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if object.Value != "value config/b.json" {
+				t.Errorf("Unexpected value = %s", object.Value)
+			}
+
+			err = store.Commit(ctx)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			log := commits(t, dir)
+			if len(log) != 1 {
+				t.Fatalf("Incorrect commits = %v, want 1", len(log))
+			}
+			want := "Sync 3 objects\n\nset a\nset config/b.json\nset config/nested/c\n"
+			if log[0].Message != want || log[0].Author.Email != "sync@example.com" {
+				t.Errorf("Unexpected commit = %q by %s", log[0].Message, log[0].Author.Email)
+			}
+
+			err = store.Delete(ctx, "a")
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			err = store.Commit(ctx)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+
+			// Another storage on the repository sees the commits
+			store, err = OpenGitStorage(dir)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			all, err := store.List(ctx)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if len(all) != 2 {
+				t.Errorf("Incorrect len = %v, want 2", len(all))
+			}
+			_, err = store.Get(ctx, "a")
+			if !objectsync.IsNotFoundError(err) {
+				t.Errorf("Unexpected error = %v", err)
+			}
+
+			log = commits(t, dir)
+			if len(log) != 2 || log[0].Message != "Sync 1 objects\n\ndelete a\n" {
+				t.Errorf("Unexpected commits = %v", log)
+			}
+			tree, err := log[0].Tree()
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			_, err = tree.File("config/nested/c")
+			if err != nil {
+				t.Errorf("Error: %v", err)
+			}
+
+			// Nothing is committed without changes
+			err = store.Set(ctx, &objectsync.GenericObject{ID: "config/b.json", Value: "value config/b.json"})
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			err = store.Commit(ctx)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if len(commits(t, dir)) != 2 {
+				t.Errorf("Unexpected commit without changes")
+			}
+		})
+	}
+
+	t.Run("Worktree", func(t *testing.T) {
+		dir := t.TempDir()
+		repo, err := git.PlainInit(dir, false)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		store, err := OpenGitStorage(dir)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		modified := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+		object := &objectsync.GenericObject{ID: "a", Value: "a", Modified: modified, Version: objectsync.VersionVector{"local": 1}}
+		object.VersionHash = objectsync.NewHash(object.Value)
+		err = store.Set(ctx, object)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if string(object.VersionHash) != string(object.Hash) {
+			t.Errorf("Expected the version hash to be the blob hash")
+		}
+		err = store.Commit(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// Files edited but not committed are objects too
+		err = os.WriteFile(filepath.Join(dir, "b"), []byte("b"), 0600)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		all, err := store.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 2 {
+			t.Errorf("Incorrect len = %v, want 2", len(all))
+		}
+
+		got, err := store.Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if !got.Modified.Equal(modified) || got.Version["local"] != 1 {
+			t.Errorf("Unexpected object = %+v", got)
+		}
+
+		// Only the writes of the storage are committed
+		worktree, _ := repo.Worktree()
+		status, err := worktree.Status()
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(status) != 1 || status.File("b").Worktree != git.Untracked {
+			t.Errorf("Unexpected status = %v", status)
+		}
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		dir := t.TempDir()
+		_, err := git.PlainInit(dir, false)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		store1, err := OpenGitStorage(dir)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		store2 := objectsync.NewInMemoryStorage("remote")
+		status := objectsync.NewInMemoryStatusStorage()
+
+		for i := 0; i < 3; i++ {
+			store1.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("local%v", i), Value: "local", Modified: time.Now().UTC()})
+			store2.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("remote%v", i), Value: "remote", Modified: time.Now().UTC()})
+		}
+		store1.Commit(ctx)
+
+		opts := []objectsync.Option{objectsync.WithCausality("local", "remote")}
+		err = objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		store2.Set(ctx, &objectsync.GenericObject{ID: "local1", Value: "changed", Modified: time.Now().UTC()})
+		err = objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// One commit to start with, then one per sync with changes
+		log := commits(t, dir)
+		if len(log) != 3 {
+			t.Fatalf("Incorrect commits = %v, want 3", len(log))
+		}
+		if !strings.Contains(log[0].Message, "set local1\n") || strings.Contains(log[0].Message, "local0") {
+			t.Errorf("Unexpected message = %q", log[0].Message)
+		}
+		if !strings.Contains(log[1].Message, "set remote0\nset remote1\nset remote2\n") {
+			t.Errorf("Unexpected message = %q", log[1].Message)
+		}
+
+		object, err := store1.Get(ctx, "local1")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != "changed" {
+			t.Errorf("Unexpected value = %s", object.Value)
+		}
+	})
+
+	t.Run("Signed", func(t *testing.T) {
+		dir := t.TempDir()
+		_, err := git.PlainInit(dir, false)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		store, err := OpenGitStorage(dir)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		public, key, _ := ed25519.GenerateKey(nil)
+		modified := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+		signer := objectsync.NewSignedStorage(store, "local", key, nil)
+		err = signer.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "value", Modified: modified, Version: objectsync.VersionVector{"local": 1}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// The signature is kept, with the time it covers, so the object
+		// verifies when read again
+		verifier := func() *objectsync.SignedStorage {
+			reader, err := OpenGitStorage(dir)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			return objectsync.NewSignedStorage(reader, "remote", nil, map[string]ed25519.PublicKey{"local": public})
+		}
+		got, err := verifier().Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if got.Signature == nil || got.Signature.Replica != "local" || !got.Modified.Equal(modified) {
+			t.Errorf("Unexpected object = %+v", got)
+		}
+		all, err := verifier().GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 1 {
+			t.Errorf("Incorrect len = %v, want 1", len(all))
+		}
+
+		// Written again without one, it no longer verifies
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "unsigned", Modified: modified, Version: objectsync.VersionVector{"local": 2}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = verifier().Get(ctx, "a")
+		if !objectsync.IsVerificationError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+}
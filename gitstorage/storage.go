@@ -0,0 +1,488 @@
+// Package gitstorage implements objectsync storage on a Git repository.  Each
+// object is a file, with its ID the slash separated path in the repository,
+// and the writes of each sync are committed together.
+package gitstorage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/keithballdotnet/objectsync"
+)
+
+// metadataDir is the directory of the repository keeping the versions of
+// the objects
+const metadataDir = ".objectsync"
+
+// Option configures a GitStorage
+type Option func(*GitStorage)
+
+// WithAuthor will set the author of the commits, which is objectsync by
+// default
+func WithAuthor(name, email string) Option {
+	return func(s *GitStorage) {
+		s.author = object.Signature{Name: name, Email: email}
+	}
+}
+
+// GitStorage is an objectsync.Storage keeping objects as files in a Git
+// repository.
+//
+// The Hash of an object is the hash of its blob.  In a repository with a
+// working tree the objects are the files in it, whether committed or not,
+// and Modified is their mtime.  In a bare repository the objects are the
+// files in the tree of HEAD, and Modified is the time of its commit.
+//
+// The writes are committed as one commit listing their IDs by Commit, which
+// Sync calls once its changes are applied.
+type GitStorage struct {
+	dir    string
+	repo   *git.Repository
+	author object.Signature
+
+	mu sync.Mutex
+	// worktree is nil for a bare repository
+	worktree *git.Worktree
+	// changes are the IDs written since the last commit, with their change
+	changes map[string]string
+	// staged are the files of a bare repository written since the last
+	// commit, with nil for the ones removed
+	staged map[string]*blob
+	// head and files cache the files in the tree of HEAD
+	head  plumbing.Hash
+	files map[string]*blob
+}
+
+// OpenGitStorage will return a GitStorage for the repository at dir, which
+// may be bare
+func OpenGitStorage(dir string, opts ...Option) (*GitStorage, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &GitStorage{
+		dir:     dir,
+		repo:    repo,
+		author:  object.Signature{Name: "objectsync", Email: "objectsync@localhost"},
+		changes: make(map[string]string),
+		staged:  make(map[string]*blob),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.worktree, err = repo.Worktree()
+	if err == git.ErrIsBareRepository {
+		s.worktree, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetName will return the directory of the repository
+func (s *GitStorage) GetName() string {
+	return s.dir
+}
+
+// validID will return if id is a path of a file the storage lists.  Hidden
+// files are left out, so the repository can keep its own.
+func validID(id string) bool {
+	if id == "" || path.Clean(id) != id || path.IsAbs(id) {
+		return false
+	}
+	for _, part := range strings.Split(id, "/") {
+		if strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+	return true
+}
+
+// metadata is kept for the objects with a version or signature.  A signature
+// covers the modified time, which a commit does not keep, so it is kept here
+// too.
+type metadata struct {
+	Version     objectsync.VersionVector
+	VersionHash objectsync.Hash
+	Signature   *objectsync.ObjectSignature `json:",omitempty"`
+	Modified    time.Time                   `json:",omitzero"`
+}
+
+func newMetadata(object *objectsync.GenericObject) *metadata {
+	m := &metadata{Version: object.Version, VersionHash: object.VersionHash, Signature: object.Signature}
+	if object.Signature != nil {
+		m.Modified = object.Modified
+	}
+	return m
+}
+
+// apply will set the metadata on the object read
+func (m *metadata) apply(object *objectsync.GenericObject) {
+	object.Version, object.VersionHash, object.Signature = m.Version, m.VersionHash, m.Signature
+	if m.Signature != nil && !m.Modified.IsZero() {
+		object.Modified = m.Modified
+	}
+}
+
+// Set will write the object to its file, to be committed with the others
+func (s *GitStorage) Set(ctx context.Context, object *objectsync.GenericObject) error {
+	if !validID(object.ID) {
+		return fmt.Errorf("git: invalid ID %s, it must be a relative path without hidden parts", object.ID)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hash := plumbing.ComputeHash(plumbing.BlobObject, []byte(object.Value))
+	meta := path.Join(metadataDir, object.ID)
+	var err error
+	if object.Version != nil || object.Signature != nil {
+		// The version belongs to this content, whatever its hash elsewhere
+		if string(object.VersionHash) == string(objectsync.NewHash(object.Value)) {
+			object.VersionHash = hash[:]
+		}
+		data, err := json.Marshal(newMetadata(object))
+		if err != nil {
+			return err
+		}
+		err = s.write(meta, data, time.Time{})
+		if err != nil {
+			return err
+		}
+	} else {
+		err = s.remove(meta)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.write(object.ID, []byte(object.Value), object.Modified)
+	if err != nil {
+		return err
+	}
+	s.changes[object.ID] = "set"
+	object.Hash = hash[:]
+	return nil
+}
+
+// Get will read the object with id
+func (s *GitStorage) Get(ctx context.Context, id string) (*objectsync.GenericObject, error) {
+	if !validID(id) {
+		return nil, objectsync.ErrorNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.read(id, true)
+}
+
+// GetAll will return all objects
+func (s *GitStorage) GetAll(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.list(true)
+}
+
+// List will return all objects without their values.  In a bare repository
+// no blob is read to do so.
+func (s *GitStorage) List(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.list(false)
+}
+
+// Delete will remove the file of the object, to be committed with the others
+func (s *GitStorage) Delete(ctx context.Context, id string) error {
+	if !validID(id) {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.remove(id)
+	if err != nil {
+		return err
+	}
+	err = s.remove(path.Join(metadataDir, id))
+	if err != nil {
+		return err
+	}
+	s.changes[id] = "delete"
+	return nil
+}
+
+// Commit will commit the writes since the last commit, with a message
+// listing the IDs written.  Nothing is committed if the files are unchanged.
+func (s *GitStorage) Commit(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.changes) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(s.changes))
+	for id := range s.changes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	message := fmt.Sprintf("Sync %v objects\n\n", len(ids))
+	for _, id := range ids {
+		message += s.changes[id] + " " + id + "\n"
+	}
+
+	author := s.author
+	author.When = time.Now()
+	var err error
+	if s.worktree != nil {
+		err = s.commitWorktree(ids, message, &author)
+	} else {
+		err = s.commitTree(message, &author)
+	}
+	if err != nil {
+		return err
+	}
+	s.changes = make(map[string]string)
+	return nil
+}
+
+// commitWorktree will stage the files of ids and commit them
+func (s *GitStorage) commitWorktree(ids []string, message string, author *object.Signature) error {
+	for _, id := range ids {
+		for _, file := range []string{id, path.Join(metadataDir, id)} {
+			_, err := os.Stat(filepath.Join(s.dir, filepath.FromSlash(file)))
+			switch {
+			case err == nil:
+				err = s.worktree.AddWithOptions(&git.AddOptions{Path: file, SkipStatus: true})
+			case os.IsNotExist(err):
+				// Removes the file from the index, if it was added
+				_, err = s.worktree.Add(file)
+				if err == index.ErrEntryNotFound {
+					err = nil
+				}
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := s.worktree.Commit(message, &git.CommitOptions{Author: author})
+	if err == git.ErrEmptyCommit {
+		return nil
+	}
+	return err
+}
+
+// list will return the objects.  Without values the files of a working tree
+// are still read to hash them.
+func (s *GitStorage) list(values bool) (objectsync.GenericObjectCollection, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	all := objectsync.GenericObjectCollection{}
+	for _, id := range ids {
+		object, err := s.read(id, values)
+		if err != nil {
+			if objectsync.IsNotFoundError(err) {
+				continue
+			}
+			return nil, err
+		}
+		all = append(all, object)
+	}
+	return all, nil
+}
+
+// ids will return the IDs of all objects
+func (s *GitStorage) ids() ([]string, error) {
+	ids := []string{}
+	if s.worktree == nil {
+		files, _, err := s.tree()
+		if err != nil {
+			return nil, err
+		}
+		for file := range files {
+			if validID(file) {
+				ids = append(ids, file)
+			}
+		}
+		return ids, nil
+	}
+
+	err := filepath.Walk(s.dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if file == s.dir {
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			rel, err := filepath.Rel(s.dir, file)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// read will return the object with id
+func (s *GitStorage) read(id string, values bool) (*objectsync.GenericObject, error) {
+	object := &objectsync.GenericObject{ID: id}
+	if s.worktree == nil {
+		files, modified, err := s.tree()
+		if err != nil {
+			return nil, err
+		}
+		b, ok := files[id]
+		if !ok {
+			return nil, objectsync.ErrorNotFound
+		}
+		object.Hash = b.hash[:]
+		object.Modified = modified
+		if values {
+			value, err := s.blob(b.hash)
+			if err != nil {
+				return nil, err
+			}
+			object.Value = string(value)
+		}
+	} else {
+		file := filepath.Join(s.dir, filepath.FromSlash(id))
+		info, err := os.Stat(file)
+		if os.IsNotExist(err) {
+			return nil, objectsync.ErrorNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		value, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			return nil, objectsync.ErrorNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		hash := plumbing.ComputeHash(plumbing.BlobObject, value)
+		object.Hash = hash[:]
+		object.Modified = info.ModTime().UTC()
+		if values {
+			object.Value = string(value)
+		}
+	}
+
+	data, err := s.readFile(path.Join(metadataDir, id))
+	if err != nil {
+		if objectsync.IsNotFoundError(err) {
+			return object, nil
+		}
+		return nil, err
+	}
+	m := &metadata{}
+	err = json.Unmarshal(data, m)
+	if err != nil {
+		return nil, err
+	}
+	m.apply(object)
+	return object, nil
+}
+
+// readFile will return the content of the file in the repository
+func (s *GitStorage) readFile(file string) ([]byte, error) {
+	if s.worktree != nil {
+		data, err := os.ReadFile(filepath.Join(s.dir, filepath.FromSlash(file)))
+		if os.IsNotExist(err) {
+			return nil, objectsync.ErrorNotFound
+		}
+		return data, err
+	}
+
+	files, _, err := s.tree()
+	if err != nil {
+		return nil, err
+	}
+	b, ok := files[file]
+	if !ok {
+		return nil, objectsync.ErrorNotFound
+	}
+	return s.blob(b.hash)
+}
+
+// write will write data to the file in the repository, with its mtime set to
+// modified unless it is zero
+func (s *GitStorage) write(file string, data []byte, modified time.Time) error {
+	if s.worktree == nil {
+		hash, err := s.writeBlob(data)
+		if err != nil {
+			return err
+		}
+		s.staged[file] = &blob{hash: hash, mode: regular}
+		return nil
+	}
+
+	name := filepath.Join(s.dir, filepath.FromSlash(file))
+	err := os.MkdirAll(filepath.Dir(name), 0700)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && !modified.IsZero() {
+		err = os.Chtimes(tmp.Name(), modified, modified)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// remove will remove the file from the repository
+func (s *GitStorage) remove(file string) error {
+	if s.worktree == nil {
+		s.staged[file] = nil
+		return nil
+	}
+
+	err := os.Remove(filepath.Join(s.dir, filepath.FromSlash(file)))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
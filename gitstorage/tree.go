@@ -0,0 +1,222 @@
+package gitstorage
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// regular is the mode of the files written
+const regular = filemode.Regular
+
+// blob is a file in a tree
+type blob struct {
+	hash plumbing.Hash
+	mode filemode.FileMode
+}
+
+// tree will return the files in the tree of HEAD with the staged changes, and
+// the time of the HEAD commit.  A repository without commits has no files.
+func (s *GitStorage) tree() (map[string]*blob, time.Time, error) {
+	files := map[string]*blob{}
+	var modified time.Time
+
+	commit, err := s.headCommit()
+	if err != nil {
+		return nil, modified, err
+	}
+	if commit != nil {
+		modified = commit.Committer.When.UTC()
+		if s.files == nil || s.head != commit.Hash {
+			s.files, err = treeFiles(commit)
+			if err != nil {
+				return nil, modified, err
+			}
+			s.head = commit.Hash
+		}
+		for file, b := range s.files {
+			files[file] = b
+		}
+	}
+
+	for file, b := range s.staged {
+		if b == nil {
+			delete(files, file)
+			continue
+		}
+		files[file] = b
+	}
+	return files, modified, nil
+}
+
+// headCommit will return the commit of HEAD, nil if there is none yet
+func (s *GitStorage) headCommit() (*object.Commit, error) {
+	ref, err := s.repo.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.CommitObject(ref.Hash())
+}
+
+// treeFiles will return the files in the tree of commit
+func treeFiles(commit *object.Commit) (map[string]*blob, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]*blob{}
+	iter := tree.Files()
+	defer iter.Close()
+	for {
+		f, err := iter.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		files[f.Name] = &blob{hash: f.Hash, mode: f.Mode}
+	}
+}
+
+// blob will return the content of the blob with hash
+func (s *GitStorage) blob(hash plumbing.Hash) ([]byte, error) {
+	b, err := s.repo.BlobObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	r, err := b.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// writeBlob will store data as a blob, and return its hash
+func (s *GitStorage) writeBlob(data []byte) (plumbing.Hash, error) {
+	obj := s.repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	_, err = w.Write(data)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return s.repo.Storer.SetEncodedObject(obj)
+}
+
+// commitTree will commit the staged files of a bare repository on the branch
+// of HEAD
+func (s *GitStorage) commitTree(message string, author *object.Signature) error {
+	files, _, err := s.tree()
+	if err != nil {
+		return err
+	}
+	treeHash, err := s.writeTree(files)
+	if err != nil {
+		return err
+	}
+
+	commit := &object.Commit{
+		Author:    *author,
+		Committer: *author,
+		Message:   message,
+		TreeHash:  treeHash,
+	}
+	parent, err := s.headCommit()
+	if err != nil {
+		return err
+	}
+	if parent != nil {
+		if parent.TreeHash == treeHash {
+			s.staged = make(map[string]*blob)
+			return nil
+		}
+		commit.ParentHashes = []plumbing.Hash{parent.Hash}
+	}
+
+	obj := s.repo.Storer.NewEncodedObject()
+	err = commit.Encode(obj)
+	if err != nil {
+		return err
+	}
+	commitHash, err := s.repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return err
+	}
+
+	// HEAD names the branch to move, unless it is detached
+	head, err := s.repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return err
+	}
+	name := plumbing.HEAD
+	if head.Type() == plumbing.SymbolicReference {
+		name = head.Target()
+	}
+	err = s.repo.Storer.SetReference(plumbing.NewHashReference(name, commitHash))
+	if err != nil {
+		return err
+	}
+	s.staged = make(map[string]*blob)
+	return nil
+}
+
+// writeTree will store the tree of files, with the trees of its
+// directories, and return its hash
+func (s *GitStorage) writeTree(files map[string]*blob) (plumbing.Hash, error) {
+	tree := &object.Tree{}
+	dirs := map[string]map[string]*blob{}
+	for file, b := range files {
+		i := strings.Index(file, "/")
+		if i < 0 {
+			tree.Entries = append(tree.Entries, object.TreeEntry{Name: file, Mode: b.mode, Hash: b.hash})
+			continue
+		}
+		dir := file[:i]
+		if dirs[dir] == nil {
+			dirs[dir] = map[string]*blob{}
+		}
+		dirs[dir][file[i+1:]] = b
+	}
+	for dir, files := range dirs {
+		hash, err := s.writeTree(files)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: dir, Mode: filemode.Dir, Hash: hash})
+	}
+
+	// Git sorts directories as if their names ended with a slash
+	sortName := func(e object.TreeEntry) string {
+		if e.Mode == filemode.Dir {
+			return e.Name + "/"
+		}
+		return e.Name
+	}
+	sort.Slice(tree.Entries, func(i, j int) bool {
+		return sortName(tree.Entries[i]) < sortName(tree.Entries[j])
+	})
+
+	obj := s.repo.Storer.NewEncodedObject()
+	err := tree.Encode(obj)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return s.repo.Storer.SetEncodedObject(obj)
+}
@@ -0,0 +1,393 @@
+package grpcstorage
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/keithballdotnet/objectsync"
+	pb "github.com/keithballdotnet/objectsync/grpcstorage/objectsyncpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultBatchSize is the number of operations sent in each batch of a
+// transfer
+const DefaultBatchSize = 100
+
+// Progress counts the operations of a transfer done so far, and the bytes of
+// their values
+type Progress struct {
+	Operations int64
+	Bytes      int64
+}
+
+// Option configures a GRPCStorage
+type Option func(*GRPCStorage)
+
+// WithBatchSize will set the number of operations sent in each batch of a
+// transfer
+func WithBatchSize(size int) Option {
+	return func(s *GRPCStorage) {
+		if size > 0 {
+			s.batchSize = size
+		}
+	}
+}
+
+// WithProgress will call progress with the progress the server reports after
+// each batch of a transfer
+func WithProgress(progress func(Progress)) Option {
+	return func(s *GRPCStorage) {
+		s.progress = progress
+	}
+}
+
+// GRPCStorage is an objectsync.Storage on an ObjectSync service, such as a
+// Server.
+//
+// The Hash of an object is the one of the storage served, so objects are
+// streamed by List without their values.  GetAll, SetBatch and DeleteBatch
+// transfer objects in batches over one stream, which Sync uses for the
+// changes it writes.  Writes are conditional on the hash last read for the
+// object, and fail with objectsync.ErrorPreconditionFailed if it has changed
+// since.  It is an objectsync.Merkler and an objectsync.Sketcher, so Sync
+// can read only the nodes of the Merkle tree of the service that differ, or
+// its sketch.  It is an objectsync.DeltaStorage too, so only the blocks of a
+// large value that changed are sent.
+type GRPCStorage struct {
+	client    pb.ObjectSyncClient
+	name      string
+	batchSize int
+	progress  func(Progress)
+
+	mu sync.Mutex
+	// hashes are the hashes last read per ID, nil if it was read as missing
+	hashes map[string]objectsync.Hash
+}
+
+// NewGRPCStorage will return a GRPCStorage using the service on conn, known
+// as name
+func NewGRPCStorage(conn grpc.ClientConnInterface, name string, opts ...Option) *GRPCStorage {
+	s := &GRPCStorage{
+		client:    pb.NewObjectSyncClient(conn),
+		name:      name,
+		batchSize: DefaultBatchSize,
+		hashes:    make(map[string]objectsync.Hash),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// GetName ...
+func (s *GRPCStorage) GetName() string {
+	return s.name
+}
+
+// Set ...
+func (s *GRPCStorage) Set(ctx context.Context, object *objectsync.GenericObject) error {
+	resp, err := s.client.Set(ctx, &pb.SetRequest{Object: toProto(object, true), Precondition: s.precondition(object.ID)})
+	if err != nil {
+		return fromStatus(err)
+	}
+
+	s.setHash(object.ID, resp.Hash)
+	object.Hash = resp.Hash
+	return nil
+}
+
+// SetBatch will write the objects in batches over one stream.  All objects
+// are tried, and the first error is returned.
+func (s *GRPCStorage) SetBatch(ctx context.Context, objects []*objectsync.GenericObject) error {
+	ops := make([]*pb.Operation, len(objects))
+	for i, object := range objects {
+		ops[i] = &pb.Operation{Op: &pb.Operation_Set{Set: &pb.SetRequest{
+			Object:       toProto(object, true),
+			Precondition: s.precondition(object.ID),
+		}}}
+	}
+
+	results, err := s.transfer(ctx, ops)
+	if err != nil {
+		return err
+	}
+
+	var first error
+	for i, result := range results {
+		err = resultError(result)
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		s.setHash(objects[i].ID, result.Object.GetHash())
+		objects[i].Hash = result.Object.GetHash()
+	}
+	return first
+}
+
+// Get ...
+func (s *GRPCStorage) Get(ctx context.Context, id string) (*objectsync.GenericObject, error) {
+	o, err := s.client.Get(ctx, &pb.GetRequest{Id: id})
+	if err != nil {
+		err = fromStatus(err)
+		if objectsync.IsNotFoundError(err) {
+			s.setHash(id, nil)
+		}
+		return nil, err
+	}
+
+	s.setHash(id, o.Hash)
+	return fromProto(o), nil
+}
+
+// GetAll will list the objects, and transfer their values in batches over
+// one stream
+func (s *GRPCStorage) GetAll(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	listed, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ops := make([]*pb.Operation, len(listed))
+	for i, object := range listed {
+		ops[i] = &pb.Operation{Op: &pb.Operation_Get{Get: &pb.GetRequest{Id: object.ID}}}
+	}
+	results, err := s.transfer(ctx, ops)
+	if err != nil {
+		return nil, err
+	}
+
+	all := objectsync.GenericObjectCollection{}
+	for i, result := range results {
+		err = resultError(result)
+		if err != nil {
+			// Deleted since it was listed
+			if objectsync.IsNotFoundError(err) {
+				s.setHash(listed[i].ID, nil)
+				continue
+			}
+			return nil, err
+		}
+		s.setHash(listed[i].ID, result.Object.GetHash())
+		all = append(all, fromProto(result.Object))
+	}
+	return all, nil
+}
+
+// List will return all objects without their values
+func (s *GRPCStorage) List(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	stream, err := s.client.List(ctx, &pb.ListRequest{})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+
+	all := objectsync.GenericObjectCollection{}
+	for {
+		o, err := stream.Recv()
+		if err == io.EOF {
+			return all, nil
+		}
+		if err != nil {
+			return nil, fromStatus(err)
+		}
+		s.setHash(o.Id, o.Hash)
+		all = append(all, fromProto(o))
+	}
+}
+
+// MerkleNode will return the node at prefix of the Merkle tree of the service
+func (s *GRPCStorage) MerkleNode(ctx context.Context, prefix string) (*objectsync.MerkleNode, error) {
+	resp, err := s.client.MerkleNode(ctx, &pb.MerkleNodeRequest{Prefix: prefix})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+
+	node := &objectsync.MerkleNode{Prefix: resp.Prefix, Hash: resp.Hash}
+	for _, child := range resp.Children {
+		if len(child) == 0 {
+			child = nil
+		}
+		node.Children = append(node.Children, child)
+	}
+	if len(resp.Objects) > 0 {
+		node.Objects = make(map[string]objectsync.Hash, len(resp.Objects))
+		for id, hash := range resp.Objects {
+			node.Objects[id] = hash
+		}
+	}
+	return node, nil
+}
+
+// Sketch will return the sketch of the objects of the service
+func (s *GRPCStorage) Sketch(ctx context.Context, cells int) (*objectsync.IBLT, error) {
+	resp, err := s.client.Sketch(ctx, &pb.SketchRequest{Cells: int32(cells)})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+
+	sketch := &objectsync.IBLT{Cells: make([]objectsync.IBLTCell, len(resp.Cells))}
+	for i, cell := range resp.Cells {
+		sketch.Cells[i] = objectsync.IBLTCell{Count: cell.Count, KeySum: cell.KeySum, CheckSum: cell.CheckSum}
+	}
+	return sketch, nil
+}
+
+// DeltaSignature will return the signature of the value of the object on the
+// service
+func (s *GRPCStorage) DeltaSignature(ctx context.Context, id string, blockSize int) (*objectsync.DeltaSignature, error) {
+	resp, err := s.client.DeltaSignature(ctx, &pb.DeltaSignatureRequest{Id: id, BlockSize: int32(blockSize)})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	return fromProtoSignature(resp), nil
+}
+
+// Patch will set the object with the value delta makes of the one on the
+// service, with the precondition Set would have
+func (s *GRPCStorage) Patch(ctx context.Context, object *objectsync.GenericObject, delta *objectsync.Delta) error {
+	resp, err := s.client.Patch(ctx, &pb.PatchRequest{
+		Object:       toProto(object, false),
+		Delta:        toProtoDelta(delta),
+		Precondition: s.precondition(object.ID),
+	})
+	if err != nil {
+		return fromStatus(err)
+	}
+
+	s.setHash(object.ID, resp.Hash)
+	object.Hash = resp.Hash
+	return nil
+}
+
+// Delete will remove a entry from the storage
+func (s *GRPCStorage) Delete(ctx context.Context, id string) error {
+	precondition := s.precondition(id)
+	if precondition.GetKind() == pb.Precondition_ABSENT {
+		precondition = nil
+	}
+
+	_, err := s.client.Delete(ctx, &pb.DeleteRequest{Id: id, Precondition: precondition})
+	if err != nil {
+		return fromStatus(err)
+	}
+	s.setHash(id, nil)
+	return nil
+}
+
+// DeleteBatch will remove the entries in batches over one stream.  All are
+// tried, and the first error is returned.
+func (s *GRPCStorage) DeleteBatch(ctx context.Context, ids []string) error {
+	ops := make([]*pb.Operation, len(ids))
+	for i, id := range ids {
+		precondition := s.precondition(id)
+		if precondition.GetKind() == pb.Precondition_ABSENT {
+			precondition = nil
+		}
+		ops[i] = &pb.Operation{Op: &pb.Operation_Delete{Delete: &pb.DeleteRequest{Id: id, Precondition: precondition}}}
+	}
+
+	results, err := s.transfer(ctx, ops)
+	if err != nil {
+		return err
+	}
+
+	var first error
+	for i, result := range results {
+		err = resultError(result)
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		s.setHash(ids[i], nil)
+	}
+	return first
+}
+
+// transfer will send the operations in batches over one stream, while
+// receiving the results of the batches sent before, and return the results
+// in order
+func (s *GRPCStorage) transfer(ctx context.Context, ops []*pb.Operation) ([]*pb.Result, error) {
+	if len(ops) == 0 {
+		return nil, nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := s.client.Transfer(ctx)
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+
+	sent := make(chan error, 1)
+	go func() {
+		for start := 0; start < len(ops); start += s.batchSize {
+			end := start + s.batchSize
+			if end > len(ops) {
+				end = len(ops)
+			}
+			err := stream.Send(&pb.TransferRequest{Operations: ops[start:end]})
+			if err != nil {
+				sent <- err
+				return
+			}
+		}
+		sent <- stream.CloseSend()
+	}()
+
+	results := make([]*pb.Result, 0, len(ops))
+	for len(results) < len(ops) {
+		resp, err := stream.Recv()
+		if err != nil {
+			return nil, fromStatus(err)
+		}
+		results = append(results, resp.Results...)
+		if s.progress != nil && resp.Progress != nil {
+			s.progress(Progress{Operations: resp.Progress.Operations, Bytes: resp.Progress.Bytes})
+		}
+	}
+
+	err = <-sent
+	if err != nil {
+		return nil, err
+	}
+	_, err = stream.Recv()
+	if err != io.EOF {
+		return nil, fromStatus(err)
+	}
+	return results[:len(ops)], nil
+}
+
+// resultError will return the error of the result, nil if it succeeded
+func resultError(result *pb.Result) error {
+	if codes.Code(result.Code) == codes.OK {
+		return nil
+	}
+	return fromStatus(status.Error(codes.Code(result.Code), result.Message))
+}
+
+// precondition will return the precondition for writing the object with id
+func (s *GRPCStorage) precondition(id string) *pb.Precondition {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hash, seen := s.hashes[id]
+	switch {
+	case !seen:
+		return nil
+	case hash == nil:
+		return &pb.Precondition{Kind: pb.Precondition_ABSENT}
+	}
+	return &pb.Precondition{Kind: pb.Precondition_MATCH, Hash: hash}
+}
+
+func (s *GRPCStorage) setHash(id string, hash objectsync.Hash) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hashes[id] = hash
+}
@@ -0,0 +1,111 @@
+package grpcstorage
+
+import (
+	"github.com/keithballdotnet/objectsync"
+	pb "github.com/keithballdotnet/objectsync/grpcstorage/objectsyncpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func toProto(object *objectsync.GenericObject, value bool) *pb.Object {
+	o := &pb.Object{
+		Id:          object.ID,
+		Hash:        object.Hash,
+		Modified:    timestamppb.New(object.Modified),
+		Version:     object.Version,
+		VersionHash: object.VersionHash,
+	}
+	if value {
+		o.Value = []byte(object.Value)
+	}
+	if object.Signature != nil {
+		o.Signature = &pb.ObjectSignature{
+			Replica:   object.Signature.Replica,
+			Hash:      object.Signature.Hash,
+			Signature: object.Signature.Signature,
+		}
+	}
+	return o
+}
+
+func fromProto(o *pb.Object) *objectsync.GenericObject {
+	object := &objectsync.GenericObject{
+		ID:          o.Id,
+		Value:       string(o.Value),
+		Hash:        o.Hash,
+		VersionHash: o.VersionHash,
+	}
+	if o.Modified != nil {
+		object.Modified = o.Modified.AsTime()
+	}
+	if len(o.Version) > 0 {
+		object.Version = o.Version
+	}
+	if o.Signature != nil {
+		object.Signature = &objectsync.ObjectSignature{
+			Replica:   o.Signature.Replica,
+			Hash:      o.Signature.Hash,
+			Signature: o.Signature.Signature,
+		}
+	}
+	return object
+}
+
+func toProtoSignature(signature *objectsync.DeltaSignature) *pb.DeltaSignatureResponse {
+	resp := &pb.DeltaSignatureResponse{BlockSize: int32(signature.BlockSize)}
+	for _, block := range signature.Blocks {
+		resp.Blocks = append(resp.Blocks, &pb.BlockSignature{Weak: block.Weak, Strong: block.Strong})
+	}
+	return resp
+}
+
+func fromProtoSignature(resp *pb.DeltaSignatureResponse) *objectsync.DeltaSignature {
+	signature := &objectsync.DeltaSignature{BlockSize: int(resp.BlockSize)}
+	for _, block := range resp.Blocks {
+		signature.Blocks = append(signature.Blocks, objectsync.BlockSignature{Weak: block.Weak, Strong: block.Strong})
+	}
+	return signature
+}
+
+func toProtoDelta(delta *objectsync.Delta) *pb.Delta {
+	d := &pb.Delta{BlockSize: int32(delta.BlockSize), Hash: delta.Hash}
+	for _, op := range delta.Ops {
+		d.Ops = append(d.Ops, &pb.DeltaOp{Block: int64(op.Block), Data: []byte(op.Data)})
+	}
+	return d
+}
+
+func fromProtoDelta(d *pb.Delta) *objectsync.Delta {
+	delta := &objectsync.Delta{BlockSize: int(d.BlockSize), Hash: d.Hash}
+	for _, op := range d.Ops {
+		delta.Ops = append(delta.Ops, objectsync.DeltaOp{Block: int(op.Block), Data: string(op.Data)})
+	}
+	return delta
+}
+
+// toStatus will map objectsync errors to their status codes
+func toStatus(err error) error {
+	switch {
+	case objectsync.IsNotFoundError(err):
+		return status.Error(codes.NotFound, err.Error())
+	case err == objectsync.ErrorPreconditionFailed:
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case err == objectsync.ErrorDeltaMismatch:
+		return status.Error(codes.Aborted, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// fromStatus will map status codes to their objectsync errors
+func fromStatus(err error) error {
+	switch status.Code(err) {
+	case codes.NotFound:
+		return objectsync.ErrorNotFound
+	case codes.FailedPrecondition:
+		return objectsync.ErrorPreconditionFailed
+	case codes.Aborted:
+		return objectsync.ErrorDeltaMismatch
+	}
+	return err
+}
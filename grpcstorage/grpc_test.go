@@ -0,0 +1,457 @@
+package grpcstorage
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"math/rand"
+	"net"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/keithballdotnet/objectsync"
+	pb "github.com/keithballdotnet/objectsync/grpcstorage/objectsyncpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// Check the interfaces
+var _ objectsync.Storage = &GRPCStorage{}
+var _ objectsync.Lister = &GRPCStorage{}
+var _ objectsync.BatchWriter = &GRPCStorage{}
+var _ objectsync.Merkler = &GRPCStorage{}
+var _ objectsync.Sketcher = &GRPCStorage{}
+var _ objectsync.DeltaStorage = &GRPCStorage{}
+var _ pb.ObjectSyncServer = &Server{}
+
+// newConn will serve store over an in-memory listener, count the unary
+// writes to it, and return a connection to it
+func newConn(t *testing.T, store objectsync.Storage, writes *int32) *grpc.ClientConn {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if info.FullMethod == pb.ObjectSync_Set_FullMethodName || info.FullMethod == pb.ObjectSync_Delete_FullMethodName {
+			atomic.AddInt32(writes, 1)
+		}
+		return handler(ctx, req)
+	}))
+	pb.RegisterObjectSyncServer(server, NewServer(store))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestGRPCStorage(t *testing.T) {
+
+	ctx := context.TODO()
+
+	t.Run("SetGet", func(t *testing.T) {
+		var writes int32
+		store := NewGRPCStorage(newConn(t, objectsync.NewInMemoryStorage("remote"), &writes), "grpc")
+
+		modified := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+		object := &objectsync.GenericObject{ID: "a", Value: "value a", Modified: modified, Version: objectsync.VersionVector{"local": 1}}
+		err := store.Set(ctx, object)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if string(object.Hash) != string(objectsync.NewHash(object.Value)) {
+			t.Errorf("Unexpected hash = %x", object.Hash)
+		}
+
+		got, err := store.Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if got.Value != object.Value || !got.Modified.Equal(modified) || got.Version["local"] != 1 {
+			t.Errorf("Unexpected object = %+v", got)
+		}
+
+		listed, err := store.List(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(listed) != 1 || listed[0].Value != "" || string(listed[0].Hash) != string(object.Hash) {
+			t.Errorf("Unexpected list = %+v", listed)
+		}
+
+		err = store.Delete(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = store.Get(ctx, "a")
+		if !objectsync.IsNotFoundError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+
+	t.Run("Transfer", func(t *testing.T) {
+		var writes int32
+		var progress []Progress
+		store := NewGRPCStorage(newConn(t, objectsync.NewInMemoryStorage("remote"), &writes), "grpc",
+			WithBatchSize(7),
+			WithProgress(func(p Progress) {
+				progress = append(progress, p)
+			}))
+
+		objects := objectsync.GenericObjectCollection{}
+		for i := 0; i < 50; i++ {
+			objects = append(objects, &objectsync.GenericObject{ID: fmt.Sprintf("object%02d", i), Value: "0123456789"})
+		}
+		err := store.SetBatch(ctx, objects)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(progress) != 8 {
+			t.Fatalf("Incorrect progress len = %v, want 8", len(progress))
+		}
+		if last := progress[7]; last.Operations != 50 || last.Bytes != 500 {
+			t.Errorf("Unexpected progress = %+v", last)
+		}
+		if atomic.LoadInt32(&writes) != 0 {
+			t.Errorf("Unexpected unary writes = %v", writes)
+		}
+
+		all, err := store.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 50 {
+			t.Fatalf("Incorrect len = %v, want 50", len(all))
+		}
+		for _, object := range all {
+			if object.Value != "0123456789" {
+				t.Errorf("Unexpected value for [%s]", object.ID)
+			}
+		}
+	})
+
+	t.Run("Preconditions", func(t *testing.T) {
+		var writes int32
+		conn := newConn(t, objectsync.NewInMemoryStorage("remote"), &writes)
+		store1 := NewGRPCStorage(conn, "grpc1")
+		store2 := NewGRPCStorage(conn, "grpc2")
+
+		err := store1.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "a"})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = store2.Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = store1.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "changed"})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = store2.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "stale"})
+		if err != objectsync.ErrorPreconditionFailed {
+			t.Errorf("Unexpected error = %v", err)
+		}
+		err = store2.SetBatch(ctx, []*objectsync.GenericObject{{ID: "a", Value: "stale"}})
+		if err != objectsync.ErrorPreconditionFailed {
+			t.Errorf("Unexpected error = %v", err)
+		}
+		err = store2.Delete(ctx, "a")
+		if err != objectsync.ErrorPreconditionFailed {
+			t.Errorf("Unexpected error = %v", err)
+		}
+		err = store2.DeleteBatch(ctx, []string{"a"})
+		if err != objectsync.ErrorPreconditionFailed {
+			t.Errorf("Unexpected error = %v", err)
+		}
+
+		_, err = store2.Get(ctx, "b")
+		if !objectsync.IsNotFoundError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+		err = store1.Set(ctx, &objectsync.GenericObject{ID: "b", Value: "b"})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = store2.Set(ctx, &objectsync.GenericObject{ID: "b", Value: "other"})
+		if err != objectsync.ErrorPreconditionFailed {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		var writes int32
+		var progress []Progress
+		remote := objectsync.NewInMemoryStorage("remote")
+		store1 := objectsync.NewInMemoryStorage("local")
+		store2 := NewGRPCStorage(newConn(t, remote, &writes), "grpc", WithProgress(func(p Progress) {
+			progress = append(progress, p)
+		}))
+		status := objectsync.NewInMemoryStatusStorage()
+
+		for i := 0; i < 3; i++ {
+			store1.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("local%v", i), Value: "local", Modified: time.Now().UTC()})
+			remote.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("remote%v", i), Value: "remote", Modified: time.Now().UTC()})
+		}
+
+		opts := []objectsync.Option{objectsync.WithCausality("local", "remote")}
+		err := objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		// The objects are written over a stream
+		if len(progress) == 0 || atomic.LoadInt32(&writes) != 0 {
+			t.Errorf("Unexpected writes = %v with progress %+v", writes, progress)
+		}
+
+		store1.Delete(ctx, "local2")
+		remote.Set(ctx, &objectsync.GenericObject{ID: "local1", Value: "changed", Modified: time.Now().UTC()})
+		err = objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// Nothing changed, so nothing is written
+		before := atomic.LoadInt32(&writes)
+		err = objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if written := atomic.LoadInt32(&writes) - before; written != 0 {
+			t.Errorf("Unexpected writes = %v", written)
+		}
+
+		object, err := store1.Get(ctx, "local1")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != "changed" {
+			t.Errorf("Unexpected value = %s", object.Value)
+		}
+		all, _ := remote.GetAll(ctx)
+		if len(all) != 5 {
+			t.Errorf("Incorrect len = %v, want 5", len(all))
+		}
+	})
+
+	t.Run("Merkle", func(t *testing.T) {
+		var writes int32
+		local, remote := objectsync.NewInMemoryStorage("local"), objectsync.NewInMemoryStorage("remote")
+		store1 := NewGRPCStorage(newConn(t, local, &writes), "local")
+		store2 := NewGRPCStorage(newConn(t, remote, &writes), "remote")
+		status := objectsync.NewInMemoryStatusStorage()
+
+		for i := 0; i < 100; i++ {
+			local.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("object%v", i), Value: fmt.Sprintf("value%v", i), Modified: time.Now().UTC()})
+		}
+		err := objectsync.Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		remote.Set(ctx, &objectsync.GenericObject{ID: "object1", Value: "changed", Modified: time.Now().UTC()})
+		local.Delete(ctx, "object2")
+		err = objectsync.Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// The nodes served are the ones of a tree over the objects
+		all, _ := remote.GetAll(ctx)
+		if len(all) != 99 {
+			t.Errorf("Incorrect len = %v, want 99", len(all))
+		}
+		tree := objectsync.NewMerkleTree()
+		for _, object := range all {
+			tree.Set(object.ID, object.Hash)
+		}
+		for _, store := range []*GRPCStorage{store1, store2} {
+			for _, prefix := range []string{"", objectsync.MerkleBucket("object1")[:1]} {
+				node, err := store.MerkleNode(ctx, prefix)
+				if err != nil {
+					t.Fatalf("Error: %v", err)
+				}
+				if !reflect.DeepEqual(node, tree.Node(prefix)) {
+					t.Errorf("Unexpected node at %q = %+v, want %+v", prefix, node, tree.Node(prefix))
+				}
+			}
+		}
+		object, err := local.Get(ctx, "object1")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != "changed" {
+			t.Errorf("Unexpected value = %s", object.Value)
+		}
+	})
+
+	t.Run("Sketch", func(t *testing.T) {
+		var writes int32
+		local, remote := objectsync.NewInMemoryStorage("local"), objectsync.NewInMemoryStorage("remote")
+		store1 := NewGRPCStorage(newConn(t, local, &writes), "local")
+		store2 := NewGRPCStorage(newConn(t, remote, &writes), "remote")
+		status := objectsync.NewInMemoryStatusStorage()
+
+		for i := 0; i < 100; i++ {
+			local.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("object%v", i), Value: fmt.Sprintf("value%v", i), Modified: time.Now().UTC()})
+		}
+		opts := []objectsync.Option{objectsync.WithSketches(60)}
+		err := objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		remote.Set(ctx, &objectsync.GenericObject{ID: "object1", Value: "changed", Modified: time.Now().UTC()})
+		local.Delete(ctx, "object2")
+		err = objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// The sketches served are the ones over the objects
+		all, _ := remote.GetAll(ctx)
+		if len(all) != 99 {
+			t.Errorf("Incorrect len = %v, want 99", len(all))
+		}
+		want := objectsync.NewIBLT(60)
+		for _, object := range all {
+			want.Insert(object.ID, object.Hash)
+		}
+		for _, store := range []*GRPCStorage{store1, store2} {
+			sketch, err := store.Sketch(ctx, 60)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if !reflect.DeepEqual(sketch, want) {
+				t.Errorf("Unexpected sketch of %s", store.GetName())
+			}
+		}
+		_, err = store1.Sketch(ctx, 0)
+		if err == nil {
+			t.Errorf("Expected an error for no cells")
+		}
+		object, err := local.Get(ctx, "object1")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != "changed" {
+			t.Errorf("Unexpected value = %s", object.Value)
+		}
+	})
+
+	t.Run("Delta", func(t *testing.T) {
+		var writes int32
+		local, remote := objectsync.NewInMemoryStorage("local"), objectsync.NewInMemoryStorage("remote")
+		store2 := NewGRPCStorage(newConn(t, remote, &writes), "grpc")
+		status := objectsync.NewInMemoryStatusStorage()
+
+		// A binary value, large enough to be patched
+		random := rand.New(rand.NewSource(1))
+		value := make([]byte, 10000)
+		random.Read(value)
+		local.Set(ctx, &objectsync.GenericObject{ID: "a", Value: string(value), Modified: time.Now().UTC()})
+		err := objectsync.Sync(ctx, local, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// A change in the middle is sent as a patch, not set whole
+		changed := string(value[:5000]) + "changed" + string(value[5000:])
+		local.Set(ctx, &objectsync.GenericObject{ID: "a", Value: changed, Modified: time.Now().UTC()})
+		before := atomic.LoadInt32(&writes)
+		err = objectsync.Sync(ctx, local, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if written := atomic.LoadInt32(&writes) - before; written != 0 {
+			t.Errorf("Unexpected writes = %v", written)
+		}
+		object, err := remote.Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != changed {
+			t.Errorf("Unexpected value of %v bytes", len(object.Value))
+		}
+
+		signature, err := store2.DeltaSignature(ctx, "a", 1024)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if !reflect.DeepEqual(signature, objectsync.NewDeltaSignature(changed, 1024)) {
+			t.Errorf("Unexpected signature of %v blocks", len(signature.Blocks))
+		}
+		delta := objectsync.NewDelta(signature, "more"+changed)
+		if delta.Size() != len("more") {
+			t.Errorf("Unexpected delta size = %v", delta.Size())
+		}
+		err = store2.Patch(ctx, &objectsync.GenericObject{ID: "a", Modified: time.Now().UTC()}, delta)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		object, _ = remote.Get(ctx, "a")
+		if object.Value != "more"+changed {
+			t.Errorf("Unexpected value of %v bytes", len(object.Value))
+		}
+
+		// A delta made for another value does not apply
+		err = store2.Patch(ctx, &objectsync.GenericObject{ID: "a"}, delta)
+		if err != objectsync.ErrorDeltaMismatch {
+			t.Errorf("Unexpected error = %v", err)
+		}
+		_, err = store2.DeltaSignature(ctx, "missing", 1024)
+		if !objectsync.IsNotFoundError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+
+	t.Run("Signed", func(t *testing.T) {
+		var writes int32
+		conn := newConn(t, objectsync.NewInMemoryStorage("remote"), &writes)
+		store := NewGRPCStorage(conn, "grpc")
+		public, key, _ := ed25519.GenerateKey(nil)
+		modified := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+		signer := objectsync.NewSignedStorage(store, "local", key, nil)
+		err := signer.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "value", Modified: modified, Version: objectsync.VersionVector{"local": 1}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// The signature is kept, with the time it covers, so the object
+		// verifies when read again
+		verifier := func() *objectsync.SignedStorage {
+			reader := NewGRPCStorage(conn, "grpc")
+			return objectsync.NewSignedStorage(reader, "remote", nil, map[string]ed25519.PublicKey{"local": public})
+		}
+		got, err := verifier().Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if got.Signature == nil || got.Signature.Replica != "local" || !got.Modified.Equal(modified) {
+			t.Errorf("Unexpected object = %+v", got)
+		}
+		all, err := verifier().GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 1 {
+			t.Errorf("Incorrect len = %v, want 1", len(all))
+		}
+
+		// Written again without one, it no longer verifies
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "unsigned", Modified: modified, Version: objectsync.VersionVector{"local": 2}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = verifier().Get(ctx, "a")
+		if !objectsync.IsVerificationError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+}
@@ -0,0 +1,5 @@
+// Package objectsyncpb holds the messages and service of grpcstorage,
+// generated from objectsync.proto.
+package objectsyncpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative objectsync.proto
@@ -0,0 +1,1695 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: objectsync.proto
+
+package objectsyncpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Precondition_Kind int32
+
+const (
+	// ANY writes whatever there is
+	Precondition_ANY Precondition_Kind = 0
+	// ABSENT writes only if there is no object
+	Precondition_ABSENT Precondition_Kind = 1
+	// MATCH writes only if the object has the hash
+	Precondition_MATCH Precondition_Kind = 2
+)
+
+// Enum value maps for Precondition_Kind.
+var (
+	Precondition_Kind_name = map[int32]string{
+		0: "ANY",
+		1: "ABSENT",
+		2: "MATCH",
+	}
+	Precondition_Kind_value = map[string]int32{
+		"ANY":    0,
+		"ABSENT": 1,
+		"MATCH":  2,
+	}
+)
+
+func (x Precondition_Kind) Enum() *Precondition_Kind {
+	p := new(Precondition_Kind)
+	*p = x
+	return p
+}
+
+func (x Precondition_Kind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Precondition_Kind) Descriptor() protoreflect.EnumDescriptor {
+	return file_objectsync_proto_enumTypes[0].Descriptor()
+}
+
+func (Precondition_Kind) Type() protoreflect.EnumType {
+	return &file_objectsync_proto_enumTypes[0]
+}
+
+func (x Precondition_Kind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Precondition_Kind.Descriptor instead.
+func (Precondition_Kind) EnumDescriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{2, 0}
+}
+
+// Object is an object of the storage.  Listings and writes leave out the
+// value.
+type Object struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Value         []byte                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	Hash          []byte                 `protobuf:"bytes,3,opt,name=hash,proto3" json:"hash,omitempty"`
+	Modified      *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=modified,proto3" json:"modified,omitempty"`
+	Version       map[string]uint64      `protobuf:"bytes,5,rep,name=version,proto3" json:"version,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	VersionHash   []byte                 `protobuf:"bytes,6,opt,name=version_hash,json=versionHash,proto3" json:"version_hash,omitempty"`
+	Signature     *ObjectSignature       `protobuf:"bytes,7,opt,name=signature,proto3" json:"signature,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Object) Reset() {
+	*x = Object{}
+	mi := &file_objectsync_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Object) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Object) ProtoMessage() {}
+
+func (x *Object) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Object.ProtoReflect.Descriptor instead.
+func (*Object) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Object) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Object) GetValue() []byte {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *Object) GetHash() []byte {
+	if x != nil {
+		return x.Hash
+	}
+	return nil
+}
+
+func (x *Object) GetModified() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Modified
+	}
+	return nil
+}
+
+func (x *Object) GetVersion() map[string]uint64 {
+	if x != nil {
+		return x.Version
+	}
+	return nil
+}
+
+func (x *Object) GetVersionHash() []byte {
+	if x != nil {
+		return x.VersionHash
+	}
+	return nil
+}
+
+func (x *Object) GetSignature() *ObjectSignature {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+// ObjectSignature is the signature of an object by the replica it came from
+type ObjectSignature struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Replica       string                 `protobuf:"bytes,1,opt,name=replica,proto3" json:"replica,omitempty"`
+	Hash          []byte                 `protobuf:"bytes,2,opt,name=hash,proto3" json:"hash,omitempty"`
+	Signature     []byte                 `protobuf:"bytes,3,opt,name=signature,proto3" json:"signature,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ObjectSignature) Reset() {
+	*x = ObjectSignature{}
+	mi := &file_objectsync_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ObjectSignature) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ObjectSignature) ProtoMessage() {}
+
+func (x *ObjectSignature) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ObjectSignature.ProtoReflect.Descriptor instead.
+func (*ObjectSignature) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ObjectSignature) GetReplica() string {
+	if x != nil {
+		return x.Replica
+	}
+	return ""
+}
+
+func (x *ObjectSignature) GetHash() []byte {
+	if x != nil {
+		return x.Hash
+	}
+	return nil
+}
+
+func (x *ObjectSignature) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+// Precondition is what a write expects of the object it replaces
+type Precondition struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Kind          Precondition_Kind      `protobuf:"varint,1,opt,name=kind,proto3,enum=objectsync.v1.Precondition_Kind" json:"kind,omitempty"`
+	Hash          []byte                 `protobuf:"bytes,2,opt,name=hash,proto3" json:"hash,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Precondition) Reset() {
+	*x = Precondition{}
+	mi := &file_objectsync_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Precondition) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Precondition) ProtoMessage() {}
+
+func (x *Precondition) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Precondition.ProtoReflect.Descriptor instead.
+func (*Precondition) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Precondition) GetKind() Precondition_Kind {
+	if x != nil {
+		return x.Kind
+	}
+	return Precondition_ANY
+}
+
+func (x *Precondition) GetHash() []byte {
+	if x != nil {
+		return x.Hash
+	}
+	return nil
+}
+
+type ListRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRequest) Reset() {
+	*x = ListRequest{}
+	mi := &file_objectsync_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRequest) ProtoMessage() {}
+
+func (x *ListRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRequest.ProtoReflect.Descriptor instead.
+func (*ListRequest) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{3}
+}
+
+type GetRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRequest) Reset() {
+	*x = GetRequest{}
+	mi := &file_objectsync_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRequest) ProtoMessage() {}
+
+func (x *GetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRequest.ProtoReflect.Descriptor instead.
+func (*GetRequest) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GetRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type SetRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Object        *Object                `protobuf:"bytes,1,opt,name=object,proto3" json:"object,omitempty"`
+	Precondition  *Precondition          `protobuf:"bytes,2,opt,name=precondition,proto3" json:"precondition,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetRequest) Reset() {
+	*x = SetRequest{}
+	mi := &file_objectsync_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetRequest) ProtoMessage() {}
+
+func (x *SetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetRequest.ProtoReflect.Descriptor instead.
+func (*SetRequest) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *SetRequest) GetObject() *Object {
+	if x != nil {
+		return x.Object
+	}
+	return nil
+}
+
+func (x *SetRequest) GetPrecondition() *Precondition {
+	if x != nil {
+		return x.Precondition
+	}
+	return nil
+}
+
+type SetResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Hash          []byte                 `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetResponse) Reset() {
+	*x = SetResponse{}
+	mi := &file_objectsync_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetResponse) ProtoMessage() {}
+
+func (x *SetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetResponse.ProtoReflect.Descriptor instead.
+func (*SetResponse) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *SetResponse) GetHash() []byte {
+	if x != nil {
+		return x.Hash
+	}
+	return nil
+}
+
+type DeleteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Precondition  *Precondition          `protobuf:"bytes,2,opt,name=precondition,proto3" json:"precondition,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteRequest) Reset() {
+	*x = DeleteRequest{}
+	mi := &file_objectsync_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteRequest) ProtoMessage() {}
+
+func (x *DeleteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteRequest.ProtoReflect.Descriptor instead.
+func (*DeleteRequest) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *DeleteRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *DeleteRequest) GetPrecondition() *Precondition {
+	if x != nil {
+		return x.Precondition
+	}
+	return nil
+}
+
+type DeleteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteResponse) Reset() {
+	*x = DeleteResponse{}
+	mi := &file_objectsync_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteResponse) ProtoMessage() {}
+
+func (x *DeleteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteResponse.ProtoReflect.Descriptor instead.
+func (*DeleteResponse) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{8}
+}
+
+// Operation is one operation of a batch
+type Operation struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Op:
+	//
+	//	*Operation_Get
+	//	*Operation_Set
+	//	*Operation_Delete
+	Op            isOperation_Op `protobuf_oneof:"op"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Operation) Reset() {
+	*x = Operation{}
+	mi := &file_objectsync_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Operation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Operation) ProtoMessage() {}
+
+func (x *Operation) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Operation.ProtoReflect.Descriptor instead.
+func (*Operation) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Operation) GetOp() isOperation_Op {
+	if x != nil {
+		return x.Op
+	}
+	return nil
+}
+
+func (x *Operation) GetGet() *GetRequest {
+	if x != nil {
+		if x, ok := x.Op.(*Operation_Get); ok {
+			return x.Get
+		}
+	}
+	return nil
+}
+
+func (x *Operation) GetSet() *SetRequest {
+	if x != nil {
+		if x, ok := x.Op.(*Operation_Set); ok {
+			return x.Set
+		}
+	}
+	return nil
+}
+
+func (x *Operation) GetDelete() *DeleteRequest {
+	if x != nil {
+		if x, ok := x.Op.(*Operation_Delete); ok {
+			return x.Delete
+		}
+	}
+	return nil
+}
+
+type isOperation_Op interface {
+	isOperation_Op()
+}
+
+type Operation_Get struct {
+	Get *GetRequest `protobuf:"bytes,1,opt,name=get,proto3,oneof"`
+}
+
+type Operation_Set struct {
+	Set *SetRequest `protobuf:"bytes,2,opt,name=set,proto3,oneof"`
+}
+
+type Operation_Delete struct {
+	Delete *DeleteRequest `protobuf:"bytes,3,opt,name=delete,proto3,oneof"`
+}
+
+func (*Operation_Get) isOperation_Op() {}
+
+func (*Operation_Set) isOperation_Op() {}
+
+func (*Operation_Delete) isOperation_Op() {}
+
+// Result is the outcome of an operation.  Code is the status code the
+// operation would have failed with on its own, OK if it did not.
+type Result struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Code          int32                  `protobuf:"varint,1,opt,name=code,proto3" json:"code,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Object        *Object                `protobuf:"bytes,3,opt,name=object,proto3" json:"object,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Result) Reset() {
+	*x = Result{}
+	mi := &file_objectsync_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Result) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Result) ProtoMessage() {}
+
+func (x *Result) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Result.ProtoReflect.Descriptor instead.
+func (*Result) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Result) GetCode() int32 {
+	if x != nil {
+		return x.Code
+	}
+	return 0
+}
+
+func (x *Result) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Result) GetObject() *Object {
+	if x != nil {
+		return x.Object
+	}
+	return nil
+}
+
+// Progress counts the operations done on a stream, and the bytes of the
+// values sent and received
+type Progress struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Operations    int64                  `protobuf:"varint,1,opt,name=operations,proto3" json:"operations,omitempty"`
+	Bytes         int64                  `protobuf:"varint,2,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Progress) Reset() {
+	*x = Progress{}
+	mi := &file_objectsync_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Progress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Progress) ProtoMessage() {}
+
+func (x *Progress) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Progress.ProtoReflect.Descriptor instead.
+func (*Progress) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Progress) GetOperations() int64 {
+	if x != nil {
+		return x.Operations
+	}
+	return 0
+}
+
+func (x *Progress) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+type TransferRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Operations    []*Operation           `protobuf:"bytes,1,rep,name=operations,proto3" json:"operations,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TransferRequest) Reset() {
+	*x = TransferRequest{}
+	mi := &file_objectsync_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TransferRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TransferRequest) ProtoMessage() {}
+
+func (x *TransferRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TransferRequest.ProtoReflect.Descriptor instead.
+func (*TransferRequest) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *TransferRequest) GetOperations() []*Operation {
+	if x != nil {
+		return x.Operations
+	}
+	return nil
+}
+
+type TransferResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       []*Result              `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	Progress      *Progress              `protobuf:"bytes,2,opt,name=progress,proto3" json:"progress,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TransferResponse) Reset() {
+	*x = TransferResponse{}
+	mi := &file_objectsync_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TransferResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TransferResponse) ProtoMessage() {}
+
+func (x *TransferResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TransferResponse.ProtoReflect.Descriptor instead.
+func (*TransferResponse) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *TransferResponse) GetResults() []*Result {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+func (x *TransferResponse) GetProgress() *Progress {
+	if x != nil {
+		return x.Progress
+	}
+	return nil
+}
+
+type MerkleNodeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Prefix        string                 `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MerkleNodeRequest) Reset() {
+	*x = MerkleNodeRequest{}
+	mi := &file_objectsync_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MerkleNodeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MerkleNodeRequest) ProtoMessage() {}
+
+func (x *MerkleNodeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MerkleNodeRequest.ProtoReflect.Descriptor instead.
+func (*MerkleNodeRequest) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *MerkleNodeRequest) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+// MerkleNodeResponse is a node of the Merkle tree.  Either children or
+// objects is set unless the node is empty, and empty children have no hash.
+type MerkleNodeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Prefix        string                 `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	Hash          []byte                 `protobuf:"bytes,2,opt,name=hash,proto3" json:"hash,omitempty"`
+	Children      [][]byte               `protobuf:"bytes,3,rep,name=children,proto3" json:"children,omitempty"`
+	Objects       map[string][]byte      `protobuf:"bytes,4,rep,name=objects,proto3" json:"objects,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MerkleNodeResponse) Reset() {
+	*x = MerkleNodeResponse{}
+	mi := &file_objectsync_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MerkleNodeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MerkleNodeResponse) ProtoMessage() {}
+
+func (x *MerkleNodeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MerkleNodeResponse.ProtoReflect.Descriptor instead.
+func (*MerkleNodeResponse) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *MerkleNodeResponse) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+func (x *MerkleNodeResponse) GetHash() []byte {
+	if x != nil {
+		return x.Hash
+	}
+	return nil
+}
+
+func (x *MerkleNodeResponse) GetChildren() [][]byte {
+	if x != nil {
+		return x.Children
+	}
+	return nil
+}
+
+func (x *MerkleNodeResponse) GetObjects() map[string][]byte {
+	if x != nil {
+		return x.Objects
+	}
+	return nil
+}
+
+type SketchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cells         int32                  `protobuf:"varint,1,opt,name=cells,proto3" json:"cells,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SketchRequest) Reset() {
+	*x = SketchRequest{}
+	mi := &file_objectsync_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SketchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SketchRequest) ProtoMessage() {}
+
+func (x *SketchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SketchRequest.ProtoReflect.Descriptor instead.
+func (*SketchRequest) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *SketchRequest) GetCells() int32 {
+	if x != nil {
+		return x.Cells
+	}
+	return 0
+}
+
+// SketchCell is a cell of an IBLT sketch
+type SketchCell struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Count         int64                  `protobuf:"varint,1,opt,name=count,proto3" json:"count,omitempty"`
+	KeySum        []byte                 `protobuf:"bytes,2,opt,name=key_sum,json=keySum,proto3" json:"key_sum,omitempty"`
+	CheckSum      uint64                 `protobuf:"varint,3,opt,name=check_sum,json=checkSum,proto3" json:"check_sum,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SketchCell) Reset() {
+	*x = SketchCell{}
+	mi := &file_objectsync_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SketchCell) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SketchCell) ProtoMessage() {}
+
+func (x *SketchCell) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SketchCell.ProtoReflect.Descriptor instead.
+func (*SketchCell) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *SketchCell) GetCount() int64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *SketchCell) GetKeySum() []byte {
+	if x != nil {
+		return x.KeySum
+	}
+	return nil
+}
+
+func (x *SketchCell) GetCheckSum() uint64 {
+	if x != nil {
+		return x.CheckSum
+	}
+	return 0
+}
+
+type SketchResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cells         []*SketchCell          `protobuf:"bytes,1,rep,name=cells,proto3" json:"cells,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SketchResponse) Reset() {
+	*x = SketchResponse{}
+	mi := &file_objectsync_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SketchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SketchResponse) ProtoMessage() {}
+
+func (x *SketchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SketchResponse.ProtoReflect.Descriptor instead.
+func (*SketchResponse) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *SketchResponse) GetCells() []*SketchCell {
+	if x != nil {
+		return x.Cells
+	}
+	return nil
+}
+
+type DeltaSignatureRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	BlockSize     int32                  `protobuf:"varint,2,opt,name=block_size,json=blockSize,proto3" json:"block_size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeltaSignatureRequest) Reset() {
+	*x = DeltaSignatureRequest{}
+	mi := &file_objectsync_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeltaSignatureRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeltaSignatureRequest) ProtoMessage() {}
+
+func (x *DeltaSignatureRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeltaSignatureRequest.ProtoReflect.Descriptor instead.
+func (*DeltaSignatureRequest) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *DeltaSignatureRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *DeltaSignatureRequest) GetBlockSize() int32 {
+	if x != nil {
+		return x.BlockSize
+	}
+	return 0
+}
+
+// BlockSignature holds the checksums of a block of a value
+type BlockSignature struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Weak          uint32                 `protobuf:"varint,1,opt,name=weak,proto3" json:"weak,omitempty"`
+	Strong        []byte                 `protobuf:"bytes,2,opt,name=strong,proto3" json:"strong,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BlockSignature) Reset() {
+	*x = BlockSignature{}
+	mi := &file_objectsync_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BlockSignature) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BlockSignature) ProtoMessage() {}
+
+func (x *BlockSignature) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BlockSignature.ProtoReflect.Descriptor instead.
+func (*BlockSignature) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *BlockSignature) GetWeak() uint32 {
+	if x != nil {
+		return x.Weak
+	}
+	return 0
+}
+
+func (x *BlockSignature) GetStrong() []byte {
+	if x != nil {
+		return x.Strong
+	}
+	return nil
+}
+
+type DeltaSignatureResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	BlockSize     int32                  `protobuf:"varint,1,opt,name=block_size,json=blockSize,proto3" json:"block_size,omitempty"`
+	Blocks        []*BlockSignature      `protobuf:"bytes,2,rep,name=blocks,proto3" json:"blocks,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeltaSignatureResponse) Reset() {
+	*x = DeltaSignatureResponse{}
+	mi := &file_objectsync_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeltaSignatureResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeltaSignatureResponse) ProtoMessage() {}
+
+func (x *DeltaSignatureResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeltaSignatureResponse.ProtoReflect.Descriptor instead.
+func (*DeltaSignatureResponse) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *DeltaSignatureResponse) GetBlockSize() int32 {
+	if x != nil {
+		return x.BlockSize
+	}
+	return 0
+}
+
+func (x *DeltaSignatureResponse) GetBlocks() []*BlockSignature {
+	if x != nil {
+		return x.Blocks
+	}
+	return nil
+}
+
+// DeltaOp copies a block of the current value, or inserts data if the block
+// is negative
+type DeltaOp struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Block         int64                  `protobuf:"varint,1,opt,name=block,proto3" json:"block,omitempty"`
+	Data          []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeltaOp) Reset() {
+	*x = DeltaOp{}
+	mi := &file_objectsync_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeltaOp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeltaOp) ProtoMessage() {}
+
+func (x *DeltaOp) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeltaOp.ProtoReflect.Descriptor instead.
+func (*DeltaOp) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *DeltaOp) GetBlock() int64 {
+	if x != nil {
+		return x.Block
+	}
+	return 0
+}
+
+func (x *DeltaOp) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+// Delta makes a value with the hash out of the current one
+type Delta struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	BlockSize     int32                  `protobuf:"varint,1,opt,name=block_size,json=blockSize,proto3" json:"block_size,omitempty"`
+	Ops           []*DeltaOp             `protobuf:"bytes,2,rep,name=ops,proto3" json:"ops,omitempty"`
+	Hash          []byte                 `protobuf:"bytes,3,opt,name=hash,proto3" json:"hash,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Delta) Reset() {
+	*x = Delta{}
+	mi := &file_objectsync_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Delta) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Delta) ProtoMessage() {}
+
+func (x *Delta) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Delta.ProtoReflect.Descriptor instead.
+func (*Delta) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *Delta) GetBlockSize() int32 {
+	if x != nil {
+		return x.BlockSize
+	}
+	return 0
+}
+
+func (x *Delta) GetOps() []*DeltaOp {
+	if x != nil {
+		return x.Ops
+	}
+	return nil
+}
+
+func (x *Delta) GetHash() []byte {
+	if x != nil {
+		return x.Hash
+	}
+	return nil
+}
+
+// PatchRequest writes the object, without its value, with the value the
+// delta makes
+type PatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Object        *Object                `protobuf:"bytes,1,opt,name=object,proto3" json:"object,omitempty"`
+	Delta         *Delta                 `protobuf:"bytes,2,opt,name=delta,proto3" json:"delta,omitempty"`
+	Precondition  *Precondition          `protobuf:"bytes,3,opt,name=precondition,proto3" json:"precondition,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PatchRequest) Reset() {
+	*x = PatchRequest{}
+	mi := &file_objectsync_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PatchRequest) ProtoMessage() {}
+
+func (x *PatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_objectsync_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PatchRequest.ProtoReflect.Descriptor instead.
+func (*PatchRequest) Descriptor() ([]byte, []int) {
+	return file_objectsync_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *PatchRequest) GetObject() *Object {
+	if x != nil {
+		return x.Object
+	}
+	return nil
+}
+
+func (x *PatchRequest) GetDelta() *Delta {
+	if x != nil {
+		return x.Delta
+	}
+	return nil
+}
+
+func (x *PatchRequest) GetPrecondition() *Precondition {
+	if x != nil {
+		return x.Precondition
+	}
+	return nil
+}
+
+var File_objectsync_proto protoreflect.FileDescriptor
+
+const file_objectsync_proto_rawDesc = "" +
+	"\n" +
+	"\x10objectsync.proto\x12\robjectsync.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xd5\x02\n" +
+	"\x06Object\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\fR\x05value\x12\x12\n" +
+	"\x04hash\x18\x03 \x01(\fR\x04hash\x126\n" +
+	"\bmodified\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\bmodified\x12<\n" +
+	"\aversion\x18\x05 \x03(\v2\".objectsync.v1.Object.VersionEntryR\aversion\x12!\n" +
+	"\fversion_hash\x18\x06 \x01(\fR\vversionHash\x12<\n" +
+	"\tsignature\x18\a \x01(\v2\x1e.objectsync.v1.ObjectSignatureR\tsignature\x1a:\n" +
+	"\fVersionEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x04R\x05value:\x028\x01\"]\n" +
+	"\x0fObjectSignature\x12\x18\n" +
+	"\areplica\x18\x01 \x01(\tR\areplica\x12\x12\n" +
+	"\x04hash\x18\x02 \x01(\fR\x04hash\x12\x1c\n" +
+	"\tsignature\x18\x03 \x01(\fR\tsignature\"\x80\x01\n" +
+	"\fPrecondition\x124\n" +
+	"\x04kind\x18\x01 \x01(\x0e2 .objectsync.v1.Precondition.KindR\x04kind\x12\x12\n" +
+	"\x04hash\x18\x02 \x01(\fR\x04hash\"&\n" +
+	"\x04Kind\x12\a\n" +
+	"\x03ANY\x10\x00\x12\n" +
+	"\n" +
+	"\x06ABSENT\x10\x01\x12\t\n" +
+	"\x05MATCH\x10\x02\"\r\n" +
+	"\vListRequest\"\x1c\n" +
+	"\n" +
+	"GetRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"|\n" +
+	"\n" +
+	"SetRequest\x12-\n" +
+	"\x06object\x18\x01 \x01(\v2\x15.objectsync.v1.ObjectR\x06object\x12?\n" +
+	"\fprecondition\x18\x02 \x01(\v2\x1b.objectsync.v1.PreconditionR\fprecondition\"!\n" +
+	"\vSetResponse\x12\x12\n" +
+	"\x04hash\x18\x01 \x01(\fR\x04hash\"`\n" +
+	"\rDeleteRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12?\n" +
+	"\fprecondition\x18\x02 \x01(\v2\x1b.objectsync.v1.PreconditionR\fprecondition\"\x10\n" +
+	"\x0eDeleteResponse\"\xa7\x01\n" +
+	"\tOperation\x12-\n" +
+	"\x03get\x18\x01 \x01(\v2\x19.objectsync.v1.GetRequestH\x00R\x03get\x12-\n" +
+	"\x03set\x18\x02 \x01(\v2\x19.objectsync.v1.SetRequestH\x00R\x03set\x126\n" +
+	"\x06delete\x18\x03 \x01(\v2\x1c.objectsync.v1.DeleteRequestH\x00R\x06deleteB\x04\n" +
+	"\x02op\"e\n" +
+	"\x06Result\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\x05R\x04code\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12-\n" +
+	"\x06object\x18\x03 \x01(\v2\x15.objectsync.v1.ObjectR\x06object\"@\n" +
+	"\bProgress\x12\x1e\n" +
+	"\n" +
+	"operations\x18\x01 \x01(\x03R\n" +
+	"operations\x12\x14\n" +
+	"\x05bytes\x18\x02 \x01(\x03R\x05bytes\"K\n" +
+	"\x0fTransferRequest\x128\n" +
+	"\n" +
+	"operations\x18\x01 \x03(\v2\x18.objectsync.v1.OperationR\n" +
+	"operations\"x\n" +
+	"\x10TransferResponse\x12/\n" +
+	"\aresults\x18\x01 \x03(\v2\x15.objectsync.v1.ResultR\aresults\x123\n" +
+	"\bprogress\x18\x02 \x01(\v2\x17.objectsync.v1.ProgressR\bprogress\"+\n" +
+	"\x11MerkleNodeRequest\x12\x16\n" +
+	"\x06prefix\x18\x01 \x01(\tR\x06prefix\"\xe2\x01\n" +
+	"\x12MerkleNodeResponse\x12\x16\n" +
+	"\x06prefix\x18\x01 \x01(\tR\x06prefix\x12\x12\n" +
+	"\x04hash\x18\x02 \x01(\fR\x04hash\x12\x1a\n" +
+	"\bchildren\x18\x03 \x03(\fR\bchildren\x12H\n" +
+	"\aobjects\x18\x04 \x03(\v2..objectsync.v1.MerkleNodeResponse.ObjectsEntryR\aobjects\x1a:\n" +
+	"\fObjectsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\fR\x05value:\x028\x01\"%\n" +
+	"\rSketchRequest\x12\x14\n" +
+	"\x05cells\x18\x01 \x01(\x05R\x05cells\"X\n" +
+	"\n" +
+	"SketchCell\x12\x14\n" +
+	"\x05count\x18\x01 \x01(\x03R\x05count\x12\x17\n" +
+	"\akey_sum\x18\x02 \x01(\fR\x06keySum\x12\x1b\n" +
+	"\tcheck_sum\x18\x03 \x01(\x04R\bcheckSum\"A\n" +
+	"\x0eSketchResponse\x12/\n" +
+	"\x05cells\x18\x01 \x03(\v2\x19.objectsync.v1.SketchCellR\x05cells\"F\n" +
+	"\x15DeltaSignatureRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1d\n" +
+	"\n" +
+	"block_size\x18\x02 \x01(\x05R\tblockSize\"<\n" +
+	"\x0eBlockSignature\x12\x12\n" +
+	"\x04weak\x18\x01 \x01(\rR\x04weak\x12\x16\n" +
+	"\x06strong\x18\x02 \x01(\fR\x06strong\"n\n" +
+	"\x16DeltaSignatureResponse\x12\x1d\n" +
+	"\n" +
+	"block_size\x18\x01 \x01(\x05R\tblockSize\x125\n" +
+	"\x06blocks\x18\x02 \x03(\v2\x1d.objectsync.v1.BlockSignatureR\x06blocks\"3\n" +
+	"\aDeltaOp\x12\x14\n" +
+	"\x05block\x18\x01 \x01(\x03R\x05block\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\"d\n" +
+	"\x05Delta\x12\x1d\n" +
+	"\n" +
+	"block_size\x18\x01 \x01(\x05R\tblockSize\x12(\n" +
+	"\x03ops\x18\x02 \x03(\v2\x16.objectsync.v1.DeltaOpR\x03ops\x12\x12\n" +
+	"\x04hash\x18\x03 \x01(\fR\x04hash\"\xaa\x01\n" +
+	"\fPatchRequest\x12-\n" +
+	"\x06object\x18\x01 \x01(\v2\x15.objectsync.v1.ObjectR\x06object\x12*\n" +
+	"\x05delta\x18\x02 \x01(\v2\x14.objectsync.v1.DeltaR\x05delta\x12?\n" +
+	"\fprecondition\x18\x03 \x01(\v2\x1b.objectsync.v1.PreconditionR\fprecondition2\x93\x05\n" +
+	"\n" +
+	"ObjectSync\x12;\n" +
+	"\x04List\x12\x1a.objectsync.v1.ListRequest\x1a\x15.objectsync.v1.Object0\x01\x127\n" +
+	"\x03Get\x12\x19.objectsync.v1.GetRequest\x1a\x15.objectsync.v1.Object\x12<\n" +
+	"\x03Set\x12\x19.objectsync.v1.SetRequest\x1a\x1a.objectsync.v1.SetResponse\x12E\n" +
+	"\x06Delete\x12\x1c.objectsync.v1.DeleteRequest\x1a\x1d.objectsync.v1.DeleteResponse\x12O\n" +
+	"\bTransfer\x12\x1e.objectsync.v1.TransferRequest\x1a\x1f.objectsync.v1.TransferResponse(\x010\x01\x12Q\n" +
+	"\n" +
+	"MerkleNode\x12 .objectsync.v1.MerkleNodeRequest\x1a!.objectsync.v1.MerkleNodeResponse\x12E\n" +
+	"\x06Sketch\x12\x1c.objectsync.v1.SketchRequest\x1a\x1d.objectsync.v1.SketchResponse\x12]\n" +
+	"\x0eDeltaSignature\x12$.objectsync.v1.DeltaSignatureRequest\x1a%.objectsync.v1.DeltaSignatureResponse\x12@\n" +
+	"\x05Patch\x12\x1b.objectsync.v1.PatchRequest\x1a\x1a.objectsync.v1.SetResponseB@Z>github.com/keithballdotnet/objectsync/grpcstorage/objectsyncpbb\x06proto3"
+
+var (
+	file_objectsync_proto_rawDescOnce sync.Once
+	file_objectsync_proto_rawDescData []byte
+)
+
+func file_objectsync_proto_rawDescGZIP() []byte {
+	file_objectsync_proto_rawDescOnce.Do(func() {
+		file_objectsync_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_objectsync_proto_rawDesc), len(file_objectsync_proto_rawDesc)))
+	})
+	return file_objectsync_proto_rawDescData
+}
+
+var file_objectsync_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_objectsync_proto_msgTypes = make([]protoimpl.MessageInfo, 27)
+var file_objectsync_proto_goTypes = []any{
+	(Precondition_Kind)(0),         // 0: objectsync.v1.Precondition.Kind
+	(*Object)(nil),                 // 1: objectsync.v1.Object
+	(*ObjectSignature)(nil),        // 2: objectsync.v1.ObjectSignature
+	(*Precondition)(nil),           // 3: objectsync.v1.Precondition
+	(*ListRequest)(nil),            // 4: objectsync.v1.ListRequest
+	(*GetRequest)(nil),             // 5: objectsync.v1.GetRequest
+	(*SetRequest)(nil),             // 6: objectsync.v1.SetRequest
+	(*SetResponse)(nil),            // 7: objectsync.v1.SetResponse
+	(*DeleteRequest)(nil),          // 8: objectsync.v1.DeleteRequest
+	(*DeleteResponse)(nil),         // 9: objectsync.v1.DeleteResponse
+	(*Operation)(nil),              // 10: objectsync.v1.Operation
+	(*Result)(nil),                 // 11: objectsync.v1.Result
+	(*Progress)(nil),               // 12: objectsync.v1.Progress
+	(*TransferRequest)(nil),        // 13: objectsync.v1.TransferRequest
+	(*TransferResponse)(nil),       // 14: objectsync.v1.TransferResponse
+	(*MerkleNodeRequest)(nil),      // 15: objectsync.v1.MerkleNodeRequest
+	(*MerkleNodeResponse)(nil),     // 16: objectsync.v1.MerkleNodeResponse
+	(*SketchRequest)(nil),          // 17: objectsync.v1.SketchRequest
+	(*SketchCell)(nil),             // 18: objectsync.v1.SketchCell
+	(*SketchResponse)(nil),         // 19: objectsync.v1.SketchResponse
+	(*DeltaSignatureRequest)(nil),  // 20: objectsync.v1.DeltaSignatureRequest
+	(*BlockSignature)(nil),         // 21: objectsync.v1.BlockSignature
+	(*DeltaSignatureResponse)(nil), // 22: objectsync.v1.DeltaSignatureResponse
+	(*DeltaOp)(nil),                // 23: objectsync.v1.DeltaOp
+	(*Delta)(nil),                  // 24: objectsync.v1.Delta
+	(*PatchRequest)(nil),           // 25: objectsync.v1.PatchRequest
+	nil,                            // 26: objectsync.v1.Object.VersionEntry
+	nil,                            // 27: objectsync.v1.MerkleNodeResponse.ObjectsEntry
+	(*timestamppb.Timestamp)(nil),  // 28: google.protobuf.Timestamp
+}
+var file_objectsync_proto_depIdxs = []int32{
+	28, // 0: objectsync.v1.Object.modified:type_name -> google.protobuf.Timestamp
+	26, // 1: objectsync.v1.Object.version:type_name -> objectsync.v1.Object.VersionEntry
+	2,  // 2: objectsync.v1.Object.signature:type_name -> objectsync.v1.ObjectSignature
+	0,  // 3: objectsync.v1.Precondition.kind:type_name -> objectsync.v1.Precondition.Kind
+	1,  // 4: objectsync.v1.SetRequest.object:type_name -> objectsync.v1.Object
+	3,  // 5: objectsync.v1.SetRequest.precondition:type_name -> objectsync.v1.Precondition
+	3,  // 6: objectsync.v1.DeleteRequest.precondition:type_name -> objectsync.v1.Precondition
+	5,  // 7: objectsync.v1.Operation.get:type_name -> objectsync.v1.GetRequest
+	6,  // 8: objectsync.v1.Operation.set:type_name -> objectsync.v1.SetRequest
+	8,  // 9: objectsync.v1.Operation.delete:type_name -> objectsync.v1.DeleteRequest
+	1,  // 10: objectsync.v1.Result.object:type_name -> objectsync.v1.Object
+	10, // 11: objectsync.v1.TransferRequest.operations:type_name -> objectsync.v1.Operation
+	11, // 12: objectsync.v1.TransferResponse.results:type_name -> objectsync.v1.Result
+	12, // 13: objectsync.v1.TransferResponse.progress:type_name -> objectsync.v1.Progress
+	27, // 14: objectsync.v1.MerkleNodeResponse.objects:type_name -> objectsync.v1.MerkleNodeResponse.ObjectsEntry
+	18, // 15: objectsync.v1.SketchResponse.cells:type_name -> objectsync.v1.SketchCell
+	21, // 16: objectsync.v1.DeltaSignatureResponse.blocks:type_name -> objectsync.v1.BlockSignature
+	23, // 17: objectsync.v1.Delta.ops:type_name -> objectsync.v1.DeltaOp
+	1,  // 18: objectsync.v1.PatchRequest.object:type_name -> objectsync.v1.Object
+	24, // 19: objectsync.v1.PatchRequest.delta:type_name -> objectsync.v1.Delta
+	3,  // 20: objectsync.v1.PatchRequest.precondition:type_name -> objectsync.v1.Precondition
+	4,  // 21: objectsync.v1.ObjectSync.List:input_type -> objectsync.v1.ListRequest
+	5,  // 22: objectsync.v1.ObjectSync.Get:input_type -> objectsync.v1.GetRequest
+	6,  // 23: objectsync.v1.ObjectSync.Set:input_type -> objectsync.v1.SetRequest
+	8,  // 24: objectsync.v1.ObjectSync.Delete:input_type -> objectsync.v1.DeleteRequest
+	13, // 25: objectsync.v1.ObjectSync.Transfer:input_type -> objectsync.v1.TransferRequest
+	15, // 26: objectsync.v1.ObjectSync.MerkleNode:input_type -> objectsync.v1.MerkleNodeRequest
+	17, // 27: objectsync.v1.ObjectSync.Sketch:input_type -> objectsync.v1.SketchRequest
+	20, // 28: objectsync.v1.ObjectSync.DeltaSignature:input_type -> objectsync.v1.DeltaSignatureRequest
+	25, // 29: objectsync.v1.ObjectSync.Patch:input_type -> objectsync.v1.PatchRequest
+	1,  // 30: objectsync.v1.ObjectSync.List:output_type -> objectsync.v1.Object
+	1,  // 31: objectsync.v1.ObjectSync.Get:output_type -> objectsync.v1.Object
+	7,  // 32: objectsync.v1.ObjectSync.Set:output_type -> objectsync.v1.SetResponse
+	9,  // 33: objectsync.v1.ObjectSync.Delete:output_type -> objectsync.v1.DeleteResponse
+	14, // 34: objectsync.v1.ObjectSync.Transfer:output_type -> objectsync.v1.TransferResponse
+	16, // 35: objectsync.v1.ObjectSync.MerkleNode:output_type -> objectsync.v1.MerkleNodeResponse
+	19, // 36: objectsync.v1.ObjectSync.Sketch:output_type -> objectsync.v1.SketchResponse
+	22, // 37: objectsync.v1.ObjectSync.DeltaSignature:output_type -> objectsync.v1.DeltaSignatureResponse
+	7,  // 38: objectsync.v1.ObjectSync.Patch:output_type -> objectsync.v1.SetResponse
+	30, // [30:39] is the sub-list for method output_type
+	21, // [21:30] is the sub-list for method input_type
+	21, // [21:21] is the sub-list for extension type_name
+	21, // [21:21] is the sub-list for extension extendee
+	0,  // [0:21] is the sub-list for field type_name
+}
+
+func init() { file_objectsync_proto_init() }
+func file_objectsync_proto_init() {
+	if File_objectsync_proto != nil {
+		return
+	}
+	file_objectsync_proto_msgTypes[9].OneofWrappers = []any{
+		(*Operation_Get)(nil),
+		(*Operation_Set)(nil),
+		(*Operation_Delete)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_objectsync_proto_rawDesc), len(file_objectsync_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   27,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_objectsync_proto_goTypes,
+		DependencyIndexes: file_objectsync_proto_depIdxs,
+		EnumInfos:         file_objectsync_proto_enumTypes,
+		MessageInfos:      file_objectsync_proto_msgTypes,
+	}.Build()
+	File_objectsync_proto = out.File
+	file_objectsync_proto_goTypes = nil
+	file_objectsync_proto_depIdxs = nil
+}
@@ -0,0 +1,459 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: objectsync.proto
+
+package objectsyncpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ObjectSync_List_FullMethodName           = "/objectsync.v1.ObjectSync/List"
+	ObjectSync_Get_FullMethodName            = "/objectsync.v1.ObjectSync/Get"
+	ObjectSync_Set_FullMethodName            = "/objectsync.v1.ObjectSync/Set"
+	ObjectSync_Delete_FullMethodName         = "/objectsync.v1.ObjectSync/Delete"
+	ObjectSync_Transfer_FullMethodName       = "/objectsync.v1.ObjectSync/Transfer"
+	ObjectSync_MerkleNode_FullMethodName     = "/objectsync.v1.ObjectSync/MerkleNode"
+	ObjectSync_Sketch_FullMethodName         = "/objectsync.v1.ObjectSync/Sketch"
+	ObjectSync_DeltaSignature_FullMethodName = "/objectsync.v1.ObjectSync/DeltaSignature"
+	ObjectSync_Patch_FullMethodName          = "/objectsync.v1.ObjectSync/Patch"
+)
+
+// ObjectSyncClient is the client API for ObjectSync service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ObjectSync serves a storage to sync with
+type ObjectSyncClient interface {
+	// List streams the objects of the storage without their values
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Object], error)
+	// Get returns an object, or fails with NOT_FOUND
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Object, error)
+	// Set writes an object, or fails with FAILED_PRECONDITION
+	Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error)
+	// Delete removes an object, or fails with FAILED_PRECONDITION
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	// Transfer runs batches of operations.  Each request is answered by a
+	// response with a result per operation, in order, and the progress of the
+	// stream so far.
+	Transfer(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[TransferRequest, TransferResponse], error)
+	// MerkleNode returns the node of the Merkle tree of the storage at a
+	// prefix
+	MerkleNode(ctx context.Context, in *MerkleNodeRequest, opts ...grpc.CallOption) (*MerkleNodeResponse, error)
+	// Sketch returns the IBLT sketch of the objects of the storage, or fails
+	// with INVALID_ARGUMENT for too many cells
+	Sketch(ctx context.Context, in *SketchRequest, opts ...grpc.CallOption) (*SketchResponse, error)
+	// DeltaSignature returns the signature of the blocks of the value of an
+	// object, or fails with NOT_FOUND
+	DeltaSignature(ctx context.Context, in *DeltaSignatureRequest, opts ...grpc.CallOption) (*DeltaSignatureResponse, error)
+	// Patch writes an object with the value a delta makes of the current one,
+	// or fails with FAILED_PRECONDITION, or ABORTED if the delta does not make
+	// the value it was made for
+	Patch(ctx context.Context, in *PatchRequest, opts ...grpc.CallOption) (*SetResponse, error)
+}
+
+type objectSyncClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewObjectSyncClient(cc grpc.ClientConnInterface) ObjectSyncClient {
+	return &objectSyncClient{cc}
+}
+
+func (c *objectSyncClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Object], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ObjectSync_ServiceDesc.Streams[0], ObjectSync_List_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ListRequest, Object]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ObjectSync_ListClient = grpc.ServerStreamingClient[Object]
+
+func (c *objectSyncClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Object, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Object)
+	err := c.cc.Invoke(ctx, ObjectSync_Get_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *objectSyncClient) Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetResponse)
+	err := c.cc.Invoke(ctx, ObjectSync_Set_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *objectSyncClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, ObjectSync_Delete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *objectSyncClient) Transfer(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[TransferRequest, TransferResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ObjectSync_ServiceDesc.Streams[1], ObjectSync_Transfer_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[TransferRequest, TransferResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ObjectSync_TransferClient = grpc.BidiStreamingClient[TransferRequest, TransferResponse]
+
+func (c *objectSyncClient) MerkleNode(ctx context.Context, in *MerkleNodeRequest, opts ...grpc.CallOption) (*MerkleNodeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MerkleNodeResponse)
+	err := c.cc.Invoke(ctx, ObjectSync_MerkleNode_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *objectSyncClient) Sketch(ctx context.Context, in *SketchRequest, opts ...grpc.CallOption) (*SketchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SketchResponse)
+	err := c.cc.Invoke(ctx, ObjectSync_Sketch_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *objectSyncClient) DeltaSignature(ctx context.Context, in *DeltaSignatureRequest, opts ...grpc.CallOption) (*DeltaSignatureResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeltaSignatureResponse)
+	err := c.cc.Invoke(ctx, ObjectSync_DeltaSignature_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *objectSyncClient) Patch(ctx context.Context, in *PatchRequest, opts ...grpc.CallOption) (*SetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetResponse)
+	err := c.cc.Invoke(ctx, ObjectSync_Patch_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ObjectSyncServer is the server API for ObjectSync service.
+// All implementations must embed UnimplementedObjectSyncServer
+// for forward compatibility.
+//
+// ObjectSync serves a storage to sync with
+type ObjectSyncServer interface {
+	// List streams the objects of the storage without their values
+	List(*ListRequest, grpc.ServerStreamingServer[Object]) error
+	// Get returns an object, or fails with NOT_FOUND
+	Get(context.Context, *GetRequest) (*Object, error)
+	// Set writes an object, or fails with FAILED_PRECONDITION
+	Set(context.Context, *SetRequest) (*SetResponse, error)
+	// Delete removes an object, or fails with FAILED_PRECONDITION
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	// Transfer runs batches of operations.  Each request is answered by a
+	// response with a result per operation, in order, and the progress of the
+	// stream so far.
+	Transfer(grpc.BidiStreamingServer[TransferRequest, TransferResponse]) error
+	// MerkleNode returns the node of the Merkle tree of the storage at a
+	// prefix
+	MerkleNode(context.Context, *MerkleNodeRequest) (*MerkleNodeResponse, error)
+	// Sketch returns the IBLT sketch of the objects of the storage, or fails
+	// with INVALID_ARGUMENT for too many cells
+	Sketch(context.Context, *SketchRequest) (*SketchResponse, error)
+	// DeltaSignature returns the signature of the blocks of the value of an
+	// object, or fails with NOT_FOUND
+	DeltaSignature(context.Context, *DeltaSignatureRequest) (*DeltaSignatureResponse, error)
+	// Patch writes an object with the value a delta makes of the current one,
+	// or fails with FAILED_PRECONDITION, or ABORTED if the delta does not make
+	// the value it was made for
+	Patch(context.Context, *PatchRequest) (*SetResponse, error)
+	mustEmbedUnimplementedObjectSyncServer()
+}
+
+// UnimplementedObjectSyncServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedObjectSyncServer struct{}
+
+func (UnimplementedObjectSyncServer) List(*ListRequest, grpc.ServerStreamingServer[Object]) error {
+	return status.Error(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedObjectSyncServer) Get(context.Context, *GetRequest) (*Object, error) {
+	return nil, status.Error(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedObjectSyncServer) Set(context.Context, *SetRequest) (*SetResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Set not implemented")
+}
+func (UnimplementedObjectSyncServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedObjectSyncServer) Transfer(grpc.BidiStreamingServer[TransferRequest, TransferResponse]) error {
+	return status.Error(codes.Unimplemented, "method Transfer not implemented")
+}
+func (UnimplementedObjectSyncServer) MerkleNode(context.Context, *MerkleNodeRequest) (*MerkleNodeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method MerkleNode not implemented")
+}
+func (UnimplementedObjectSyncServer) Sketch(context.Context, *SketchRequest) (*SketchResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Sketch not implemented")
+}
+func (UnimplementedObjectSyncServer) DeltaSignature(context.Context, *DeltaSignatureRequest) (*DeltaSignatureResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method DeltaSignature not implemented")
+}
+func (UnimplementedObjectSyncServer) Patch(context.Context, *PatchRequest) (*SetResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Patch not implemented")
+}
+func (UnimplementedObjectSyncServer) mustEmbedUnimplementedObjectSyncServer() {}
+func (UnimplementedObjectSyncServer) testEmbeddedByValue()                    {}
+
+// UnsafeObjectSyncServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ObjectSyncServer will
+// result in compilation errors.
+type UnsafeObjectSyncServer interface {
+	mustEmbedUnimplementedObjectSyncServer()
+}
+
+func RegisterObjectSyncServer(s grpc.ServiceRegistrar, srv ObjectSyncServer) {
+	// If the following call panics, it indicates UnimplementedObjectSyncServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ObjectSync_ServiceDesc, srv)
+}
+
+func _ObjectSync_List_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ObjectSyncServer).List(m, &grpc.GenericServerStream[ListRequest, Object]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ObjectSync_ListServer = grpc.ServerStreamingServer[Object]
+
+func _ObjectSync_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ObjectSyncServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ObjectSync_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ObjectSyncServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ObjectSync_Set_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ObjectSyncServer).Set(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ObjectSync_Set_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ObjectSyncServer).Set(ctx, req.(*SetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ObjectSync_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ObjectSyncServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ObjectSync_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ObjectSyncServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ObjectSync_Transfer_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ObjectSyncServer).Transfer(&grpc.GenericServerStream[TransferRequest, TransferResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ObjectSync_TransferServer = grpc.BidiStreamingServer[TransferRequest, TransferResponse]
+
+func _ObjectSync_MerkleNode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MerkleNodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ObjectSyncServer).MerkleNode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ObjectSync_MerkleNode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ObjectSyncServer).MerkleNode(ctx, req.(*MerkleNodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ObjectSync_Sketch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SketchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ObjectSyncServer).Sketch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ObjectSync_Sketch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ObjectSyncServer).Sketch(ctx, req.(*SketchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ObjectSync_DeltaSignature_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeltaSignatureRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ObjectSyncServer).DeltaSignature(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ObjectSync_DeltaSignature_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ObjectSyncServer).DeltaSignature(ctx, req.(*DeltaSignatureRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ObjectSync_Patch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ObjectSyncServer).Patch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ObjectSync_Patch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ObjectSyncServer).Patch(ctx, req.(*PatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ObjectSync_ServiceDesc is the grpc.ServiceDesc for ObjectSync service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ObjectSync_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "objectsync.v1.ObjectSync",
+	HandlerType: (*ObjectSyncServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _ObjectSync_Get_Handler,
+		},
+		{
+			MethodName: "Set",
+			Handler:    _ObjectSync_Set_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _ObjectSync_Delete_Handler,
+		},
+		{
+			MethodName: "MerkleNode",
+			Handler:    _ObjectSync_MerkleNode_Handler,
+		},
+		{
+			MethodName: "Sketch",
+			Handler:    _ObjectSync_Sketch_Handler,
+		},
+		{
+			MethodName: "DeltaSignature",
+			Handler:    _ObjectSync_DeltaSignature_Handler,
+		},
+		{
+			MethodName: "Patch",
+			Handler:    _ObjectSync_Patch_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "List",
+			Handler:       _ObjectSync_List_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Transfer",
+			Handler:       _ObjectSync_Transfer_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "objectsync.proto",
+}
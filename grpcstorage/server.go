@@ -0,0 +1,374 @@
+// Package grpcstorage serves any objectsync.Storage as a gRPC service, and
+// implements a storage on such a service, so storages in different processes
+// can be synced.  The service is defined in objectsyncpb/objectsync.proto.
+package grpcstorage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/keithballdotnet/objectsync"
+	pb "github.com/keithballdotnet/objectsync/grpcstorage/objectsyncpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MaxCells is the most cells of a sketch served
+const MaxCells = 1 << 20
+
+// Server is an objectsyncpb.ObjectSyncServer serving a Storage.  Writes are
+// serialized with each other and with reads, so their preconditions hold
+// against the other writes through the server, and the storage need not be
+// safe for concurrent use.
+type Server struct {
+	pb.UnimplementedObjectSyncServer
+
+	store objectsync.Storage
+	mu    sync.RWMutex
+
+	// tree is the Merkle tree of the last root asked for, kept for the nodes
+	// below until the next write
+	treeMu sync.Mutex
+	tree   *objectsync.MerkleTree
+}
+
+// NewServer will return a Server serving store
+func NewServer(store objectsync.Storage) *Server {
+	return &Server{store: store}
+}
+
+// List will stream the objects ordered by ID, without reading their values
+// if the storage can list them
+func (s *Server) List(req *pb.ListRequest, stream grpc.ServerStreamingServer[pb.Object]) error {
+	s.mu.RLock()
+	objects, err := s.list(stream.Context())
+	s.mu.RUnlock()
+	if err != nil {
+		return toStatus(err)
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].ID < objects[j].ID
+	})
+	for _, object := range objects {
+		err = stream.Send(toProto(object, false))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) list(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	if lister, ok := s.store.(objectsync.Lister); ok {
+		return lister.List(ctx)
+	}
+	return s.store.GetAll(ctx)
+}
+
+// Get ...
+func (s *Server) Get(ctx context.Context, req *pb.GetRequest) (*pb.Object, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.get(ctx, req)
+}
+
+// Set ...
+func (s *Server) Set(ctx context.Context, req *pb.SetRequest) (*pb.SetResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.set(ctx, req)
+}
+
+// Delete ...
+func (s *Server) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.delete(ctx, req)
+}
+
+// Transfer will run each batch of operations received, in order, and answer
+// with their results and the progress of the stream
+func (s *Server) Transfer(stream grpc.BidiStreamingServer[pb.TransferRequest, pb.TransferResponse]) error {
+	ctx := stream.Context()
+	progress := &pb.Progress{}
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		resp := &pb.TransferResponse{Results: make([]*pb.Result, len(req.Operations))}
+		s.mu.Lock()
+		for i, op := range req.Operations {
+			resp.Results[i] = s.run(ctx, op, progress)
+		}
+		s.mu.Unlock()
+
+		resp.Progress = &pb.Progress{Operations: progress.Operations, Bytes: progress.Bytes}
+		err = stream.Send(resp)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// MerkleNode will return the node at prefix of the Merkle tree of the
+// storage if it is an objectsync.Merkler.  Otherwise the tree is built from
+// the listing when its root is asked for, as a walk of a tree starts there,
+// and kept for the nodes below.
+func (s *Server) MerkleNode(ctx context.Context, req *pb.MerkleNodeRequest) (*pb.MerkleNodeResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var node *objectsync.MerkleNode
+	if merkler, ok := s.store.(objectsync.Merkler); ok {
+		var err error
+		node, err = merkler.MerkleNode(ctx, req.Prefix)
+		if err != nil {
+			return nil, toStatus(err)
+		}
+	} else {
+		s.treeMu.Lock()
+		tree := s.tree
+		s.treeMu.Unlock()
+		if req.Prefix == "" || tree == nil {
+			objects, err := s.list(ctx)
+			if err != nil {
+				return nil, toStatus(err)
+			}
+			tree = objectsync.NewMerkleTree()
+			for _, object := range objects {
+				tree.Set(object.ID, object.Hash)
+			}
+			s.treeMu.Lock()
+			s.tree = tree
+			s.treeMu.Unlock()
+		}
+		node = tree.Node(req.Prefix)
+	}
+
+	resp := &pb.MerkleNodeResponse{Prefix: node.Prefix, Hash: node.Hash, Objects: map[string][]byte{}}
+	for _, child := range node.Children {
+		resp.Children = append(resp.Children, child)
+	}
+	for id, hash := range node.Objects {
+		resp.Objects[id] = hash
+	}
+	return resp, nil
+}
+
+// Sketch will return the sketch of the storage, made from the listing if it
+// is not an objectsync.Sketcher
+func (s *Server) Sketch(ctx context.Context, req *pb.SketchRequest) (*pb.SketchResponse, error) {
+	if req.Cells < 1 || req.Cells > MaxCells {
+		return nil, status.Error(codes.InvalidArgument, "invalid cells")
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var sketch *objectsync.IBLT
+	if sketcher, ok := s.store.(objectsync.Sketcher); ok {
+		var err error
+		sketch, err = sketcher.Sketch(ctx, int(req.Cells))
+		if err != nil {
+			return nil, toStatus(err)
+		}
+	} else {
+		objects, err := s.list(ctx)
+		if err != nil {
+			return nil, toStatus(err)
+		}
+		sketch = objectsync.NewIBLT(int(req.Cells))
+		for _, object := range objects {
+			sketch.Insert(object.ID, object.Hash)
+		}
+	}
+
+	resp := &pb.SketchResponse{Cells: make([]*pb.SketchCell, len(sketch.Cells))}
+	for i, cell := range sketch.Cells {
+		resp.Cells[i] = &pb.SketchCell{Count: cell.Count, KeySum: cell.KeySum, CheckSum: cell.CheckSum}
+	}
+	return resp, nil
+}
+
+// DeltaSignature will return the signature of the value of the object, made
+// from the value read if the storage is not an objectsync.DeltaStorage
+func (s *Server) DeltaSignature(ctx context.Context, req *pb.DeltaSignatureRequest) (*pb.DeltaSignatureResponse, error) {
+	if req.BlockSize < 1 {
+		return nil, status.Error(codes.InvalidArgument, "invalid block size")
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if deltas, ok := s.store.(objectsync.DeltaStorage); ok {
+		signature, err := deltas.DeltaSignature(ctx, req.Id, int(req.BlockSize))
+		if err != nil {
+			return nil, toStatus(err)
+		}
+		return toProtoSignature(signature), nil
+	}
+
+	object, err := s.store.Get(ctx, req.Id)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toProtoSignature(objectsync.NewDeltaSignature(object.Value, int(req.BlockSize))), nil
+}
+
+// Patch will set the object with the value the delta makes of the current
+// one, applied by the storage if it is an objectsync.DeltaStorage
+func (s *Server) Patch(ctx context.Context, req *pb.PatchRequest) (*pb.SetResponse, error) {
+	if req.GetObject().GetId() == "" || req.Delta == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing object or delta")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.check(ctx, req.Object.Id, req.Precondition)
+	if err != nil {
+		return nil, err
+	}
+
+	s.forget()
+	object := fromProto(req.Object)
+	object.Value = ""
+	delta := fromProtoDelta(req.Delta)
+	if deltas, ok := s.store.(objectsync.DeltaStorage); ok {
+		err = deltas.Patch(ctx, object, delta)
+		if err != nil {
+			return nil, toStatus(err)
+		}
+		return &pb.SetResponse{Hash: object.Hash}, nil
+	}
+
+	current, err := s.store.Get(ctx, object.ID)
+	if err != nil {
+		if objectsync.IsNotFoundError(err) {
+			return nil, toStatus(objectsync.ErrorDeltaMismatch)
+		}
+		return nil, toStatus(err)
+	}
+	object.Value, err = objectsync.ApplyDelta(current.Value, delta)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	err = s.store.Set(ctx, object)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.SetResponse{Hash: object.Hash}, nil
+}
+
+// forget will drop the tree kept, once the storage is written to
+func (s *Server) forget() {
+	s.treeMu.Lock()
+	s.tree = nil
+	s.treeMu.Unlock()
+}
+
+// run will run the operation, and count it in progress
+func (s *Server) run(ctx context.Context, op *pb.Operation, progress *pb.Progress) *pb.Result {
+	progress.Operations++
+
+	var object *pb.Object
+	var err error
+	switch {
+	case op.GetGet() != nil:
+		object, err = s.get(ctx, op.GetGet())
+		if err == nil {
+			progress.Bytes += int64(len(object.Value))
+		}
+	case op.GetSet() != nil:
+		req := op.GetSet()
+		var resp *pb.SetResponse
+		resp, err = s.set(ctx, req)
+		if err == nil {
+			progress.Bytes += int64(len(req.GetObject().GetValue()))
+			object = &pb.Object{Id: req.GetObject().GetId(), Hash: resp.Hash}
+		}
+	case op.GetDelete() != nil:
+		_, err = s.delete(ctx, op.GetDelete())
+	default:
+		err = status.Error(codes.InvalidArgument, "empty operation")
+	}
+
+	if err != nil {
+		st := status.Convert(err)
+		return &pb.Result{Code: int32(st.Code()), Message: st.Message()}
+	}
+	return &pb.Result{Code: int32(codes.OK), Object: object}
+}
+
+func (s *Server) get(ctx context.Context, req *pb.GetRequest) (*pb.Object, error) {
+	object, err := s.store.Get(ctx, req.Id)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toProto(object, true), nil
+}
+
+func (s *Server) set(ctx context.Context, req *pb.SetRequest) (*pb.SetResponse, error) {
+	if req.GetObject().GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing object")
+	}
+	err := s.check(ctx, req.Object.Id, req.Precondition)
+	if err != nil {
+		return nil, err
+	}
+
+	s.forget()
+	object := fromProto(req.Object)
+	err = s.store.Set(ctx, object)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.SetResponse{Hash: object.Hash}, nil
+}
+
+func (s *Server) delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	err := s.check(ctx, req.Id, req.Precondition)
+	if err != nil {
+		return nil, err
+	}
+
+	s.forget()
+	err = s.store.Delete(ctx, req.Id)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.DeleteResponse{}, nil
+}
+
+// check will fail with FAILED_PRECONDITION if the object with id does not
+// meet precondition
+func (s *Server) check(ctx context.Context, id string, precondition *pb.Precondition) error {
+	kind := precondition.GetKind()
+	if kind == pb.Precondition_ANY {
+		return nil
+	}
+
+	object, err := s.store.Get(ctx, id)
+	if err != nil && !objectsync.IsNotFoundError(err) {
+		return toStatus(err)
+	}
+	found := err == nil
+
+	if (kind == pb.Precondition_ABSENT && found) || (kind == pb.Precondition_MATCH && (!found || !bytes.Equal(object.Hash, precondition.Hash))) {
+		return toStatus(objectsync.ErrorPreconditionFailed)
+	}
+	return nil
+}
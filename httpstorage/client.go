@@ -0,0 +1,342 @@
+package httpstorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/keithballdotnet/objectsync"
+)
+
+// HTTPStorage is an objectsync.Storage on a server speaking the protocol of
+// the package, such as a Handler.
+//
+// The Hash of an object is the one of the storage served, so objects are
+// listed without downloading them.  Writes are conditional on the ETag last
+// read for the object, and fail with objectsync.ErrorPreconditionFailed if
+// it has changed since.  It is an objectsync.Merkler and an
+// objectsync.Sketcher, so Sync can read only the nodes of the Merkle tree of
+// the server that differ, or its sketch.  It is an objectsync.DeltaStorage
+// too, so only the blocks of a large value that changed are sent.
+type HTTPStorage struct {
+	client *http.Client
+	base   *url.URL
+	limit  int
+
+	mu sync.Mutex
+	// etags are the ETags last read per ID, empty if it was read as missing
+	etags map[string]string
+}
+
+// NewHTTPStorage will return a HTTPStorage for the server at baseURL.
+// Authentication is left to the transport of client.
+func NewHTTPStorage(client *http.Client, baseURL string) (*HTTPStorage, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPStorage{
+		client: client,
+		base:   base,
+		limit:  DefaultLimit,
+		etags:  make(map[string]string),
+	}, nil
+}
+
+// GetName will return the base URL
+func (s *HTTPStorage) GetName() string {
+	return s.base.String()
+}
+
+// objectURL will return the URL of the object.  Dot segments are escaped too,
+// so they are not resolved away.
+func (s *HTTPStorage) objectURL(id string) string {
+	escaped := url.PathEscape(id)
+	if id == "." || id == ".." {
+		escaped = strings.ReplaceAll(escaped, ".", "%2E")
+	}
+	return s.base.String() + "objects/" + escaped
+}
+
+// Set ...
+func (s *HTTPStorage) Set(ctx context.Context, object *objectsync.GenericObject) error {
+	header := http.Header{}
+	etag, seen := s.etag(object.ID)
+	switch {
+	case seen && etag == "":
+		header.Set("If-None-Match", "*")
+	case seen:
+		header.Set("If-Match", etag)
+	}
+
+	result := &Object{}
+	err := s.do(ctx, http.MethodPut, s.objectURL(object.ID), header, toWire(object, true), result)
+	if err != nil {
+		return err
+	}
+
+	s.setETag(object.ID, ETag(result.Hash))
+	object.Hash = result.Hash
+	return nil
+}
+
+// Get ...
+func (s *HTTPStorage) Get(ctx context.Context, id string) (*objectsync.GenericObject, error) {
+	result := &Object{}
+	err := s.do(ctx, http.MethodGet, s.objectURL(id), nil, nil, result)
+	if err != nil {
+		if objectsync.IsNotFoundError(err) {
+			s.setETag(id, "")
+		}
+		return nil, err
+	}
+
+	s.setETag(id, ETag(result.Hash))
+	return fromWire(result), nil
+}
+
+// GetAll will return all objects, fetching the values of each page of the
+// listing in a batch
+func (s *HTTPStorage) GetAll(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	all := objectsync.GenericObjectCollection{}
+	err := s.pages(ctx, func(page *Page) error {
+		if len(page.Objects) == 0 {
+			return nil
+		}
+		batch := &Batch{}
+		for _, object := range page.Objects {
+			batch.Operations = append(batch.Operations, &Operation{Op: OpGet, ID: object.ID})
+		}
+		results, err := s.Batch(ctx, batch)
+		if err != nil {
+			return err
+		}
+
+		for i, result := range results.Results {
+			switch {
+			case result.Status == http.StatusOK && result.Object != nil:
+				s.setETag(result.Object.ID, ETag(result.Object.Hash))
+				all = append(all, fromWire(result.Object))
+			case result.Status == http.StatusNotFound:
+				// Deleted since it was listed
+				s.setETag(batch.Operations[i].ID, "")
+			default:
+				return statusError(result.Status, result.Error)
+			}
+		}
+		return nil
+	})
+	return all, err
+}
+
+// List will return all objects without their values
+func (s *HTTPStorage) List(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	all := objectsync.GenericObjectCollection{}
+	err := s.pages(ctx, func(page *Page) error {
+		for _, object := range page.Objects {
+			s.setETag(object.ID, ETag(object.Hash))
+			all = append(all, fromWire(object))
+		}
+		return nil
+	})
+	return all, err
+}
+
+// pages will call fn with each page of the listing
+func (s *HTTPStorage) pages(ctx context.Context, fn func(page *Page) error) error {
+	after := ""
+	for {
+		query := url.Values{"limit": {strconv.Itoa(s.limit)}}
+		if after != "" {
+			query.Set("after", after)
+		}
+		u := s.base.ResolveReference(&url.URL{Path: "objects", RawQuery: query.Encode()})
+
+		page := &Page{}
+		err := s.do(ctx, http.MethodGet, u.String(), nil, nil, page)
+		if err != nil {
+			return err
+		}
+		err = fn(page)
+		if err != nil {
+			return err
+		}
+		if page.Next == "" {
+			return nil
+		}
+		after = page.Next
+	}
+}
+
+// MerkleNode will return the node at prefix of the Merkle tree of the server
+func (s *HTTPStorage) MerkleNode(ctx context.Context, prefix string) (*objectsync.MerkleNode, error) {
+	u := s.base.ResolveReference(&url.URL{Path: "merkle", RawQuery: url.Values{"prefix": {prefix}}.Encode()})
+	node := &Node{}
+	err := s.do(ctx, http.MethodGet, u.String(), nil, nil, node)
+	if err != nil {
+		return nil, err
+	}
+	return &objectsync.MerkleNode{Prefix: node.Prefix, Hash: node.Hash, Children: node.Children, Objects: node.Objects}, nil
+}
+
+// Sketch will return the sketch of the objects of the server
+func (s *HTTPStorage) Sketch(ctx context.Context, cells int) (*objectsync.IBLT, error) {
+	u := s.base.ResolveReference(&url.URL{Path: "sketch", RawQuery: url.Values{"cells": {strconv.Itoa(cells)}}.Encode()})
+	wire := &Sketch{}
+	err := s.do(ctx, http.MethodGet, u.String(), nil, nil, wire)
+	if err != nil {
+		return nil, err
+	}
+
+	sketch := &objectsync.IBLT{Cells: make([]objectsync.IBLTCell, len(wire.Cells))}
+	for i, cell := range wire.Cells {
+		sketch.Cells[i] = objectsync.IBLTCell{Count: cell.Count, KeySum: cell.KeySum, CheckSum: cell.CheckSum}
+	}
+	return sketch, nil
+}
+
+// DeltaSignature will return the signature of the value of the object on the
+// server
+func (s *HTTPStorage) DeltaSignature(ctx context.Context, id string, blockSize int) (*objectsync.DeltaSignature, error) {
+	escaped := strings.TrimPrefix(s.objectURL(id), s.base.String()+"objects/")
+	target := s.base.String() + "signature/" + escaped + "?" + url.Values{"blockSize": {strconv.Itoa(blockSize)}}.Encode()
+	signature := &Signature{}
+	err := s.do(ctx, http.MethodGet, target, nil, nil, signature)
+	if err != nil {
+		return nil, err
+	}
+	return fromWireSignature(signature), nil
+}
+
+// Patch will set the object with the value delta makes of the one on the
+// server, conditional on the ETag last read as Set is
+func (s *HTTPStorage) Patch(ctx context.Context, object *objectsync.GenericObject, delta *objectsync.Delta) error {
+	header := http.Header{}
+	etag, seen := s.etag(object.ID)
+	switch {
+	case seen && etag == "":
+		header.Set("If-None-Match", "*")
+	case seen:
+		header.Set("If-Match", etag)
+	}
+
+	result := &Object{}
+	patch := &Patch{Object: toWire(object, false), Delta: toWireDelta(delta)}
+	err := s.do(ctx, http.MethodPatch, s.objectURL(object.ID), header, patch, result)
+	if err != nil {
+		return err
+	}
+
+	s.setETag(object.ID, ETag(result.Hash))
+	object.Hash = result.Hash
+	object.VersionHash = result.VersionHash
+	return nil
+}
+
+// Delete will remove a entry from the storage
+func (s *HTTPStorage) Delete(ctx context.Context, id string) error {
+	header := http.Header{}
+	etag, seen := s.etag(id)
+	if seen && etag != "" {
+		header.Set("If-Match", etag)
+	}
+
+	err := s.do(ctx, http.MethodDelete, s.objectURL(id), header, nil, nil)
+	if err != nil && !objectsync.IsNotFoundError(err) {
+		return err
+	}
+	s.setETag(id, "")
+	return nil
+}
+
+// Batch will run the operations of batch on the server, in order
+func (s *HTTPStorage) Batch(ctx context.Context, batch *Batch) (*BatchResult, error) {
+	results := &BatchResult{}
+	err := s.do(ctx, http.MethodPost, s.base.ResolveReference(&url.URL{Path: "batch"}).String(), nil, batch, results)
+	if err != nil {
+		return nil, err
+	}
+	if len(results.Results) != len(batch.Operations) {
+		return nil, fmt.Errorf("http: batch of %v operations answered with %v results", len(batch.Operations), len(results.Results))
+	}
+	return results, nil
+}
+
+// do will send the request with the JSON of in, and decode the response
+// into out unless it is nil
+func (s *HTTPStorage) do(ctx context.Context, method, target string, header http.Header, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return err
+	}
+	for name := range header {
+		req.Header.Set(name, header.Get(name))
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		e := &Error{}
+		json.NewDecoder(resp.Body).Decode(e)
+		return statusError(resp.StatusCode, e.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// statusError will map a status code to its objectsync error
+func statusError(status int, message string) error {
+	switch status {
+	case http.StatusNotFound:
+		return objectsync.ErrorNotFound
+	case http.StatusPreconditionFailed:
+		return objectsync.ErrorPreconditionFailed
+	case http.StatusConflict:
+		return objectsync.ErrorDeltaMismatch
+	}
+	return fmt.Errorf("http: %v %s: %s", status, http.StatusText(status), message)
+}
+
+func (s *HTTPStorage) etag(id string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	etag, ok := s.etags[id]
+	return etag, ok
+}
+
+func (s *HTTPStorage) setETag(id, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.etags[id] = etag
+}
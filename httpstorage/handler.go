@@ -0,0 +1,473 @@
+package httpstorage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/keithballdotnet/objectsync"
+)
+
+// Handler is an http.Handler serving a Storage with the protocol of the
+// package.  Writes are serialized with each other and with reads, so their
+// preconditions hold against the other writes through the handler, and the
+// storage need not be safe for concurrent use.
+type Handler struct {
+	store objectsync.Storage
+	mu    sync.RWMutex
+
+	// listing is the sorted listing of the last first page, kept for the
+	// pages after it until the next write, and tree the Merkle tree of the
+	// last root asked for, kept for the nodes below
+	listMu  sync.Mutex
+	listing []*Object
+	tree    *objectsync.MerkleTree
+}
+
+// NewHandler will return a Handler serving store
+func NewHandler(store objectsync.Storage) *Handler {
+	return &Handler{store: store}
+}
+
+// ServeHTTP ...
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.EscapedPath()
+	switch {
+	case path == "/objects" && r.Method == http.MethodGet:
+		h.serveList(w, r)
+	case strings.HasPrefix(path, "/objects/"):
+		id, err := url.PathUnescape(strings.TrimPrefix(path, "/objects/"))
+		if err != nil || id == "" {
+			writeError(w, http.StatusBadRequest, "invalid ID")
+			return
+		}
+		h.serveObject(w, r, id)
+	case strings.HasPrefix(path, "/signature/") && r.Method == http.MethodGet:
+		id, err := url.PathUnescape(strings.TrimPrefix(path, "/signature/"))
+		if err != nil || id == "" {
+			writeError(w, http.StatusBadRequest, "invalid ID")
+			return
+		}
+		h.serveSignature(w, r, id)
+	case path == "/batch" && r.Method == http.MethodPost:
+		h.serveBatch(w, r)
+	case path == "/merkle" && r.Method == http.MethodGet:
+		h.serveMerkle(w, r)
+	case path == "/sketch" && r.Method == http.MethodGet:
+		h.serveSketch(w, r)
+	case path == "/objects" || path == "/batch" || path == "/merkle" || path == "/sketch" || strings.HasPrefix(path, "/signature/"):
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (h *Handler) serveList(w http.ResponseWriter, r *http.Request) {
+	limit := DefaultLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		if n < limit {
+			limit = n
+		}
+	}
+
+	// A scan lists the storage for its first page, and the pages after
+	// start after the last ID seen
+	after := r.URL.Query().Get("after")
+	h.mu.RLock()
+	objects, err := h.list(r.Context(), after == "")
+	h.mu.RUnlock()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	start := 0
+	if after != "" {
+		start = sort.Search(len(objects), func(i int) bool {
+			return objects[i].ID > after
+		})
+	}
+	page := &Page{Objects: []*Object{}}
+	for _, object := range objects[start:] {
+		if len(page.Objects) == limit {
+			page.Next = page.Objects[limit-1].ID
+			break
+		}
+		page.Objects = append(page.Objects, object)
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// list will return the objects of the storage ordered by ID, without their
+// values.  The listing kept is returned unless fresh, or there is none.
+func (h *Handler) list(ctx context.Context, fresh bool) ([]*Object, error) {
+	h.listMu.Lock()
+	defer h.listMu.Unlock()
+	if !fresh && h.listing != nil {
+		return h.listing, nil
+	}
+
+	var objects objectsync.GenericObjectCollection
+	var err error
+	if lister, ok := h.store.(objectsync.Lister); ok {
+		objects, err = lister.List(ctx)
+	} else {
+		objects, err = h.store.GetAll(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].ID < objects[j].ID
+	})
+
+	h.listing = make([]*Object, len(objects))
+	for i, object := range objects {
+		h.listing[i] = toWire(object, false)
+	}
+	return h.listing, nil
+}
+
+// forget will drop the listing and tree kept, once the storage is written to
+func (h *Handler) forget() {
+	h.listMu.Lock()
+	h.listing = nil
+	h.tree = nil
+	h.listMu.Unlock()
+}
+
+func (h *Handler) serveMerkle(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	node, err := h.merkleNode(r.Context(), r.URL.Query().Get("prefix"))
+	h.mu.RUnlock()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, &Node{Prefix: node.Prefix, Hash: node.Hash, Children: node.Children, Objects: node.Objects})
+}
+
+// merkleNode will return the node at prefix of the tree of the storage.  A
+// walk of a tree starts at its root, so that is when the tree of a storage
+// that does not keep one is built.
+func (h *Handler) merkleNode(ctx context.Context, prefix string) (*objectsync.MerkleNode, error) {
+	if merkler, ok := h.store.(objectsync.Merkler); ok {
+		return merkler.MerkleNode(ctx, prefix)
+	}
+
+	h.listMu.Lock()
+	tree := h.tree
+	h.listMu.Unlock()
+	if prefix == "" || tree == nil {
+		objects, err := h.list(ctx, true)
+		if err != nil {
+			return nil, err
+		}
+		tree = objectsync.NewMerkleTree()
+		for _, object := range objects {
+			tree.Set(object.ID, object.Hash)
+		}
+		h.listMu.Lock()
+		h.tree = tree
+		h.listMu.Unlock()
+	}
+	return tree.Node(prefix), nil
+}
+
+func (h *Handler) serveSketch(w http.ResponseWriter, r *http.Request) {
+	cells, err := strconv.Atoi(r.URL.Query().Get("cells"))
+	if err != nil || cells < 1 || cells > MaxCells {
+		writeError(w, http.StatusBadRequest, "invalid cells")
+		return
+	}
+
+	h.mu.RLock()
+	sketch, err := h.sketch(r.Context(), cells)
+	h.mu.RUnlock()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	wire := &Sketch{Cells: make([]*Cell, len(sketch.Cells))}
+	for i, cell := range sketch.Cells {
+		wire.Cells[i] = &Cell{Count: cell.Count, KeySum: cell.KeySum, CheckSum: cell.CheckSum}
+	}
+	writeJSON(w, http.StatusOK, wire)
+}
+
+// sketch will return the sketch of the storage, made from a fresh listing
+// if it can not make one itself
+func (h *Handler) sketch(ctx context.Context, cells int) (*objectsync.IBLT, error) {
+	if sketcher, ok := h.store.(objectsync.Sketcher); ok {
+		return sketcher.Sketch(ctx, cells)
+	}
+
+	objects, err := h.list(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	sketch := objectsync.NewIBLT(cells)
+	for _, object := range objects {
+		sketch.Insert(object.ID, object.Hash)
+	}
+	return sketch, nil
+}
+
+func (h *Handler) serveSignature(w http.ResponseWriter, r *http.Request, id string) {
+	blockSize, err := strconv.Atoi(r.URL.Query().Get("blockSize"))
+	if err != nil || blockSize < 1 {
+		writeError(w, http.StatusBadRequest, "invalid blockSize")
+		return
+	}
+
+	h.mu.RLock()
+	signature, err := h.signature(r.Context(), id, blockSize)
+	h.mu.RUnlock()
+	if err != nil {
+		result := errorResult(err)
+		writeError(w, result.Status, result.Error)
+		return
+	}
+	writeJSON(w, http.StatusOK, toWireSignature(signature))
+}
+
+// signature will return the delta signature of the value of the object,
+// made from the value read if the storage can not make one itself
+func (h *Handler) signature(ctx context.Context, id string, blockSize int) (*objectsync.DeltaSignature, error) {
+	if deltas, ok := h.store.(objectsync.DeltaStorage); ok {
+		return deltas.DeltaSignature(ctx, id, blockSize)
+	}
+
+	object, err := h.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return objectsync.NewDeltaSignature(object.Value, blockSize), nil
+}
+
+func (h *Handler) serveObject(w http.ResponseWriter, r *http.Request, id string) {
+	var result *Result
+	switch r.Method {
+	case http.MethodGet:
+		h.mu.RLock()
+		result = h.get(r.Context(), id)
+		h.mu.RUnlock()
+	case http.MethodPut:
+		object := &Object{}
+		err := json.NewDecoder(r.Body).Decode(object)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		object.ID = id
+
+		h.mu.Lock()
+		result = h.put(r.Context(), object, r.Header.Get("If-Match"), r.Header.Get("If-None-Match"))
+		h.mu.Unlock()
+	case http.MethodPatch:
+		patch := &Patch{}
+		err := json.NewDecoder(r.Body).Decode(patch)
+		if err != nil || patch.Object == nil || patch.Delta == nil {
+			writeError(w, http.StatusBadRequest, "invalid patch")
+			return
+		}
+		patch.Object.ID = id
+
+		h.mu.Lock()
+		result = h.patch(r.Context(), patch, r.Header.Get("If-Match"), r.Header.Get("If-None-Match"))
+		h.mu.Unlock()
+	case http.MethodDelete:
+		h.mu.Lock()
+		result = h.delete(r.Context(), id, r.Header.Get("If-Match"), r.Header.Get("If-None-Match"))
+		h.mu.Unlock()
+	default:
+		result = &Result{Status: http.StatusMethodNotAllowed, Error: "method not allowed"}
+	}
+
+	if result.Error != "" {
+		writeError(w, result.Status, result.Error)
+		return
+	}
+	if result.Object == nil {
+		w.WriteHeader(result.Status)
+		return
+	}
+	w.Header().Set("ETag", ETag(result.Object.Hash))
+	writeJSON(w, result.Status, result.Object)
+}
+
+func (h *Handler) serveBatch(w http.ResponseWriter, r *http.Request) {
+	batch := &Batch{}
+	err := json.NewDecoder(r.Body).Decode(batch)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	results := &BatchResult{Results: make([]*Result, len(batch.Operations))}
+	for i, op := range batch.Operations {
+		switch op.Op {
+		case OpGet:
+			results.Results[i] = h.get(r.Context(), op.ID)
+		case OpPut:
+			if op.Object == nil || op.Object.ID == "" {
+				results.Results[i] = &Result{Status: http.StatusBadRequest, Error: "missing object"}
+				continue
+			}
+			results.Results[i] = h.put(r.Context(), op.Object, op.IfMatch, op.IfNoneMatch)
+		case OpDelete:
+			results.Results[i] = h.delete(r.Context(), op.ID, op.IfMatch, op.IfNoneMatch)
+		default:
+			results.Results[i] = &Result{Status: http.StatusBadRequest, Error: "unknown operation " + op.Op}
+		}
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+func (h *Handler) get(ctx context.Context, id string) *Result {
+	object, err := h.store.Get(ctx, id)
+	if err != nil {
+		return errorResult(err)
+	}
+	return &Result{Status: http.StatusOK, Object: toWire(object, true)}
+}
+
+// put will set the object, which answers without its value
+func (h *Handler) put(ctx context.Context, o *Object, ifMatch, ifNoneMatch string) *Result {
+	result := h.check(ctx, o.ID, ifMatch, ifNoneMatch)
+	if result != nil {
+		return result
+	}
+
+	h.forget()
+	object := fromWire(o)
+	err := h.store.Set(ctx, object)
+	if err != nil {
+		return errorResult(err)
+	}
+	return &Result{Status: http.StatusOK, Object: toWire(object, false)}
+}
+
+// patch will set the object with the value the delta makes of the current
+// one, which answers without its value
+func (h *Handler) patch(ctx context.Context, patch *Patch, ifMatch, ifNoneMatch string) *Result {
+	result := h.check(ctx, patch.Object.ID, ifMatch, ifNoneMatch)
+	if result != nil {
+		return result
+	}
+
+	h.forget()
+	object := fromWire(patch.Object)
+	object.Value = ""
+	delta := fromWireDelta(patch.Delta)
+	if deltas, ok := h.store.(objectsync.DeltaStorage); ok {
+		err := deltas.Patch(ctx, object, delta)
+		if err != nil {
+			return errorResult(err)
+		}
+		return &Result{Status: http.StatusOK, Object: toWire(object, false)}
+	}
+
+	current, err := h.store.Get(ctx, object.ID)
+	if err != nil {
+		if objectsync.IsNotFoundError(err) {
+			return errorResult(objectsync.ErrorDeltaMismatch)
+		}
+		return errorResult(err)
+	}
+	object.Value, err = objectsync.ApplyDelta(current.Value, delta)
+	if err != nil {
+		return errorResult(err)
+	}
+	err = h.store.Set(ctx, object)
+	if err != nil {
+		return errorResult(err)
+	}
+	return &Result{Status: http.StatusOK, Object: toWire(object, false)}
+}
+
+func (h *Handler) delete(ctx context.Context, id, ifMatch, ifNoneMatch string) *Result {
+	result := h.check(ctx, id, ifMatch, ifNoneMatch)
+	if result != nil {
+		return result
+	}
+
+	h.forget()
+	err := h.store.Delete(ctx, id)
+	if err != nil {
+		return errorResult(err)
+	}
+	return &Result{Status: http.StatusNoContent}
+}
+
+// check will return a result if the preconditions on the object with id do
+// not hold, nil if they do
+func (h *Handler) check(ctx context.Context, id, ifMatch, ifNoneMatch string) *Result {
+	if ifMatch == "" && ifNoneMatch == "" {
+		return nil
+	}
+
+	object, err := h.store.Get(ctx, id)
+	if err != nil && !objectsync.IsNotFoundError(err) {
+		return errorResult(err)
+	}
+	etag := ""
+	if err == nil {
+		etag = ETag(object.Hash)
+	}
+
+	if (ifMatch != "" && !matches(ifMatch, etag)) || (ifNoneMatch != "" && matches(ifNoneMatch, etag)) {
+		return &Result{Status: http.StatusPreconditionFailed, Error: objectsync.ErrorPreconditionFailed.Error()}
+	}
+	return nil
+}
+
+// matches will return if the header lists etag, empty if the object is missing
+func matches(header, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func errorResult(err error) *Result {
+	switch {
+	case objectsync.IsNotFoundError(err):
+		return &Result{Status: http.StatusNotFound, Error: err.Error()}
+	case err == objectsync.ErrorPreconditionFailed:
+		return &Result{Status: http.StatusPreconditionFailed, Error: err.Error()}
+	case err == objectsync.ErrorDeltaMismatch:
+		return &Result{Status: http.StatusConflict, Error: err.Error()}
+	}
+	return &Result{Status: http.StatusInternalServerError, Error: err.Error()}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, &Error{Error: message})
+}
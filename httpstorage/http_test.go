@@ -0,0 +1,491 @@
+package httpstorage
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/keithballdotnet/objectsync"
+)
+
+// Check the interfaces
+var _ objectsync.Storage = &HTTPStorage{}
+var _ objectsync.Lister = &HTTPStorage{}
+var _ objectsync.Merkler = &HTTPStorage{}
+var _ objectsync.Sketcher = &HTTPStorage{}
+var _ objectsync.DeltaStorage = &HTTPStorage{}
+var _ http.Handler = &Handler{}
+
+// newServer will serve store under /sync, and count the writes to it
+func newServer(t *testing.T, store objectsync.Storage, writes *int32) *httptest.Server {
+	handler := NewHandler(store)
+	mux := http.NewServeMux()
+	mux.Handle("/sync/", http.StripPrefix("/sync", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut || r.Method == http.MethodDelete {
+			atomic.AddInt32(writes, 1)
+		}
+		handler.ServeHTTP(w, r)
+	})))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// listingStorage counts the listings of a storage
+type listingStorage struct {
+	*objectsync.InMemoryStorage
+	listings int
+}
+
+func (s *listingStorage) GetAll(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	s.listings++
+	return s.InMemoryStorage.GetAll(ctx)
+}
+
+func TestHTTPStorage(t *testing.T) {
+
+	ctx := context.TODO()
+
+	t.Run("SetGet", func(t *testing.T) {
+		var writes int32
+		server := newServer(t, objectsync.NewInMemoryStorage("remote"), &writes)
+		store, err := NewHTTPStorage(server.Client(), server.URL+"/sync")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		modified := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+		signature := &objectsync.ObjectSignature{Replica: "local", Signature: []byte{1, 2, 3}}
+		for _, id := range []string{"a", "dir/b c", ".."} {
+			object := &objectsync.GenericObject{ID: id, Value: "value\x00\xff " + id, Modified: modified, Version: objectsync.VersionVector{"local": 1}, Signature: signature}
+			err = store.Set(ctx, object)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if string(object.Hash) != string(objectsync.NewHash(object.Value)) {
+				t.Errorf("Unexpected hash for [%s]", id)
+			}
+
+			got, err := store.Get(ctx, id)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if got.ID != id || got.Value != object.Value || !got.Modified.Equal(modified) || got.Version["local"] != 1 {
+				t.Errorf("Unexpected object = %+v", got)
+			}
+			if got.Signature == nil || got.Signature.Replica != "local" || string(got.Signature.Signature) != "\x01\x02\x03" {
+				t.Errorf("Unexpected signature = %+v", got.Signature)
+			}
+		}
+
+		err = store.Delete(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = store.Get(ctx, "a")
+		if !objectsync.IsNotFoundError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+
+		resp, err := server.Client().Post(server.URL+"/sync/objects", "application/json", nil)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("Unexpected status = %v", resp.StatusCode)
+		}
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		var writes int32
+		remote := &listingStorage{InMemoryStorage: objectsync.NewInMemoryStorage("remote")}
+		for i := 0; i < 20; i++ {
+			remote.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("object%02d", i), Value: fmt.Sprintf("value%v", i)})
+		}
+		server := newServer(t, remote, &writes)
+
+		resp, err := server.Client().Get(server.URL + "/sync/objects?limit=7&after=object03")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		page := &Page{}
+		err = json.NewDecoder(resp.Body).Decode(page)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(page.Objects) != 7 || page.Objects[0].ID != "object04" || page.Next != "object10" || page.Objects[0].Value != nil {
+			t.Errorf("Unexpected page = %+v", page)
+		}
+
+		store, err := NewHTTPStorage(server.Client(), server.URL+"/sync/")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		store.limit = 7
+		remote.listings = 0
+		listed, err := store.List(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		// The pages of a scan are served from one listing
+		if remote.listings != 1 {
+			t.Errorf("Unexpected listings = %v", remote.listings)
+		}
+		all, err := store.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(listed) != 20 || len(all) != 20 {
+			t.Errorf("Incorrect len = %v and %v, want 20", len(listed), len(all))
+		}
+		for _, object := range all {
+			if object.Value == "" {
+				t.Errorf("Expected value for [%s]", object.ID)
+			}
+		}
+	})
+
+	t.Run("Preconditions", func(t *testing.T) {
+		var writes int32
+		server := newServer(t, objectsync.NewInMemoryStorage("remote"), &writes)
+		store1, _ := NewHTTPStorage(server.Client(), server.URL+"/sync")
+		store2, _ := NewHTTPStorage(server.Client(), server.URL+"/sync")
+
+		err := store1.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "a"})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = store2.Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = store1.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "changed"})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = store2.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "stale"})
+		if err != objectsync.ErrorPreconditionFailed {
+			t.Errorf("Unexpected error = %v", err)
+		}
+		err = store2.Delete(ctx, "a")
+		if err != objectsync.ErrorPreconditionFailed {
+			t.Errorf("Unexpected error = %v", err)
+		}
+
+		req, _ := http.NewRequest(http.MethodPut, server.URL+"/sync/objects/a", strings.NewReader(`{"value":"bmV3"}`))
+		req.Header.Set("If-None-Match", "*")
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusPreconditionFailed {
+			t.Errorf("Unexpected status = %v", resp.StatusCode)
+		}
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		var writes int32
+		server := newServer(t, objectsync.NewInMemoryStorage("remote"), &writes)
+		store, _ := NewHTTPStorage(server.Client(), server.URL+"/sync")
+
+		results, err := store.Batch(ctx, &Batch{Operations: []*Operation{
+			{Op: OpPut, Object: &Object{ID: "a", Value: []byte("a")}},
+			{Op: OpPut, Object: &Object{ID: "b", Value: []byte("b")}, IfNoneMatch: "*"},
+			{Op: OpPut, Object: &Object{ID: "b", Value: []byte("again")}, IfNoneMatch: "*"},
+			{Op: OpGet, ID: "b"},
+			{Op: OpDelete, ID: "a", IfMatch: ETag(objectsync.NewHash("a"))},
+			{Op: OpGet, ID: "a"},
+			{Op: "rename"},
+		}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		want := []int{200, 200, 412, 200, 204, 404, 400}
+		for i, result := range results.Results {
+			if result.Status != want[i] {
+				t.Errorf("Unexpected status of operation %v = %v, want %v", i, result.Status, want[i])
+			}
+		}
+		if string(results.Results[3].Object.Value) != "b" {
+			t.Errorf("Unexpected object = %+v", results.Results[3].Object)
+		}
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		var writes int32
+		remote := objectsync.NewInMemoryStorage("remote")
+		server := newServer(t, remote, &writes)
+		store1 := objectsync.NewInMemoryStorage("local")
+		store2, _ := NewHTTPStorage(server.Client(), server.URL+"/sync")
+		status := objectsync.NewInMemoryStatusStorage()
+
+		for i := 0; i < 3; i++ {
+			store1.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("local%v", i), Value: "local", Modified: time.Now().UTC()})
+			remote.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("remote%v", i), Value: "remote", Modified: time.Now().UTC()})
+		}
+
+		opts := []objectsync.Option{objectsync.WithCausality("local", "remote")}
+		err := objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		remote.Set(ctx, &objectsync.GenericObject{ID: "local1", Value: "changed", Modified: time.Now().UTC()})
+		err = objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// Nothing changed, so nothing is written
+		before := atomic.LoadInt32(&writes)
+		err = objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if written := atomic.LoadInt32(&writes) - before; written != 0 {
+			t.Errorf("Unexpected writes = %v", written)
+		}
+
+		object, err := store1.Get(ctx, "local1")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != "changed" {
+			t.Errorf("Unexpected value = %s", object.Value)
+		}
+		all, _ := remote.GetAll(ctx)
+		if len(all) != 6 {
+			t.Errorf("Incorrect len = %v, want 6", len(all))
+		}
+	})
+
+	t.Run("Merkle", func(t *testing.T) {
+		var writes int32
+		local, remote := objectsync.NewInMemoryStorage("local"), objectsync.NewInMemoryStorage("remote")
+		server1, server2 := newServer(t, local, &writes), newServer(t, remote, &writes)
+		store1, _ := NewHTTPStorage(server1.Client(), server1.URL+"/sync")
+		store2, _ := NewHTTPStorage(server2.Client(), server2.URL+"/sync")
+		status := objectsync.NewInMemoryStatusStorage()
+
+		for i := 0; i < 100; i++ {
+			local.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("object%v", i), Value: fmt.Sprintf("value%v", i), Modified: time.Now().UTC()})
+		}
+		err := objectsync.Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		remote.Set(ctx, &objectsync.GenericObject{ID: "object1", Value: "changed", Modified: time.Now().UTC()})
+		local.Delete(ctx, "object2")
+		err = objectsync.Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// The nodes served are the ones of a tree over the objects
+		all, _ := remote.GetAll(ctx)
+		if len(all) != 99 {
+			t.Errorf("Incorrect len = %v, want 99", len(all))
+		}
+		tree := objectsync.NewMerkleTree()
+		for _, object := range all {
+			tree.Set(object.ID, object.Hash)
+		}
+		for _, store := range []*HTTPStorage{store1, store2} {
+			for _, prefix := range []string{"", objectsync.MerkleBucket("object1")[:1]} {
+				node, err := store.MerkleNode(ctx, prefix)
+				if err != nil {
+					t.Fatalf("Error: %v", err)
+				}
+				if !reflect.DeepEqual(node, tree.Node(prefix)) {
+					t.Errorf("Unexpected node at %q = %+v, want %+v", prefix, node, tree.Node(prefix))
+				}
+			}
+		}
+		object, err := local.Get(ctx, "object1")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != "changed" {
+			t.Errorf("Unexpected value = %s", object.Value)
+		}
+	})
+
+	t.Run("Sketch", func(t *testing.T) {
+		var writes int32
+		local, remote := objectsync.NewInMemoryStorage("local"), objectsync.NewInMemoryStorage("remote")
+		server1, server2 := newServer(t, local, &writes), newServer(t, remote, &writes)
+		store1, _ := NewHTTPStorage(server1.Client(), server1.URL+"/sync")
+		store2, _ := NewHTTPStorage(server2.Client(), server2.URL+"/sync")
+		status := objectsync.NewInMemoryStatusStorage()
+
+		for i := 0; i < 100; i++ {
+			local.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("object%v", i), Value: fmt.Sprintf("value%v", i), Modified: time.Now().UTC()})
+		}
+		opts := []objectsync.Option{objectsync.WithSketches(60)}
+		err := objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		remote.Set(ctx, &objectsync.GenericObject{ID: "object1", Value: "changed", Modified: time.Now().UTC()})
+		local.Delete(ctx, "object2")
+		err = objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// The sketches served are the ones over the objects
+		all, _ := remote.GetAll(ctx)
+		if len(all) != 99 {
+			t.Errorf("Incorrect len = %v, want 99", len(all))
+		}
+		want := objectsync.NewIBLT(60)
+		for _, object := range all {
+			want.Insert(object.ID, object.Hash)
+		}
+		for _, store := range []*HTTPStorage{store1, store2} {
+			sketch, err := store.Sketch(ctx, 60)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if !reflect.DeepEqual(sketch, want) {
+				t.Errorf("Unexpected sketch of %s", store.GetName())
+			}
+		}
+		_, err = store1.Sketch(ctx, 0)
+		if err == nil {
+			t.Errorf("Expected an error for no cells")
+		}
+		object, err := local.Get(ctx, "object1")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != "changed" {
+			t.Errorf("Unexpected value = %s", object.Value)
+		}
+	})
+
+	t.Run("Delta", func(t *testing.T) {
+		var writes int32
+		local, remote := objectsync.NewInMemoryStorage("local"), objectsync.NewInMemoryStorage("remote")
+		server := newServer(t, remote, &writes)
+		store2, _ := NewHTTPStorage(server.Client(), server.URL+"/sync")
+		status := objectsync.NewInMemoryStatusStorage()
+
+		// A binary value, large enough to be patched
+		random := rand.New(rand.NewSource(1))
+		value := make([]byte, 10000)
+		random.Read(value)
+		local.Set(ctx, &objectsync.GenericObject{ID: "a", Value: string(value), Modified: time.Now().UTC()})
+		err := objectsync.Sync(ctx, local, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// A change in the middle is sent as a patch, not set whole
+		changed := string(value[:5000]) + "changed" + string(value[5000:])
+		local.Set(ctx, &objectsync.GenericObject{ID: "a", Value: changed, Modified: time.Now().UTC()})
+		before := atomic.LoadInt32(&writes)
+		err = objectsync.Sync(ctx, local, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if written := atomic.LoadInt32(&writes) - before; written != 0 {
+			t.Errorf("Unexpected writes = %v", written)
+		}
+		object, err := remote.Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != changed {
+			t.Errorf("Unexpected value of %v bytes", len(object.Value))
+		}
+
+		signature, err := store2.DeltaSignature(ctx, "a", 1024)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if !reflect.DeepEqual(signature, objectsync.NewDeltaSignature(changed, 1024)) {
+			t.Errorf("Unexpected signature of %v blocks", len(signature.Blocks))
+		}
+		delta := objectsync.NewDelta(signature, "more"+changed)
+		if delta.Size() != len("more") {
+			t.Errorf("Unexpected delta size = %v", delta.Size())
+		}
+		err = store2.Patch(ctx, &objectsync.GenericObject{ID: "a", Modified: time.Now().UTC()}, delta)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		object, _ = remote.Get(ctx, "a")
+		if object.Value != "more"+changed {
+			t.Errorf("Unexpected value of %v bytes", len(object.Value))
+		}
+
+		// A delta made for another value does not apply
+		err = store2.Patch(ctx, &objectsync.GenericObject{ID: "a"}, delta)
+		if err != objectsync.ErrorDeltaMismatch {
+			t.Errorf("Unexpected error = %v", err)
+		}
+		_, err = store2.DeltaSignature(ctx, "missing", 1024)
+		if !objectsync.IsNotFoundError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+
+	t.Run("Signed", func(t *testing.T) {
+		var writes int32
+		server := newServer(t, objectsync.NewInMemoryStorage("remote"), &writes)
+		store, err := NewHTTPStorage(server.Client(), server.URL+"/sync")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		public, key, _ := ed25519.GenerateKey(nil)
+		modified := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+		signer := objectsync.NewSignedStorage(store, "local", key, nil)
+		err = signer.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "value", Modified: modified, Version: objectsync.VersionVector{"local": 1}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// The signature is kept, with the time it covers, so the object
+		// verifies when read again
+		verifier := func() *objectsync.SignedStorage {
+			reader, _ := NewHTTPStorage(server.Client(), server.URL+"/sync")
+			return objectsync.NewSignedStorage(reader, "remote", nil, map[string]ed25519.PublicKey{"local": public})
+		}
+		got, err := verifier().Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if got.Signature == nil || got.Signature.Replica != "local" || !got.Modified.Equal(modified) {
+			t.Errorf("Unexpected object = %+v", got)
+		}
+		all, err := verifier().GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 1 {
+			t.Errorf("Incorrect len = %v, want 1", len(all))
+		}
+
+		// Written again without one, it no longer verifies
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "unsigned", Modified: modified, Version: objectsync.VersionVector{"local": 2}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = verifier().Get(ctx, "a")
+		if !objectsync.IsVerificationError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+}
@@ -0,0 +1,228 @@
+// Package httpstorage exposes any objectsync.Storage over HTTP, and
+// implements a storage on such a server, so storages in different processes
+// can be synced.
+//
+// The protocol is JSON over these endpoints, relative to where the Handler
+// is mounted:
+//
+//	GET    /objects?after=ID&limit=N  list the objects without their values,
+//	                                  ordered by ID, after the ID given
+//	GET    /objects/ID                get the object
+//	PUT    /objects/ID                set the object
+//	DELETE /objects/ID                delete the object
+//	POST   /batch                     run a list of gets, puts and deletes
+//	GET    /merkle?prefix=P           get the node of the Merkle tree at
+//	                                  the prefix
+//	GET    /sketch?cells=N            get the IBLT sketch of the objects
+//	                                  with the cells
+//	GET    /signature/ID?blockSize=N  get the delta signature of the value
+//	                                  of the object
+//	PATCH  /objects/ID                set the object, with the value a
+//	                                  delta makes of the current one
+//
+// IDs in paths are escaped.  A list answers with a Page, whose Next is the
+// after of the next page, empty on the last one.  The pages after the first
+// are served from the listing made for it, until the storage is written to.
+// Objects carry their hash as an ETag, and PUT and DELETE honour If-Match,
+// and If-None-Match: * for objects that must not exist, failing with 412
+// Precondition Failed.  A batch sends a Batch and answers with a BatchResult
+// holding a Result for each operation, in order.  A node of the Merkle tree
+// answers with a Node, from the storage if it is an objectsync.Merkler, or
+// else from a tree built from the listing for the root and kept for the
+// nodes below.  A sketch answers with a Sketch, from the storage if it is an
+// objectsync.Sketcher, or else from the listing.  A signature answers with a
+// Signature, and a patch sends a Patch and answers as a PUT does, or with
+// 409 Conflict if the delta does not make the value it was made for.  Both
+// use the storage if it is an objectsync.DeltaStorage, or else the value
+// read from it.  Errors answer with an Error.
+package httpstorage
+
+import (
+	"encoding/hex"
+	"time"
+
+	"github.com/keithballdotnet/objectsync"
+)
+
+// DefaultLimit is the page size when none is asked for, and the largest one
+// served
+const DefaultLimit = 1000
+
+// MaxCells is the most cells of a sketch served
+const MaxCells = 1 << 20
+
+// Operations of a batch
+const (
+	OpGet    = "get"
+	OpPut    = "put"
+	OpDelete = "delete"
+)
+
+// Object is an object on the wire.  The value is carried as bytes, so in
+// base64, as it need not be valid UTF-8.  Listings leave out the value.
+type Object struct {
+	ID          string                      `json:"id"`
+	Value       []byte                      `json:"value,omitempty"`
+	Hash        objectsync.Hash             `json:"hash,omitempty"`
+	Modified    time.Time                   `json:"modified"`
+	Version     objectsync.VersionVector    `json:"version,omitempty"`
+	VersionHash objectsync.Hash             `json:"versionHash,omitempty"`
+	Signature   *objectsync.ObjectSignature `json:"signature,omitempty"`
+}
+
+// Page is a page of a listing
+type Page struct {
+	Objects []*Object `json:"objects"`
+	Next    string    `json:"next,omitempty"`
+}
+
+// Operation is an operation of a batch.  Object is the object to put, and
+// IfMatch and IfNoneMatch the preconditions as their headers would be.
+type Operation struct {
+	Op          string  `json:"op"`
+	ID          string  `json:"id,omitempty"`
+	Object      *Object `json:"object,omitempty"`
+	IfMatch     string  `json:"ifMatch,omitempty"`
+	IfNoneMatch string  `json:"ifNoneMatch,omitempty"`
+}
+
+// Batch is a list of operations, run in order
+type Batch struct {
+	Operations []*Operation `json:"operations"`
+}
+
+// Result is the outcome of an operation, with the status code it would have
+// had on its own
+type Result struct {
+	Status int     `json:"status"`
+	Object *Object `json:"object,omitempty"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// BatchResult holds the results of a batch
+type BatchResult struct {
+	Results []*Result `json:"results"`
+}
+
+// Node is a node of the Merkle tree of the objects
+type Node struct {
+	Prefix   string                     `json:"prefix"`
+	Hash     objectsync.Hash            `json:"hash,omitempty"`
+	Children []objectsync.Hash          `json:"children,omitempty"`
+	Objects  map[string]objectsync.Hash `json:"objects,omitempty"`
+}
+
+// Sketch is the IBLT sketch of the objects
+type Sketch struct {
+	Cells []*Cell `json:"cells"`
+}
+
+// Cell is a cell of a Sketch
+type Cell struct {
+	Count    int64  `json:"count,omitempty"`
+	KeySum   []byte `json:"keySum,omitempty"`
+	CheckSum uint64 `json:"checkSum,omitempty"`
+}
+
+// Signature is the delta signature of a value
+type Signature struct {
+	BlockSize int      `json:"blockSize"`
+	Blocks    []*Block `json:"blocks,omitempty"`
+}
+
+// Block holds the checksums of a block of a Signature
+type Block struct {
+	Weak   uint32          `json:"weak"`
+	Strong objectsync.Hash `json:"strong"`
+}
+
+// Patch is an object to set, without its value, and the delta that makes
+// its value out of the current one
+type Patch struct {
+	Object *Object `json:"object"`
+	Delta  *Delta  `json:"delta"`
+}
+
+// Delta is a delta on the wire.  The data inserted is carried as bytes, as
+// it need not be valid UTF-8.
+type Delta struct {
+	BlockSize int             `json:"blockSize"`
+	Ops       []*DeltaOp      `json:"ops,omitempty"`
+	Hash      objectsync.Hash `json:"hash"`
+}
+
+// DeltaOp is an operation of a Delta, copying Block of the current value or
+// inserting Data if Block is negative
+type DeltaOp struct {
+	Block int    `json:"block"`
+	Data  []byte `json:"data,omitempty"`
+}
+
+// Error is the body of an error response
+type Error struct {
+	Error string `json:"error"`
+}
+
+// ETag will return the entity tag of an object with hash
+func ETag(hash objectsync.Hash) string {
+	return `"` + hex.EncodeToString(hash) + `"`
+}
+
+func toWire(object *objectsync.GenericObject, value bool) *Object {
+	o := &Object{
+		ID:          object.ID,
+		Hash:        object.Hash,
+		Modified:    object.Modified,
+		Version:     object.Version,
+		VersionHash: object.VersionHash,
+		Signature:   object.Signature,
+	}
+	if value {
+		o.Value = []byte(object.Value)
+	}
+	return o
+}
+
+func fromWire(o *Object) *objectsync.GenericObject {
+	return &objectsync.GenericObject{
+		ID:          o.ID,
+		Value:       string(o.Value),
+		Hash:        o.Hash,
+		Modified:    o.Modified,
+		Version:     o.Version,
+		VersionHash: o.VersionHash,
+		Signature:   o.Signature,
+	}
+}
+
+func toWireSignature(signature *objectsync.DeltaSignature) *Signature {
+	s := &Signature{BlockSize: signature.BlockSize}
+	for _, block := range signature.Blocks {
+		s.Blocks = append(s.Blocks, &Block{Weak: block.Weak, Strong: block.Strong})
+	}
+	return s
+}
+
+func fromWireSignature(s *Signature) *objectsync.DeltaSignature {
+	signature := &objectsync.DeltaSignature{BlockSize: s.BlockSize}
+	for _, block := range s.Blocks {
+		signature.Blocks = append(signature.Blocks, objectsync.BlockSignature{Weak: block.Weak, Strong: block.Strong})
+	}
+	return signature
+}
+
+func toWireDelta(delta *objectsync.Delta) *Delta {
+	d := &Delta{BlockSize: delta.BlockSize, Hash: delta.Hash}
+	for _, op := range delta.Ops {
+		d.Ops = append(d.Ops, &DeltaOp{Block: op.Block, Data: []byte(op.Data)})
+	}
+	return d
+}
+
+func fromWireDelta(d *Delta) *objectsync.Delta {
+	delta := &objectsync.Delta{BlockSize: d.BlockSize, Hash: d.Hash}
+	for _, op := range d.Ops {
+		delta.Ops = append(delta.Ops, objectsync.DeltaOp{Block: op.Block, Data: string(op.Data)})
+	}
+	return delta
+}
@@ -0,0 +1,68 @@
+// Package vobject reads the properties of iCalendar and vCard objects, as far
+// as the storages syncing them need to.
+package vobject
+
+import "strings"
+
+// Lines will return the content lines of data, with folded lines joined
+func Lines(data string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// Name will return the upper case name of the property on line
+func Name(line string) string {
+	end := strings.IndexAny(line, ";:")
+	if end < 0 {
+		return strings.ToUpper(line)
+	}
+	return strings.ToUpper(line[:end])
+}
+
+// UID will return the first UID property of data, empty if there is none
+func UID(data string) string {
+	for _, line := range Lines(data) {
+		if Name(line) != "UID" {
+			continue
+		}
+		// Parameter values may be quoted, and contain colons
+		quoted := false
+		for i, c := range line {
+			switch {
+			case c == '"':
+				quoted = !quoted
+			case c == ':' && !quoted:
+				return strings.TrimSpace(line[i+1:])
+			}
+		}
+	}
+	return ""
+}
+
+// volatile are the properties servers and clients rewrite without the item
+// changing
+var volatile = map[string]bool{
+	"PRODID":  true,
+	"DTSTAMP": true,
+}
+
+// Normalize will return data without folding and volatile properties, so
+// that items differing only in those compare equal
+func Normalize(data string) string {
+	lines := []string{}
+	for _, line := range Lines(data) {
+		if !volatile[Name(line)] {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\r\n")
+}
@@ -0,0 +1,170 @@
+package objectsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// FieldConflict is a field of a JSON document that was changed on both sides
+type FieldConflict struct {
+	Conflict *Conflict
+	// Path holds the keys leading to the field from the document root
+	Path []string
+	// Local and Remote are the decoded values of the field.  A side that
+	// removed the field has its Deleted flag set.
+	Local         interface{}
+	LocalDeleted  bool
+	Remote        interface{}
+	RemoteDeleted bool
+}
+
+// FieldResolver decides the value of a field that was changed on both sides.
+// Returning deleted removes the field from the merged document.
+type FieldResolver func(ctx context.Context, field *FieldConflict) (value interface{}, deleted bool, err error)
+
+// FieldLastWriteWins is a FieldResolver that takes the field from the most
+// recently modified object
+func FieldLastWriteWins(ctx context.Context, field *FieldConflict) (interface{}, bool, error) {
+	if field.Conflict.Local.Modified.After(field.Conflict.Remote.Modified) {
+		return field.Local, field.LocalDeleted, nil
+	}
+	return field.Remote, field.RemoteDeleted, nil
+}
+
+// JSONMergeResolver is a ConflictResolver for values holding JSON objects.  It
+// merges the documents against their base key by key, recursing into nested
+// objects.  Fields changed on one side only are taken from that side, while
+// fields changed on both are decided by Field.  Conflicts without a known
+// base, or whose values are not JSON objects, are passed on to Fallback.
+type JSONMergeResolver struct {
+	Field    FieldResolver
+	Fallback ConflictResolver
+}
+
+// NewJSONMergeResolver will return a JSONMergeResolver.  If field is nil,
+// FieldLastWriteWins is used, and if fallback is nil, LastWriteWins is used.
+func NewJSONMergeResolver(field FieldResolver, fallback ConflictResolver) *JSONMergeResolver {
+	if field == nil {
+		field = FieldLastWriteWins
+	}
+	if fallback == nil {
+		fallback = LastWriteWins
+	}
+	return &JSONMergeResolver{Field: field, Fallback: fallback}
+}
+
+// Resolve will merge the local and remote documents of the conflict
+func (r *JSONMergeResolver) Resolve(ctx context.Context, conflict *Conflict) (*GenericObject, error) {
+	if conflict.Base == nil || conflict.Local == nil || conflict.Remote == nil {
+		return r.Fallback.Resolve(ctx, conflict)
+	}
+
+	base, okBase := decodeJSONObject(conflict.Base.Value)
+	local, okLocal := decodeJSONObject(conflict.Local.Value)
+	remote, okRemote := decodeJSONObject(conflict.Remote.Value)
+	if !okBase || !okLocal || !okRemote {
+		fmt.Printf("Value of [%s] is not a JSON object.  Fall back.\n", conflict.ID)
+		return r.Fallback.Resolve(ctx, conflict)
+	}
+
+	merged, err := r.mergeFields(ctx, conflict, nil, base, local, remote)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := encodeJSON(merged)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Merged fields of [%s]\n", conflict.ID)
+	return newMergedObject(conflict, value), nil
+}
+
+func (r *JSONMergeResolver) mergeFields(ctx context.Context, conflict *Conflict, path []string, base, local, remote map[string]interface{}) (map[string]interface{}, error) {
+	keys := map[string]bool{}
+	for _, fields := range []map[string]interface{}{base, local, remote} {
+		for key := range fields {
+			keys[key] = true
+		}
+	}
+
+	merged := map[string]interface{}{}
+	for key := range keys {
+		baseValue, inBase := base[key]
+		localValue, inLocal := local[key]
+		remoteValue, inRemote := remote[key]
+
+		localChanged := inLocal != inBase || !reflect.DeepEqual(localValue, baseValue)
+		remoteChanged := inRemote != inBase || !reflect.DeepEqual(remoteValue, baseValue)
+		fieldPath := append(append([]string(nil), path...), key)
+
+		value, deleted := localValue, !inLocal
+		switch {
+		case !localChanged:
+			value, deleted = remoteValue, !inRemote
+		case !remoteChanged:
+		case inLocal == inRemote && reflect.DeepEqual(localValue, remoteValue):
+		default:
+			baseObject, okBase := baseValue.(map[string]interface{})
+			localObject, okLocal := localValue.(map[string]interface{})
+			remoteObject, okRemote := remoteValue.(map[string]interface{})
+			if okBase && okLocal && okRemote {
+				nested, err := r.mergeFields(ctx, conflict, fieldPath, baseObject, localObject, remoteObject)
+				if err != nil {
+					return nil, err
+				}
+				value = nested
+				break
+			}
+
+			var err error
+			value, deleted, err = r.Field(ctx, &FieldConflict{
+				Conflict:      conflict,
+				Path:          fieldPath,
+				Local:         localValue,
+				LocalDeleted:  !inLocal,
+				Remote:        remoteValue,
+				RemoteDeleted: !inRemote,
+			})
+			if err != nil {
+				return nil, err
+			}
+			fmt.Printf("Resolved field [%s] of [%s]\n", strings.Join(fieldPath, "."), conflict.ID)
+		}
+
+		if !deleted {
+			merged[key] = value
+		}
+	}
+
+	return merged, nil
+}
+
+// decodeJSONObject will decode value if it holds a JSON object
+func decodeJSONObject(value string) (map[string]interface{}, bool) {
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+
+	object := map[string]interface{}{}
+	err := decoder.Decode(&object)
+	if err != nil || object == nil || decoder.More() {
+		return nil, false
+	}
+	return object, true
+}
+
+func encodeJSON(object interface{}) (string, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(object)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
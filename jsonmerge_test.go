@@ -0,0 +1,88 @@
+package objectsync
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestJSONMergeResolver(t *testing.T) {
+
+	ctx := context.TODO()
+	now := time.Now().UTC()
+
+	conflict := func(base, local, remote string) *Conflict {
+		return &Conflict{
+			ID:     "record",
+			Base:   &GenericObject{ID: "record", Value: base, Modified: now},
+			Local:  &GenericObject{ID: "record", Value: local, Modified: now.Add(2 * time.Minute)},
+			Remote: &GenericObject{ID: "record", Value: remote, Modified: now.Add(time.Minute)},
+		}
+	}
+
+	tests := []struct {
+		name                string
+		base, local, remote string
+		field               FieldResolver
+		want                string
+	}{
+		{
+			name:   "DifferentFields",
+			base:   `{"name":"Ada","email":"ada@example.com","age":36}`,
+			local:  `{"name":"Ada Lovelace","email":"ada@example.com","age":36}`,
+			remote: `{"name":"Ada","email":"ada@example.org","age":36}`,
+			want:   `{"age":36,"email":"ada@example.org","name":"Ada Lovelace"}`,
+		},
+		{
+			name:   "AddAndRemove",
+			base:   `{"name":"Ada","tags":["a"]}`,
+			local:  `{"name":"Ada","tags":["a"],"city":"London"}`,
+			remote: `{"name":"Ada"}`,
+			want:   `{"city":"London","name":"Ada"}`,
+		},
+		{
+			name:   "Nested",
+			base:   `{"address":{"street":"1 Main St","city":"London"}}`,
+			local:  `{"address":{"street":"2 Main St","city":"London"}}`,
+			remote: `{"address":{"street":"1 Main St","city":"Paris"}}`,
+			want:   `{"address":{"city":"Paris","street":"2 Main St"}}`,
+		},
+		{
+			name:   "SameFieldLastWriteWins",
+			base:   `{"name":"Ada","age":36}`,
+			local:  `{"name":"Ada Lovelace","age":36}`,
+			remote: `{"name":"Augusta Ada","age":37}`,
+			want:   `{"age":37,"name":"Ada Lovelace"}`,
+		},
+		{
+			name:   "SameFieldCallback",
+			base:   `{"name":"Ada","age":36}`,
+			local:  `{"name":"Ada Lovelace","age":36}`,
+			remote: `{"name":"Augusta Ada","age":36}`,
+			field: func(ctx context.Context, field *FieldConflict) (interface{}, bool, error) {
+				return field.Local.(string) + " / " + field.Remote.(string), false, nil
+			},
+			want: `{"age":36,"name":"Ada Lovelace / Augusta Ada"}`,
+		},
+		{
+			name:   "NotJSON",
+			base:   `plain`,
+			local:  `local text`,
+			remote: `remote text`,
+			want:   `local text`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := NewJSONMergeResolver(tt.field, nil)
+			object, err := resolver.Resolve(ctx, conflict(tt.base, tt.local, tt.remote))
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if object.Value != tt.want {
+				t.Errorf("Unexpected value = %s expected %s", object.Value, tt.want)
+			}
+		})
+	}
+}
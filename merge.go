@@ -0,0 +1,179 @@
+package objectsync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// MergeResolver is a ConflictResolver that does a line based three-way merge
+// (diff3) of text values against their base.  Edits to separate lines on each
+// side are combined.  Conflicts without a known base, or where both sides
+// changed the same lines, are passed on to Fallback.
+type MergeResolver struct {
+	Fallback ConflictResolver
+}
+
+// NewMergeResolver will return a MergeResolver.  If fallback is nil,
+// LastWriteWins is used.
+func NewMergeResolver(fallback ConflictResolver) *MergeResolver {
+	if fallback == nil {
+		fallback = LastWriteWins
+	}
+	return &MergeResolver{Fallback: fallback}
+}
+
+// Resolve will merge the local and remote changes of the conflict
+func (r *MergeResolver) Resolve(ctx context.Context, conflict *Conflict) (*GenericObject, error) {
+	if conflict.Base == nil || conflict.Local == nil || conflict.Remote == nil {
+		return r.Fallback.Resolve(ctx, conflict)
+	}
+
+	value, ok := merge3(conflict.Base.Value, conflict.Local.Value, conflict.Remote.Value)
+	if !ok {
+		fmt.Printf("Overlapping changes to [%s].  Fall back.\n", conflict.ID)
+		return r.Fallback.Resolve(ctx, conflict)
+	}
+
+	fmt.Printf("Merged changes to [%s]\n", conflict.ID)
+	return newMergedObject(conflict, value), nil
+}
+
+// newMergedObject will return an object holding value as the merge of the conflict
+func newMergedObject(conflict *Conflict, value string) *GenericObject {
+	modified := conflict.Local.Modified
+	if conflict.Remote.Modified.After(modified) {
+		modified = conflict.Remote.Modified
+	}
+
+	return &GenericObject{
+		ID:       conflict.ID,
+		Hash:     NewHash(value),
+		Modified: modified,
+		Value:    value,
+	}
+}
+
+// merge3 will merge the line changes made in local and remote to base.  It
+// returns false if both sides changed the same region differently.
+func merge3(base, local, remote string) (string, bool) {
+	o, a, b := splitLines(base), splitLines(local), splitLines(remote)
+	matchA, matchB := matchLines(o, a), matchLines(o, b)
+
+	merged := []string{}
+	io, ia, ib := 0, 0, 0
+	for io < len(o) || ia < len(a) || ib < len(b) {
+		// Lines unchanged on both sides
+		k := 0
+		for io+k < len(o) && matchA[io+k] == ia+k && matchB[io+k] == ib+k {
+			k++
+		}
+		if k > 0 {
+			merged = append(merged, o[io:io+k]...)
+			io, ia, ib = io+k, ia+k, ib+k
+			continue
+		}
+
+		// Find the end of the changed region, the next base line kept by both sides
+		end := io
+		for end < len(o) && (matchA[end] < 0 || matchB[end] < 0) {
+			end++
+		}
+		endA, endB := len(a), len(b)
+		if end < len(o) {
+			endA, endB = matchA[end], matchB[end]
+		}
+
+		chunkO, chunkA, chunkB := o[io:end], a[ia:endA], b[ib:endB]
+		switch {
+		case equalLines(chunkA, chunkO):
+			merged = append(merged, chunkB...)
+		case equalLines(chunkB, chunkO), equalLines(chunkA, chunkB):
+			merged = append(merged, chunkA...)
+		default:
+			return "", false
+		}
+		io, ia, ib = end, endA, endB
+	}
+
+	return strings.Join(merged, ""), true
+}
+
+// splitLines will split s into lines, keeping the line endings
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// matchLines will return for every line of a the index of the same line in
+// b, or -1 if it was removed.  It uses the Myers shortest edit script.
+func matchLines(a, b []string) []int {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	trace := [][]int{}
+
+	found := false
+	for d := 0; d <= n+m && !found; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	match := make([]int, n)
+	for i := range match {
+		match[i] = -1
+	}
+
+	// Walk back through the edit script recording the matched lines
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x, y = x-1, y-1
+			match[x] = y
+		}
+		x, y = prevX, prevY
+	}
+
+	return match
+}
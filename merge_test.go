@@ -0,0 +1,109 @@
+package objectsync
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMerge3(t *testing.T) {
+	base := "one\ntwo\nthree\nfour\nfive\n"
+
+	tests := []struct {
+		name          string
+		local, remote string
+		want          string
+		ok            bool
+	}{
+		{"Separate", "ONE\ntwo\nthree\nfour\nfive\n", "one\ntwo\nthree\nfour\nFIVE\n", "ONE\ntwo\nthree\nfour\nFIVE\n", true},
+		{"InsertAndDelete", "one\ntwo\nthree\nthree and a half\nfour\nfive\n", "two\nthree\nfour\nfive\n", "two\nthree\nthree and a half\nfour\nfive\n", true},
+		{"Same", "one\nTWO\nthree\nfour\nfive\n", "one\nTWO\nthree\nfour\nfive\n", "one\nTWO\nthree\nfour\nfive\n", true},
+		{"OneSide", base, "one\ntwo\n3\nfour\nfive\nsix\n", "one\ntwo\n3\nfour\nfive\nsix\n", true},
+		{"Overlap", "one\ntwo\nTHREE\nfour\nfive\n", "one\ntwo\n3\nfour\nfive\n", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := merge3(base, tt.local, tt.remote)
+			if ok != tt.ok {
+				t.Fatalf("Unexpected ok = %v expected %v", ok, tt.ok)
+			}
+			if got != tt.want {
+				t.Errorf("Unexpected merge = %q expected %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeResolver(t *testing.T) {
+
+	ctx := context.TODO()
+
+	status := NewInMemoryStatusStorage()
+	bases := NewInMemoryBaseStorage()
+	store1 := NewInMemoryStorage("local")
+	store2 := NewInMemoryStorage("remote")
+	opts := []Option{WithBaseStorage(bases), WithConflictResolver(NewMergeResolver(nil))}
+
+	now := time.Now().UTC()
+	err := store1.Set(ctx, &GenericObject{ID: "doc", Value: "one\ntwo\nthree\n", Modified: now})
+	if err != nil {
+		t.Errorf("Error: %v", err)
+	}
+	err = Sync(ctx, store1, store2, status, opts...)
+	if err != nil {
+		t.Errorf("Error: %v", err)
+	}
+
+	update := func(store Storage, value string, modified time.Time) {
+		err := store.Set(ctx, &GenericObject{ID: "doc", Value: value, Modified: modified})
+		if err != nil {
+			t.Errorf("Error: %v", err)
+		}
+	}
+	check := func(value string) {
+		for _, store := range []Storage{store1, store2} {
+			object, err := store.Get(ctx, "doc")
+			if err != nil {
+				t.Errorf("Error: %v", err)
+			}
+			if object.Value != value {
+				t.Fatalf("Unexpected value = %q in %s expected %q", object.Value, store.GetName(), value)
+			}
+		}
+	}
+
+	// Non overlapping edits are merged
+	update(store1, "ONE\ntwo\nthree\n", now.Add(time.Minute))
+	update(store2, "one\ntwo\nTHREE\n", now.Add(2*time.Minute))
+	err = Sync(ctx, store1, store2, status, opts...)
+	if err != nil {
+		t.Errorf("Error: %v", err)
+	}
+	check("ONE\ntwo\nTHREE\n")
+
+	// The merge became the new base, so merging works again
+	update(store1, "ONE\nTWO\nTHREE\n", now.Add(3*time.Minute))
+	update(store2, "ONE\ntwo\nTHREE\nFOUR\n", now.Add(4*time.Minute))
+	err = Sync(ctx, store1, store2, status, opts...)
+	if err != nil {
+		t.Errorf("Error: %v", err)
+	}
+	check("ONE\nTWO\nTHREE\nFOUR\n")
+
+	// Overlapping edits fall back to last write wins
+	update(store1, "1\nTWO\nTHREE\nFOUR\n", now.Add(6*time.Minute))
+	update(store2, "one\nTWO\nTHREE\nFOUR\n", now.Add(5*time.Minute))
+	err = Sync(ctx, store1, store2, status, opts...)
+	if err != nil {
+		t.Errorf("Error: %v", err)
+	}
+	check("1\nTWO\nTHREE\nFOUR\n")
+
+	// Nothing changes if we change nothing
+	err = Sync(ctx, store1, store2, status, opts...)
+	if err != nil {
+		t.Errorf("Error: %v", err)
+	}
+	check("1\nTWO\nTHREE\nFOUR\n")
+}
@@ -0,0 +1,385 @@
+package objectsync
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	// merkleDepth is the length of the bucket prefixes, in hex digits
+	merkleDepth = 4
+	// merkleLeafSize is the number of objects under which a node lists its
+	// objects instead of its children
+	merkleLeafSize = 32
+	merkleDigits   = "0123456789abcdef"
+)
+
+// Merkler is implemented by a Storage that maintains a MerkleTree over the
+// IDs and hashes of its objects.  When both storages implement it, Sync
+// compares their trees to ones built from the status, and walks down only
+// the subtrees that differ, instead of listing all objects.
+type Merkler interface {
+	MerkleNode(ctx context.Context, prefix string) (*MerkleNode, error)
+}
+
+// MerkleNode is the node of a MerkleTree at a prefix of the bucket of IDs.
+// Either Children or Objects is set, unless the node is empty.
+type MerkleNode struct {
+	Prefix string
+	Hash   Hash
+	// Children are the hashes of the 16 nodes below, one per hex digit
+	Children []Hash
+	// Objects are the hashes of the objects below by ID, when there are few
+	Objects map[string]Hash
+}
+
+// MerkleTree is a Merkle tree over the IDs and hashes of objects.  Each
+// object is kept in the bucket named by the first hex digits of the SHA-256
+// of its ID, so buckets are balanced whatever the IDs.  The hash of a bucket
+// is over its sorted IDs and hashes, and the hash of a node is over the
+// hashes of its children, so two trees over the same objects have the same
+// root.
+type MerkleTree struct {
+	buckets map[string]map[string]Hash
+	counts  map[string]int
+	hashes  map[string]Hash
+}
+
+// NewMerkleTree ...
+func NewMerkleTree() *MerkleTree {
+	return &MerkleTree{
+		buckets: make(map[string]map[string]Hash),
+		counts:  make(map[string]int),
+		hashes:  make(map[string]Hash),
+	}
+}
+
+// Set will add the object with id and hash to the tree, or change its hash
+func (t *MerkleTree) Set(id string, hash Hash) {
+	bucket := MerkleBucket(id)
+	objects, ok := t.buckets[bucket]
+	if !ok {
+		objects = make(map[string]Hash)
+		t.buckets[bucket] = objects
+	}
+	if _, ok := objects[id]; !ok {
+		t.count(bucket, 1)
+	}
+	objects[id] = hash
+	t.invalidate(bucket)
+}
+
+// Delete will remove the object with id from the tree
+func (t *MerkleTree) Delete(id string) {
+	bucket := MerkleBucket(id)
+	objects := t.buckets[bucket]
+	if _, ok := objects[id]; !ok {
+		return
+	}
+	delete(objects, id)
+	if len(objects) == 0 {
+		delete(t.buckets, bucket)
+	}
+	t.count(bucket, -1)
+	t.invalidate(bucket)
+}
+
+// Get will return the hash of the object with id, nil if it is not in the tree
+func (t *MerkleTree) Get(id string) Hash {
+	return t.buckets[MerkleBucket(id)][id]
+}
+
+// Hash will return the hash of the node at prefix, nil if it is empty
+func (t *MerkleTree) Hash(prefix string) Hash {
+	if t.counts[prefix] == 0 {
+		return nil
+	}
+	if hash, ok := t.hashes[prefix]; ok {
+		return hash
+	}
+
+	var hash Hash
+	if len(prefix) == merkleDepth {
+		hash = merkleBucketHash(t.buckets[prefix])
+	} else {
+		children := make([]Hash, len(merkleDigits))
+		for i := range merkleDigits {
+			children[i] = t.Hash(prefix + merkleDigits[i:i+1])
+		}
+		hash = merkleNodeHash(children)
+	}
+	t.hashes[prefix] = hash
+	return hash
+}
+
+// Node will return the node at prefix
+func (t *MerkleTree) Node(prefix string) *MerkleNode {
+	node := &MerkleNode{Prefix: prefix, Hash: t.Hash(prefix)}
+	count := t.counts[prefix]
+	switch {
+	case count == 0:
+	case count <= merkleLeafSize || len(prefix) >= merkleDepth:
+		node.Objects = t.objects(prefix)
+	default:
+		node.Children = make([]Hash, len(merkleDigits))
+		for i := range merkleDigits {
+			node.Children[i] = t.Hash(prefix + merkleDigits[i:i+1])
+		}
+	}
+	return node
+}
+
+// objects will return the hashes of the objects under prefix by ID
+func (t *MerkleTree) objects(prefix string) map[string]Hash {
+	objects := make(map[string]Hash, t.counts[prefix])
+	if len(prefix) >= merkleDepth {
+		for id, hash := range t.buckets[prefix[:merkleDepth]] {
+			objects[id] = hash
+		}
+		return objects
+	}
+	for bucket, bucketObjects := range t.buckets {
+		if !strings.HasPrefix(bucket, prefix) {
+			continue
+		}
+		for id, hash := range bucketObjects {
+			objects[id] = hash
+		}
+	}
+	return objects
+}
+
+// count will add n to the counts of the nodes on the path to bucket
+func (t *MerkleTree) count(bucket string, n int) {
+	for i := 0; i <= len(bucket); i++ {
+		t.counts[bucket[:i]] += n
+		if t.counts[bucket[:i]] == 0 {
+			delete(t.counts, bucket[:i])
+		}
+	}
+}
+
+// invalidate will forget the hashes of the nodes on the path to bucket
+func (t *MerkleTree) invalidate(bucket string) {
+	for i := 0; i <= len(bucket); i++ {
+		delete(t.hashes, bucket[:i])
+	}
+}
+
+// MerkleNodes is where a Merkler keeps the nodes of its tree, such as a
+// table next to its objects, so the tree is not built again in memory.  It
+// is kept up to date with UpdateMerkle and read with ReadMerkleNode, and
+// gives the same hashes as a MerkleTree over the same objects.
+type MerkleNodes interface {
+	// GetMerkleHash will return the hash and the number of objects of the
+	// node at prefix, nil and 0 if it is empty
+	GetMerkleHash(ctx context.Context, prefix string) (Hash, int, error)
+	// SetMerkleHash will keep the hash and the number of objects of the node
+	// at prefix, and forget the node if count is 0
+	SetMerkleHash(ctx context.Context, prefix string, hash Hash, count int) error
+	// MerkleObjects will return the hashes by ID of the objects whose
+	// MerkleBucket starts with prefix
+	MerkleObjects(ctx context.Context, prefix string) (map[string]Hash, error)
+}
+
+// UpdateMerkle will update the nodes on the path to the bucket of the object
+// with id, once it is set or deleted
+func UpdateMerkle(ctx context.Context, nodes MerkleNodes, id string) error {
+	bucket := MerkleBucket(id)
+	objects, err := nodes.MerkleObjects(ctx, bucket)
+	if err != nil {
+		return err
+	}
+	var hash Hash
+	if len(objects) > 0 {
+		hash = merkleBucketHash(objects)
+	}
+	err = nodes.SetMerkleHash(ctx, bucket, hash, len(objects))
+	if err != nil {
+		return err
+	}
+
+	for i := len(bucket) - 1; i >= 0; i-- {
+		prefix := bucket[:i]
+		children := make([]Hash, len(merkleDigits))
+		count := 0
+		for j := range merkleDigits {
+			var n int
+			children[j], n, err = nodes.GetMerkleHash(ctx, prefix+merkleDigits[j:j+1])
+			if err != nil {
+				return err
+			}
+			count += n
+		}
+		hash = nil
+		if count > 0 {
+			hash = merkleNodeHash(children)
+		}
+		err = nodes.SetMerkleHash(ctx, prefix, hash, count)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadMerkleNode will return the node at prefix of the tree kept in nodes
+func ReadMerkleNode(ctx context.Context, nodes MerkleNodes, prefix string) (*MerkleNode, error) {
+	hash, count, err := nodes.GetMerkleHash(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	node := &MerkleNode{Prefix: prefix, Hash: hash}
+	switch {
+	case count == 0:
+		node.Hash = nil
+	case count <= merkleLeafSize || len(prefix) >= merkleDepth:
+		node.Objects, err = nodes.MerkleObjects(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		node.Children = make([]Hash, len(merkleDigits))
+		for i := range merkleDigits {
+			node.Children[i], _, err = nodes.GetMerkleHash(ctx, prefix+merkleDigits[i:i+1])
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return node, nil
+}
+
+// MerkleBucket will return the bucket of the object with id, the first hex
+// digits of the SHA-256 of the ID
+func MerkleBucket(id string) string {
+	hash := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(hash[:])[:merkleDepth]
+}
+
+// merkleBucketHash will return the hash of a bucket over its sorted IDs and
+// hashes
+func merkleBucketHash(objects map[string]Hash) Hash {
+	ids := make([]string, 0, len(objects))
+	for id := range objects {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	h := sha256.New()
+	for _, id := range ids {
+		writeMerkleField(h, []byte(id))
+		writeMerkleField(h, objects[id])
+	}
+	return h.Sum(nil)
+}
+
+// merkleNodeHash will return the hash of a node over the hashes of its
+// children
+func merkleNodeHash(children []Hash) Hash {
+	h := sha256.New()
+	for _, child := range children {
+		writeMerkleField(h, child)
+	}
+	return h.Sum(nil)
+}
+
+func writeMerkleField(h io.Writer, field []byte) {
+	var size [binary.MaxVarintLen64]byte
+	h.Write(size[:binary.PutUvarint(size[:], uint64(len(field)))])
+	h.Write(field)
+}
+
+// merkleObjects will find the IDs whose object changed in either storage
+// since the last sync, by walking down the subtrees of their trees that
+// differ from the trees of the status, and read those objects.  The IDs
+// include objects missing from both storages whose status is left over.
+func merkleObjects(ctx context.Context, local, remote Storage, stati []*SyncStatus) (localSet, remoteSet GenericObjectCollection, ids map[string]bool, err error) {
+	localTree, remoteTree := NewMerkleTree(), NewMerkleTree()
+	for _, syncStatus := range stati {
+		localTree.Set(syncStatus.ID, syncStatus.LocalHash)
+		remoteTree.Set(syncStatus.ID, syncStatus.RemoteHash)
+	}
+
+	ids = make(map[string]bool)
+	err = diffMerkle(ctx, local.(Merkler), localTree, "", ids)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	err = diffMerkle(ctx, remote.(Merkler), remoteTree, "", ids)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	localSet, err = getObjects(ctx, local, ids)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	remoteSet, err = getObjects(ctx, remote, ids)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return localSet, remoteSet, ids, nil
+}
+
+// diffMerkle will add the IDs under prefix whose hash in store differs from
+// the one in expected to ids
+func diffMerkle(ctx context.Context, store Merkler, expected *MerkleTree, prefix string, ids map[string]bool) error {
+	node, err := store.MerkleNode(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(node.Hash, expected.Hash(prefix)) {
+		return nil
+	}
+
+	if node.Children == nil {
+		for id, hash := range node.Objects {
+			if !bytes.Equal(hash, expected.Get(id)) {
+				ids[id] = true
+			}
+		}
+		for id := range expected.objects(prefix) {
+			if _, ok := node.Objects[id]; !ok {
+				ids[id] = true
+			}
+		}
+		return nil
+	}
+
+	for i, hash := range node.Children {
+		child := prefix + merkleDigits[i:i+1]
+		if bytes.Equal(hash, expected.Hash(child)) {
+			continue
+		}
+		err = diffMerkle(ctx, store, expected, child, ids)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getObjects will read the objects with ids from store, leaving out the ones
+// it does not have
+func getObjects(ctx context.Context, store Storage, ids map[string]bool) (GenericObjectCollection, error) {
+	objects := GenericObjectCollection{}
+	for id := range ids {
+		object, err := store.Get(ctx, id)
+		if err != nil {
+			if IsNotFoundError(err) {
+				continue
+			}
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
@@ -0,0 +1,203 @@
+package objectsync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Check the interfaces
+var _ Merkler = &countingStorage{}
+
+// countingStorage keeps a Merkle tree of a storage, and counts the nodes and
+// objects read from it
+type countingStorage struct {
+	*InMemoryStorage
+	tree        *MerkleTree
+	nodes, gets int
+}
+
+func (s *countingStorage) Set(ctx context.Context, object *GenericObject) error {
+	err := s.InMemoryStorage.Set(ctx, object)
+	if err != nil {
+		return err
+	}
+	if s.tree == nil {
+		s.tree = NewMerkleTree()
+	}
+	s.tree.Set(object.ID, object.Hash)
+	return nil
+}
+
+func (s *countingStorage) Delete(ctx context.Context, id string) error {
+	if s.tree != nil {
+		s.tree.Delete(id)
+	}
+	return s.InMemoryStorage.Delete(ctx, id)
+}
+
+func (s *countingStorage) MerkleNode(ctx context.Context, prefix string) (*MerkleNode, error) {
+	s.nodes++
+	if s.tree == nil {
+		s.tree = NewMerkleTree()
+	}
+	return s.tree.Node(prefix), nil
+}
+
+func (s *countingStorage) Get(ctx context.Context, id string) (*GenericObject, error) {
+	s.gets++
+	return s.InMemoryStorage.Get(ctx, id)
+}
+
+// mapMerkleNodes keeps the nodes of a tree in maps, as a storage would in
+// its tables
+type mapMerkleNodes struct {
+	objects map[string]Hash
+	hashes  map[string]Hash
+	counts  map[string]int
+}
+
+func (n *mapMerkleNodes) GetMerkleHash(ctx context.Context, prefix string) (Hash, int, error) {
+	return n.hashes[prefix], n.counts[prefix], nil
+}
+
+func (n *mapMerkleNodes) SetMerkleHash(ctx context.Context, prefix string, hash Hash, count int) error {
+	n.hashes[prefix], n.counts[prefix] = hash, count
+	return nil
+}
+
+func (n *mapMerkleNodes) MerkleObjects(ctx context.Context, prefix string) (map[string]Hash, error) {
+	objects := map[string]Hash{}
+	for id, hash := range n.objects {
+		if strings.HasPrefix(MerkleBucket(id), prefix) {
+			objects[id] = hash
+		}
+	}
+	return objects, nil
+}
+
+func TestMerkle(t *testing.T) {
+
+	ctx := context.TODO()
+
+	t.Run("Tree", func(t *testing.T) {
+		tree1, tree2 := NewMerkleTree(), NewMerkleTree()
+		for i := 0; i < 1000; i++ {
+			tree1.Set(fmt.Sprintf("object%v", i), NewHash(fmt.Sprintf("value%v", i)))
+		}
+		for i := 999; i >= 0; i-- {
+			tree2.Set(fmt.Sprintf("object%v", i), NewHash("changed"))
+			tree2.Set(fmt.Sprintf("object%v", i), NewHash(fmt.Sprintf("value%v", i)))
+		}
+		tree2.Set("extra", NewHash("extra"))
+		if bytes.Equal(tree1.Hash(""), tree2.Hash("")) {
+			t.Errorf("Expected roots to differ")
+		}
+		tree2.Delete("extra")
+		if !bytes.Equal(tree1.Hash(""), tree2.Hash("")) {
+			t.Errorf("Expected roots to match")
+		}
+
+		root := tree1.Node("")
+		if len(root.Children) != 16 || root.Objects != nil {
+			t.Errorf("Unexpected root = %+v", root)
+		}
+		if node := NewMerkleTree().Node(""); node.Hash != nil || node.Children != nil || node.Objects != nil {
+			t.Errorf("Unexpected empty node = %+v", node)
+		}
+	})
+
+	t.Run("Nodes", func(t *testing.T) {
+		tree := NewMerkleTree()
+		nodes := &mapMerkleNodes{objects: map[string]Hash{}, hashes: map[string]Hash{}, counts: map[string]int{}}
+		for i := 0; i < 100; i++ {
+			id, hash := fmt.Sprintf("object%v", i), NewHash(fmt.Sprintf("value%v", i))
+			tree.Set(id, hash)
+			nodes.objects[id] = hash
+			err := UpdateMerkle(ctx, nodes, id)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+		}
+		for i := 0; i < 100; i += 3 {
+			id := fmt.Sprintf("object%v", i)
+			tree.Delete(id)
+			delete(nodes.objects, id)
+			err := UpdateMerkle(ctx, nodes, id)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+		}
+
+		// The nodes read are the ones of the tree over the same objects
+		for _, prefix := range []string{"", "0", MerkleBucket("object1")[:2], MerkleBucket("object1"), MerkleBucket("object0")} {
+			got, err := ReadMerkleNode(ctx, nodes, prefix)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tree.Node(prefix)) {
+				t.Errorf("Unexpected node at %q = %+v, want %+v", prefix, got, tree.Node(prefix))
+			}
+		}
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		store1 := &countingStorage{InMemoryStorage: NewInMemoryStorage("local")}
+		store2 := &countingStorage{InMemoryStorage: NewInMemoryStorage("remote")}
+		status := NewInMemoryStatusStorage()
+		for i := 0; i < 5000; i++ {
+			store1.Set(ctx, &GenericObject{ID: fmt.Sprintf("object%v", i), Value: fmt.Sprintf("value%v", i), Modified: time.Now().UTC()})
+		}
+		err := Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// Nothing changed, so only the roots are compared
+		store1.nodes, store2.nodes, store1.gets, store2.gets = 0, 0, 0, 0
+		err = Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if store1.nodes != 1 || store2.nodes != 1 || store1.gets != 0 || store2.gets != 0 {
+			t.Errorf("Unexpected reads = %v, %v nodes and %v, %v gets", store1.nodes, store2.nodes, store1.gets, store2.gets)
+		}
+
+		store1.Set(ctx, &GenericObject{ID: "object1", Value: "changed", Modified: time.Now().UTC()})
+		store2.Delete(ctx, "object2")
+		store2.Set(ctx, &GenericObject{ID: "new", Value: "new", Modified: time.Now().UTC()})
+		store1.nodes, store2.nodes = 0, 0
+		err = Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if store1.nodes > 1+2*16 || store2.nodes > 1+2*2*16 {
+			t.Errorf("Unexpected nodes read = %v and %v", store1.nodes, store2.nodes)
+		}
+
+		for _, store := range []*countingStorage{store1, store2} {
+			all, _ := store.GetAll(ctx)
+			if len(all) != 5000 {
+				t.Errorf("Incorrect len = %v, want 5000", len(all))
+			}
+			object, err := store.Get(ctx, "object1")
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if object.Value != "changed" {
+				t.Errorf("Unexpected value = %s", object.Value)
+			}
+			_, err = store.Get(ctx, "object2")
+			if err == nil || !IsNotFoundError(err) {
+				t.Errorf("Unexpected error = %v", err)
+			}
+		}
+		if !bytes.Equal(store1.tree.Hash(""), store2.tree.Hash("")) {
+			t.Errorf("Expected roots to match")
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package objectsync
+
+import "time"
+
+// Option is a configuration option for Sync
+type Option func(*options)
+
+type options struct {
+	causality     bool
+	localReplica  string
+	remoteReplica string
+	resolver      ConflictResolver
+	bases         BaseStorage
+	conflicts     ConflictStorage
+
+	tombstones         bool
+	tombstoneRetention time.Duration
+
+	sketchCells int
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{resolver: LastWriteWins}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithCausality will make Sync track the causal history of objects with
+// version vectors.  localReplica and remoteReplica name the replicas behind
+// the local and remote storage and must be unique across all synced replicas.
+// Conflict resolution is then only invoked for edits that are truly concurrent,
+// rather than whenever both sides have changed.
+func WithCausality(localReplica, remoteReplica string) Option {
+	return func(o *options) {
+		o.causality = true
+		o.localReplica = localReplica
+		o.remoteReplica = remoteReplica
+	}
+}
+
+// WithConflictResolver will set how Sync resolves objects changed on both sides.
+// The default is LastWriteWins.
+func WithConflictResolver(resolver ConflictResolver) Option {
+	return func(o *options) {
+		o.resolver = resolver
+	}
+}
+
+// WithBaseStorage will make Sync keep the content of every object as it was at
+// the last sync, so the ConflictResolver is given the base of a conflict.
+func WithBaseStorage(bases BaseStorage) Option {
+	return func(o *options) {
+		o.bases = bases
+	}
+}
+
+// WithConflictStorage will make Sync record conflicts that the ConflictResolver
+// defers, such as with DeferConflicts, and skip their objects until they are
+// resolved through a ConflictQueue.
+func WithConflictStorage(conflicts ConflictStorage) Option {
+	return func(o *options) {
+		o.conflicts = conflicts
+	}
+}
+
+// WithTombstones will make Sync use the tombstones kept by storages that
+// implement TombstoneStorage.  Deletions then carry their time and origin to
+// the other side, an object deleted on one side but changed on the other is
+// passed to the ConflictResolver, and deletions reach replicas that have not
+// synced with each other before.  Tombstones older than retention are removed
+// after each sync, unless retention is zero.
+//
+// A storage that does not implement TombstoneStorage leaves no record of its
+// deletions, so an object it deleted but the other side changed since the
+// last sync is passed to the ConflictResolver with nothing to weigh against
+// the change, and is restored by the default resolver.
+func WithTombstones(retention time.Duration) Option {
+	return func(o *options) {
+		o.tombstones = true
+		o.tombstoneRetention = retention
+	}
+}
+
+// WithSketches will make Sync reconcile storages that implement Sketcher by
+// exchanging IBLT sketches of cells cells, instead of listing their objects.
+// The sketches can be decoded as long as the objects changed since the last
+// sync are well below a third of the cells.  Otherwise Sync falls back to
+// the Merkle trees of the storages, or to listing them.
+func WithSketches(cells int) Option {
+	return func(o *options) {
+		o.sketchCells = cells
+	}
+}
@@ -0,0 +1,334 @@
+package redisstorage
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/keithballdotnet/objectsync"
+	"github.com/redis/go-redis/v9"
+)
+
+// Check the interfaces
+var _ objectsync.TransactionalStorage = &RedisStorage{}
+var _ objectsync.Lister = &RedisStorage{}
+var _ objectsync.Sketcher = &RedisStorage{}
+var _ objectsync.StatusStorage = &RedisStatusStorage{}
+var _ objectsync.TokenStorage = &RedisStatusStorage{}
+
+func newClient(t *testing.T) redis.UniversalClient {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestRedisStorage(t *testing.T) {
+
+	ctx := context.TODO()
+
+	t.Run("SetGet", func(t *testing.T) {
+		store := NewRedisStorage(newClient(t), "cache")
+
+		modified := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+		object := &objectsync.GenericObject{ID: "a", Value: "a", Modified: modified, Version: objectsync.VersionVector{"local": 1}}
+		object.VersionHash = objectsync.NewHash(object.Value)
+		err := store.Set(ctx, object)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		got, err := store.Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if got.Value != "a" || string(got.Hash) != string(object.Hash) || !got.Modified.Equal(modified) || got.Version["local"] != 1 {
+			t.Errorf("Unexpected object = %+v", got)
+		}
+
+		// Writing without a version removes it
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "b"})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		got, err = store.Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if got.Version != nil {
+			t.Errorf("Unexpected version = %v", got.Version)
+		}
+
+		err = store.Delete(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = store.Get(ctx, "a")
+		if !objectsync.IsNotFoundError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+
+	t.Run("Batches", func(t *testing.T) {
+		store := NewRedisStorage(newClient(t), "cache")
+		for i := 0; i < batchSize*2+1; i++ {
+			err := store.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("object%v", i), Value: fmt.Sprintf("value%v", i)})
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+		}
+
+		all, err := store.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != batchSize*2+1 {
+			t.Errorf("Incorrect len = %v, want %v", len(all), batchSize*2+1)
+		}
+		listed, err := store.List(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(listed) != batchSize*2+1 || listed[0].Value != "" || listed[0].Hash == nil {
+			t.Errorf("Unexpected listing of %v objects", len(listed))
+		}
+	})
+
+	t.Run("CompareAndSet", func(t *testing.T) {
+		client := newClient(t)
+		store1 := NewRedisStorage(client, "cache")
+		store2 := NewRedisStorage(client, "cache")
+
+		// Changed by someone else since it was read
+		err := store1.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "a"})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = store2.Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = store1.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "changed"})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = store2.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "stale"})
+		if err != objectsync.ErrorPreconditionFailed {
+			t.Errorf("Unexpected error = %v", err)
+		}
+		err = store2.Delete(ctx, "a")
+		if err != objectsync.ErrorPreconditionFailed {
+			t.Errorf("Unexpected error = %v", err)
+		}
+
+		// Created by someone else since it was read as missing
+		_, err = store2.Get(ctx, "b")
+		if !objectsync.IsNotFoundError(err) {
+			t.Fatalf("Unexpected error = %v", err)
+		}
+		err = store1.Set(ctx, &objectsync.GenericObject{ID: "b", Value: "b"})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = store2.Set(ctx, &objectsync.GenericObject{ID: "b", Value: "stale"})
+		if err != objectsync.ErrorPreconditionFailed {
+			t.Errorf("Unexpected error = %v", err)
+		}
+
+		// Read again, the write goes through
+		_, err = store2.Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = store2.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "fresh"})
+		if err != nil {
+			t.Errorf("Error: %v", err)
+		}
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		client := newClient(t)
+		store1 := NewRedisStorage(client, "local")
+		store2 := NewRedisStorage(client, "remote")
+		status := NewRedisStatusStorage(client, "local_remote")
+
+		if !store1.SupportsStatus(status) || store1.SupportsStatus(NewRedisStatusStorage(newClient(t), "local_remote")) {
+			t.Errorf("Unexpected status support")
+		}
+
+		for i := 0; i < 3; i++ {
+			store1.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("local%v", i), Value: "local", Modified: time.Now().UTC()})
+			store2.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("remote%v", i), Value: "remote", Modified: time.Now().UTC()})
+		}
+
+		opts := []objectsync.Option{objectsync.WithCausality("local", "remote"), objectsync.WithSketches(60)}
+		err := objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		store2.Set(ctx, &objectsync.GenericObject{ID: "local1", Value: "changed", Modified: time.Now().UTC()})
+		store1.Delete(ctx, "remote2")
+		err = objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		for _, store := range []*RedisStorage{store1, store2} {
+			all, err := store.GetAll(ctx)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if len(all) != 5 {
+				t.Errorf("Incorrect len = %v, want 5", len(all))
+			}
+		}
+		// The sketches are the ones over the objects
+		for _, store := range []*RedisStorage{store1, store2} {
+			all, err := store.GetAll(ctx)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			want := objectsync.NewIBLT(60)
+			for _, object := range all {
+				want.Insert(object.ID, object.Hash)
+			}
+			sketch, err := store.Sketch(ctx, 60)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if !reflect.DeepEqual(sketch, want) {
+				t.Errorf("Unexpected sketch of %s", store.GetName())
+			}
+		}
+		object, err := store1.Get(ctx, "local1")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != "changed" {
+			t.Errorf("Unexpected value = %s", object.Value)
+		}
+
+		stati, err := status.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(stati) != 5 {
+			t.Errorf("Incorrect status len = %v, want 5", len(stati))
+		}
+		_, err = status.Get(ctx, "remote2")
+		if !objectsync.IsNotFoundError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+	t.Run("Tokens", func(t *testing.T) {
+		status := NewRedisStatusStorage(newClient(t), "{local}:status")
+		_, err := status.GetToken(ctx, objectsync.SideLocal)
+		if !objectsync.IsNotFoundError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+		for _, token := range []string{"token1", "token2"} {
+			err = status.SetToken(ctx, objectsync.SideLocal, token)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+		}
+		err = status.SetToken(ctx, objectsync.SideRemote, "remote")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		token, err := status.GetToken(ctx, objectsync.SideLocal)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if token != "token2" {
+			t.Errorf("Unexpected token = %s", token)
+		}
+
+		// The tokens are kept apart from the status
+		stati, err := status.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(stati) != 0 {
+			t.Errorf("Unexpected status = %v", stati)
+		}
+	})
+
+	t.Run("Cluster", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		client := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{server.Addr()}})
+		t.Cleanup(func() { client.Close() })
+		store1 := NewRedisStorage(client, "local")
+		store2 := NewRedisStorage(client, "remote")
+		status := NewRedisStatusStorage(client, "{local}:status")
+
+		if !store1.SupportsStatus(status) || store1.SupportsStatus(NewRedisStatusStorage(client, "local_remote")) {
+			t.Errorf("Unexpected status support")
+		}
+
+		store1.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "local", Modified: time.Now().UTC()})
+		store2.Set(ctx, &objectsync.GenericObject{ID: "b", Value: "remote", Modified: time.Now().UTC()})
+		err := objectsync.Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// The keys of each storage share its hash tag
+		for _, key := range server.Keys() {
+			if !strings.HasPrefix(key, "{local}:") && !strings.HasPrefix(key, "{remote}:") {
+				t.Errorf("Unexpected key = %s", key)
+			}
+		}
+		all, _ := store2.GetAll(ctx)
+		if len(all) != 2 {
+			t.Errorf("Incorrect len = %v, want 2", len(all))
+		}
+	})
+
+	t.Run("Signed", func(t *testing.T) {
+		client := newClient(t)
+		store := NewRedisStorage(client, "signed")
+		public, key, _ := ed25519.GenerateKey(nil)
+		modified := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+		signer := objectsync.NewSignedStorage(store, "local", key, nil)
+		err := signer.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "value", Modified: modified, Version: objectsync.VersionVector{"local": 1}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// The signature is kept, with the time it covers, so the object
+		// verifies when read again
+		verifier := func() *objectsync.SignedStorage {
+			reader := NewRedisStorage(client, "signed")
+			return objectsync.NewSignedStorage(reader, "remote", nil, map[string]ed25519.PublicKey{"local": public})
+		}
+		got, err := verifier().Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if got.Signature == nil || got.Signature.Replica != "local" || !got.Modified.Equal(modified) {
+			t.Errorf("Unexpected object = %+v", got)
+		}
+		all, err := verifier().GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 1 {
+			t.Errorf("Incorrect len = %v, want 1", len(all))
+		}
+
+		// Written again without one, it no longer verifies
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "unsigned", Modified: modified, Version: objectsync.VersionVector{"local": 2}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = verifier().Get(ctx, "a")
+		if !objectsync.IsVerificationError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package redisstorage
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/keithballdotnet/objectsync"
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStatusStorage is an objectsync.StatusStorage keeping the sync status
+// in one Redis hash, with a field per ID.  It is an objectsync.TokenStorage,
+// keeping the tokens of the change feeds in the hash key:tokens.
+type RedisStatusStorage struct {
+	client redis.UniversalClient
+	key    string
+}
+
+// NewRedisStatusStorage will return a RedisStatusStorage keeping the status
+// in key.  Each pair of synced storages needs its own key.  On a cluster the
+// key must have the hash tag of one of the storages, such as
+// {prefix}:status, for the status to be written along with its objects.
+func NewRedisStatusStorage(client redis.UniversalClient, key string) *RedisStatusStorage {
+	return &RedisStatusStorage{client: client, key: key}
+}
+
+// Set ...
+func (s *RedisStatusStorage) Set(ctx context.Context, object *objectsync.SyncStatus) error {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	return s.client.HSet(ctx, s.key, object.ID, data).Err()
+}
+
+// Get ...
+func (s *RedisStatusStorage) Get(ctx context.Context, id string) (*objectsync.SyncStatus, error) {
+	data, err := s.client.HGet(ctx, s.key, id).Bytes()
+	if err == redis.Nil {
+		return nil, objectsync.ErrorNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	status := &objectsync.SyncStatus{}
+	err = json.Unmarshal(data, status)
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// GetAll ...
+func (s *RedisStatusStorage) GetAll(ctx context.Context) ([]*objectsync.SyncStatus, error) {
+	all, err := s.client.HGetAll(ctx, s.key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	stati := make([]*objectsync.SyncStatus, 0, len(all))
+	for _, data := range all {
+		status := &objectsync.SyncStatus{}
+		err = json.Unmarshal([]byte(data), status)
+		if err != nil {
+			return nil, err
+		}
+		stati = append(stati, status)
+	}
+	return stati, nil
+}
+
+// Delete ...
+func (s *RedisStatusStorage) Delete(ctx context.Context, id string) error {
+	return s.client.HDel(ctx, s.key, id).Err()
+}
+
+// GetToken ...
+func (s *RedisStatusStorage) GetToken(ctx context.Context, side string) (string, error) {
+	token, err := s.client.HGet(ctx, s.key+":tokens", side).Result()
+	if err == redis.Nil {
+		return "", objectsync.ErrorNotFound
+	}
+	return token, err
+}
+
+// SetToken ...
+func (s *RedisStatusStorage) SetToken(ctx context.Context, side, token string) error {
+	return s.client.HSet(ctx, s.key+":tokens", side, token).Err()
+}
@@ -0,0 +1,391 @@
+// Package redisstorage implements objectsync storage and status storage on
+// Redis.  Each object is a hash holding its value and metadata, and a set
+// indexes the IDs of a storage.
+//
+// The keys of a storage start with its prefix as a hash tag, {prefix}:, so
+// they share a hash slot and its scripts run on a Redis Cluster.  Cluster
+// mode is supported only that way: the status is written in the same script
+// as an object only if the key of the status has the same hash tag.
+package redisstorage
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keithballdotnet/objectsync"
+	"github.com/redis/go-redis/v9"
+)
+
+// Fields of the hash of an object
+const (
+	fieldValue       = "value"
+	fieldHash        = "hash"
+	fieldModified    = "modified"
+	fieldVersion     = "version"
+	fieldVersionHash = "version-hash"
+	fieldSignature   = "signature"
+)
+
+// batchSize is the number of commands pipelined at once when reading all
+// objects
+const batchSize = 500
+
+// condition is the start of the write scripts, checking the hash of the
+// object is still the one expected.  ARGV[1] is the condition, and ARGV[2]
+// the hash expected.
+const condition = `
+local current = redis.call('HGET', KEYS[1], 'hash')
+if ARGV[1] == 'absent' and current then
+	return 0
+end
+if ARGV[1] == 'match' and current ~= ARGV[2] then
+	return 0
+end
+`
+
+// setScript will replace the object in KEYS[1] with the fields from ARGV[5],
+// index ARGV[3] in KEYS[2], and set the status ARGV[4] in KEYS[3] if given
+var setScript = redis.NewScript(condition + `
+redis.call('DEL', KEYS[1])
+redis.call('HSET', KEYS[1], unpack(ARGV, 5))
+redis.call('SADD', KEYS[2], ARGV[3])
+if KEYS[3] then
+	redis.call('HSET', KEYS[3], ARGV[3], ARGV[4])
+end
+return 1
+`)
+
+// deleteScript will remove the object in KEYS[1], ARGV[3] from the index in
+// KEYS[2], and its status in KEYS[3] if given
+var deleteScript = redis.NewScript(condition + `
+redis.call('DEL', KEYS[1])
+redis.call('SREM', KEYS[2], ARGV[3])
+if KEYS[3] then
+	redis.call('HDEL', KEYS[3], ARGV[3])
+end
+return 1
+`)
+
+// RedisStorage is an objectsync.Storage keeping objects in Redis.
+//
+// Writes are compare-and-set on the hash last read for the object, done in
+// a script, so an object changed by another writer since the sync read it
+// is not overwritten.  Such writes fail with
+// objectsync.ErrorPreconditionFailed.  The status is written by the same
+// script when the RedisStatusStorage uses the same client.  It is an
+// objectsync.Sketcher, summarizing the objects as listed.
+type RedisStorage struct {
+	client redis.UniversalClient
+	prefix string
+
+	mu sync.Mutex
+	// hashes are the hashes last read per ID, empty if it was read as missing
+	hashes map[string]string
+}
+
+// NewRedisStorage will return a RedisStorage keeping its objects in keys
+// starting with {prefix}:
+func NewRedisStorage(client redis.UniversalClient, prefix string) *RedisStorage {
+	return &RedisStorage{
+		client: client,
+		prefix: prefix,
+		hashes: make(map[string]string),
+	}
+}
+
+// GetName will return the prefix
+func (s *RedisStorage) GetName() string {
+	return s.prefix
+}
+
+func (s *RedisStorage) key(id string) string {
+	return "{" + s.prefix + "}:object:" + id
+}
+
+func (s *RedisStorage) index() string {
+	return "{" + s.prefix + "}:ids"
+}
+
+// Set ...
+func (s *RedisStorage) Set(ctx context.Context, object *objectsync.GenericObject) error {
+	return s.set(ctx, object, nil, nil)
+}
+
+func (s *RedisStorage) set(ctx context.Context, object *objectsync.GenericObject, status *RedisStatusStorage, syncStatus *objectsync.SyncStatus) error {
+	hash := objectsync.NewHash(object.Value)
+	fields := []interface{}{
+		fieldValue, object.Value,
+		fieldHash, hex.EncodeToString(hash),
+		fieldModified, object.Modified.Format(time.RFC3339Nano),
+	}
+	if object.Version != nil {
+		version, err := json.Marshal(object.Version)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, fieldVersion, string(version), fieldVersionHash, hex.EncodeToString(object.VersionHash))
+	}
+	if object.Signature != nil {
+		signature, err := json.Marshal(object.Signature)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, fieldSignature, string(signature))
+	}
+
+	keys := []string{s.key(object.ID), s.index()}
+	statusData := ""
+	if status != nil {
+		data, err := json.Marshal(syncStatus)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, status.key)
+		statusData = string(data)
+	}
+
+	cond, expected := s.condition(object.ID)
+	args := append([]interface{}{cond, expected, object.ID, statusData}, fields...)
+	err := s.run(ctx, setScript, keys, args)
+	if err != nil {
+		return err
+	}
+
+	s.setHash(object.ID, hex.EncodeToString(hash))
+	object.Hash = hash
+	return nil
+}
+
+// Get ...
+func (s *RedisStorage) Get(ctx context.Context, id string) (*objectsync.GenericObject, error) {
+	fields, err := s.client.HGetAll(ctx, s.key(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		s.setHash(id, "")
+		return nil, objectsync.ErrorNotFound
+	}
+
+	object, err := decodeObject(id, fields)
+	if err != nil {
+		return nil, err
+	}
+	s.setHash(id, fields[fieldHash])
+	return object, nil
+}
+
+// GetAll will return all objects, read in pipelined batches
+func (s *RedisStorage) GetAll(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	return s.list(ctx, func(pipe redis.Pipeliner, key string) redis.Cmder {
+		return pipe.HGetAll(ctx, key)
+	}, func(cmd redis.Cmder) (map[string]string, error) {
+		return cmd.(*redis.MapStringStringCmd).Result()
+	})
+}
+
+// List will return all objects without their values, read in pipelined
+// batches
+func (s *RedisStorage) List(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	names := []string{fieldHash, fieldModified, fieldVersion, fieldVersionHash, fieldSignature}
+	return s.list(ctx, func(pipe redis.Pipeliner, key string) redis.Cmder {
+		return pipe.HMGet(ctx, key, names...)
+	}, func(cmd redis.Cmder) (map[string]string, error) {
+		values, err := cmd.(*redis.SliceCmd).Result()
+		if err != nil {
+			return nil, err
+		}
+		fields := map[string]string{}
+		for i, value := range values {
+			if value, ok := value.(string); ok {
+				fields[names[i]] = value
+			}
+		}
+		return fields, nil
+	})
+}
+
+// Sketch will summarize the IDs and hashes of the objects listed
+func (s *RedisStorage) Sketch(ctx context.Context, cells int) (*objectsync.IBLT, error) {
+	all, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sketch := objectsync.NewIBLT(cells)
+	for _, object := range all {
+		sketch.Insert(object.ID, object.Hash)
+	}
+	return sketch, nil
+}
+
+// list will read the fields of every indexed object with read, a batch at a
+// time, and decode them with result
+func (s *RedisStorage) list(ctx context.Context, read func(pipe redis.Pipeliner, key string) redis.Cmder, result func(cmd redis.Cmder) (map[string]string, error)) (objectsync.GenericObjectCollection, error) {
+	ids, err := s.client.SMembers(ctx, s.index()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	all := objectsync.GenericObjectCollection{}
+	for start := 0; start < len(ids); start += batchSize {
+		batch := ids[start:]
+		if len(batch) > batchSize {
+			batch = batch[:batchSize]
+		}
+
+		pipe := s.client.Pipeline()
+		cmds := make([]redis.Cmder, len(batch))
+		for i, id := range batch {
+			cmds[i] = read(pipe, s.key(id))
+		}
+		_, err = pipe.Exec(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, id := range batch {
+			fields, err := result(cmds[i])
+			if err != nil {
+				return nil, err
+			}
+			// Deleted since it was indexed
+			if fields[fieldHash] == "" {
+				continue
+			}
+			object, err := decodeObject(id, fields)
+			if err != nil {
+				return nil, err
+			}
+			s.setHash(id, fields[fieldHash])
+			all = append(all, object)
+		}
+	}
+	return all, nil
+}
+
+// Delete will remove a entry from the storage
+func (s *RedisStorage) Delete(ctx context.Context, id string) error {
+	return s.delete(ctx, id, nil)
+}
+
+func (s *RedisStorage) delete(ctx context.Context, id string, status *RedisStatusStorage) error {
+	keys := []string{s.key(id), s.index()}
+	if status != nil {
+		keys = append(keys, status.key)
+	}
+
+	cond, expected := s.condition(id)
+	if cond == "absent" {
+		cond = "any"
+	}
+	err := s.run(ctx, deleteScript, keys, []interface{}{cond, expected, id, ""})
+	if err != nil {
+		return err
+	}
+
+	s.setHash(id, "")
+	return nil
+}
+
+// SupportsStatus will return true for status storages using the same
+// client, and on a cluster with a key in the same hash slot
+func (s *RedisStorage) SupportsStatus(status objectsync.StatusStorage) bool {
+	redisStatus, ok := status.(*RedisStatusStorage)
+	if !ok || redisStatus.client != s.client {
+		return false
+	}
+	if _, cluster := s.client.(*redis.ClusterClient); cluster {
+		return hashTag(redisStatus.key) == hashTag(s.index())
+	}
+	return true
+}
+
+// SetWithStatus will set the object and its sync status in one script
+func (s *RedisStorage) SetWithStatus(ctx context.Context, object *objectsync.GenericObject, status objectsync.StatusStorage, syncStatus *objectsync.SyncStatus) error {
+	return s.set(ctx, object, status.(*RedisStatusStorage), syncStatus)
+}
+
+// DeleteWithStatus will delete the object and its sync status in one script
+func (s *RedisStorage) DeleteWithStatus(ctx context.Context, id string, status objectsync.StatusStorage) error {
+	return s.delete(ctx, id, status.(*RedisStatusStorage))
+}
+
+// run will run the write script, which returns 0 if its condition failed
+func (s *RedisStorage) run(ctx context.Context, script *redis.Script, keys []string, args []interface{}) error {
+	written, err := script.Run(ctx, s.client, keys, args...).Int()
+	if err != nil {
+		return err
+	}
+	if written == 0 {
+		return objectsync.ErrorPreconditionFailed
+	}
+	return nil
+}
+
+// condition will return the condition for writing the object with id, and
+// the hash it expects
+func (s *RedisStorage) condition(id string) (string, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hash, seen := s.hashes[id]
+	switch {
+	case !seen:
+		return "any", ""
+	case hash == "":
+		return "absent", ""
+	}
+	return "match", hash
+}
+
+func (s *RedisStorage) setHash(id, hash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hashes[id] = hash
+}
+
+// hashTag will return the part of key a cluster hashes to find its slot
+func hashTag(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+	return key
+}
+
+func decodeObject(id string, fields map[string]string) (*objectsync.GenericObject, error) {
+	object := &objectsync.GenericObject{ID: id, Value: fields[fieldValue]}
+
+	var err error
+	object.Hash, err = hex.DecodeString(fields[fieldHash])
+	if err != nil {
+		return nil, err
+	}
+	object.Modified, err = time.Parse(time.RFC3339Nano, fields[fieldModified])
+	if err != nil {
+		return nil, err
+	}
+
+	if version, ok := fields[fieldVersion]; ok {
+		err = json.Unmarshal([]byte(version), &object.Version)
+		if err != nil {
+			return nil, err
+		}
+		object.VersionHash, err = hex.DecodeString(fields[fieldVersionHash])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if signature, ok := fields[fieldSignature]; ok {
+		object.Signature = &objectsync.ObjectSignature{}
+		err = json.Unmarshal([]byte(signature), object.Signature)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return object, nil
+}
@@ -0,0 +1,381 @@
+package s3storage
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/keithballdotnet/objectsync"
+)
+
+// Check the interfaces
+var _ objectsync.Storage = &S3Storage{}
+var _ objectsync.Lister = &S3Storage{}
+
+// requestCounter counts the requests to the fake by method
+type requestCounter struct {
+	handler http.Handler
+	mu      sync.Mutex
+	counts  map[string]int
+}
+
+func (c *requestCounter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	c.counts[r.Method]++
+	c.mu.Unlock()
+	c.handler.ServeHTTP(w, r)
+}
+
+func (c *requestCounter) count(method string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[method]
+}
+
+func (c *requestCounter) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts = make(map[string]int)
+}
+
+// newClient will return a client for a new in-process S3 fake with bucket
+func newClient(t *testing.T, bucket string) *s3.Client {
+	client, _ := newCountingClient(t, bucket)
+	return client
+}
+
+// newCountingClient will return a client for a new in-process S3 fake with
+// bucket, and the counter of its requests
+func newCountingClient(t *testing.T, bucket string) (*s3.Client, *requestCounter) {
+	counter := &requestCounter{handler: gofakes3.New(s3mem.New()).Server(), counts: make(map[string]int)}
+	server := httptest.NewServer(counter)
+	t.Cleanup(server.Close)
+
+	client := s3.New(s3.Options{
+		BaseEndpoint: aws.String(server.URL),
+		Region:       "us-east-1",
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		UsePathStyle: true,
+	})
+	_, err := client.CreateBucket(context.TODO(), &s3.CreateBucketInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	return client, counter
+}
+
+func TestS3Storage(t *testing.T) {
+
+	ctx := context.TODO()
+
+	t.Run("SetGet", func(t *testing.T) {
+		client := newClient(t, "bucket")
+		store := NewS3Storage(client, "bucket", "objects/")
+
+		object := &objectsync.GenericObject{
+			ID:          "a",
+			Value:       "value",
+			Version:     objectsync.VersionVector{"local": 2},
+			VersionHash: objectsync.NewHash("value"),
+		}
+		err := store.Set(ctx, object)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		got, err := store.Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if got.Value != "value" || string(got.Hash) != string(objectsync.NewHash("value")) || got.Version["local"] != 2 || string(got.VersionHash) != string(object.VersionHash) {
+			t.Errorf("Unexpected object = %+v", got)
+		}
+		if got.Modified.IsZero() {
+			t.Errorf("Expected LastModified as Modified")
+		}
+
+		_, err = store.Get(ctx, "missing")
+		if !objectsync.IsNotFoundError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+
+		// Objects written by other tools take their hash from the ETag
+		_, err = client.PutObject(ctx, &s3.PutObjectInput{Bucket: aws.String("bucket"), Key: aws.String("objects/b"), Body: strings.NewReader("other")})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		got, err = store.Get(ctx, "b")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(got.Hash) == 0 {
+			t.Errorf("Expected hash from ETag")
+		}
+
+		err = store.Delete(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = store.Get(ctx, "a")
+		if !objectsync.IsNotFoundError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+
+	t.Run("Paginated", func(t *testing.T) {
+		client := newClient(t, "bucket")
+		store := NewS3Storage(client, "bucket", "objects/")
+		other := NewS3Storage(client, "bucket", "other/")
+
+		for i := 0; i < 1050; i++ {
+			_, err := client.PutObject(ctx, &s3.PutObjectInput{Bucket: aws.String("bucket"), Key: aws.String(fmt.Sprintf("objects/%04d", i)), Body: strings.NewReader("x")})
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+		}
+		other.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "a"})
+
+		all, err := store.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 1050 {
+			t.Errorf("Incorrect len = %v, want 1050", len(all))
+		}
+		listed, err := store.List(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(listed) != 1050 {
+			t.Errorf("Incorrect list len = %v, want 1050", len(listed))
+		}
+		all, _ = other.GetAll(ctx)
+		if len(all) != 1 || all[0].ID != "a" {
+			t.Errorf("Unexpected objects = %+v", all)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		client, counter := newCountingClient(t, "bucket")
+		store := NewS3Storage(client, "bucket", "objects/")
+		for i := 0; i < 3; i++ {
+			err := store.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("%v", i), Value: fmt.Sprintf("Object%v", i), Version: objectsync.VersionVector{"local": 1}})
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+		}
+		_, err := client.PutObject(ctx, &s3.PutObjectInput{Bucket: aws.String("bucket"), Key: aws.String("objects/other"), Body: strings.NewReader("other")})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// Objects not read yet are read with HeadObject, and not their values
+		counter.reset()
+		listed, err := store.List(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(listed) != 4 {
+			t.Fatalf("Incorrect len = %v, want 4", len(listed))
+		}
+		if counter.count(http.MethodHead) != 4 || counter.count(http.MethodGet) != 1 {
+			t.Errorf("Unexpected requests = %v", counter.counts)
+		}
+		for _, object := range listed {
+			got, err := store.Get(ctx, object.ID)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if object.Value != "" || string(object.Hash) != string(got.Hash) || !object.Modified.Equal(got.Modified) || object.Version["local"] != got.Version["local"] {
+				t.Errorf("Unexpected object = %+v, want %+v", object, got)
+			}
+		}
+
+		// Unchanged objects need no HeadObject
+		counter.reset()
+		_, err = store.List(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if counter.count(http.MethodHead) != 0 || counter.count(http.MethodGet) != 1 {
+			t.Errorf("Unexpected requests = %v", counter.counts)
+		}
+
+		// Changed ones do
+		store.Set(ctx, &objectsync.GenericObject{ID: "0", Value: "changed"})
+		counter.reset()
+		listed, err = store.List(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if counter.count(http.MethodHead) != 1 {
+			t.Errorf("Unexpected requests = %v", counter.counts)
+		}
+		for _, object := range listed {
+			if object.ID == "0" && string(object.Hash) != string(objectsync.NewHash("changed")) {
+				t.Errorf("Unexpected hash of changed object")
+			}
+		}
+	})
+
+	t.Run("Conditional", func(t *testing.T) {
+		client := newClient(t, "bucket")
+		store := NewS3Storage(client, "bucket", "", WithConditionalWrites())
+		someoneElse := NewS3Storage(client, "bucket", "")
+
+		_, err := store.Get(ctx, "a")
+		if !objectsync.IsNotFoundError(err) {
+			t.Fatalf("Unexpected error = %v", err)
+		}
+		someoneElse.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "theirs"})
+
+		// Created since we found it missing
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "ours"})
+		if err != objectsync.ErrorPreconditionFailed {
+			t.Errorf("Unexpected error = %v", err)
+		}
+
+		_, err = store.Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "ours"})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// Changed since we last read or wrote it
+		someoneElse.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "theirs again"})
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "ours again"})
+		if err != objectsync.ErrorPreconditionFailed {
+			t.Errorf("Unexpected error = %v", err)
+		}
+
+		object, _ := someoneElse.Get(ctx, "a")
+		if object.Value != "theirs again" {
+			t.Errorf("Unexpected value = %s expected theirs again", object.Value)
+		}
+
+		// Created since it was missing from the listing
+		_, err = store.List(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		someoneElse.Set(ctx, &objectsync.GenericObject{ID: "b", Value: "theirs"})
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "b", Value: "ours"})
+		if err != objectsync.ErrorPreconditionFailed {
+			t.Errorf("Unexpected error = %v", err)
+		}
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "c", Value: "ours"})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		client := newClient(t, "bucket")
+		store1 := objectsync.NewInMemoryStorage("local")
+		store2 := NewS3Storage(client, "bucket", "sync/", WithConditionalWrites())
+		status := objectsync.NewInMemoryStatusStorage()
+
+		for i := 0; i < 3; i++ {
+			store1.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("local%v", i), Value: fmt.Sprintf("Object%v", i), Modified: time.Now().UTC()})
+			err := store2.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("remote%v", i), Value: fmt.Sprintf("Object%v", i)})
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+		}
+
+		opts := []objectsync.Option{objectsync.WithCausality("local", "remote")}
+		err := objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		store1.Delete(ctx, "remote0")
+		store1.Set(ctx, &objectsync.GenericObject{ID: "local1", Value: "changed", Modified: time.Now().UTC()})
+		err = objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		all, err := store2.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 5 {
+			t.Errorf("Incorrect len = %v, want 5", len(all))
+		}
+		object, err := store2.Get(ctx, "local1")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != "changed" {
+			t.Errorf("Unexpected value = %s expected changed", object.Value)
+		}
+
+		// Nothing changes if we change nothing
+		err = objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		stati, _ := status.GetAll(ctx)
+		if len(stati) != 5 {
+			t.Errorf("Incorrect status len = %v, want 5", len(stati))
+		}
+	})
+
+	t.Run("Signed", func(t *testing.T) {
+		client := newClient(t, "bucket")
+		store := NewS3Storage(client, "bucket", "signed/")
+		public, key, _ := ed25519.GenerateKey(nil)
+		modified := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+		signer := objectsync.NewSignedStorage(store, "local", key, nil)
+		err := signer.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "value", Modified: modified, Version: objectsync.VersionVector{"local": 1}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// The signature is kept, with the time it covers, so the object
+		// verifies when read again
+		verifier := func() *objectsync.SignedStorage {
+			reader := NewS3Storage(client, "bucket", "signed/")
+			return objectsync.NewSignedStorage(reader, "remote", nil, map[string]ed25519.PublicKey{"local": public})
+		}
+		got, err := verifier().Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if got.Signature == nil || got.Signature.Replica != "local" || !got.Modified.Equal(modified) {
+			t.Errorf("Unexpected object = %+v", got)
+		}
+		all, err := verifier().GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 1 {
+			t.Errorf("Incorrect len = %v, want 1", len(all))
+		}
+
+		// Written again without one, it no longer verifies
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "unsigned", Modified: modified, Version: objectsync.VersionVector{"local": 2}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = verifier().Get(ctx, "a")
+		if !objectsync.IsVerificationError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+}
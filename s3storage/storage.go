@@ -0,0 +1,412 @@
+// Package s3storage implements objectsync storage on any S3-compatible
+// object store.  Objects are kept as keys under a prefix of a bucket.
+package s3storage
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/keithballdotnet/objectsync"
+)
+
+// User metadata keys written with each object
+const (
+	metaHash        = "sha256"
+	metaVersion     = "version"
+	metaVersionHash = "version-hash"
+	metaSignature   = "signature"
+	metaModified    = "modified"
+)
+
+// Option configures a S3Storage
+type Option func(*S3Storage)
+
+// WithConditionalWrites will make writes conditional on the ETag last read for
+// the object, so an object changed by someone else since the sync read it is
+// not overwritten.  Objects missing from the last listing, or read as
+// missing, are only created if they still do not exist.  Such writes fail
+// with objectsync.ErrorPreconditionFailed.  The service must support If-Match
+// and If-None-Match on PutObject.
+func WithConditionalWrites() Option {
+	return func(s *S3Storage) {
+		s.conditional = true
+	}
+}
+
+// S3Storage is an objectsync.Storage keeping objects in a S3 bucket.
+//
+// The hash of the value is stored in the object's user metadata.  Objects
+// written by other tools have none, and take their hash from the ETag.
+// Modified is the LastModified time of the object, or for a signed object the
+// modified time it was signed with, kept in the metadata with the signature.
+//
+// List pages through ListObjectsV2 without reading values.  As a listing
+// holds no user metadata, it is read with HeadObject for the objects whose
+// ETag or LastModified has changed since they were last read, so a listing of
+// an unchanged bucket makes no request per object.
+type S3Storage struct {
+	client      *s3.Client
+	bucket      string
+	prefix      string
+	conditional bool
+
+	mu sync.Mutex
+	// etags are the ETags last read per ID, empty if it was read as missing.
+	// Once listed, IDs not in etags were missing from the listing.
+	etags  map[string]string
+	listed bool
+	// heads are the metadata last read per ID
+	heads map[string]*head
+}
+
+// head is the metadata of an object as last read
+type head struct {
+	etag     string
+	modified time.Time
+	metadata map[string]string
+}
+
+// NewS3Storage will return a S3Storage keeping its objects in bucket, with
+// keys made of prefix and the object ID
+func NewS3Storage(client *s3.Client, bucket, prefix string, opts ...Option) *S3Storage {
+	s := &S3Storage{
+		client: client,
+		bucket: bucket,
+		prefix: prefix,
+		etags:  make(map[string]string),
+		heads:  make(map[string]*head),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// GetName will return the bucket and prefix
+func (s *S3Storage) GetName() string {
+	return s.bucket + "/" + s.prefix
+}
+
+func (s *S3Storage) key(id string) *string {
+	return aws.String(s.prefix + id)
+}
+
+// Set ...
+func (s *S3Storage) Set(ctx context.Context, object *objectsync.GenericObject) error {
+	hash := objectsync.NewHash(object.Value)
+	metadata := map[string]string{metaHash: hex.EncodeToString(hash)}
+	if object.Version != nil {
+		version, err := json.Marshal(object.Version)
+		if err != nil {
+			return err
+		}
+		metadata[metaVersion] = string(version)
+		metadata[metaVersionHash] = hex.EncodeToString(object.VersionHash)
+	}
+	if object.Signature != nil {
+		signature, err := json.Marshal(object.Signature)
+		if err != nil {
+			return err
+		}
+		metadata[metaSignature] = string(signature)
+		metadata[metaModified] = object.Modified.Format(time.RFC3339Nano)
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      s.key(object.ID),
+		Body:     strings.NewReader(object.Value),
+		Metadata: metadata,
+	}
+	if s.conditional {
+		etag, seen := s.etag(object.ID)
+		switch {
+		case seen && etag == "":
+			input.IfNoneMatch = aws.String("*")
+		case seen:
+			input.IfMatch = aws.String(etag)
+		}
+	}
+
+	output, err := s.client.PutObject(ctx, input)
+	if err != nil {
+		return translateError(err)
+	}
+
+	s.setETag(object.ID, aws.ToString(output.ETag))
+	object.Hash = hash
+	return nil
+}
+
+// Get ...
+func (s *S3Storage) Get(ctx context.Context, id string) (*objectsync.GenericObject, error) {
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    s.key(id),
+	})
+	if err != nil {
+		err = translateError(err)
+		if objectsync.IsNotFoundError(err) {
+			s.setETag(id, "")
+		}
+		return nil, err
+	}
+	defer output.Body.Close()
+
+	value, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &head{
+		etag:     aws.ToString(output.ETag),
+		modified: aws.ToTime(output.LastModified).UTC(),
+		metadata: output.Metadata,
+	}
+	object, err := decodeObject(id, string(value), h)
+	if err != nil {
+		return nil, err
+	}
+
+	s.setHead(id, h)
+	return object, nil
+}
+
+// GetAll will return all objects under the prefix.  Listing is paginated, but
+// the value of each object is downloaded as well.
+func (s *S3Storage) GetAll(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	all := objectsync.GenericObjectCollection{}
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix),
+	})
+	listed := make(map[string]bool)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, translateError(err)
+		}
+
+		for _, item := range page.Contents {
+			id := strings.TrimPrefix(aws.ToString(item.Key), s.prefix)
+			listed[id] = true
+			object, err := s.Get(ctx, id)
+			found, err := wasFound(err)
+			if err != nil {
+				return nil, err
+			}
+			// Deleted since it was listed
+			if !found {
+				continue
+			}
+			all = append(all, object)
+		}
+	}
+	s.setListed(listed)
+	return all, nil
+}
+
+// List will return all objects under the prefix without their values
+func (s *S3Storage) List(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	all := objectsync.GenericObjectCollection{}
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix),
+	})
+	listed := make(map[string]bool)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, translateError(err)
+		}
+
+		for _, item := range page.Contents {
+			id := strings.TrimPrefix(aws.ToString(item.Key), s.prefix)
+			listed[id] = true
+			h, err := s.stat(ctx, id, aws.ToString(item.ETag), aws.ToTime(item.LastModified))
+			found, err := wasFound(err)
+			if err != nil {
+				return nil, err
+			}
+			// Deleted since it was listed
+			if !found {
+				continue
+			}
+
+			object, err := decodeObject(id, "", h)
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, object)
+		}
+	}
+	s.setListed(listed)
+	return all, nil
+}
+
+// stat will return the metadata of the object listed with etag and modified,
+// as last read if it is unchanged since, or else read with HeadObject
+func (s *S3Storage) stat(ctx context.Context, id, etag string, modified time.Time) (*head, error) {
+	s.mu.Lock()
+	h, ok := s.heads[id]
+	s.mu.Unlock()
+	// Listings have the time in milliseconds, and heads in seconds
+	if ok && h.etag == etag && h.modified.Equal(modified.UTC().Truncate(time.Second)) {
+		return h, nil
+	}
+
+	output, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    s.key(id),
+	})
+	if err != nil {
+		err = translateError(err)
+		if objectsync.IsNotFoundError(err) {
+			s.setETag(id, "")
+		}
+		return nil, err
+	}
+
+	h = &head{
+		etag:     aws.ToString(output.ETag),
+		modified: aws.ToTime(output.LastModified).UTC(),
+		metadata: output.Metadata,
+	}
+	s.setHead(id, h)
+	return h, nil
+}
+
+// Delete will remove a entry from the storage
+func (s *S3Storage) Delete(ctx context.Context, id string) error {
+	input := &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    s.key(id),
+	}
+	if s.conditional {
+		etag, seen := s.etag(id)
+		if seen && etag != "" {
+			input.IfMatch = aws.String(etag)
+		}
+	}
+
+	_, err := s.client.DeleteObject(ctx, input)
+	if err != nil {
+		return translateError(err)
+	}
+
+	s.setETag(id, "")
+	return nil
+}
+
+// etag will return the ETag last read for the object with id, empty if it is
+// missing, and whether it is known
+func (s *S3Storage) etag(id string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	etag, ok := s.etags[id]
+	if !ok && s.listed {
+		return "", true
+	}
+	return etag, ok
+}
+
+// setListed will record the IDs of a listing, so the others are known to be
+// missing
+func (s *S3Storage) setListed(listed map[string]bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id := range s.etags {
+		if !listed[id] {
+			delete(s.etags, id)
+			delete(s.heads, id)
+		}
+	}
+	s.listed = true
+}
+
+// setETag will record the ETag of the object with id, written or found
+// missing, and forget its metadata
+func (s *S3Storage) setETag(id, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.etags[id] = etag
+	delete(s.heads, id)
+}
+
+// setHead will record the metadata of the object with id as read
+func (s *S3Storage) setHead(id string, h *head) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.etags[id] = h.etag
+	s.heads[id] = h
+}
+
+func decodeObject(id, value string, h *head) (*objectsync.GenericObject, error) {
+	object := &objectsync.GenericObject{ID: id, Value: value, Modified: h.modified}
+	metadata := h.metadata
+
+	hash, err := hex.DecodeString(metadata[metaHash])
+	if err != nil || len(hash) == 0 {
+		hash = []byte(strings.Trim(h.etag, `"`))
+	}
+	object.Hash = hash
+
+	if version, ok := metadata[metaVersion]; ok {
+		err = json.Unmarshal([]byte(version), &object.Version)
+		if err != nil {
+			return nil, err
+		}
+		object.VersionHash, err = hex.DecodeString(metadata[metaVersionHash])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if signature, ok := metadata[metaSignature]; ok {
+		object.Signature = &objectsync.ObjectSignature{}
+		err = json.Unmarshal([]byte(signature), object.Signature)
+		if err != nil {
+			return nil, err
+		}
+		if modified, ok := metadata[metaModified]; ok {
+			object.Modified, err = time.Parse(time.RFC3339Nano, modified)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return object, nil
+}
+
+// translateError will map S3 errors to their objectsync equivalents
+func translateError(err error) error {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	switch apiErr.ErrorCode() {
+	case "NoSuchKey", "NotFound":
+		return objectsync.ErrorNotFound
+	case "PreconditionFailed":
+		return objectsync.ErrorPreconditionFailed
+	}
+	return err
+}
+
+func wasFound(err error) (bool, error) {
+	if err == nil {
+		return true, nil
+	}
+	if objectsync.IsNotFoundError(err) {
+		return false, nil
+	}
+	return false, err
+}
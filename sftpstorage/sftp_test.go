@@ -0,0 +1,384 @@
+package sftpstorage
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/keithballdotnet/objectsync"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// Check the interfaces
+var _ objectsync.Storage = &SFTPStorage{}
+var _ objectsync.Lister = &SFTPStorage{}
+
+// server is an in-process SSH server with the sftp subsystem
+type server struct {
+	addr     string
+	config   *ssh.ClientConfig
+	accepted int32
+}
+
+func newServer(t *testing.T) *server {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if c.User() == "partner" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("access denied")
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &server{
+		addr: listener.Addr().String(),
+		config: &ssh.ClientConfig{
+			User:            "partner",
+			Auth:            []ssh.AuthMethod{ssh.Password("secret")},
+			HostKeyCallback: ssh.FixedHostKey(signer.PublicKey()),
+		},
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&s.accepted, 1)
+			go s.serve(conn, config)
+		}
+	}()
+	return s
+}
+
+func (s *server) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+				server, err := sftp.NewServer(channel)
+				if err != nil {
+					channel.Close()
+					return
+				}
+				server.Serve()
+				server.Close()
+			}
+		}()
+	}
+}
+
+func TestSFTPStorage(t *testing.T) {
+
+	ctx := context.TODO()
+
+	t.Run("SetGet", func(t *testing.T) {
+		srv := newServer(t)
+		dir := t.TempDir()
+		store, err := Dial(srv.addr, srv.config, dir)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		defer store.Close()
+
+		modified := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+		for _, id := range []string{"a", "reports/2026.csv", ".hidden", "file.sha256"} {
+			object := &objectsync.GenericObject{ID: id, Value: "value " + id, Modified: modified}
+			err = store.Set(ctx, object)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if string(object.Hash) != string(objectsync.NewHash(object.Value)) {
+				t.Errorf("Unexpected hash for [%s]", id)
+			}
+
+			got, err := store.Get(ctx, id)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if got.ID != id || got.Value != "value "+id || !got.Modified.Equal(modified) {
+				t.Errorf("Unexpected object = %+v", got)
+			}
+		}
+
+		// Nothing is left behind by the uploads
+		files, _ := os.ReadDir(dir)
+		for _, file := range files {
+			if strings.HasPrefix(file.Name(), tmpPrefix) {
+				t.Errorf("Unexpected temporary file [%s]", file.Name())
+			}
+		}
+
+		// Files dropped by others are objects too
+		err = os.WriteFile(filepath.Join(dir, "drop.csv"), []byte("dropped"), 0600)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		all, err := store.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 5 {
+			t.Errorf("Incorrect len = %v, want 5", len(all))
+		}
+
+		object := &objectsync.GenericObject{ID: "a", Value: "versioned", Version: objectsync.VersionVector{"local": 2}}
+		object.VersionHash = objectsync.NewHash(object.Value)
+		err = store.Set(ctx, object)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		got, err := store.Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if got.Version["local"] != 2 || string(got.VersionHash) != string(object.VersionHash) {
+			t.Errorf("Unexpected version = %v", got.Version)
+		}
+
+		err = store.Delete(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = store.Get(ctx, "a")
+		if !objectsync.IsNotFoundError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+		_, err = os.Stat(filepath.Join(dir, metadataDir, "a"))
+		if !os.IsNotExist(err) {
+			t.Errorf("Expected metadata to be removed")
+		}
+
+		if accepted := atomic.LoadInt32(&srv.accepted); accepted != 1 {
+			t.Errorf("Unexpected connections = %v, want 1", accepted)
+		}
+	})
+
+	t.Run("Checksums", func(t *testing.T) {
+		srv := newServer(t)
+		dir := t.TempDir()
+		store, err := Dial(srv.addr, srv.config, dir, WithChecksumFiles())
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		defer store.Close()
+
+		for i := 0; i < 3; i++ {
+			err = store.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("%v.csv", i), Value: fmt.Sprintf("value%v", i)})
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "0.csv.sha256"))
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		want := fmt.Sprintf("%x  0.csv\n", []byte(objectsync.NewHash("value0")))
+		if string(data) != want {
+			t.Errorf("Unexpected checksum = %q, want %q", data, want)
+		}
+
+		// A checksum is trusted while its file is not touched, so the file is
+		// not downloaded
+		info, err := os.Stat(filepath.Join(dir, "2.csv"))
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		sidecar := filepath.Join(dir, "2.csv.sha256")
+		err = os.WriteFile(sidecar, checksum("2.csv", objectsync.NewHash("trusted")), 0600)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		os.Chtimes(sidecar, info.ModTime(), info.ModTime())
+
+		// A file replaced by someone else has a stale checksum
+		err = os.WriteFile(filepath.Join(dir, "1.csv"), []byte("replaced"), 0600)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		os.Chtimes(filepath.Join(dir, "1.csv"), time.Now().Add(time.Hour), time.Now().Add(time.Hour))
+
+		all, err := store.List(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 3 {
+			t.Errorf("Incorrect len = %v, want 3", len(all))
+		}
+		for _, object := range all {
+			value := map[string]string{"0.csv": "value0", "1.csv": "replaced", "2.csv": "trusted"}[object.ID]
+			if string(object.Hash) != string(objectsync.NewHash(value)) || object.Value != "" {
+				t.Errorf("Unexpected object = %+v", object)
+			}
+		}
+
+		object, err := store.Get(ctx, "2.csv")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if string(object.Hash) != string(objectsync.NewHash("value2")) {
+			t.Errorf("Expected Get to hash the value")
+		}
+	})
+
+	t.Run("Reconnect", func(t *testing.T) {
+		srv := newServer(t)
+		store, err := Dial(srv.addr, srv.config, t.TempDir())
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		defer store.Close()
+
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "a"})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		store.conn.Close()
+		store.client.Wait()
+
+		_, err = store.Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if accepted := atomic.LoadInt32(&srv.accepted); accepted != 2 {
+			t.Errorf("Unexpected connections = %v, want 2", accepted)
+		}
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		srv := newServer(t)
+		store1, err := Dial(srv.addr, srv.config, t.TempDir(), WithChecksumFiles())
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		defer store1.Close()
+		store2 := objectsync.NewInMemoryStorage("remote")
+		status := objectsync.NewInMemoryStatusStorage()
+
+		for i := 0; i < 3; i++ {
+			store1.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("local%v", i), Value: "local", Modified: time.Now().UTC()})
+			store2.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("remote%v", i), Value: "remote", Modified: time.Now().UTC()})
+		}
+
+		opts := []objectsync.Option{objectsync.WithCausality("local", "remote")}
+		err = objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		store2.Set(ctx, &objectsync.GenericObject{ID: "local1", Value: "changed", Modified: time.Now().UTC()})
+		err = objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		object, err := store1.Get(ctx, "local1")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != "changed" {
+			t.Errorf("Unexpected value = %s", object.Value)
+		}
+		all, _ := store1.GetAll(ctx)
+		if len(all) != 6 {
+			t.Errorf("Incorrect len = %v, want 6", len(all))
+		}
+		if accepted := atomic.LoadInt32(&srv.accepted); accepted != 1 {
+			t.Errorf("Unexpected connections = %v, want 1", accepted)
+		}
+	})
+
+	t.Run("Signed", func(t *testing.T) {
+		srv := newServer(t)
+		dir := t.TempDir()
+		store, err := Dial(srv.addr, srv.config, dir)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		defer store.Close()
+		public, key, _ := ed25519.GenerateKey(nil)
+		modified := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+		signer := objectsync.NewSignedStorage(store, "local", key, nil)
+		err = signer.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "value", Modified: modified, Version: objectsync.VersionVector{"local": 1}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// The signature is kept, with the time it covers, so the object
+		// verifies when read again
+		verifier := func() *objectsync.SignedStorage {
+			reader, err := Dial(srv.addr, srv.config, dir)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			t.Cleanup(func() { reader.Close() })
+			return objectsync.NewSignedStorage(reader, "remote", nil, map[string]ed25519.PublicKey{"local": public})
+		}
+		got, err := verifier().Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if got.Signature == nil || got.Signature.Replica != "local" || !got.Modified.Equal(modified) {
+			t.Errorf("Unexpected object = %+v", got)
+		}
+		all, err := verifier().GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 1 {
+			t.Errorf("Incorrect len = %v, want 1", len(all))
+		}
+
+		// Written again without one, it no longer verifies
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "unsigned", Modified: modified, Version: objectsync.VersionVector{"local": 2}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = verifier().Get(ctx, "a")
+		if !objectsync.IsVerificationError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+}
@@ -0,0 +1,473 @@
+// Package sftpstorage implements objectsync storage on a remote directory
+// reached over SSH/SFTP.  Each object is a file in the directory, named by
+// its escaped ID.
+package sftpstorage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keithballdotnet/objectsync"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// metadataDir is the hidden directory keeping the versions of the objects,
+// out of the way of whoever picks up the files
+const metadataDir = ".objectsync"
+
+// checksumExtension is the extension of the sidecar checksum files
+const checksumExtension = ".sha256"
+
+// tmpPrefix is the prefix of files being uploaded
+const tmpPrefix = ".tmp-"
+
+// Option configures a SFTPStorage
+type Option func(*SFTPStorage)
+
+// WithChecksumFiles will write the sha256 of each object to a sidecar file
+// next to it, in the format of sha256sum.  Objects are then listed by reading
+// the checksums instead of downloading them, and receivers can verify a drop
+// with sha256sum -c.
+func WithChecksumFiles() Option {
+	return func(s *SFTPStorage) {
+		s.checksums = true
+	}
+}
+
+// SFTPStorage is an objectsync.Storage keeping objects as files in a remote
+// directory.
+//
+// Files are uploaded to a temporary name and renamed into place, so they are
+// never picked up half written.  Modified is the mtime of the file, and is
+// set on upload.  One connection is used for all operations, and a storage
+// from Dial dials again if it is lost.
+type SFTPStorage struct {
+	dir       string
+	name      string
+	checksums bool
+
+	mu     sync.Mutex
+	client *sftp.Client
+	// conn and dial are only set by Dial
+	conn *ssh.Client
+	dial func() (*ssh.Client, error)
+}
+
+// Dial will connect to the SSH server at addr, and return a SFTPStorage for
+// dir on it.  Close the storage to close the connection.
+func Dial(addr string, config *ssh.ClientConfig, dir string, opts ...Option) (*SFTPStorage, error) {
+	s := newSFTPStorage(dir, opts)
+	s.name = addr + ":" + dir
+	s.dial = func() (*ssh.Client, error) {
+		return ssh.Dial("tcp", addr, config)
+	}
+
+	client, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	err = client.MkdirAll(path.Join(s.dir, metadataDir))
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewSFTPStorage will return a SFTPStorage for dir using client, which is
+// left to the caller to close
+func NewSFTPStorage(client *sftp.Client, dir string, opts ...Option) (*SFTPStorage, error) {
+	s := newSFTPStorage(dir, opts)
+	s.client = client
+	err := client.MkdirAll(path.Join(s.dir, metadataDir))
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newSFTPStorage(dir string, opts []Option) *SFTPStorage {
+	s := &SFTPStorage{dir: dir, name: dir}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// GetName will return the directory, after the address if dialed
+func (s *SFTPStorage) GetName() string {
+	return s.name
+}
+
+// Close will close the connection opened by Dial
+func (s *SFTPStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	s.client.Close()
+	err := s.conn.Close()
+	s.client, s.conn = nil, nil
+	return err
+}
+
+// connect will return the client, dialing if there is no connection
+func (s *SFTPStorage) connect() (*sftp.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client != nil {
+		return s.client, nil
+	}
+	conn, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	s.client, s.conn = client, conn
+	return client, nil
+}
+
+// disconnect will drop client if it is still the connection in use
+func (s *SFTPStorage) disconnect(client *sftp.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client != client || s.conn == nil {
+		return
+	}
+	s.client.Close()
+	s.conn.Close()
+	s.client, s.conn = nil, nil
+}
+
+// do will run fn with the client, and run it once more on a new connection
+// if the connection was lost
+func (s *SFTPStorage) do(fn func(client *sftp.Client) error) error {
+	client, err := s.connect()
+	if err != nil {
+		return err
+	}
+	err = fn(client)
+	if s.dial == nil || !errors.Is(err, sftp.ErrSSHFxConnectionLost) {
+		return err
+	}
+
+	s.disconnect(client)
+	client, err = s.connect()
+	if err != nil {
+		return err
+	}
+	return fn(client)
+}
+
+// name will return the file name of the object with id.  Hidden names are
+// kept for temporary and metadata files, and the checksum extension for the
+// sidecar files, so those are escaped too.
+func name(id string) string {
+	name := url.PathEscape(id)
+	if strings.HasPrefix(name, ".") {
+		name = "%2E" + name[1:]
+	}
+	if strings.HasSuffix(name, checksumExtension) {
+		name = strings.TrimSuffix(name, checksumExtension) + "%2E" + checksumExtension[1:]
+	}
+	return name
+}
+
+// id will return the ID of the object in the file name.  Files dropped by
+// others that are not escaped are known by their name.
+func id(name string) string {
+	id, err := url.PathUnescape(name)
+	if err != nil {
+		return name
+	}
+	return id
+}
+
+// isObject will return if the file holds an object
+func isObject(info os.FileInfo) bool {
+	return info.Mode().IsRegular() && !strings.HasPrefix(info.Name(), ".") && !strings.HasSuffix(info.Name(), checksumExtension)
+}
+
+// metadata is kept for the objects with a version or signature.  A signature
+// covers the modified time to the nanosecond, which SFTP keeps to the second,
+// so it is kept here too.
+type metadata struct {
+	Version     objectsync.VersionVector
+	VersionHash objectsync.Hash
+	Signature   *objectsync.ObjectSignature `json:",omitempty"`
+	Modified    time.Time                   `json:",omitzero"`
+}
+
+func newMetadata(object *objectsync.GenericObject) *metadata {
+	m := &metadata{Version: object.Version, VersionHash: object.VersionHash, Signature: object.Signature}
+	if object.Signature != nil {
+		m.Modified = object.Modified
+	}
+	return m
+}
+
+// apply will set the metadata on the object read
+func (m *metadata) apply(object *objectsync.GenericObject) {
+	object.Version, object.VersionHash, object.Signature = m.Version, m.VersionHash, m.Signature
+	if m.Signature != nil && !m.Modified.IsZero() {
+		object.Modified = m.Modified
+	}
+}
+
+// Set will upload the object, replacing its file atomically
+func (s *SFTPStorage) Set(ctx context.Context, object *objectsync.GenericObject) error {
+	name := name(object.ID)
+	hash := objectsync.NewHash(object.Value)
+
+	err := s.do(func(client *sftp.Client) error {
+		meta := path.Join(s.dir, metadataDir)
+		if object.Version != nil || object.Signature != nil {
+			data, err := json.Marshal(newMetadata(object))
+			if err != nil {
+				return err
+			}
+			err = s.upload(client, meta, name, data, time.Time{})
+			if err != nil {
+				return err
+			}
+		} else {
+			err := client.Remove(path.Join(meta, name))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+
+		err := s.upload(client, s.dir, name, []byte(object.Value), object.Modified)
+		if err != nil || !s.checksums {
+			return err
+		}
+
+		// The checksum has the mtime of its file, so one left behind by a
+		// file replaced by someone else is not trusted
+		info, err := client.Stat(path.Join(s.dir, name))
+		if err != nil {
+			return err
+		}
+		return s.upload(client, s.dir, name+checksumExtension, checksum(name, hash), info.ModTime())
+	})
+	if err != nil {
+		return err
+	}
+	object.Hash = hash
+	return nil
+}
+
+// Get will download the object with id
+func (s *SFTPStorage) Get(ctx context.Context, id string) (*objectsync.GenericObject, error) {
+	var object *objectsync.GenericObject
+	err := s.do(func(client *sftp.Client) error {
+		info, err := client.Stat(path.Join(s.dir, name(id)))
+		if os.IsNotExist(err) {
+			return objectsync.ErrorNotFound
+		}
+		if err != nil {
+			return err
+		}
+		object, err = s.read(client, info, true)
+		return err
+	})
+	return object, err
+}
+
+// GetAll will download all objects
+func (s *SFTPStorage) GetAll(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	return s.list(true)
+}
+
+// List will return all objects without their values.  Only the objects
+// without a checksum file are downloaded to hash them.
+func (s *SFTPStorage) List(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	return s.list(false)
+}
+
+func (s *SFTPStorage) list(values bool) (objectsync.GenericObjectCollection, error) {
+	all := objectsync.GenericObjectCollection{}
+	err := s.do(func(client *sftp.Client) error {
+		files, err := client.ReadDir(s.dir)
+		if err != nil {
+			return err
+		}
+
+		all = all[:0]
+		for _, info := range files {
+			if !isObject(info) {
+				continue
+			}
+			object, err := s.read(client, info, values)
+			if err != nil {
+				if objectsync.IsNotFoundError(err) {
+					continue
+				}
+				return err
+			}
+			all = append(all, object)
+		}
+		return nil
+	})
+	return all, err
+}
+
+// Delete will remove the file of the object, and its checksum and metadata
+func (s *SFTPStorage) Delete(ctx context.Context, id string) error {
+	name := name(id)
+	return s.do(func(client *sftp.Client) error {
+		for _, file := range []string{
+			path.Join(s.dir, name),
+			path.Join(s.dir, name+checksumExtension),
+			path.Join(s.dir, metadataDir, name),
+		} {
+			err := client.Remove(file)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// read will return the object in the file.  Without values the hash is
+// taken from the checksum file, if there is one for this mtime.
+func (s *SFTPStorage) read(client *sftp.Client, info os.FileInfo, values bool) (*objectsync.GenericObject, error) {
+	object := &objectsync.GenericObject{
+		ID:       id(info.Name()),
+		Modified: info.ModTime().UTC(),
+	}
+
+	if !values && s.checksums {
+		object.Hash = s.readChecksum(client, info)
+	}
+	if object.Hash == nil {
+		value, err := readFile(client, path.Join(s.dir, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+		object.Hash = objectsync.NewHash(string(value))
+		if values {
+			object.Value = string(value)
+		}
+	}
+
+	data, err := readFile(client, path.Join(s.dir, metadataDir, info.Name()))
+	if err != nil {
+		if objectsync.IsNotFoundError(err) {
+			return object, nil
+		}
+		return nil, err
+	}
+	m := &metadata{}
+	err = json.Unmarshal(data, m)
+	if err != nil {
+		return nil, err
+	}
+	m.apply(object)
+	return object, nil
+}
+
+// readChecksum will return the hash in the checksum file of the file, nil if
+// there is none or it is stale
+func (s *SFTPStorage) readChecksum(client *sftp.Client, info os.FileInfo) objectsync.Hash {
+	file := path.Join(s.dir, info.Name()+checksumExtension)
+	sidecar, err := client.Stat(file)
+	if err != nil || !sidecar.ModTime().Equal(info.ModTime()) {
+		return nil
+	}
+	data, err := readFile(client, file)
+	if err != nil {
+		return nil
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return nil
+	}
+	hash, err := hex.DecodeString(fields[0])
+	if err != nil || len(hash) != 32 {
+		return nil
+	}
+	return hash
+}
+
+// checksum will return the line sha256sum writes for the file
+func checksum(name string, hash objectsync.Hash) []byte {
+	return []byte(hex.EncodeToString(hash) + "  " + name + "\n")
+}
+
+// upload will write data to name in dir through a temporary file, and set
+// its mtime to modified unless it is zero
+func (s *SFTPStorage) upload(client *sftp.Client, dir, name string, data []byte, modified time.Time) error {
+	random := make([]byte, 8)
+	_, err := rand.Read(random)
+	if err != nil {
+		return err
+	}
+	tmp := path.Join(dir, tmpPrefix+hex.EncodeToString(random))
+
+	f, err := client.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && !modified.IsZero() {
+		err = client.Chtimes(tmp, modified, modified)
+	}
+	if err == nil {
+		err = rename(client, tmp, path.Join(dir, name))
+	}
+	if err != nil {
+		client.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// rename will move from over to.  Servers without the posix-rename extension
+// refuse to rename over a file, so it is removed first.
+func rename(client *sftp.Client, from, to string) error {
+	if _, ok := client.HasExtension("posix-rename@openssh.com"); ok {
+		return client.PosixRename(from, to)
+	}
+	err := client.Remove(to)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return client.Rename(from, to)
+}
+
+// readFile will return the content of the file
+func readFile(client *sftp.Client, file string) ([]byte, error) {
+	f, err := client.Open(file)
+	if os.IsNotExist(err) {
+		return nil, objectsync.ErrorNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
@@ -0,0 +1,300 @@
+package objectsync
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Reasons an object fails verification
+const (
+	ReasonUnsigned      = "unsigned"
+	ReasonUnknownSigner = "unknown signer"
+	ReasonBadSignature  = "bad signature"
+	ReasonHashMismatch  = "hash mismatch"
+)
+
+// ObjectSignature is the Ed25519 signature of an object by the replica it
+// came from.  It covers the ID, the hash of the value, the modified time and
+// the version of the object.
+type ObjectSignature struct {
+	Replica string
+	// Hash is the hash of the value signed
+	Hash      Hash
+	Signature []byte
+}
+
+// VerificationError is returned by a SignedStorage for an object that is
+// not signed by a trusted replica, or whose value does not match its
+// signature or hash.  Sync returns it as it is, and as a SignedStorage
+// verifies every object when listed, before any change is made.
+type VerificationError struct {
+	ID      string
+	Replica string
+	Reason  string
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("verification of [%s] signed by [%s] failed: %s", e.ID, e.Replica, e.Reason)
+}
+
+// IsVerificationError will return true if err is a VerificationError
+func IsVerificationError(err error) bool {
+	_, ok := err.(*VerificationError)
+	return ok
+}
+
+// Quarantiner is implemented by a Storage that leaves the objects failing
+// verification out of its listing.  Sync leaves those objects alone on both
+// sides, rather than take them as deleted.
+type Quarantiner interface {
+	// Quarantined will return the IDs of the objects left out of the last listing
+	Quarantined(ctx context.Context) ([]string, error)
+}
+
+// quarantinedObjects will return the IDs quarantined by either storage
+func quarantinedObjects(ctx context.Context, stores ...Storage) (map[string]bool, error) {
+	held := map[string]bool{}
+	for _, store := range stores {
+		quarantiner, ok := store.(Quarantiner)
+		if !ok {
+			continue
+		}
+		ids, err := quarantiner.Quarantined(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			held[id] = true
+		}
+	}
+	return held, nil
+}
+
+// SignedOption configures a SignedStorage
+type SignedOption func(*SignedStorage)
+
+// WithQuarantine will make a SignedStorage keep the objects that fail
+// verification, as they were stored, in quarantine.  They are left out of
+// GetAll, rather than failing it, so the objects that verify can still be
+// synced.  failed is called with the error of each, if not nil.
+func WithQuarantine(quarantine Storage, failed func(err *VerificationError)) SignedOption {
+	return func(s *SignedStorage) {
+		s.quarantine = quarantine
+		s.failed = failed
+	}
+}
+
+// SignedStorage is a Storage that signs the objects it keeps in another
+// storage, and verifies them when they are read.
+//
+// The signature of an object is kept in its Signature, so the other storage
+// must keep it along with the modified time and version as they were set.
+// An object set with the Signature it was read with from another
+// SignedStorage keeps it, once verified, so objects stay signed by the
+// replica they came from however far they are synced.  If only the modified
+// time or version has changed since, such as by Sync with causality enabled,
+// the object is signed again by the replica of the storage.  Objects are read
+// only if signed by a trusted replica, and their value matches.
+type SignedStorage struct {
+	store      Storage
+	replica    string
+	key        ed25519.PrivateKey
+	trusted    map[string]ed25519.PublicKey
+	quarantine Storage
+	failed     func(err *VerificationError)
+
+	// quarantined are the IDs left out of the last GetAll
+	quarantined []string
+}
+
+// NewSignedStorage will return a SignedStorage keeping its objects in store,
+// signing them as replica with key, and trusting the signatures of the
+// replicas in trusted as well as its own.  With a nil key the storage only
+// verifies, and can only set objects signed elsewhere.
+func NewSignedStorage(store Storage, replica string, key ed25519.PrivateKey, trusted map[string]ed25519.PublicKey, opts ...SignedOption) *SignedStorage {
+	s := &SignedStorage{
+		store:   store,
+		replica: replica,
+		key:     key,
+		trusted: make(map[string]ed25519.PublicKey),
+	}
+	for name, public := range trusted {
+		s.trusted[name] = public
+	}
+	if key != nil {
+		s.trusted[replica] = key.Public().(ed25519.PublicKey)
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// GetName ...
+func (s *SignedStorage) GetName() string {
+	return s.store.GetName()
+}
+
+// Set will sign the object, or verify the signature it carries, and set it
+// in the storage
+func (s *SignedStorage) Set(ctx context.Context, object *GenericObject) error {
+	signature := object.Signature
+	if signature != nil {
+		if err := s.verify(object, signature); err != nil {
+			// Only a signature of this very value is replaced, as the
+			// modified time or version changed since it was signed
+			if s.key == nil || err.Reason != ReasonBadSignature {
+				return err
+			}
+			signature = nil
+		}
+	}
+	if signature == nil {
+		if s.key == nil {
+			return errors.New("can not sign without a key")
+		}
+		hash := NewHash(object.Value)
+		signature = &ObjectSignature{
+			Replica:   s.replica,
+			Hash:      hash,
+			Signature: ed25519.Sign(s.key, signedMessage(object, hash)),
+		}
+	}
+
+	stored := *object
+	stored.Signature = signature
+	err := s.store.Set(ctx, &stored)
+	if err != nil {
+		return err
+	}
+
+	object.Hash = stored.Hash
+	object.Signature = signature
+	return nil
+}
+
+// Get will return the object once verified
+func (s *SignedStorage) Get(ctx context.Context, id string) (*GenericObject, error) {
+	object, err := s.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.check(ctx, object)
+	if err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+// GetAll will return all objects once verified.  With a quarantine the
+// objects that fail are left out, otherwise the first failure is returned.
+func (s *SignedStorage) GetAll(ctx context.Context) (GenericObjectCollection, error) {
+	all, err := s.store.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.quarantined = nil
+	objects := make(GenericObjectCollection, 0, len(all))
+	for _, object := range all {
+		err = s.check(ctx, object)
+		if IsVerificationError(err) && s.quarantine != nil {
+			s.quarantined = append(s.quarantined, object.ID)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+// Quarantined ...
+func (s *SignedStorage) Quarantined(ctx context.Context) ([]string, error) {
+	return s.quarantined, nil
+}
+
+// Delete will remove a entry from the storage
+func (s *SignedStorage) Delete(ctx context.Context, id string) error {
+	return s.store.Delete(ctx, id)
+}
+
+// check will verify the object, quarantining it if it fails
+func (s *SignedStorage) check(ctx context.Context, object *GenericObject) error {
+	if object.Signature == nil {
+		return s.fail(ctx, object, &VerificationError{ID: object.ID, Reason: ReasonUnsigned})
+	}
+
+	if err := s.verify(object, object.Signature); err != nil {
+		return s.fail(ctx, object, err)
+	}
+	return nil
+}
+
+// fail will quarantine the object failing verification with err, and return
+// err
+func (s *SignedStorage) fail(ctx context.Context, object *GenericObject, err *VerificationError) error {
+	if s.quarantine == nil {
+		return err
+	}
+
+	quarantined := *object
+	setErr := s.quarantine.Set(ctx, &quarantined)
+	if setErr != nil {
+		return setErr
+	}
+	fmt.Printf("Quarantined: %v Reason: %s\n", object.ID, err.Reason)
+	if s.failed != nil {
+		s.failed(err)
+	}
+	return err
+}
+
+// verify will check the signature of the object
+func (s *SignedStorage) verify(object *GenericObject, signature *ObjectSignature) *VerificationError {
+	if !bytes.Equal(signature.Hash, NewHash(object.Value)) {
+		return &VerificationError{ID: object.ID, Replica: signature.Replica, Reason: ReasonHashMismatch}
+	}
+	public, ok := s.trusted[signature.Replica]
+	if !ok {
+		return &VerificationError{ID: object.ID, Replica: signature.Replica, Reason: ReasonUnknownSigner}
+	}
+	if !ed25519.Verify(public, signedMessage(object, signature.Hash), signature.Signature) {
+		return &VerificationError{ID: object.ID, Replica: signature.Replica, Reason: ReasonBadSignature}
+	}
+	return nil
+}
+
+// signedMessage is what is signed for the object with the hash of its value,
+// so a signature can not be moved to another object or version
+func signedMessage(object *GenericObject, hash Hash) []byte {
+	message := []byte("objectsync signature\x00")
+	message = append(message, object.ID...)
+	message = append(message, 0)
+	message = append(message, hash...)
+
+	var modified int64
+	if !object.Modified.IsZero() {
+		modified = object.Modified.UnixNano()
+	}
+	message = binary.BigEndian.AppendUint64(message, uint64(modified))
+
+	replicas := make([]string, 0, len(object.Version))
+	for replica := range object.Version {
+		replicas = append(replicas, replica)
+	}
+	sort.Strings(replicas)
+	for _, replica := range replicas {
+		message = append(message, replica...)
+		message = append(message, 0)
+		message = binary.BigEndian.AppendUint64(message, object.Version[replica])
+	}
+	return message
+}
@@ -0,0 +1,233 @@
+package objectsync
+
+import (
+	"context"
+	"crypto/ed25519"
+	"testing"
+	"time"
+)
+
+// Check the interfaces
+var _ Storage = &SignedStorage{}
+var _ error = &VerificationError{}
+
+func TestSigned(t *testing.T) {
+
+	ctx := context.TODO()
+	publicA, keyA, _ := ed25519.GenerateKey(nil)
+	publicB, keyB, _ := ed25519.GenerateKey(nil)
+	_, keyC, _ := ed25519.GenerateKey(nil)
+
+	t.Run("SetGet", func(t *testing.T) {
+		inner := NewInMemoryStorage("local")
+		store := NewSignedStorage(inner, "a", keyA, nil)
+
+		object := &GenericObject{ID: "a", Value: "value", Modified: time.Now().UTC()}
+		err := store.Set(ctx, object)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Signature == nil || object.Signature.Replica != "a" || string(object.Hash) != string(NewHash("value")) {
+			t.Fatalf("Unexpected object = %+v", object)
+		}
+
+		got, err := store.Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if got.Value != "value" || string(got.Hash) != string(object.Hash) || got.Signature.Replica != "a" {
+			t.Errorf("Unexpected object = %+v", got)
+		}
+
+		// Verified elsewhere with the public key only
+		verifier := NewSignedStorage(inner, "b", nil, map[string]ed25519.PublicKey{"a": publicA})
+		all, err := verifier.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 1 || all[0].Value != "value" {
+			t.Errorf("Unexpected objects = %+v", all)
+		}
+		err = verifier.Set(ctx, &GenericObject{ID: "b", Value: "unsigned"})
+		if err == nil {
+			t.Errorf("Expected an error signing without a key")
+		}
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			tamper func(inner *InMemoryStorage)
+			reason string
+		}{
+			{"Unsigned", func(inner *InMemoryStorage) {
+				inner.Set(ctx, &GenericObject{ID: "a", Value: "value"})
+			}, ReasonUnsigned},
+			{"Value", func(inner *InMemoryStorage) {
+				object, _ := inner.Get(ctx, "a")
+				tampered := *object
+				tampered.Value += "!"
+				inner.Set(ctx, &tampered)
+			}, ReasonHashMismatch},
+			{"Version", func(inner *InMemoryStorage) {
+				object, _ := inner.Get(ctx, "a")
+				tampered := *object
+				tampered.Version = VersionVector{"a": 5}
+				inner.Set(ctx, &tampered)
+			}, ReasonBadSignature},
+			{"Moved", func(inner *InMemoryStorage) {
+				object, _ := inner.Get(ctx, "b")
+				moved := *object
+				moved.ID = "a"
+				inner.Set(ctx, &moved)
+			}, ReasonBadSignature},
+			{"Unknown", func(inner *InMemoryStorage) {
+				NewSignedStorage(inner, "c", keyC, nil).Set(ctx, &GenericObject{ID: "a", Value: "forged"})
+			}, ReasonUnknownSigner},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				inner := NewInMemoryStorage("remote")
+				quarantine := NewInMemoryStorage("quarantine")
+				var failures []*VerificationError
+				store := NewSignedStorage(inner, "a", keyA, nil, WithQuarantine(quarantine, func(err *VerificationError) {
+					failures = append(failures, err)
+				}))
+				store.Set(ctx, &GenericObject{ID: "a", Value: "value a", Modified: time.Now().UTC()})
+				store.Set(ctx, &GenericObject{ID: "b", Value: "value b", Modified: time.Now().UTC()})
+				test.tamper(inner)
+
+				_, err := store.Get(ctx, "a")
+				verr, ok := err.(*VerificationError)
+				if !ok || verr.ID != "a" || verr.Reason != test.reason {
+					t.Fatalf("Unexpected error = %v", err)
+				}
+
+				// The objects that verify are still listed
+				all, err := store.GetAll(ctx)
+				if err != nil {
+					t.Fatalf("Error: %v", err)
+				}
+				if len(all) != 1 || all[0].ID != "b" {
+					t.Errorf("Unexpected objects = %+v", all)
+				}
+				ids, _ := store.Quarantined(ctx)
+				if len(ids) != 1 || ids[0] != "a" {
+					t.Errorf("Unexpected quarantined = %v", ids)
+				}
+				if len(failures) != 2 || failures[1].Reason != test.reason {
+					t.Errorf("Unexpected failures = %+v", failures)
+				}
+				_, err = quarantine.Get(ctx, "a")
+				if err != nil {
+					t.Errorf("Error: %v", err)
+				}
+			})
+		}
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		trusted := map[string]ed25519.PublicKey{"a": publicA, "b": publicB}
+		innerA := NewInMemoryStorage("local")
+		innerB := NewInMemoryStorage("remote")
+		storeA := NewSignedStorage(innerA, "a", keyA, trusted)
+		storeB := NewSignedStorage(innerB, "b", keyB, trusted)
+		status := NewInMemoryStatusStorage()
+
+		storeA.Set(ctx, &GenericObject{ID: "a", Value: "from a", Modified: time.Now().UTC()})
+		storeB.Set(ctx, &GenericObject{ID: "b", Value: "from b", Modified: time.Now().UTC()})
+		err := Sync(ctx, storeA, storeB, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// Objects stay signed by their origin
+		for _, store := range []*SignedStorage{storeA, storeB} {
+			for id, replica := range map[string]string{"a": "a", "b": "b"} {
+				object, err := store.Get(ctx, id)
+				if err != nil {
+					t.Fatalf("Error: %v", err)
+				}
+				if object.Signature.Replica != replica {
+					t.Errorf("Unexpected signer of [%s] = %s", id, object.Signature.Replica)
+				}
+			}
+		}
+
+		// An object altered at rest stops Sync before it changes anything
+		object, _ := innerB.Get(ctx, "a")
+		tampered := *object
+		tampered.Value += "!"
+		innerB.Set(ctx, &tampered)
+		storeB.Set(ctx, &GenericObject{ID: "c", Value: "from b", Modified: time.Now().UTC()})
+		err = Sync(ctx, storeA, storeB, status)
+		if !IsVerificationError(err) {
+			t.Fatalf("Unexpected error = %v", err)
+		}
+		_, err = innerA.Get(ctx, "c")
+		if err == nil || !IsNotFoundError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+
+		// Quarantined, it is left alone while the rest is synced
+		quarantined := NewSignedStorage(innerB, "b", keyB, trusted, WithQuarantine(NewInMemoryStorage("quarantine"), nil))
+		err = Sync(ctx, storeA, quarantined, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = innerA.Get(ctx, "c")
+		if err != nil {
+			t.Errorf("Error: %v", err)
+		}
+		object, err = storeA.Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != "from a" {
+			t.Errorf("Unexpected value = %s", object.Value)
+		}
+		_, err = status.Get(ctx, "a")
+		if err != nil {
+			t.Errorf("Error: %v", err)
+		}
+
+		// An object altered in transit is refused
+		signed, err := storeB.Get(ctx, "b")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		forged := &GenericObject{ID: "b", Value: "forged", Modified: signed.Modified, Signature: signed.Signature}
+		err = storeA.Set(ctx, forged)
+		if !IsVerificationError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+
+	t.Run("Causality", func(t *testing.T) {
+		trusted := map[string]ed25519.PublicKey{"a": publicA, "b": publicB}
+		storeA := NewSignedStorage(NewInMemoryStorage("local"), "a", keyA, trusted)
+		storeB := NewSignedStorage(NewInMemoryStorage("remote"), "b", keyB, trusted)
+		status := NewInMemoryStatusStorage()
+		opts := []Option{WithCausality("local", "remote")}
+
+		storeA.Set(ctx, &GenericObject{ID: "a", Value: "from a", Modified: time.Now().UTC()})
+		for i := 0; i < 2; i++ {
+			err := Sync(ctx, storeA, storeB, status, opts...)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+		}
+
+		// The versions Sync gives the object are signed too
+		for _, store := range []*SignedStorage{storeA, storeB} {
+			object, err := store.Get(ctx, "a")
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if object.Value != "from a" || object.Version["local"] != 1 {
+				t.Errorf("Unexpected object = %+v", object)
+			}
+		}
+	})
+}
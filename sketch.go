@@ -0,0 +1,243 @@
+package objectsync
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// sketchHashes is the number of cells each entry is added to
+const sketchHashes = 3
+
+// errSketchUndecodable is returned when the difference of two sketches is
+// too large to decode
+var errSketchUndecodable = errors.New("sketch undecodable")
+
+// Sketcher is implemented by a Storage that can summarize the IDs and
+// hashes of its objects in an IBLT.  With WithSketches, Sync subtracts it
+// from one of the status, and only reads the objects in the difference.
+type Sketcher interface {
+	Sketch(ctx context.Context, cells int) (*IBLT, error)
+}
+
+// IBLT is an invertible Bloom lookup table of IDs and hashes.  Subtracting
+// the IBLT of one set from the one of another leaves their difference, which
+// can be decoded as long as it is small compared to the cells.
+type IBLT struct {
+	Cells []IBLTCell
+}
+
+// IBLTCell is a cell of an IBLT
+type IBLTCell struct {
+	// Count is the number of entries added, less those removed
+	Count int64
+	// KeySum is the XOR of the encoded entries
+	KeySum []byte
+	// CheckSum is the XOR of the checksums of the encoded entries
+	CheckSum uint64
+}
+
+// NewIBLT will return an empty IBLT with cells cells
+func NewIBLT(cells int) *IBLT {
+	if cells < sketchHashes {
+		cells = sketchHashes
+	}
+	return &IBLT{Cells: make([]IBLTCell, cells)}
+}
+
+// Insert will add the object with id and hash
+func (t *IBLT) Insert(id string, hash Hash) {
+	t.add(encodeSketchKey(id, hash), 1)
+}
+
+// Subtract will return the IBLT of the entries of t less those of other
+func (t *IBLT) Subtract(other *IBLT) (*IBLT, error) {
+	if len(t.Cells) != len(other.Cells) {
+		return nil, fmt.Errorf("can not subtract IBLT of %v cells from one of %v", len(other.Cells), len(t.Cells))
+	}
+
+	diff := &IBLT{Cells: make([]IBLTCell, len(t.Cells))}
+	for i := range t.Cells {
+		diff.Cells[i] = IBLTCell{
+			Count:    t.Cells[i].Count - other.Cells[i].Count,
+			KeySum:   xorBytes(t.Cells[i].KeySum, other.Cells[i].KeySum),
+			CheckSum: t.Cells[i].CheckSum ^ other.Cells[i].CheckSum,
+		}
+	}
+	return diff, nil
+}
+
+// Decode will return the entries with a positive count, and those with a
+// negative one, as hashes by ID.  It fails with errSketchUndecodable if the
+// entries can not all be recovered.
+func (t *IBLT) Decode() (added, removed map[string]Hash, err error) {
+	cells := &IBLT{Cells: make([]IBLTCell, len(t.Cells))}
+	copy(cells.Cells, t.Cells)
+	added, removed = make(map[string]Hash), make(map[string]Hash)
+
+	for progress := true; progress; {
+		progress = false
+		for i := range cells.Cells {
+			cell := cells.Cells[i]
+			if cell.Count != 1 && cell.Count != -1 {
+				continue
+			}
+			key := bytes.TrimRight(cell.KeySum, "\x00")
+			if sketchCheckSum(key) != cell.CheckSum {
+				continue
+			}
+			id, hash, ok := decodeSketchKey(key)
+			if !ok {
+				continue
+			}
+
+			if cell.Count == 1 {
+				added[id] = hash
+			} else {
+				removed[id] = hash
+			}
+			cells.add(key, -cell.Count)
+			progress = true
+		}
+	}
+
+	for _, cell := range cells.Cells {
+		if cell.Count != 0 || cell.CheckSum != 0 || len(bytes.TrimRight(cell.KeySum, "\x00")) != 0 {
+			return nil, nil, errSketchUndecodable
+		}
+	}
+	return added, removed, nil
+}
+
+// add will add the encoded entry count times to its cells
+func (t *IBLT) add(key []byte, count int64) {
+	check := sketchCheckSum(key)
+	for _, i := range t.indexes(key) {
+		cell := &t.Cells[i]
+		cell.Count += count
+		cell.KeySum = xorBytes(cell.KeySum, key)
+		cell.CheckSum ^= check
+	}
+}
+
+// indexes will return the cells of the encoded entry, one in each of the
+// sketchHashes parts of the table, so they are distinct
+func (t *IBLT) indexes(key []byte) []int {
+	digest := sha256.Sum256(key)
+	part := len(t.Cells) / sketchHashes
+	indexes := make([]int, sketchHashes)
+	for i := range indexes {
+		n := binary.BigEndian.Uint64(digest[i*8:])
+		indexes[i] = i*part + int(n%uint64(part))
+	}
+	return indexes
+}
+
+// encodeSketchKey will encode an entry so that it ends in a non-zero byte,
+// as KeySum is padded with zeros
+func encodeSketchKey(id string, hash Hash) []byte {
+	key := make([]byte, 0, 2*binary.MaxVarintLen64+len(id)+len(hash)+1)
+	key = binary.AppendUvarint(key, uint64(len(id)))
+	key = append(key, id...)
+	key = binary.AppendUvarint(key, uint64(len(hash)))
+	key = append(key, hash...)
+	return append(key, 1)
+}
+
+func decodeSketchKey(key []byte) (string, Hash, bool) {
+	if len(key) == 0 || key[len(key)-1] != 1 {
+		return "", nil, false
+	}
+	key = key[:len(key)-1]
+
+	size, n := binary.Uvarint(key)
+	if n <= 0 || uint64(len(key)-n) < size {
+		return "", nil, false
+	}
+	id := string(key[n : n+int(size)])
+	key = key[n+int(size):]
+
+	size, n = binary.Uvarint(key)
+	if n <= 0 || uint64(len(key)-n) != size {
+		return "", nil, false
+	}
+	return id, Hash(key[n:]), true
+}
+
+func sketchCheckSum(key []byte) uint64 {
+	digest := sha256.Sum256(append([]byte("check"), key...))
+	return binary.BigEndian.Uint64(digest[:])
+}
+
+// xorBytes will return the XOR of a and b, the shorter padded with zeros
+func xorBytes(a, b []byte) []byte {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	sum := make([]byte, len(a))
+	copy(sum, a)
+	for i := range b {
+		sum[i] ^= b[i]
+	}
+	return sum
+}
+
+// sketchObjects will find the IDs whose object changed in either storage
+// since the last sync, by decoding the difference of their sketches and ones
+// of the status, and read those objects.  It fails with errSketchUndecodable
+// if there are too many changes for the cells.
+func sketchObjects(ctx context.Context, local, remote Storage, stati []*SyncStatus, cells int) (localSet, remoteSet GenericObjectCollection, ids map[string]bool, err error) {
+	localExpected, remoteExpected := NewIBLT(cells), NewIBLT(cells)
+	for _, syncStatus := range stati {
+		localExpected.Insert(syncStatus.ID, syncStatus.LocalHash)
+		remoteExpected.Insert(syncStatus.ID, syncStatus.RemoteHash)
+	}
+
+	ids = make(map[string]bool)
+	err = diffSketch(ctx, local.(Sketcher), localExpected, ids)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	err = diffSketch(ctx, remote.(Sketcher), remoteExpected, ids)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	localSet, err = getObjects(ctx, local, ids)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	remoteSet, err = getObjects(ctx, remote, ids)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return localSet, remoteSet, ids, nil
+}
+
+// diffSketch will add the IDs whose hash in store differs from the one in
+// expected to ids
+func diffSketch(ctx context.Context, store Sketcher, expected *IBLT, ids map[string]bool) error {
+	sketch, err := store.Sketch(ctx, len(expected.Cells))
+	if err != nil {
+		return err
+	}
+	diff, err := sketch.Subtract(expected)
+	if err != nil {
+		return err
+	}
+	added, removed, err := diff.Decode()
+	if err != nil {
+		return err
+	}
+
+	for id := range added {
+		ids[id] = true
+	}
+	for id := range removed {
+		ids[id] = true
+	}
+	return nil
+}
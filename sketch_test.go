@@ -0,0 +1,116 @@
+package objectsync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Check the interfaces
+var _ Sketcher = &countingStorage{}
+
+func (s *countingStorage) Sketch(ctx context.Context, cells int) (*IBLT, error) {
+	sketch := NewIBLT(cells)
+	for id, object := range s.idIndex {
+		sketch.Insert(id, object.Hash)
+	}
+	return sketch, nil
+}
+
+func TestSketch(t *testing.T) {
+
+	ctx := context.TODO()
+
+	t.Run("Decode", func(t *testing.T) {
+		sketch1, sketch2 := NewIBLT(60), NewIBLT(60)
+		for i := 0; i < 1000; i++ {
+			id := fmt.Sprintf("object%v", i)
+			sketch1.Insert(id, NewHash(id))
+			if i%100 != 0 {
+				sketch2.Insert(id, NewHash(id))
+			}
+		}
+		sketch1.Insert("changed", NewHash("new"))
+		sketch2.Insert("changed", NewHash("old"))
+		sketch2.Insert("removed", nil)
+
+		diff, err := sketch1.Subtract(sketch2)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		added, removed, err := diff.Decode()
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(added) != 11 || len(removed) != 2 {
+			t.Fatalf("Incorrect len = %v and %v, want 11 and 2", len(added), len(removed))
+		}
+		if !bytes.Equal(added["object500"], NewHash("object500")) || !bytes.Equal(added["changed"], NewHash("new")) || !bytes.Equal(removed["changed"], NewHash("old")) {
+			t.Errorf("Unexpected difference = %v and %v", added, removed)
+		}
+		if hash, ok := removed["removed"]; !ok || len(hash) != 0 {
+			t.Errorf("Unexpected difference = %v", removed)
+		}
+
+		// Far more entries than cells
+		diff, err = NewIBLT(60).Subtract(sketch2)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, _, err = diff.Decode()
+		if err != errSketchUndecodable {
+			t.Errorf("Unexpected error = %v", err)
+		}
+		_, err = NewIBLT(30).Subtract(sketch2)
+		if err == nil {
+			t.Errorf("Expected error")
+		}
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		store1 := &countingStorage{InMemoryStorage: NewInMemoryStorage("local")}
+		store2 := &countingStorage{InMemoryStorage: NewInMemoryStorage("remote")}
+		status := NewInMemoryStatusStorage()
+		opts := []Option{WithSketches(60)}
+		for i := 0; i < 1000; i++ {
+			store1.Set(ctx, &GenericObject{ID: fmt.Sprintf("object%v", i), Value: fmt.Sprintf("value%v", i), Modified: time.Now().UTC()})
+		}
+
+		// Everything is new, so the trees are walked instead
+		err := Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if store1.nodes == 0 {
+			t.Errorf("Expected nodes read")
+		}
+
+		store1.Set(ctx, &GenericObject{ID: "object1", Value: "changed", Modified: time.Now().UTC()})
+		store2.Delete(ctx, "object2")
+		store2.Set(ctx, &GenericObject{ID: "new", Value: "new", Modified: time.Now().UTC()})
+		store1.nodes, store2.nodes, store1.gets, store2.gets = 0, 0, 0, 0
+		err = Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if store1.nodes != 0 || store2.nodes != 0 || store1.gets > 4 || store2.gets > 4 {
+			t.Errorf("Unexpected reads = %v, %v nodes and %v, %v gets", store1.nodes, store2.nodes, store1.gets, store2.gets)
+		}
+
+		for _, store := range []*countingStorage{store1, store2} {
+			all, _ := store.GetAll(ctx)
+			if len(all) != 1000 {
+				t.Errorf("Incorrect len = %v, want 1000", len(all))
+			}
+			object, err := store.Get(ctx, "object1")
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if object.Value != "changed" {
+				t.Errorf("Unexpected value = %s", object.Value)
+			}
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package sqlstorage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dialect holds the differences between the SQL databases supported
+type Dialect struct {
+	name      string
+	blobType  string
+	bindParam func(n int) string
+}
+
+// Supported dialects
+var (
+	SQLite = Dialect{
+		name:      "sqlite",
+		blobType:  "BLOB",
+		bindParam: func(n int) string { return "?" },
+	}
+	PostgreSQL = Dialect{
+		name:      "postgres",
+		blobType:  "BYTEA",
+		bindParam: func(n int) string { return fmt.Sprintf("$%d", n) },
+	}
+)
+
+// String will return the name of the dialect
+func (d Dialect) String() string {
+	return d.name
+}
+
+// rebind will replace the ? placeholders in query with those of the dialect.
+// A ? in a quoted string or identifier is left as it is.
+func (d Dialect) rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	var quote rune
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			// A doubled quote ends the string, and starts it again
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '?':
+			n++
+			b.WriteString(d.bindParam(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// expand will fill in the table name and column types of a statement
+func (d Dialect) expand(statement, table string) string {
+	return strings.NewReplacer("{table}", table, "{blob}", d.blobType).Replace(statement)
+}
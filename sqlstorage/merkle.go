@@ -0,0 +1,63 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/keithballdotnet/objectsync"
+)
+
+// merkleNodes are the nodes of the Merkle tree of a SQLStorage, read and
+// written through db
+type merkleNodes struct {
+	s  *SQLStorage
+	db execer
+}
+
+// GetMerkleHash ...
+func (n *merkleNodes) GetMerkleHash(ctx context.Context, prefix string) (objectsync.Hash, int, error) {
+	var hash []byte
+	count := 0
+	err := n.db.QueryRowContext(ctx, n.s.query(`SELECT hash, object_count FROM {table}_merkle WHERE prefix = ?`), prefix).Scan(&hash, &count)
+	if err == sql.ErrNoRows {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return objectsync.Hash(hash), count, nil
+}
+
+// SetMerkleHash ...
+func (n *merkleNodes) SetMerkleHash(ctx context.Context, prefix string, hash objectsync.Hash, count int) error {
+	if count == 0 {
+		_, err := n.db.ExecContext(ctx, n.s.query(`DELETE FROM {table}_merkle WHERE prefix = ?`), prefix)
+		return err
+	}
+	_, err := n.db.ExecContext(ctx, n.s.query(`INSERT INTO {table}_merkle (prefix, hash, object_count) VALUES (?, ?, ?)
+		ON CONFLICT (prefix) DO UPDATE SET hash = excluded.hash, object_count = excluded.object_count`),
+		prefix, []byte(hash), count)
+	return err
+}
+
+// MerkleObjects will read the objects of the buckets starting with prefix.
+// Buckets are hex, so they all sort before prefix followed by a g.
+func (n *merkleNodes) MerkleObjects(ctx context.Context, prefix string) (map[string]objectsync.Hash, error) {
+	rows, err := n.db.QueryContext(ctx, n.s.query(`SELECT id, hash FROM {table} WHERE bucket >= ? AND bucket < ?`), prefix, prefix+"g")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	objects := map[string]objectsync.Hash{}
+	for rows.Next() {
+		var id string
+		var hash []byte
+		err = rows.Scan(&id, &hash)
+		if err != nil {
+			return nil, err
+		}
+		objects[id] = objectsync.Hash(hash)
+	}
+	return objects, rows.Err()
+}
@@ -0,0 +1,98 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+)
+
+var validTable = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// migration is a list of statements that move a table schema on one version
+type migration []string
+
+var objectMigrations = []migration{
+	{
+		`CREATE TABLE {table} (
+			id TEXT PRIMARY KEY,
+			hash {blob} NOT NULL,
+			modified BIGINT,
+			value {blob} NOT NULL,
+			version TEXT,
+			version_hash {blob},
+			signature TEXT,
+			bucket TEXT NOT NULL
+		)`,
+		`CREATE INDEX {table}_hash ON {table} (hash)`,
+		`CREATE INDEX {table}_modified ON {table} (modified)`,
+		`CREATE INDEX {table}_bucket ON {table} (bucket)`,
+		`CREATE TABLE {table}_merkle (
+			prefix TEXT PRIMARY KEY,
+			hash {blob} NOT NULL,
+			object_count BIGINT NOT NULL
+		)`,
+	},
+}
+
+var statusMigrations = []migration{
+	{
+		`CREATE TABLE {table} (
+			id TEXT PRIMARY KEY,
+			local_hash {blob},
+			remote_hash {blob},
+			version TEXT
+		)`,
+		`CREATE TABLE {table}_tokens (
+			side TEXT PRIMARY KEY,
+			token TEXT NOT NULL
+		)`,
+	},
+}
+
+// migrate will bring the schema of table up to date with migrations.  The
+// applied version of each table is kept in the objectsync_schema table.
+func migrate(ctx context.Context, db *sql.DB, dialect Dialect, table string, migrations []migration) error {
+	if !validTable.MatchString(table) {
+		return fmt.Errorf("invalid table name: %q", table)
+	}
+
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS objectsync_schema (
+		table_name TEXT PRIMARY KEY,
+		version INTEGER NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	version := 0
+	err = tx.QueryRowContext(ctx, dialect.rebind(`SELECT version FROM objectsync_schema WHERE table_name = ?`), table).Scan(&version)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		for _, statement := range migrations[i] {
+			_, err = tx.ExecContext(ctx, dialect.expand(statement, table))
+			if err != nil {
+				return fmt.Errorf("migrating %s to version %d: %v", table, i+1, err)
+			}
+		}
+	}
+
+	if version < len(migrations) {
+		_, err = tx.ExecContext(ctx, dialect.rebind(`INSERT INTO objectsync_schema (table_name, version) VALUES (?, ?)
+			ON CONFLICT (table_name) DO UPDATE SET version = excluded.version`), table, len(migrations))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,445 @@
+package sqlstorage
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/keithballdotnet/objectsync"
+	_ "modernc.org/sqlite"
+)
+
+// Check the interfaces
+var _ objectsync.Storage = &SQLStorage{}
+var _ objectsync.StatusStorage = &SQLStatusStorage{}
+var _ objectsync.BatchWriter = &SQLStorage{}
+var _ objectsync.Merkler = &SQLStorage{}
+var _ objectsync.Sketcher = &SQLStorage{}
+var _ objectsync.TokenStorage = &SQLStatusStorage{}
+
+func openDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "objectsync.db"))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestSQLStorage(t *testing.T) {
+
+	ctx := context.TODO()
+
+	t.Run("SetGet", func(t *testing.T) {
+		db := openDB(t)
+		store, err := NewSQLStorage(ctx, db, SQLite, "objects")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		now := time.Now().UTC()
+		object := &objectsync.GenericObject{
+			ID:        "a",
+			Modified:  now,
+			Value:     "value\x00\xff",
+			Version:   objectsync.VersionVector{"local": 2},
+			Signature: &objectsync.ObjectSignature{Replica: "local", Signature: []byte{1, 2, 3}},
+		}
+		err = store.Set(ctx, object)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		got, err := store.Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if got.Value != object.Value || !got.Modified.Equal(now) || string(got.Hash) != string(object.Hash) || got.Version["local"] != 2 {
+			t.Errorf("Unexpected object = %+v", got)
+		}
+		if got.Signature == nil || got.Signature.Replica != "local" || string(got.Signature.Signature) != "\x01\x02\x03" {
+			t.Errorf("Unexpected object = %+v", got)
+		}
+
+		_, err = store.Get(ctx, "missing")
+		if !objectsync.IsNotFoundError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+
+		err = store.Delete(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		all, err := store.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 0 {
+			t.Errorf("Incorrect len = %v, want 0", len(all))
+		}
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		db := openDB(t)
+		store, err := NewSQLStorage(ctx, db, SQLite, "objects")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		objects := []*objectsync.GenericObject{}
+		for i := 0; i < 10; i++ {
+			objects = append(objects, &objectsync.GenericObject{ID: fmt.Sprintf("%v", i), Value: fmt.Sprintf("Object%v", i)})
+		}
+		err = store.SetBatch(ctx, objects)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		all, _ := store.GetAll(ctx)
+		if len(all) != 10 {
+			t.Errorf("Incorrect len = %v, want 10", len(all))
+		}
+
+		err = store.DeleteBatch(ctx, []string{"0", "1", "2"})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		all, _ = store.GetAll(ctx)
+		if len(all) != 7 {
+			t.Errorf("Incorrect len = %v, want 7", len(all))
+		}
+	})
+
+	t.Run("Merkle", func(t *testing.T) {
+		db := openDB(t)
+		store1, err := NewSQLStorage(ctx, db, SQLite, "local")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		store2, err := NewSQLStorage(ctx, db, SQLite, "remote")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		status, err := NewSQLStatusStorage(ctx, db, SQLite, "local_remote_status")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		objects := []*objectsync.GenericObject{}
+		for i := 0; i < 100; i++ {
+			objects = append(objects, &objectsync.GenericObject{ID: fmt.Sprintf("object%v", i), Value: fmt.Sprintf("Object%v", i), Modified: time.Now().UTC()})
+		}
+		err = store1.SetBatch(ctx, objects)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = objectsync.Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		store1.Delete(ctx, "object1")
+		store2.Set(ctx, &objectsync.GenericObject{ID: "object2", Value: "changed", Modified: time.Now().UTC()})
+		err = objectsync.Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// The trees kept are the ones over the objects
+		for _, store := range []*SQLStorage{store1, store2} {
+			all, err := store.GetAll(ctx)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if len(all) != 99 {
+				t.Errorf("Incorrect len = %v, want 99", len(all))
+			}
+			tree := objectsync.NewMerkleTree()
+			for _, object := range all {
+				tree.Set(object.ID, object.Hash)
+			}
+			for _, prefix := range []string{"", objectsync.MerkleBucket("object2")[:1]} {
+				node, err := store.MerkleNode(ctx, prefix)
+				if err != nil {
+					t.Fatalf("Error: %v", err)
+				}
+				if !reflect.DeepEqual(node, tree.Node(prefix)) {
+					t.Errorf("Unexpected node at %q = %+v, want %+v", prefix, node, tree.Node(prefix))
+				}
+			}
+		}
+		object, err := store1.Get(ctx, "object2")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != "changed" {
+			t.Errorf("Unexpected value = %s expected changed", object.Value)
+		}
+	})
+
+	t.Run("Sketch", func(t *testing.T) {
+		db := openDB(t)
+		store1, err := NewSQLStorage(ctx, db, SQLite, "local")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		store2, err := NewSQLStorage(ctx, db, SQLite, "remote")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		status, err := NewSQLStatusStorage(ctx, db, SQLite, "local_remote_status")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		objects := []*objectsync.GenericObject{}
+		for i := 0; i < 100; i++ {
+			objects = append(objects, &objectsync.GenericObject{ID: fmt.Sprintf("object%v", i), Value: fmt.Sprintf("Object%v", i), Modified: time.Now().UTC()})
+		}
+		err = store1.SetBatch(ctx, objects)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = objectsync.Sync(ctx, store1, store2, status, objectsync.WithSketches(60))
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		store1.Delete(ctx, "object1")
+		store2.Set(ctx, &objectsync.GenericObject{ID: "object2", Value: "changed", Modified: time.Now().UTC()})
+		err = objectsync.Sync(ctx, store1, store2, status, objectsync.WithSketches(60))
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// The sketches are the ones over the objects
+		for _, store := range []*SQLStorage{store1, store2} {
+			all, err := store.GetAll(ctx)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			want := objectsync.NewIBLT(60)
+			for _, object := range all {
+				want.Insert(object.ID, object.Hash)
+			}
+			sketch, err := store.Sketch(ctx, 60)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if !reflect.DeepEqual(sketch, want) {
+				t.Errorf("Unexpected sketch of %s", store.GetName())
+			}
+		}
+		object, err := store1.Get(ctx, "object2")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != "changed" {
+			t.Errorf("Unexpected value = %s expected changed", object.Value)
+		}
+	})
+
+	t.Run("Tokens", func(t *testing.T) {
+		status, err := NewSQLStatusStorage(ctx, openDB(t), SQLite, "local_remote_status")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = status.GetToken(ctx, objectsync.SideLocal)
+		if !objectsync.IsNotFoundError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+		for _, token := range []string{"token1", "token2"} {
+			err = status.SetToken(ctx, objectsync.SideLocal, token)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+		}
+		err = status.SetToken(ctx, objectsync.SideRemote, "remote")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		token, err := status.GetToken(ctx, objectsync.SideLocal)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if token != "token2" {
+			t.Errorf("Unexpected token = %s", token)
+		}
+
+		// The tokens are kept apart from the status
+		stati, err := status.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(stati) != 0 {
+			t.Errorf("Unexpected status = %v", stati)
+		}
+	})
+
+	t.Run("Migrate", func(t *testing.T) {
+		db := openDB(t)
+
+		_, err := NewSQLStorage(ctx, db, SQLite, "objects")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		version := 0
+		err = db.QueryRow(`SELECT version FROM objectsync_schema WHERE table_name = 'objects'`).Scan(&version)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if version != len(objectMigrations) {
+			t.Errorf("Unexpected version = %v, want %v", version, len(objectMigrations))
+		}
+
+		// Opening again leaves the schema alone
+		_, err = NewSQLStorage(ctx, db, SQLite, "objects")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		_, err = NewSQLStorage(ctx, db, SQLite, "objects; DROP TABLE objects")
+		if err == nil {
+			t.Errorf("Expected error for invalid table name")
+		}
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		db := openDB(t)
+		store1, err := NewSQLStorage(ctx, db, SQLite, "local")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		store2 := objectsync.NewInMemoryStorage("remote")
+		status, err := NewSQLStatusStorage(ctx, db, SQLite, "local_remote_status")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		for i := 0; i < 3; i++ {
+			store1.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("local%v", i), Value: fmt.Sprintf("Object%v", i), Modified: time.Now().UTC()})
+			store2.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("remote%v", i), Value: fmt.Sprintf("Object%v", i), Modified: time.Now().UTC()})
+		}
+
+		opts := []objectsync.Option{objectsync.WithCausality("local", "remote")}
+		err = objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		store2.Delete(ctx, "local0")
+		store2.Set(ctx, &objectsync.GenericObject{ID: "remote1", Value: "changed", Modified: time.Now().UTC()})
+		err = objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		all1, _ := store1.GetAll(ctx)
+		all2, _ := store2.GetAll(ctx)
+		if len(all1) != 5 || len(all2) != 5 {
+			t.Fatalf("Incorrect len = %v and %v, want 5", len(all1), len(all2))
+		}
+		object, err := store1.Get(ctx, "remote1")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.Value != "changed" {
+			t.Errorf("Unexpected value = %s expected changed", object.Value)
+		}
+
+		stati, err := status.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(stati) != 5 {
+			t.Errorf("Incorrect status len = %v, want 5", len(stati))
+		}
+	})
+
+	t.Run("Signed", func(t *testing.T) {
+		db := openDB(t)
+		store, err := NewSQLStorage(ctx, db, SQLite, "objects")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		public, key, _ := ed25519.GenerateKey(nil)
+		modified := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+		signer := objectsync.NewSignedStorage(store, "local", key, nil)
+		err = signer.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "value", Modified: modified, Version: objectsync.VersionVector{"local": 1}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// The signature is kept, with the time it covers, so the object
+		// verifies when read again
+		verifier := func() *objectsync.SignedStorage {
+			reader, _ := NewSQLStorage(ctx, db, SQLite, "objects")
+			return objectsync.NewSignedStorage(reader, "remote", nil, map[string]ed25519.PublicKey{"local": public})
+		}
+		got, err := verifier().Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if got.Signature == nil || got.Signature.Replica != "local" || !got.Modified.Equal(modified) {
+			t.Errorf("Unexpected object = %+v", got)
+		}
+		all, err := verifier().GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 1 {
+			t.Errorf("Incorrect len = %v, want 1", len(all))
+		}
+
+		// Written again without one, it no longer verifies
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "unsigned", Modified: modified, Version: objectsync.VersionVector{"local": 2}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = verifier().Get(ctx, "a")
+		if !objectsync.IsVerificationError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+}
+
+func TestDialect(t *testing.T) {
+
+	t.Run("Rebind", func(t *testing.T) {
+		for query, want := range map[string]string{
+			`SELECT id FROM objects WHERE id = ?`:                     `SELECT id FROM objects WHERE id = $1`,
+			`INSERT INTO objects (id, hash) VALUES (?, ?)`:            `INSERT INTO objects (id, hash) VALUES ($1, $2)`,
+			`SELECT id FROM objects WHERE id = '?' AND hash = ?`:      `SELECT id FROM objects WHERE id = '?' AND hash = $1`,
+			`SELECT id FROM objects WHERE id = 'it''s ?' AND id <> ?`: `SELECT id FROM objects WHERE id = 'it''s ?' AND id <> $1`,
+			`SELECT "a?b" FROM objects WHERE id = ?`:                  `SELECT "a?b" FROM objects WHERE id = $1`,
+		} {
+			got := PostgreSQL.rebind(query)
+			if got != want {
+				t.Errorf("Unexpected query = %s, want %s", got, want)
+			}
+			if SQLite.rebind(query) != query {
+				t.Errorf("Unexpected query = %s, want %s", SQLite.rebind(query), query)
+			}
+		}
+	})
+
+	t.Run("Expand", func(t *testing.T) {
+		for _, test := range []struct {
+			dialect Dialect
+			want    string
+		}{
+			{SQLite, `CREATE TABLE objects (hash BLOB)`},
+			{PostgreSQL, `CREATE TABLE objects (hash BYTEA)`},
+		} {
+			got := test.dialect.expand(`CREATE TABLE {table} (hash {blob})`, "objects")
+			if got != test.want {
+				t.Errorf("Unexpected statement in %s = %s, want %s", test.dialect, got, test.want)
+			}
+		}
+	})
+}
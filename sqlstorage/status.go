@@ -0,0 +1,119 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/keithballdotnet/objectsync"
+)
+
+// SQLStatusStorage is an objectsync.StatusStorage keeping the sync status in
+// a table.  It is an objectsync.TokenStorage, keeping the tokens of the
+// change feeds in the table {table}_tokens.
+type SQLStatusStorage struct {
+	db      *sql.DB
+	dialect Dialect
+	table   string
+}
+
+// NewSQLStatusStorage will return a SQLStatusStorage keeping the status in
+// table, which is created or migrated to the current schema as needed.  Each
+// pair of synced storages needs its own table.
+func NewSQLStatusStorage(ctx context.Context, db *sql.DB, dialect Dialect, table string) (*SQLStatusStorage, error) {
+	err := migrate(ctx, db, dialect, table, statusMigrations)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLStatusStorage{db: db, dialect: dialect, table: table}, nil
+}
+
+// Set ...
+func (s *SQLStatusStorage) Set(ctx context.Context, object *objectsync.SyncStatus) error {
+	version, err := encodeVersion(object.Version)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, s.query(`INSERT INTO {table} (id, local_hash, remote_hash, version) VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET local_hash = excluded.local_hash, remote_hash = excluded.remote_hash, version = excluded.version`),
+		object.ID, []byte(object.LocalHash), []byte(object.RemoteHash), version)
+	return err
+}
+
+// Get ...
+func (s *SQLStatusStorage) Get(ctx context.Context, id string) (*objectsync.SyncStatus, error) {
+	row := s.db.QueryRowContext(ctx, s.query(`SELECT id, local_hash, remote_hash, version FROM {table} WHERE id = ?`), id)
+	status, err := scanStatus(row)
+	if err == sql.ErrNoRows {
+		return nil, objectsync.ErrorNotFound
+	}
+	return status, err
+}
+
+// GetAll ...
+func (s *SQLStatusStorage) GetAll(ctx context.Context) ([]*objectsync.SyncStatus, error) {
+	rows, err := s.db.QueryContext(ctx, s.query(`SELECT id, local_hash, remote_hash, version FROM {table}`))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stati := []*objectsync.SyncStatus{}
+	for rows.Next() {
+		status, err := scanStatus(rows)
+		if err != nil {
+			return nil, err
+		}
+		stati = append(stati, status)
+	}
+
+	return stati, rows.Err()
+}
+
+// Delete ...
+func (s *SQLStatusStorage) Delete(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, s.query(`DELETE FROM {table} WHERE id = ?`), id)
+	return err
+}
+
+// GetToken ...
+func (s *SQLStatusStorage) GetToken(ctx context.Context, side string) (string, error) {
+	token := ""
+	err := s.db.QueryRowContext(ctx, s.query(`SELECT token FROM {table}_tokens WHERE side = ?`), side).Scan(&token)
+	if err == sql.ErrNoRows {
+		return "", objectsync.ErrorNotFound
+	}
+	return token, err
+}
+
+// SetToken ...
+func (s *SQLStatusStorage) SetToken(ctx context.Context, side, token string) error {
+	_, err := s.db.ExecContext(ctx, s.query(`INSERT INTO {table}_tokens (side, token) VALUES (?, ?)
+		ON CONFLICT (side) DO UPDATE SET token = excluded.token`), side, token)
+	return err
+}
+
+func (s *SQLStatusStorage) query(query string) string {
+	return s.dialect.rebind(s.dialect.expand(query, s.table))
+}
+
+func scanStatus(row scanner) (*objectsync.SyncStatus, error) {
+	var (
+		status     objectsync.SyncStatus
+		localHash  []byte
+		remoteHash []byte
+		version    sql.NullString
+	)
+	err := row.Scan(&status.ID, &localHash, &remoteHash, &version)
+	if err != nil {
+		return nil, err
+	}
+
+	status.LocalHash = objectsync.Hash(localHash)
+	status.RemoteHash = objectsync.Hash(remoteHash)
+	status.Version, err = decodeVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
@@ -0,0 +1,288 @@
+// Package sqlstorage implements objectsync storage on top of database/sql.
+// SQLite and PostgreSQL are supported, and the driver for either must be
+// registered by the application.
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/keithballdotnet/objectsync"
+)
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// SQLStorage is an objectsync.Storage keeping objects in a table.  It is an
+// objectsync.BatchWriter, so Sync writes its changes in one transaction.
+//
+// It is an objectsync.Merkler and objectsync.Sketcher too.  The nodes of its Merkle tree are kept in
+// the table {table}_merkle, updated in the transaction of each write, so
+// objects must only be written through a SQLStorage.
+type SQLStorage struct {
+	db      *sql.DB
+	dialect Dialect
+	table   string
+}
+
+// NewSQLStorage will return a SQLStorage keeping its objects in table, which
+// is created or migrated to the current schema as needed
+func NewSQLStorage(ctx context.Context, db *sql.DB, dialect Dialect, table string) (*SQLStorage, error) {
+	err := migrate(ctx, db, dialect, table, objectMigrations)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLStorage{db: db, dialect: dialect, table: table}, nil
+}
+
+// GetName will return the table name
+func (s *SQLStorage) GetName() string {
+	return s.table
+}
+
+// Set ...
+func (s *SQLStorage) Set(ctx context.Context, object *objectsync.GenericObject) error {
+	return s.batch(ctx, func(tx *sql.Tx) error {
+		return s.set(ctx, tx, object)
+	})
+}
+
+// SetBatch will set all the objects in a single transaction
+func (s *SQLStorage) SetBatch(ctx context.Context, objects []*objectsync.GenericObject) error {
+	return s.batch(ctx, func(tx *sql.Tx) error {
+		for _, object := range objects {
+			err := s.set(ctx, tx, object)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLStorage) set(ctx context.Context, db execer, object *objectsync.GenericObject) error {
+	version, err := encodeVersion(object.Version)
+	if err != nil {
+		return err
+	}
+	signature, err := encodeSignature(object.Signature)
+	if err != nil {
+		return err
+	}
+
+	hash := objectsync.NewHash(object.Value)
+	_, err = db.ExecContext(ctx, s.query(`INSERT INTO {table} (id, hash, modified, value, version, version_hash, signature, bucket) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET hash = excluded.hash, modified = excluded.modified, value = excluded.value,
+		version = excluded.version, version_hash = excluded.version_hash, signature = excluded.signature`),
+		object.ID, []byte(hash), encodeTime(object.Modified), []byte(object.Value), version, []byte(object.VersionHash), signature, objectsync.MerkleBucket(object.ID))
+	if err != nil {
+		return err
+	}
+	err = objectsync.UpdateMerkle(ctx, &merkleNodes{s: s, db: db}, object.ID)
+	if err != nil {
+		return err
+	}
+
+	object.Hash = hash
+	return nil
+}
+
+// Get ...
+func (s *SQLStorage) Get(ctx context.Context, id string) (*objectsync.GenericObject, error) {
+	row := s.db.QueryRowContext(ctx, s.query(`SELECT id, hash, modified, value, version, version_hash, signature FROM {table} WHERE id = ?`), id)
+	object, err := scanObject(row)
+	if err == sql.ErrNoRows {
+		return nil, objectsync.ErrorNotFound
+	}
+	return object, err
+}
+
+// GetAll will return all objects
+func (s *SQLStorage) GetAll(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	rows, err := s.db.QueryContext(ctx, s.query(`SELECT id, hash, modified, value, version, version_hash, signature FROM {table} ORDER BY id`))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	objects := objectsync.GenericObjectCollection{}
+	for rows.Next() {
+		object, err := scanObject(rows)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+
+	return objects, rows.Err()
+}
+
+// Delete will remove a entry from the storage
+func (s *SQLStorage) Delete(ctx context.Context, id string) error {
+	return s.batch(ctx, func(tx *sql.Tx) error {
+		return s.delete(ctx, tx, id)
+	})
+}
+
+// DeleteBatch will delete all the objects in a single transaction
+func (s *SQLStorage) DeleteBatch(ctx context.Context, ids []string) error {
+	return s.batch(ctx, func(tx *sql.Tx) error {
+		for _, id := range ids {
+			err := s.delete(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLStorage) delete(ctx context.Context, db execer, id string) error {
+	_, err := db.ExecContext(ctx, s.query(`DELETE FROM {table} WHERE id = ?`), id)
+	if err != nil {
+		return err
+	}
+	return objectsync.UpdateMerkle(ctx, &merkleNodes{s: s, db: db}, id)
+}
+
+// Sketch will summarize the IDs and hashes of the table, read without the
+// values
+func (s *SQLStorage) Sketch(ctx context.Context, cells int) (*objectsync.IBLT, error) {
+	rows, err := s.db.QueryContext(ctx, s.query(`SELECT id, hash FROM {table}`))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sketch := objectsync.NewIBLT(cells)
+	for rows.Next() {
+		var id string
+		var hash []byte
+		err = rows.Scan(&id, &hash)
+		if err != nil {
+			return nil, err
+		}
+		sketch.Insert(id, hash)
+	}
+	return sketch, rows.Err()
+}
+
+// MerkleNode will return the node at prefix of the Merkle tree of the table
+func (s *SQLStorage) MerkleNode(ctx context.Context, prefix string) (*objectsync.MerkleNode, error) {
+	return objectsync.ReadMerkleNode(ctx, &merkleNodes{s: s, db: s.db}, prefix)
+}
+
+func (s *SQLStorage) batch(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStorage) query(query string) string {
+	return s.dialect.rebind(s.dialect.expand(query, s.table))
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanObject(row scanner) (*objectsync.GenericObject, error) {
+	var (
+		object      objectsync.GenericObject
+		hash        []byte
+		modified    sql.NullInt64
+		value       []byte
+		version     sql.NullString
+		versionHash []byte
+		signature   sql.NullString
+	)
+	err := row.Scan(&object.ID, &hash, &modified, &value, &version, &versionHash, &signature)
+	if err != nil {
+		return nil, err
+	}
+
+	object.Hash = objectsync.Hash(hash)
+	object.Value = string(value)
+	object.Modified = decodeTime(modified)
+	if len(versionHash) > 0 {
+		object.VersionHash = objectsync.Hash(versionHash)
+	}
+	object.Version, err = decodeVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	object.Signature, err = decodeSignature(signature)
+	if err != nil {
+		return nil, err
+	}
+	return &object, nil
+}
+
+// encodeTime will store times as nanoseconds, with NULL for the zero time
+func encodeTime(t time.Time) sql.NullInt64 {
+	if t.IsZero() {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.UnixNano(), Valid: true}
+}
+
+func decodeTime(t sql.NullInt64) time.Time {
+	if !t.Valid {
+		return time.Time{}
+	}
+	return time.Unix(0, t.Int64).UTC()
+}
+
+func encodeVersion(version objectsync.VersionVector) (sql.NullString, error) {
+	if version == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(version)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+func decodeVersion(version sql.NullString) (objectsync.VersionVector, error) {
+	if !version.Valid {
+		return nil, nil
+	}
+	v := objectsync.VersionVector{}
+	err := json.Unmarshal([]byte(version.String), &v)
+	return v, err
+}
+
+func encodeSignature(signature *objectsync.ObjectSignature) (sql.NullString, error) {
+	if signature == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(signature)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+func decodeSignature(signature sql.NullString) (*objectsync.ObjectSignature, error) {
+	if !signature.Valid {
+		return nil, nil
+	}
+	s := &objectsync.ObjectSignature{}
+	err := json.Unmarshal([]byte(signature.String), s)
+	return s, err
+}
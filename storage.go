@@ -14,6 +14,26 @@ type Storage interface {
 	Delete(ctx context.Context, id string) error
 }
 
+// Lister is implemented by a Storage that can list its objects without
+// reading their values.  Sync lists such storages, and only reads the value
+// of an object when it is copied or its conflict resolved.
+type Lister interface {
+	List(ctx context.Context) (GenericObjectCollection, error)
+}
+
+// Committer is implemented by a Storage that gathers its writes, and makes
+// them in one go when committed.  Sync commits such storages once all its
+// changes are applied.
+type Committer interface {
+	Commit(ctx context.Context) error
+}
+
+// NewHash will return the hash of an object value
+func NewHash(value string) Hash {
+	hash := sha256.Sum256([]byte(value))
+	return Hash(hash[:])
+}
+
 // InMemoryStorage ...
 type InMemoryStorage struct {
 	name    string
@@ -33,8 +53,7 @@ func (s *InMemoryStorage) GetName() string {
 
 // Set ...
 func (s *InMemoryStorage) Set(ctx context.Context, object *GenericObject) error {
-	hash := sha256.Sum256([]byte(object.Value))
-	object.Hash = Hash(hash[:])
+	object.Hash = NewHash(object.Value)
 	s.idIndex[object.ID] = object
 	return nil
 }
@@ -66,3 +85,44 @@ func (s *InMemoryStorage) Delete(ctx context.Context, id string) error {
 	delete(s.idIndex, id)
 	return nil
 }
+
+// listObjects will return all objects of store, without their values if it
+// can list them that way
+func listObjects(ctx context.Context, store Storage) (GenericObjectCollection, error) {
+	lister, ok := store.(Lister)
+	if !ok {
+		return store.GetAll(ctx)
+	}
+
+	objects, err := lister.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, object := range objects {
+		object.source = store
+	}
+	return objects, nil
+}
+
+// loadValue will read the value of an object listed without it
+func loadValue(ctx context.Context, object *GenericObject) error {
+	if object == nil || object.source == nil {
+		return nil
+	}
+
+	stored, err := object.source.Get(ctx, object.ID)
+	if err != nil {
+		return err
+	}
+	object.Value = stored.Value
+	object.source = nil
+	return nil
+}
+
+func indexObjects(objects GenericObjectCollection) map[string]*GenericObject {
+	index := make(map[string]*GenericObject, len(objects))
+	for _, object := range objects {
+		index[object.ID] = object
+	}
+	return index
+}
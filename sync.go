@@ -3,27 +3,36 @@ package objectsync
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 )
 
 // Sync will sync together two Storages
 // Based off - https://unterwaditzer.net/2016/sync-algorithm.html
-// Last Write Wins (LWW) conflict resolution
-func Sync(ctx context.Context, local, remote Storage, status StatusStorage) error {
+// Last Write Wins (LWW) conflict resolution unless another ConflictResolver is given
+// Options such as WithCausality change how changes are discovered and resolved
+func Sync(ctx context.Context, local, remote Storage, status StatusStorage, opts ...Option) error {
+	o := newOptions(opts)
 
-	localSet, err := local.GetAll(ctx)
+	localSet, remoteSet, changedIDs, tokens, err := discoverObjects(ctx, local, remote, status, o)
 	if err != nil {
 		return err
 	}
 
 	fmt.Printf("local len: %v\n", len(localSet))
+	fmt.Printf("remote len: %v\n", len(remoteSet))
+
+	localIndex := indexObjects(localSet)
+	remoteIndex := indexObjects(remoteSet)
 
-	remoteSet, err := remote.GetAll(ctx)
+	pending, err := pendingConflicts(ctx, o)
+	if err != nil {
+		return err
+	}
+	quarantined, err := quarantinedObjects(ctx, local, remote)
 	if err != nil {
 		return err
 	}
-
-	fmt.Printf("remote len: %v\n", len(remoteSet))
 
 	foundIDs := []string{}
 
@@ -36,44 +45,39 @@ func Sync(ctx context.Context, local, remote Storage, status StatusStorage) erro
 		// Keep a note of this foundIDs to check against the status set
 		foundIDs = append(foundIDs, localObject.ID)
 
-		remoteObject, err := remote.Get(ctx, localObject.ID)
-		foundRemote, err := wasFound(err)
-		if err != nil {
-			return err
+		// Leave objects alone while a deferred conflict awaits resolution
+		if pending[localObject.ID] {
+			fmt.Printf("Conflict for [%s] awaits resolution.  Skip.\n", localObject.ID)
+			continue
+		}
+		if quarantined[localObject.ID] {
+			fmt.Printf("Object [%s] is quarantined.  Skip.\n", localObject.ID)
+			continue
 		}
 
+		remoteObject, foundRemote := remoteIndex[localObject.ID]
+
 		syncStatus, err := status.Get(ctx, localObject.ID)
 		foundStatus, err := wasFound(err)
 		if err != nil {
 			return err
 		}
 
-		// A - B - status
-		if !foundRemote && !foundStatus {
-			fmt.Printf("We should add local [%s] to remote\n", localObject.ID)
-			// Add local -> Remote
-			// Store Status
-			changes = append(changes, &Change{
-				Type:   ChangeTypeSet,
-				Object: localObject,
-				Store:  remote,
-				SyncStatus: &SyncStatus{
-					ID:         localObject.ID,
-					LocalHash:  localObject.Hash,
-					RemoteHash: localObject.Hash,
-				}})
+		if !foundStatus {
+			syncStatus = nil
 		}
+		p := newPair(localObject, remoteObject, syncStatus, o)
 
+		// A - B - status
 		// A + status - B
-		if !foundRemote && foundStatus {
-			fmt.Printf("We should delete local [%s]\n", localObject.ID)
-			// Delete local
-			// Delete status
-			changes = append(changes, &Change{
-				Type:   ChangeTypeDelete,
-				Object: localObject,
-				Store:  local,
-			})
+		if !foundRemote {
+			// Add local -> Remote and store status, or
+			// delete local and delete status
+			absent, err := absentChanges(ctx, p, local, remote, o)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, absent...)
 		}
 
 		// A + B - status
@@ -81,7 +85,11 @@ func Sync(ctx context.Context, local, remote Storage, status StatusStorage) erro
 			fmt.Printf("Found in both sets, but missing status.  Invoke conflict resolution\n")
 
 			// We should invoke conflict resolution as we dont know what to do with the object
-			changes = append(changes, resolveConflict(ctx, localObject, remoteObject, local, remote))
+			resolved, err := resolveChanges(ctx, p, local, remote, o)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, resolved...)
 		}
 
 		// A + B + Status
@@ -95,35 +103,23 @@ func Sync(ctx context.Context, local, remote Storage, status StatusStorage) erro
 			// A-Hash != Status-Hash && B-Hash == Status-Hash
 			if !bytes.Equal(localObject.Hash, syncStatus.LocalHash) && bytes.Equal(remoteObject.Hash, syncStatus.RemoteHash) {
 				fmt.Printf("Hash has changed local but not on remote.  Update remote.\n")
-				changes = append(changes, &Change{
-					Type:   ChangeTypeSet,
-					Object: localObject,
-					Store:  remote,
-					SyncStatus: &SyncStatus{
-						ID:         localObject.ID,
-						LocalHash:  localObject.Hash,
-						RemoteHash: localObject.Hash,
-					}})
+				changes = append(changes, reconcile(mergeVersions(p.local, p.remote), p, local, remote)...)
 			}
 
 			// A-Hash == Status-Hash && B-Hash != Status-Hash
 			if bytes.Equal(localObject.Hash, syncStatus.LocalHash) && !bytes.Equal(remoteObject.Hash, syncStatus.RemoteHash) {
 				fmt.Printf("Hash has changed remote but not on local.  Update local.\n")
-				changes = append(changes, &Change{
-					Type:   ChangeTypeSet,
-					Object: remoteObject,
-					Store:  local,
-					SyncStatus: &SyncStatus{
-						ID:         remoteObject.ID,
-						LocalHash:  remoteObject.Hash,
-						RemoteHash: remoteObject.Hash,
-					}})
+				changes = append(changes, reconcile(mergeVersions(p.remote, p.local), p, local, remote)...)
 			}
 
 			// A-Hash != Status-Hash && B-Hash != Status-Hash
 			if !bytes.Equal(localObject.Hash, syncStatus.LocalHash) && !bytes.Equal(remoteObject.Hash, syncStatus.RemoteHash) {
 				fmt.Printf("Hash has changed local, also changed remote.  Invoke conflict resolution.\n")
-				changes = append(changes, resolveConflict(ctx, localObject, remoteObject, local, remote))
+				resolved, err := resolveChanges(ctx, p, local, remote, o)
+				if err != nil {
+					return err
+				}
+				changes = append(changes, resolved...)
 			}
 		}
 	}
@@ -133,40 +129,32 @@ func Sync(ctx context.Context, local, remote Storage, status StatusStorage) erro
 		// Keep a note of this foundIDs to check against the status set
 		foundIDs = append(foundIDs, remoteObject.ID)
 
-		_, err = local.Get(ctx, remoteObject.ID)
-		foundLocal, err := wasFound(err)
-		if err != nil {
-			return err
+		if pending[remoteObject.ID] || quarantined[remoteObject.ID] {
+			continue
 		}
 
-		_, err = status.Get(ctx, remoteObject.ID)
+		_, foundLocal := localIndex[remoteObject.ID]
+
+		syncStatus, err := status.Get(ctx, remoteObject.ID)
 		foundStatus, err := wasFound(err)
 		if err != nil {
 			return err
 		}
-
-		// B - A - status
-		if !foundLocal && !foundStatus {
-			fmt.Printf("We should add remote [%s] to local\n", remoteObject.ID)
-			// Add remote -> local
-			// store status
-			changes = append(changes, &Change{
-				Type:   ChangeTypeSet,
-				Object: remoteObject,
-				Store:  local,
-				SyncStatus: &SyncStatus{
-					ID:         remoteObject.ID,
-					LocalHash:  remoteObject.Hash,
-					RemoteHash: remoteObject.Hash,
-				}})
+		if !foundStatus {
+			syncStatus = nil
 		}
 
+		// B - A - status
 		// B + status - A
-		if !foundLocal && foundStatus {
-			fmt.Printf("We should remove remote [%s]\n", remoteObject.ID)
-			// Delete remote
-			// Delete status
-			changes = append(changes, &Change{Type: ChangeTypeDelete, Object: remoteObject, Store: remote})
+		if !foundLocal {
+			// Add remote -> local and store status, or
+			// delete remote and delete status
+			p := newPair(nil, remoteObject, syncStatus, o)
+			absent, err := absentChanges(ctx, p, local, remote, o)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, absent...)
 		}
 	}
 
@@ -176,6 +164,13 @@ func Sync(ctx context.Context, local, remote Storage, status StatusStorage) erro
 		return err
 	}
 	for _, statusEntry := range allStati {
+		// Only the changed objects were found
+		if changedIDs != nil && !changedIDs[statusEntry.ID] {
+			continue
+		}
+		if quarantined[statusEntry.ID] {
+			continue
+		}
 		statusFound := false
 		for _, id := range foundIDs {
 			if statusEntry.ID == id {
@@ -194,32 +189,143 @@ func Sync(ctx context.Context, local, remote Storage, status StatusStorage) erro
 		changes = append(changes, &Change{Type: ChangeTypeDeleteStatus, ID: statusEntry.ID})
 	}
 
+	// Drop the conflicts whose object is gone from both sides
+	for id := range pending {
+		_, foundLocal := localIndex[id]
+		_, foundRemote := remoteIndex[id]
+		if foundLocal || foundRemote || (changedIDs != nil && !changedIDs[id]) {
+			continue
+		}
+		fmt.Printf("We should drop the conflict for [%s]\n", id)
+		changes = append(changes, &Change{Type: ChangeTypeDropConflict, ID: id})
+	}
+
 	/* Phase 2 - Reconcile changes */
+	err = applyChanges(ctx, changes, local, remote, status, o)
+	if err != nil {
+		return err
+	}
+	err = commit(ctx, local, remote)
+	if err != nil {
+		return err
+	}
+	err = saveTokens(ctx, status, tokens)
+	if err != nil {
+		return err
+	}
+
+	return collectTombstones(ctx, local, remote, o)
+}
+
+// discoverObjects will return the objects of both storages to sync.  If both
+// have change feeds, can be sketched, or maintain Merkle trees, only the
+// objects changed since the last sync are returned, along with the IDs
+// considered.  Otherwise all
+// objects are listed, and the IDs are nil.  The tokens to keep once synced
+// are returned for change feeds.
+func discoverObjects(ctx context.Context, local, remote Storage, status StatusStorage, o *options) (localSet, remoteSet GenericObjectCollection, ids map[string]bool, tokens *feedTokens, err error) {
+	_, localFeed := local.(ChangeFeed)
+	_, remoteFeed := remote.(ChangeFeed)
+	if tokenStorage, ok := status.(TokenStorage); ok && localFeed && remoteFeed {
+		return feedObjects(ctx, local, remote, tokenStorage)
+	}
+
+	_, localSketch := local.(Sketcher)
+	_, remoteSketch := remote.(Sketcher)
+	_, localMerkle := local.(Merkler)
+	_, remoteMerkle := remote.(Merkler)
+	sketch := o.sketchCells > 0 && localSketch && remoteSketch
+	if sketch || (localMerkle && remoteMerkle) {
+		stati, err := status.GetAll(ctx)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		if sketch {
+			localSet, remoteSet, ids, err = sketchObjects(ctx, local, remote, stati, o.sketchCells)
+			if err != errSketchUndecodable {
+				return localSet, remoteSet, ids, nil, err
+			}
+			fmt.Printf("Too many changes to decode sketches.  Fall back.\n")
+		}
+		if localMerkle && remoteMerkle {
+			localSet, remoteSet, ids, err = merkleObjects(ctx, local, remote, stati)
+			return localSet, remoteSet, ids, nil, err
+		}
+	}
+
+	localSet, err = listObjects(ctx, local)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	remoteSet, err = listObjects(ctx, remote)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return localSet, remoteSet, nil, nil, nil
+}
+
+// commit will commit the storages that gather their writes
+func commit(ctx context.Context, stores ...Storage) error {
+	for _, store := range stores {
+		if committer, ok := store.(Committer); ok {
+			err := committer.Commit(ctx)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// applyChanges will perform the changes on the storages.  Each write is
+// given the name of the storage on the other side as its origin.
+func applyChanges(ctx context.Context, changes []*Change, local, remote Storage, status StatusStorage, o *options) error {
+	changes, err := writeBatches(ctx, changes, local, remote, status, o)
+	if err != nil {
+		return err
+	}
+
 	for _, change := range changes {
 		fmt.Printf("Got change: %v\n", change.Type)
 
+		ctx := ctx
+		if change.Store != nil {
+			origin := remote
+			if change.Remote {
+				origin = local
+			}
+			ctx = WithOrigin(ctx, origin.GetName())
+		}
+
 		switch change.Type {
 		case ChangeTypeSet:
 			// Add object to store
-			newobj := *change.Object // As we are dealing with go specific pointers, we will copy the value out
-			err = change.Store.Set(ctx, &newobj)
+			newobj, err := changedObject(ctx, change)
 			if err != nil {
 				return err
 			}
-			// Set status
-			err = status.Set(ctx, change.SyncStatus)
+			// Set status along with it
+			err = setObject(ctx, change.Store, newobj, status, change.SyncStatus)
+			if err != nil {
+				return err
+			}
+			err = setStatusHash(ctx, status, change, newobj.Hash)
+			if err != nil {
+				return err
+			}
+			err = setBase(ctx, newobj, change.SyncStatus, o)
 			if err != nil {
 				return err
 			}
 
 			fmt.Printf("Added: %v To: %s\n", change.Object.ID, change.Store.GetName())
 		case ChangeTypeDelete:
-			err = change.Store.Delete(ctx, change.Object.ID)
+			// Delete status along with it
+			err = deleteObject(ctx, change.Store, change.Object.ID, change.Tombstone, status, o)
 			if err != nil {
 				return err
 			}
-			// Delete status
-			err = status.Delete(ctx, change.Object.ID)
+			err = deleteBase(ctx, change.Object.ID, o)
 			if err != nil {
 				return err
 			}
@@ -230,11 +336,31 @@ func Sync(ctx context.Context, local, remote Storage, status StatusStorage) erro
 			if err != nil {
 				return err
 			}
+			err = deleteBase(ctx, change.ID, o)
+			if err != nil {
+				return err
+			}
 		case ChangeTypeSetStatus:
 			err = status.Set(ctx, change.SyncStatus)
 			if err != nil {
 				return err
 			}
+			err = setBase(ctx, change.Object, change.SyncStatus, o)
+			if err != nil {
+				return err
+			}
+		case ChangeTypeDeferConflict:
+			err = o.conflicts.Set(ctx, change.Conflict)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Deferred conflict: %v\n", change.ID)
+		case ChangeTypeDropConflict:
+			err = o.conflicts.Delete(ctx, change.ID)
+			if err != nil {
+				return err
+			}
 		default:
 			fmt.Println("Currently unsupported change type")
 		}
@@ -244,34 +370,254 @@ func Sync(ctx context.Context, local, remote Storage, status StatusStorage) erro
 	return nil
 }
 
-// resolveConflict will return the object that should be considered
-// the object state to preserve
-// Last Write Wins (LWW) conflict resolution
-func resolveConflict(ctx context.Context, localObject, remoteObject *GenericObject, local, remote Storage) *Change {
-	// local object is older than remote object.  We preserve this object
-	if localObject.Modified.After(remoteObject.Modified) {
-		fmt.Printf("We should add local [%s] to remote\n", remoteObject.ID)
-		return &Change{
-			Type:   ChangeTypeSet,
-			Object: localObject,
-			Store:  remote,
-			SyncStatus: &SyncStatus{
-				ID:         localObject.ID,
-				LocalHash:  localObject.Hash,
-				RemoteHash: localObject.Hash,
-			}}
-	}
-	// remote object is older than local object.  Preserve older object.
-	fmt.Printf("We should add remote [%s] to local\n", remoteObject.ID)
+// changedObject will return a copy of the object of a set change, with its
+// value loaded
+func changedObject(ctx context.Context, change *Change) (*GenericObject, error) {
+	newobj := *change.Object // As we are dealing with go specific pointers, we will copy the value out
+	newobj.Version = change.Object.Version.Copy()
+	err := loadValue(ctx, &newobj)
+	if err != nil {
+		return nil, err
+	}
+	// The version was assigned to this content, whichever storage it came
+	// from, so give it the hash of the value.  Storages with hashes of their
+	// own are matched against the status.
+	if bytes.Equal(newobj.VersionHash, newobj.Hash) {
+		newobj.Hash = NewHash(newobj.Value)
+		newobj.VersionHash = newobj.Hash
+	}
+	return &newobj, nil
+}
+
+// pair holds the copies of an object found in the local and remote storage
+type pair struct {
+	// local and remote are the objects as considered by Sync.  With causality
+	// enabled their versions may have been advanced past the stored copies.
+	local, remote *GenericObject
+	// localStored and remoteStored are the objects as read from the storage
+	localStored, remoteStored *GenericObject
+	// status is the status of the last sync, nil if there is none
+	status *SyncStatus
+	// localTombstone and remoteTombstone record the deletion of an object
+	// missing from one side, if known
+	localTombstone, remoteTombstone *Tombstone
+}
+
+// id will return the ID of the object
+func (p *pair) id() string {
+	if p.local != nil {
+		return p.local.ID
+	}
+	return p.remote.ID
+}
+
+// tombstone will return the tombstone of the deleted side, if any
+func (p *pair) tombstone() *Tombstone {
+	if p.localTombstone != nil {
+		return p.localTombstone
+	}
+	return p.remoteTombstone
+}
+
+// load will read the values of objects listed without them
+func (p *pair) load(ctx context.Context) error {
+	err := loadValue(ctx, p.localStored)
+	if err != nil {
+		return err
+	}
+	err = loadValue(ctx, p.remoteStored)
+	if err != nil {
+		return err
+	}
+
+	if p.local != nil {
+		p.local.Value, p.local.source = p.localStored.Value, nil
+	}
+	if p.remote != nil {
+		p.remote.Value, p.remote.source = p.remoteStored.Value, nil
+	}
+	return nil
+}
+
+func newPair(localObject, remoteObject *GenericObject, syncStatus *SyncStatus, o *options) *pair {
+	p := &pair{
+		local:        localObject,
+		remote:       remoteObject,
+		localStored:  localObject,
+		remoteStored: remoteObject,
+		status:       syncStatus,
+	}
+	if o.causality {
+		p.local, p.remote = advanceVersions(localObject, remoteObject, syncStatus, o)
+	}
+	return p
+}
+
+// resolve will return the object state to preserve when an object exists
+// on both sides, or was deleted on one side and changed on the other.  With
+// causality enabled, conflict resolution is only invoked when the edits are
+// concurrent.  A nil object means the deletion wins.
+func resolve(ctx context.Context, p *pair, o *options) (*GenericObject, error) {
+	if o.causality && p.local != nil && p.remote != nil {
+		switch p.local.Version.Compare(p.remote.Version) {
+		case OrderingAfter:
+			fmt.Printf("Local [%s] descends from remote.  Update remote.\n", p.local.ID)
+			return p.local, nil
+		case OrderingBefore:
+			fmt.Printf("Remote [%s] descends from local.  Update local.\n", p.remote.ID)
+			return p.remote, nil
+		case OrderingEqual:
+			if bytes.Equal(p.local.Hash, p.remote.Hash) {
+				return p.local, nil
+			}
+		}
+	}
+
+	base, err := getBase(ctx, p.status, o)
+	if err != nil {
+		return nil, err
+	}
+
+	winner, err := o.resolver.Resolve(ctx, &Conflict{
+		ID:              p.id(),
+		Local:           p.local,
+		Remote:          p.remote,
+		Base:            base,
+		LocalTombstone:  p.localTombstone,
+		RemoteTombstone: p.remoteTombstone,
+	})
+	if err != nil || winner == nil {
+		return nil, err
+	}
+
+	winner = mergeVersions(winner, p.local, p.remote)
+	if o.causality {
+		winner.VersionHash = winner.Hash
+	}
+	return winner, nil
+}
+
+// resolveChanges will return the changes that resolve a conflict.  If the
+// resolver defers the conflict, it is recorded for manual resolution instead.
+func resolveChanges(ctx context.Context, p *pair, local, remote Storage, o *options) ([]*Change, error) {
+	err := p.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	winner, err := resolve(ctx, p, o)
+	if err == ErrorConflictDeferred {
+		if o.conflicts == nil {
+			return nil, errors.New("deferring conflicts requires a ConflictStorage")
+		}
+		base, err := getBase(ctx, p.status, o)
+		if err != nil {
+			return nil, err
+		}
+		return []*Change{{
+			Type: ChangeTypeDeferConflict,
+			ID:   p.id(),
+			Conflict: &Conflict{
+				ID:              p.id(),
+				Local:           p.localStored,
+				Remote:          p.remoteStored,
+				Base:            base,
+				LocalTombstone:  p.localTombstone,
+				RemoteTombstone: p.remoteTombstone,
+			},
+		}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return reconcile(winner, p, local, remote), nil
+}
+
+// reconcile will return the changes that leave winner in both storages.
+// Only the storages whose copy differs from winner are written, and when
+// both already match just the status is stored.  A nil winner deletes the
+// object from both storages.
+func reconcile(winner *GenericObject, p *pair, local, remote Storage) []*Change {
+	changes := []*Change{}
+	if winner == nil {
+		if p.localStored != nil {
+			changes = append(changes, newDeleteChange(p.localStored, local, p.tombstone(), false))
+		}
+		if p.remoteStored != nil {
+			changes = append(changes, newDeleteChange(p.remoteStored, remote, p.tombstone(), true))
+		}
+		if len(changes) == 0 {
+			changes = append(changes, &Change{Type: ChangeTypeDeleteStatus, ID: p.id()})
+		}
+		return changes
+	}
+
+	// Both changes share the status, which records the hash each storage
+	// reports for the object
+	syncStatus := newSyncStatus(winner)
+	if !sameObject(winner, p.localStored) {
+		changes = append(changes, newSetChange(winner, local, syncStatus, false))
+	}
+	if !sameObject(winner, p.remoteStored) {
+		changes = append(changes, newSetChange(winner, remote, syncStatus, true))
+	}
+	if len(changes) == 0 {
+		changes = append(changes, &Change{
+			Type:       ChangeTypeSetStatus,
+			ID:         winner.ID,
+			Object:     winner,
+			SyncStatus: syncStatus,
+		})
+	}
+	return changes
+}
+
+func sameObject(a, b *GenericObject) bool {
+	return b != nil && bytes.Equal(a.Hash, b.Hash) && a.Version.Compare(b.Version) == OrderingEqual
+}
+
+func newDeleteChange(object *GenericObject, store Storage, tombstone *Tombstone, remote bool) *Change {
+	return &Change{
+		Type:      ChangeTypeDelete,
+		Object:    object,
+		Store:     store,
+		Tombstone: tombstone,
+		Remote:    remote,
+	}
+}
+
+func newSetChange(object *GenericObject, store Storage, syncStatus *SyncStatus, remote bool) *Change {
 	return &Change{
-		Type:   ChangeTypeSet,
-		Object: remoteObject,
-		Store:  local,
-		SyncStatus: &SyncStatus{
-			ID:         remoteObject.ID,
-			LocalHash:  remoteObject.Hash,
-			RemoteHash: remoteObject.Hash,
-		}}
+		Type:       ChangeTypeSet,
+		Object:     object,
+		Store:      store,
+		SyncStatus: syncStatus,
+		Remote:     remote,
+	}
+}
+
+func newSyncStatus(object *GenericObject) *SyncStatus {
+	return &SyncStatus{
+		ID:         object.ID,
+		LocalHash:  object.Hash,
+		RemoteHash: object.Hash,
+		Version:    object.Version.Copy(),
+	}
+}
+
+// setStatusHash will record the hash the storage reported for the object
+// it was given by change, if it differs from the one already stored
+func setStatusHash(ctx context.Context, status StatusStorage, change *Change, hash Hash) error {
+	side := &change.SyncStatus.LocalHash
+	if change.Remote {
+		side = &change.SyncStatus.RemoteHash
+	}
+	if bytes.Equal(*side, hash) {
+		return nil
+	}
+	*side = hash
+	return status.Set(ctx, change.SyncStatus)
 }
 
 func wasFound(err error) (bool, error) {
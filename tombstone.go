@@ -0,0 +1,217 @@
+package objectsync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+)
+
+// Tombstone records the deletion of an object
+type Tombstone struct {
+	ID string
+	// Hash is the hash of the object when it was deleted
+	Hash    Hash
+	Deleted time.Time
+	// Origin is the name of the storage the object was first deleted from
+	Origin string
+}
+
+// TombstoneStorage is implemented by a Storage that keeps tombstones of its
+// deleted objects.  Setting an object removes its tombstone.
+type TombstoneStorage interface {
+	GetTombstone(ctx context.Context, id string) (*Tombstone, error)
+	GetAllTombstones(ctx context.Context) ([]*Tombstone, error)
+	// SetTombstone will delete the object and record the tombstone in its place
+	SetTombstone(ctx context.Context, tombstone *Tombstone) error
+	DeleteTombstone(ctx context.Context, id string) error
+}
+
+// InMemoryTombstoneStorage is an InMemoryStorage that leaves a tombstone of
+// each object it deletes
+type InMemoryTombstoneStorage struct {
+	*InMemoryStorage
+	tombstones map[string]*Tombstone
+}
+
+// NewInMemoryTombstoneStorage ...
+func NewInMemoryTombstoneStorage(name string) *InMemoryTombstoneStorage {
+	tombstones := make(map[string]*Tombstone)
+	return &InMemoryTombstoneStorage{InMemoryStorage: NewInMemoryStorage(name), tombstones: tombstones}
+}
+
+// Set ...
+func (s *InMemoryTombstoneStorage) Set(ctx context.Context, object *GenericObject) error {
+	delete(s.tombstones, object.ID)
+	return s.InMemoryStorage.Set(ctx, object)
+}
+
+// Delete will remove a entry from the storage, leaving a tombstone
+func (s *InMemoryTombstoneStorage) Delete(ctx context.Context, id string) error {
+	object, ok := s.idIndex[id]
+	if !ok {
+		return nil
+	}
+
+	s.tombstones[id] = &Tombstone{
+		ID:      id,
+		Hash:    object.Hash,
+		Deleted: time.Now().UTC(),
+		Origin:  s.name,
+	}
+	return s.InMemoryStorage.Delete(ctx, id)
+}
+
+// GetTombstone ...
+func (s *InMemoryTombstoneStorage) GetTombstone(ctx context.Context, id string) (*Tombstone, error) {
+	tombstone, ok := s.tombstones[id]
+	if !ok {
+		return nil, ErrorNotFound
+	}
+
+	return tombstone, nil
+}
+
+// GetAllTombstones ...
+func (s *InMemoryTombstoneStorage) GetAllTombstones(ctx context.Context) ([]*Tombstone, error) {
+	tombstones := make([]*Tombstone, len(s.tombstones))
+	i := 0
+	for _, tombstone := range s.tombstones {
+		tombstones[i] = tombstone
+		i++
+	}
+
+	return tombstones, nil
+}
+
+// SetTombstone ...
+func (s *InMemoryTombstoneStorage) SetTombstone(ctx context.Context, tombstone *Tombstone) error {
+	err := s.InMemoryStorage.Delete(ctx, tombstone.ID)
+	if err != nil {
+		return err
+	}
+	t := *tombstone
+	s.tombstones[tombstone.ID] = &t
+	return nil
+}
+
+// DeleteTombstone ...
+func (s *InMemoryTombstoneStorage) DeleteTombstone(ctx context.Context, id string) error {
+	delete(s.tombstones, id)
+	return nil
+}
+
+// CollectTombstones will remove the tombstones of store that are older than retention
+func CollectTombstones(ctx context.Context, store Storage, retention time.Duration) error {
+	tombstones, ok := store.(TombstoneStorage)
+	if !ok {
+		return nil
+	}
+
+	all, err := tombstones.GetAllTombstones(ctx)
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().UTC().Add(-retention)
+	for _, tombstone := range all {
+		if tombstone.Deleted.Before(cutoff) {
+			err = tombstones.DeleteTombstone(ctx, tombstone.ID)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Collected tombstone: %v From: %s\n", tombstone.ID, store.GetName())
+		}
+	}
+	return nil
+}
+
+// absentChanges will return the changes for an object found on only one side.
+// It is either new, and added to the other side, or deleted on the other side.
+// With tombstones enabled, a deletion is only propagated if the object has not
+// changed since, otherwise it is a conflict.
+func absentChanges(ctx context.Context, p *pair, local, remote Storage, o *options) ([]*Change, error) {
+	present, presentStored, presentStore, missingStore := p.local, p.localStored, local, remote
+	var statusHash Hash
+	if p.status != nil {
+		statusHash = p.status.LocalHash
+	}
+	if p.local == nil {
+		present, presentStored, presentStore, missingStore = p.remote, p.remoteStored, remote, local
+		if p.status != nil {
+			statusHash = p.status.RemoteHash
+		}
+	}
+
+	tombstone, err := getTombstone(ctx, missingStore, present.ID, o)
+	if err != nil {
+		return nil, err
+	}
+	if p.local == nil {
+		p.localTombstone = tombstone
+	} else {
+		p.remoteTombstone = tombstone
+	}
+
+	switch {
+	case p.status == nil && tombstone == nil:
+		fmt.Printf("We should add [%s] to %s\n", present.ID, missingStore.GetName())
+		return reconcile(present, p, local, remote), nil
+	case p.status == nil && bytes.Equal(tombstone.Hash, present.Hash),
+		p.status != nil && bytes.Equal(presentStored.Hash, statusHash),
+		p.status != nil && !o.tombstones:
+		fmt.Printf("We should delete [%s] from %s\n", present.ID, presentStore.GetName())
+		return []*Change{newDeleteChange(presentStored, presentStore, tombstone, p.local == nil)}, nil
+	}
+
+	fmt.Printf("Deleted on %s but changed on %s.  Invoke conflict resolution.\n", missingStore.GetName(), presentStore.GetName())
+	return resolveChanges(ctx, p, local, remote, o)
+}
+
+// getTombstone will return the tombstone of id in store, or nil if tombstones
+// are disabled or none is kept
+func getTombstone(ctx context.Context, store Storage, id string, o *options) (*Tombstone, error) {
+	tombstones, ok := store.(TombstoneStorage)
+	if !o.tombstones || !ok {
+		return nil, nil
+	}
+
+	tombstone, err := tombstones.GetTombstone(ctx, id)
+	found, err := wasFound(err)
+	if err != nil || !found {
+		return nil, err
+	}
+	return tombstone, nil
+}
+
+// deleteObject will delete the object and its status from store, carrying
+// over the tombstone of the original deletion if there is one
+func deleteObject(ctx context.Context, store Storage, id string, tombstone *Tombstone, status StatusStorage, o *options) error {
+	var err error
+	tombstones, ok := store.(TombstoneStorage)
+	ts, transactional := store.(TransactionalStorage)
+	switch {
+	case o.tombstones && ok && tombstone != nil:
+		err = tombstones.SetTombstone(ctx, tombstone)
+	case transactional && ts.SupportsStatus(status):
+		return ts.DeleteWithStatus(ctx, id, status)
+	default:
+		err = store.Delete(ctx, id)
+	}
+	if err != nil {
+		return err
+	}
+	return status.Delete(ctx, id)
+}
+
+func collectTombstones(ctx context.Context, local, remote Storage, o *options) error {
+	if !o.tombstones || o.tombstoneRetention <= 0 {
+		return nil
+	}
+
+	err := CollectTombstones(ctx, local, o.tombstoneRetention)
+	if err != nil {
+		return err
+	}
+	return CollectTombstones(ctx, remote, o.tombstoneRetention)
+}
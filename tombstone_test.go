@@ -0,0 +1,221 @@
+package objectsync
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Check the interfaces
+var _ TombstoneStorage = &InMemoryTombstoneStorage{}
+
+func TestTombstones(t *testing.T) {
+
+	ctx := context.TODO()
+
+	setup := func(t *testing.T, opts ...Option) (*InMemoryTombstoneStorage, *InMemoryTombstoneStorage, StatusStorage) {
+		status := NewInMemoryStatusStorage()
+		store1 := NewInMemoryTombstoneStorage("local")
+		store2 := NewInMemoryTombstoneStorage("remote")
+
+		err := store1.Set(ctx, &GenericObject{ID: "object", Value: "first", Modified: time.Now().UTC().Add(-time.Hour)})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		return store1, store2, status
+	}
+
+	t.Run("DeleteThenModify", func(t *testing.T) {
+		opts := []Option{WithTombstones(0)}
+		store1, store2, status := setup(t, opts...)
+
+		err := store2.Delete(ctx, "object")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = store1.Set(ctx, &GenericObject{ID: "object", Value: "changed", Modified: time.Now().UTC().Add(time.Minute)})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// The change is newer than the deletion, so the object is restored
+		err = Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		checkValues(ctx, t, "object", "changed", "changed", store1, store2)
+	})
+
+	t.Run("ModifyThenDelete", func(t *testing.T) {
+		opts := []Option{WithTombstones(0)}
+		store1, store2, status := setup(t, opts...)
+
+		err := store1.Set(ctx, &GenericObject{ID: "object", Value: "changed", Modified: time.Now().UTC().Add(-time.Minute)})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = store2.Delete(ctx, "object")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		err = Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		checkStore(ctx, store1, 0, nil, t)
+		checkStore(ctx, store2, 0, nil, t)
+
+		// The tombstone is carried over with its origin
+		tombstone, err := store1.GetTombstone(ctx, "object")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if tombstone.Origin != "remote" {
+			t.Errorf("Unexpected origin = %s expected %s", tombstone.Origin, "remote")
+		}
+	})
+
+	t.Run("DeferDeleteConflict", func(t *testing.T) {
+		conflicts := NewInMemoryConflictStorage()
+		opts := []Option{WithTombstones(0), WithConflictResolver(DeferConflicts), WithConflictStorage(conflicts)}
+		store1, store2, status := setup(t, opts...)
+
+		store1.Set(ctx, &GenericObject{ID: "object", Value: "changed", Modified: time.Now().UTC()})
+		store2.Delete(ctx, "object")
+
+		err := Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		conflict, err := conflicts.Get(ctx, "object")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if conflict.Remote != nil || conflict.RemoteTombstone == nil {
+			t.Fatalf("Expected conflict with a remote deletion, got %+v", conflict)
+		}
+
+		queue, err := NewConflictQueue(store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = queue.ResolveRemote(ctx, "object")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		checkStore(ctx, store1, 0, nil, t)
+		checkStore(ctx, store2, 0, nil, t)
+	})
+
+	t.Run("WithoutTombstones", func(t *testing.T) {
+		store1, store2, status := setup(t)
+
+		store2.Delete(ctx, "object")
+		store1.Set(ctx, &GenericObject{ID: "object", Value: "changed", Modified: time.Now().UTC().Add(time.Minute)})
+
+		// The change is lost to the deletion
+		err := Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		checkStore(ctx, store1, 0, nil, t)
+		checkStore(ctx, store2, 0, nil, t)
+	})
+
+	t.Run("WithoutTombstoneStorage", func(t *testing.T) {
+		opts := []Option{WithTombstones(0)}
+		status := NewInMemoryStatusStorage()
+		store1 := NewInMemoryStorage("local")
+		store2 := NewInMemoryStorage("remote")
+		store1.Set(ctx, &GenericObject{ID: "object", Value: "first", Modified: time.Now().UTC().Add(-time.Hour)})
+		err := Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		store2.Delete(ctx, "object")
+		store1.Set(ctx, &GenericObject{ID: "object", Value: "changed", Modified: time.Now().UTC()})
+
+		// Without a tombstone the deletion is not known, so the object is restored
+		err = Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		checkValues(ctx, t, "object", "changed", "changed", store1, store2)
+	})
+
+	t.Run("NWay", func(t *testing.T) {
+		opts := []Option{WithTombstones(0)}
+		store1, store2, _ := setup(t, opts...)
+
+		// A third replica that has only synced with remote
+		store3 := NewInMemoryTombstoneStorage("third")
+		status23 := NewInMemoryStatusStorage()
+		err := Sync(ctx, store2, store3, status23, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		err = store2.Delete(ctx, "object")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = Sync(ctx, store2, store3, status23, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		checkStore(ctx, store3, 0, nil, t)
+
+		// local and third sync for the first time, the deletion must not be undone
+		err = Sync(ctx, store1, store3, NewInMemoryStatusStorage(), opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		checkStore(ctx, store1, 0, nil, t)
+		checkStore(ctx, store3, 0, nil, t)
+	})
+
+	t.Run("Collect", func(t *testing.T) {
+		opts := []Option{WithTombstones(24 * time.Hour)}
+		store1, store2, status := setup(t, opts...)
+
+		err := store1.SetTombstone(ctx, &Tombstone{ID: "object", Deleted: time.Now().UTC().Add(-48 * time.Hour), Origin: "local"})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = store1.Set(ctx, &GenericObject{ID: "recent", Value: "recent", Modified: time.Now().UTC()})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = store1.Delete(ctx, "recent")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		err = Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		checkStore(ctx, store2, 0, nil, t)
+
+		// The old tombstone is collected on both sides, the recent one is kept
+		for store, want := range map[*InMemoryTombstoneStorage]int{store1: 1, store2: 0} {
+			tombstones, err := store.GetAllTombstones(ctx)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if len(tombstones) != want {
+				t.Errorf("Incorrect tombstones len = %v, want %v in %s", len(tombstones), want, store.GetName())
+			}
+		}
+		_, err = store1.GetTombstone(ctx, "recent")
+		if err != nil {
+			t.Errorf("Error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,28 @@
+package objectsync
+
+import "context"
+
+// TransactionalStorage is implemented by a Storage that can write the sync
+// status in the same transaction as the object it describes.  Sync uses it
+// whenever the StatusStorage is supported, so a failure can not leave an
+// object written without its status.
+type TransactionalStorage interface {
+	Storage
+	// SupportsStatus will return true if status can share transactions with the storage
+	SupportsStatus(status StatusStorage) bool
+	SetWithStatus(ctx context.Context, object *GenericObject, status StatusStorage, syncStatus *SyncStatus) error
+	DeleteWithStatus(ctx context.Context, id string, status StatusStorage) error
+}
+
+// setObject will set the object and its status
+func setObject(ctx context.Context, store Storage, object *GenericObject, status StatusStorage, syncStatus *SyncStatus) error {
+	if ts, ok := store.(TransactionalStorage); ok && ts.SupportsStatus(status) {
+		return ts.SetWithStatus(ctx, object, status, syncStatus)
+	}
+
+	err := setValue(ctx, store, object)
+	if err != nil {
+		return err
+	}
+	return status.Set(ctx, syncStatus)
+}
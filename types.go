@@ -17,6 +17,19 @@ type GenericObject struct {
 	Hash     Hash
 	Modified time.Time
 	Value    string
+	// Version is the causal history of the object, maintained by Sync when
+	// causality tracking is enabled.  VersionHash is the hash of the content
+	// the version was assigned to.  Storage must persist both fields.
+	Version     VersionVector
+	VersionHash Hash
+	// Signature is the signature of the replica the value came from, kept
+	// by a SignedStorage so it travels with the object through Sync.
+	// Storage should persist it along with the other fields.
+	Signature *ObjectSignature
+
+	// source is the storage to read Value from, if the object was listed
+	// without it
+	source Storage
 }
 
 // SyncStatus is a status of the last sync for items
@@ -24,6 +37,7 @@ type SyncStatus struct {
 	ID         string
 	LocalHash  Hash
 	RemoteHash Hash
+	Version    VersionVector
 }
 
 // ChangeType represents what change should be performed
@@ -31,10 +45,12 @@ type ChangeType string
 
 // Types of changes that can be done during a sync
 const (
-	ChangeTypeSet          ChangeType = "set"
-	ChangeTypeDelete       ChangeType = "delete"
-	ChangeTypeDeleteStatus ChangeType = "delete_status"
-	ChangeTypeSetStatus    ChangeType = "set_status"
+	ChangeTypeSet           ChangeType = "set"
+	ChangeTypeDelete        ChangeType = "delete"
+	ChangeTypeDeleteStatus  ChangeType = "delete_status"
+	ChangeTypeSetStatus     ChangeType = "set_status"
+	ChangeTypeDeferConflict ChangeType = "defer_conflict"
+	ChangeTypeDropConflict  ChangeType = "drop_conflict"
 )
 
 // Change is a change
@@ -44,11 +60,23 @@ type Change struct {
 	Object     *GenericObject
 	Store      Storage
 	SyncStatus *SyncStatus
+	Conflict   *Conflict
+	Tombstone  *Tombstone
+	// Remote is true if Store is the remote storage
+	Remote bool
 }
 
 // ErrorNotFound ...
 var ErrorNotFound = errors.New("not found")
 
+// ErrorConflictDeferred is returned by a ConflictResolver to leave a conflict
+// for manual resolution
+var ErrorConflictDeferred = errors.New("conflict deferred")
+
+// ErrorPreconditionFailed is returned by a Storage when a conditional write
+// finds the object changed since it was last read
+var ErrorPreconditionFailed = errors.New("precondition failed")
+
 // IsNotFoundError ...
 func IsNotFoundError(err error) bool {
 	return err.Error() == ErrorNotFound.Error()
@@ -0,0 +1,381 @@
+// Package vdirstorage implements objectsync storage on a vdir, the directory
+// layout vdirsyncer and other calendar and contact tools share.  Each
+// collection is a directory holding one .ics or .vcf file per item.
+package vdirstorage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/keithballdotnet/objectsync"
+	"github.com/keithballdotnet/objectsync/internal/vobject"
+)
+
+// Extensions of the item files
+const (
+	ExtensionCalendar = ".ics"
+	ExtensionContacts = ".vcf"
+)
+
+// metadataDir is the hidden directory of a collection keeping the versions
+// of its items, out of the way of other tools
+const metadataDir = ".objectsync"
+
+// safeName matches the UIDs that can be used as file names as they are
+var safeName = regexp.MustCompile(`^[A-Za-z0-9_.@+-]+$`)
+
+// Collections will return the collection directories in root
+func Collections(root string) ([]string, error) {
+	files, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	collections := []string{}
+	for _, file := range files {
+		if file.IsDir() && !strings.HasPrefix(file.Name(), ".") {
+			collections = append(collections, filepath.Join(root, file.Name()))
+		}
+	}
+	return collections, nil
+}
+
+// VdirStorage is an objectsync.Storage keeping items in a vdir collection.
+//
+// The ID of an item is its UID, and the file of a new item is named after
+// it.  Files written by other tools may have any name, and items without a
+// UID are known by their file name.  The Hash ignores the volatile
+// properties PRODID and DTSTAMP, so an item rewritten by another tool with
+// only those changed is not synced again.
+//
+// The file of each item is kept in an index built when the items are
+// listed, so items not under the name they would be given are found without
+// reading every file.
+type VdirStorage struct {
+	dir       string
+	extension string
+
+	// files are the file names per ID, nil until the items are listed
+	files map[string]string
+}
+
+// NewVdirStorage will return a VdirStorage for the collection in dir, which
+// is created if needed.  Only files with extension are items.
+func NewVdirStorage(dir, extension string) (*VdirStorage, error) {
+	err := os.MkdirAll(filepath.Join(dir, metadataDir), 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &VdirStorage{dir: dir, extension: extension}, nil
+}
+
+// GetName will return the directory
+func (s *VdirStorage) GetName() string {
+	return s.dir
+}
+
+// Hash will return the hash of an item, ignoring its volatile properties
+func Hash(value string) objectsync.Hash {
+	return objectsync.NewHash(vobject.Normalize(value))
+}
+
+// name will return the file name for the item with id
+func (s *VdirStorage) name(id string) string {
+	if safeName.MatchString(id) && !strings.HasPrefix(id, ".") {
+		return id + s.extension
+	}
+	hash := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(hash[:16]) + s.extension
+}
+
+// id will return the ID of the item in the file name with value
+func (s *VdirStorage) id(name, value string) string {
+	if uid := vobject.UID(value); uid != "" {
+		return uid
+	}
+	return strings.TrimSuffix(name, s.extension)
+}
+
+// metadata is kept for the items with a version or signature.  A signature
+// covers the modified time, which the file does not keep, so it is kept here
+// too.
+type metadata struct {
+	Version     objectsync.VersionVector
+	VersionHash objectsync.Hash
+	Signature   *objectsync.ObjectSignature `json:",omitempty"`
+	Modified    time.Time                   `json:",omitzero"`
+}
+
+func newMetadata(object *objectsync.GenericObject) *metadata {
+	m := &metadata{Version: object.Version, VersionHash: object.VersionHash, Signature: object.Signature}
+	if object.Signature != nil {
+		m.Modified = object.Modified
+	}
+	return m
+}
+
+// apply will set the metadata on the object read
+func (m *metadata) apply(object *objectsync.GenericObject) {
+	object.Version, object.VersionHash, object.Signature = m.Version, m.VersionHash, m.Signature
+	if m.Signature != nil && !m.Modified.IsZero() {
+		object.Modified = m.Modified
+	}
+}
+
+// Set will write the item to its file, replacing it atomically
+func (s *VdirStorage) Set(ctx context.Context, object *objectsync.GenericObject) error {
+	name, err := s.find(object.ID)
+	if err != nil && objectsync.IsNotFoundError(err) {
+		name, err = s.name(object.ID), nil
+	}
+	if err != nil {
+		return err
+	}
+	if id := s.id(name, object.Value); id != object.ID {
+		return fmt.Errorf("vdir: item %s would be read back as %s, its ID must be its UID", object.ID, id)
+	}
+
+	hash := Hash(object.Value)
+	if object.Version != nil || object.Signature != nil {
+		// The version belongs to this content, whatever its hash elsewhere
+		if string(object.VersionHash) == string(objectsync.NewHash(object.Value)) {
+			object.VersionHash = hash
+		}
+		data, err := json.Marshal(newMetadata(object))
+		if err != nil {
+			return err
+		}
+		err = writeFile(filepath.Join(s.dir, metadataDir), name, data)
+		if err != nil {
+			return err
+		}
+	} else {
+		err = os.Remove(filepath.Join(s.dir, metadataDir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	err = writeFile(s.dir, name, []byte(object.Value))
+	if err != nil {
+		return err
+	}
+	if s.files != nil {
+		s.files[object.ID] = name
+	}
+	object.Hash = hash
+	return nil
+}
+
+// Get will read the item with the UID id
+func (s *VdirStorage) Get(ctx context.Context, id string) (*objectsync.GenericObject, error) {
+	name, err := s.find(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.read(name)
+}
+
+// GetAll will return all items
+func (s *VdirStorage) GetAll(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	names, err := s.names()
+	if err != nil {
+		return nil, err
+	}
+
+	all := objectsync.GenericObjectCollection{}
+	files := make(map[string]string, len(names))
+	for _, name := range names {
+		object, err := s.read(name)
+		if err != nil {
+			if objectsync.IsNotFoundError(err) {
+				continue
+			}
+			return nil, err
+		}
+		all = append(all, object)
+		files[object.ID] = name
+	}
+	s.files = files
+	return all, nil
+}
+
+// Delete will remove the file of the item
+func (s *VdirStorage) Delete(ctx context.Context, id string) error {
+	name, err := s.find(id)
+	if err != nil {
+		if objectsync.IsNotFoundError(err) {
+			return nil
+		}
+		return err
+	}
+
+	err = os.Remove(filepath.Join(s.dir, name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err = os.Remove(filepath.Join(s.dir, metadataDir, name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(s.files, id)
+	return nil
+}
+
+// find will return the file name of the item with id.  Items are looked for
+// under the name they would be given first, then in the index, which is
+// built if the items have not been listed yet or it is out of date.
+func (s *VdirStorage) find(id string) (string, error) {
+	name := s.name(id)
+	object, err := s.read(name)
+	if err == nil && object.ID == id {
+		return name, nil
+	}
+	if err != nil && !objectsync.IsNotFoundError(err) {
+		return "", err
+	}
+
+	if s.files == nil {
+		err = s.index()
+		if err != nil {
+			return "", err
+		}
+	}
+	for rebuilt := false; ; rebuilt = true {
+		name, ok := s.files[id]
+		if !ok {
+			return "", objectsync.ErrorNotFound
+		}
+
+		// The file may have been moved by another tool since, so the index
+		// is built again once
+		value, err := os.ReadFile(filepath.Join(s.dir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		if err == nil && s.id(name, string(value)) == id {
+			return name, nil
+		}
+		delete(s.files, id)
+		if rebuilt {
+			return "", objectsync.ErrorNotFound
+		}
+		err = s.index()
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// index will build the index of the files of the items
+func (s *VdirStorage) index() error {
+	names, err := s.names()
+	if err != nil {
+		return err
+	}
+
+	files := make(map[string]string, len(names))
+	for _, name := range names {
+		value, err := os.ReadFile(filepath.Join(s.dir, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		files[s.id(name, string(value))] = name
+	}
+	s.files = files
+	return nil
+}
+
+// names will return the names of the item files
+func (s *VdirStorage) names() ([]string, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") || !strings.HasSuffix(file.Name(), s.extension) {
+			continue
+		}
+		names = append(names, file.Name())
+	}
+	return names, nil
+}
+
+func (s *VdirStorage) read(name string) (*objectsync.GenericObject, error) {
+	path := filepath.Join(s.dir, name)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, objectsync.ErrorNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	value, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, objectsync.ErrorNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	object := &objectsync.GenericObject{
+		ID:       s.id(name, string(value)),
+		Hash:     Hash(string(value)),
+		Modified: info.ModTime().UTC(),
+		Value:    string(value),
+	}
+	return object, s.readMetadata(name, object)
+}
+
+func (s *VdirStorage) readMetadata(name string, object *objectsync.GenericObject) error {
+	data, err := os.ReadFile(filepath.Join(s.dir, metadataDir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	m := &metadata{}
+	err = json.Unmarshal(data, m)
+	if err != nil {
+		return err
+	}
+	m.apply(object)
+	return nil
+}
+
+// writeFile will write data to name in dir atomically, so other tools never
+// read a partial item
+func writeFile(dir, name string, data []byte) error {
+	tmp, err := os.CreateTemp(dir, ".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(dir, name))
+}
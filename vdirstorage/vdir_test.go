@@ -0,0 +1,236 @@
+package vdirstorage
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keithballdotnet/objectsync"
+)
+
+// Check the interfaces
+var _ objectsync.Storage = &VdirStorage{}
+
+func event(uid, summary, stamp string) string {
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//objectsync//" + stamp + "//EN\r\nBEGIN:VEVENT\r\nUID:" + uid + "\r\nDTSTAMP:" + stamp + "\r\nSUMMARY:" + summary + "\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+}
+
+func TestVdirStorage(t *testing.T) {
+
+	ctx := context.TODO()
+
+	t.Run("SetGet", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "work")
+		store, err := NewVdirStorage(dir, ExtensionCalendar)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		object := &objectsync.GenericObject{ID: "meeting@example.com", Value: event("meeting@example.com", "Meeting", "20260101T000000Z")}
+		err = store.Set(ctx, object)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = os.Stat(filepath.Join(dir, "meeting@example.com.ics"))
+		if err != nil {
+			t.Errorf("Expected file named by UID: %v", err)
+		}
+
+		// UIDs that are not safe file names are hashed
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "a/b c", Value: event("a/b c", "Unsafe", "20260101T000000Z")})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// Files written by other tools may have any name
+		err = os.WriteFile(filepath.Join(dir, "other.ics"), []byte(event("other@example.com", "Other", "20260101T000000Z")), 0600)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = os.WriteFile(filepath.Join(dir, "displayname"), []byte("Work"), 0600)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		all, err := store.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 3 {
+			t.Errorf("Incorrect len = %v, want 3", len(all))
+		}
+		for _, id := range []string{"meeting@example.com", "a/b c", "other@example.com"} {
+			object, err := store.Get(ctx, id)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if object.ID != id || !strings.Contains(object.Value, "UID:"+id) {
+				t.Errorf("Unexpected object = %+v", object)
+			}
+		}
+
+		err = store.Delete(ctx, "other@example.com")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = store.Get(ctx, "other@example.com")
+		if !objectsync.IsNotFoundError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "wrong", Value: event("right", "Wrong", "20260101T000000Z")})
+		if err == nil {
+			t.Errorf("Expected error for ID that is not the UID")
+		}
+
+		// Items moved by other tools are found again
+		err = os.Rename(filepath.Join(dir, store.name("a/b c")), filepath.Join(dir, "moved.ics"))
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		object, err = store.Get(ctx, "a/b c")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if object.ID != "a/b c" {
+			t.Errorf("Unexpected object = %+v", object)
+		}
+	})
+
+	t.Run("Hash", func(t *testing.T) {
+		a := event("a", "Meeting", "20260101T000000Z")
+		b := event("a", "Meeting", "20260202T000000Z")
+		if string(Hash(a)) != string(Hash(b)) {
+			t.Errorf("Expected PRODID and DTSTAMP to be ignored")
+		}
+		if string(Hash(a)) == string(Hash(event("a", "Changed", "20260101T000000Z"))) {
+			t.Errorf("Expected SUMMARY to change the hash")
+		}
+
+		// Folded lines hash the same as unfolded ones
+		folded := strings.Replace(a, "SUMMARY:Meeting", "SUMMARY:Mee\r\n ting", 1)
+		if string(Hash(a)) != string(Hash(folded)) {
+			t.Errorf("Expected folding to be ignored")
+		}
+	})
+
+	t.Run("Collections", func(t *testing.T) {
+		root := t.TempDir()
+		for _, name := range []string{"work", "home"} {
+			_, err := NewVdirStorage(filepath.Join(root, name), ExtensionCalendar)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+		}
+		collections, err := Collections(root)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(collections) != 2 {
+			t.Errorf("Unexpected collections = %v", collections)
+		}
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		store1, err := NewVdirStorage(filepath.Join(t.TempDir(), "work"), ExtensionCalendar)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		store2 := objectsync.NewInMemoryStorage("remote")
+		status := objectsync.NewInMemoryStatusStorage()
+
+		for i := 0; i < 3; i++ {
+			id := fmt.Sprintf("local%v", i)
+			store1.Set(ctx, &objectsync.GenericObject{ID: id, Value: event(id, "Local", "20260101T000000Z"), Modified: time.Now().UTC()})
+			id = fmt.Sprintf("remote%v", i)
+			store2.Set(ctx, &objectsync.GenericObject{ID: id, Value: event(id, "Remote", "20260101T000000Z"), Modified: time.Now().UTC()})
+		}
+
+		opts := []objectsync.Option{objectsync.WithCausality("local", "remote")}
+		err = objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// Another tool only touching the DTSTAMP is not a change
+		name := filepath.Join(store1.GetName(), "remote1.ics")
+		err = os.WriteFile(name, []byte(event("remote1", "Remote", "20260303T000000Z")), 0600)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		store2.Set(ctx, &objectsync.GenericObject{ID: "local1", Value: event("local1", "Changed", "20260101T000000Z"), Modified: time.Now().UTC()})
+		before, _ := store2.Get(ctx, "remote1")
+
+		err = objectsync.Sync(ctx, store1, store2, status, opts...)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		after, _ := store2.Get(ctx, "remote1")
+		if before != after {
+			t.Errorf("Unexpected write of [remote1] to remote")
+		}
+		object, err := store1.Get(ctx, "local1")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if !strings.Contains(object.Value, "SUMMARY:Changed") {
+			t.Errorf("Unexpected value = %s", object.Value)
+		}
+		all, _ := store1.GetAll(ctx)
+		if len(all) != 6 {
+			t.Errorf("Incorrect len = %v, want 6", len(all))
+		}
+	})
+
+	t.Run("Signed", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "work")
+		store, err := NewVdirStorage(dir, ExtensionCalendar)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		public, key, _ := ed25519.GenerateKey(nil)
+		modified := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+		signer := objectsync.NewSignedStorage(store, "local", key, nil)
+		err = signer.Set(ctx, &objectsync.GenericObject{ID: "meeting@example.com", Value: event("meeting@example.com", "Meeting", "20260101T000000Z"), Modified: modified, Version: objectsync.VersionVector{"local": 1}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// The signature is kept, with the time it covers, so the object
+		// verifies when read again
+		verifier := func() *objectsync.SignedStorage {
+			reader, _ := NewVdirStorage(dir, ExtensionCalendar)
+			return objectsync.NewSignedStorage(reader, "remote", nil, map[string]ed25519.PublicKey{"local": public})
+		}
+		got, err := verifier().Get(ctx, "meeting@example.com")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if got.Signature == nil || got.Signature.Replica != "local" || !got.Modified.Equal(modified) {
+			t.Errorf("Unexpected object = %+v", got)
+		}
+		all, err := verifier().GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 1 {
+			t.Errorf("Incorrect len = %v, want 1", len(all))
+		}
+
+		// Written again without one, it no longer verifies
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "meeting@example.com", Value: event("meeting@example.com", "Moved", "20260101T000000Z"), Modified: modified, Version: objectsync.VersionVector{"local": 2}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = verifier().Get(ctx, "meeting@example.com")
+		if !objectsync.IsVerificationError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+}
@@ -0,0 +1,527 @@
+package objectsync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// originKey is the context key of the origin of a write
+type originKey struct{}
+
+// WithOrigin will return a context marking the writes made with it as coming
+// from the storage named origin.  Sync marks each change it applies with the
+// name of the storage on the other side.
+func WithOrigin(ctx context.Context, origin string) context.Context {
+	return context.WithValue(ctx, originKey{}, origin)
+}
+
+// OriginFromContext will return the origin set with WithOrigin, if any
+func OriginFromContext(ctx context.Context) (string, bool) {
+	origin, ok := ctx.Value(originKey{}).(string)
+	return origin, ok
+}
+
+// ObjectVersion is a version of an object kept by a VersionedStorage
+type ObjectVersion struct {
+	ID       string
+	Hash     Hash
+	Modified time.Time
+	Value    string
+	Version  VersionVector
+	// Origin is the name of the storage the version came from
+	Origin string
+	// Written is when the version was written, and Deleted is true if the
+	// object was deleted then
+	Written time.Time
+	Deleted bool
+}
+
+// VersionStorage keeps the versions of objects, oldest first
+type VersionStorage interface {
+	// Set will replace the versions of an object, removing them if empty
+	Set(ctx context.Context, id string, versions []*ObjectVersion) error
+	// Get will return the versions of an object, or none
+	Get(ctx context.Context, id string) ([]*ObjectVersion, error)
+	GetIDs(ctx context.Context) ([]string, error)
+}
+
+// InMemoryVersionStorage ...
+type InMemoryVersionStorage struct {
+	db map[string][]*ObjectVersion
+}
+
+// NewInMemoryVersionStorage ...
+func NewInMemoryVersionStorage() *InMemoryVersionStorage {
+	db := make(map[string][]*ObjectVersion)
+	return &InMemoryVersionStorage{db: db}
+}
+
+// Set ...
+func (s *InMemoryVersionStorage) Set(ctx context.Context, id string, versions []*ObjectVersion) error {
+	if len(versions) == 0 {
+		delete(s.db, id)
+		return nil
+	}
+	s.db[id] = versions
+	return nil
+}
+
+// Get ...
+func (s *InMemoryVersionStorage) Get(ctx context.Context, id string) ([]*ObjectVersion, error) {
+	return s.db[id], nil
+}
+
+// GetIDs ...
+func (s *InMemoryVersionStorage) GetIDs(ctx context.Context) ([]string, error) {
+	ids := make([]string, 0, len(s.db))
+	for id := range s.db {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// VersionedOption configures a VersionedStorage
+type VersionedOption func(*VersionedStorage)
+
+// WithRetention will make a VersionedStorage keep at most count versions of
+// each object, and forget the versions replaced longer than age ago.  Zero
+// keeps them all.
+func WithRetention(count int, age time.Duration) VersionedOption {
+	return func(s *VersionedStorage) {
+		s.retainCount = count
+		s.retainAge = age
+	}
+}
+
+// VersionedStorage is a Storage that keeps the history of the objects it
+// keeps in another storage, so objects overwritten or deleted, such as by
+// the ConflictResolver of Sync, can be brought back.
+//
+// Every write and deletion is recorded as a version with the time it was
+// made and its origin, from WithOrigin or else the name of the storage.  An
+// object written before it was versioned gets a first version from the
+// storage when it is replaced.  Versions replaced longer ago than the
+// retention are forgotten, but the one current at the end of the retention
+// is kept, so the storage can be restored to any time within it.
+//
+// It lists, writes in batches, shares transactions with the status and keeps
+// tombstones when the storage it wraps does, recording the versions of those
+// writes too.  Over a storage that keeps no tombstones, a tombstone set is a
+// plain deletion and none are found.
+type VersionedStorage struct {
+	store    Storage
+	versions VersionStorage
+
+	retainCount int
+	retainAge   time.Duration
+}
+
+// NewVersionedStorage will return a VersionedStorage keeping its objects in
+// store, and their versions in versions
+func NewVersionedStorage(store Storage, versions VersionStorage, opts ...VersionedOption) *VersionedStorage {
+	s := &VersionedStorage{store: store, versions: versions}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// GetName ...
+func (s *VersionedStorage) GetName() string {
+	return s.store.GetName()
+}
+
+// Set will set the object, and record it as a version
+func (s *VersionedStorage) Set(ctx context.Context, object *GenericObject) error {
+	return s.set(ctx, object, func() error {
+		return s.store.Set(ctx, object)
+	})
+}
+
+// set will make the write of the object, and record it as a version
+func (s *VersionedStorage) set(ctx context.Context, object *GenericObject, write func() error) error {
+	err := s.recordUnversioned(ctx, object.ID)
+	if err != nil {
+		return err
+	}
+	err = write()
+	if err != nil {
+		return err
+	}
+	return s.record(ctx, object.ID, newObjectVersion(object))
+}
+
+// Get ...
+func (s *VersionedStorage) Get(ctx context.Context, id string) (*GenericObject, error) {
+	return s.store.Get(ctx, id)
+}
+
+// GetAll ...
+func (s *VersionedStorage) GetAll(ctx context.Context) (GenericObjectCollection, error) {
+	return s.store.GetAll(ctx)
+}
+
+// Delete will remove the object, and record its deletion as a version if it
+// existed
+func (s *VersionedStorage) Delete(ctx context.Context, id string) error {
+	return s.delete(ctx, id, func() error {
+		return s.store.Delete(ctx, id)
+	})
+}
+
+// delete will make the deletion of the object with id, and record it as a
+// version if the object existed
+func (s *VersionedStorage) delete(ctx context.Context, id string, remove func() error) error {
+	_, err := s.store.Get(ctx, id)
+	exists, err := wasFound(err)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return remove()
+	}
+
+	err = s.recordUnversioned(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = remove()
+	if err != nil {
+		return err
+	}
+	return s.record(ctx, id, &ObjectVersion{ID: id, Deleted: true})
+}
+
+// List will return all objects without their values if the storage is a
+// Lister, or else with them
+func (s *VersionedStorage) List(ctx context.Context) (GenericObjectCollection, error) {
+	if lister, ok := s.store.(Lister); ok {
+		return lister.List(ctx)
+	}
+	return s.store.GetAll(ctx)
+}
+
+// SetBatch will set the objects, in a batch if the storage is a BatchWriter,
+// and record each as a version
+func (s *VersionedStorage) SetBatch(ctx context.Context, objects []*GenericObject) error {
+	for _, object := range objects {
+		err := s.recordUnversioned(ctx, object.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if writer, ok := s.store.(BatchWriter); ok {
+		err = writer.SetBatch(ctx, objects)
+	} else {
+		for _, object := range objects {
+			err = s.store.Set(ctx, object)
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, object := range objects {
+		err = s.record(ctx, object.ID, newObjectVersion(object))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteBatch will remove the objects, in a batch if the storage is a
+// BatchWriter, and record the deletion of those that existed as a version
+func (s *VersionedStorage) DeleteBatch(ctx context.Context, ids []string) error {
+	var existing []string
+	for _, id := range ids {
+		_, err := s.store.Get(ctx, id)
+		exists, err := wasFound(err)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		err = s.recordUnversioned(ctx, id)
+		if err != nil {
+			return err
+		}
+		existing = append(existing, id)
+	}
+
+	var err error
+	if writer, ok := s.store.(BatchWriter); ok {
+		err = writer.DeleteBatch(ctx, ids)
+	} else {
+		for _, id := range ids {
+			err = s.store.Delete(ctx, id)
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, id := range existing {
+		err = s.record(ctx, id, &ObjectVersion{ID: id, Deleted: true})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SupportsStatus will return true if the storage is a TransactionalStorage
+// supporting status
+func (s *VersionedStorage) SupportsStatus(status StatusStorage) bool {
+	ts, ok := s.store.(TransactionalStorage)
+	return ok && ts.SupportsStatus(status)
+}
+
+// SetWithStatus will set the object with its status, and record it as a
+// version
+func (s *VersionedStorage) SetWithStatus(ctx context.Context, object *GenericObject, status StatusStorage, syncStatus *SyncStatus) error {
+	return s.set(ctx, object, func() error {
+		return s.store.(TransactionalStorage).SetWithStatus(ctx, object, status, syncStatus)
+	})
+}
+
+// DeleteWithStatus will remove the object with its status, and record its
+// deletion as a version if it existed
+func (s *VersionedStorage) DeleteWithStatus(ctx context.Context, id string, status StatusStorage) error {
+	return s.delete(ctx, id, func() error {
+		return s.store.(TransactionalStorage).DeleteWithStatus(ctx, id, status)
+	})
+}
+
+// GetTombstone will return the tombstone of the object if the storage is a
+// TombstoneStorage, or else ErrorNotFound
+func (s *VersionedStorage) GetTombstone(ctx context.Context, id string) (*Tombstone, error) {
+	if tombstones, ok := s.store.(TombstoneStorage); ok {
+		return tombstones.GetTombstone(ctx, id)
+	}
+	return nil, ErrorNotFound
+}
+
+// GetAllTombstones will return the tombstones if the storage is a
+// TombstoneStorage, or else none
+func (s *VersionedStorage) GetAllTombstones(ctx context.Context) ([]*Tombstone, error) {
+	if tombstones, ok := s.store.(TombstoneStorage); ok {
+		return tombstones.GetAllTombstones(ctx)
+	}
+	return nil, nil
+}
+
+// SetTombstone will delete the object, leaving the tombstone if the storage
+// is a TombstoneStorage, and record its deletion as a version if it existed
+func (s *VersionedStorage) SetTombstone(ctx context.Context, tombstone *Tombstone) error {
+	return s.delete(ctx, tombstone.ID, func() error {
+		if tombstones, ok := s.store.(TombstoneStorage); ok {
+			return tombstones.SetTombstone(ctx, tombstone)
+		}
+		return s.store.Delete(ctx, tombstone.ID)
+	})
+}
+
+// DeleteTombstone will remove the tombstone if the storage is a
+// TombstoneStorage
+func (s *VersionedStorage) DeleteTombstone(ctx context.Context, id string) error {
+	if tombstones, ok := s.store.(TombstoneStorage); ok {
+		return tombstones.DeleteTombstone(ctx, id)
+	}
+	return nil
+}
+
+// Versions will return the versions of an object, oldest first
+func (s *VersionedStorage) Versions(ctx context.Context, id string) ([]*ObjectVersion, error) {
+	return s.versions.Get(ctx, id)
+}
+
+// GetVersion will return the version of an object current at a time, or
+// ErrorNotFound if it did not exist then
+func (s *VersionedStorage) GetVersion(ctx context.Context, id string, at time.Time) (*ObjectVersion, error) {
+	versions, err := s.versions.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var current *ObjectVersion
+	for _, version := range versions {
+		if version.Written.After(at) {
+			break
+		}
+		current = version
+	}
+	if current == nil || current.Deleted {
+		return nil, ErrorNotFound
+	}
+	return current, nil
+}
+
+// Restore will bring an object back to its version current at a time, or
+// delete it if it did not exist then.  The restored object is a new write,
+// so Sync takes it to the other side.
+func (s *VersionedStorage) Restore(ctx context.Context, id string, at time.Time) error {
+	version, err := s.GetVersion(ctx, id, at)
+	found, err := wasFound(err)
+	if err != nil {
+		return err
+	}
+	current, err := s.store.Get(ctx, id)
+	exists, err := wasFound(err)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !found && exists:
+		fmt.Printf("Restore [%s] by deleting it\n", id)
+		return s.Delete(ctx, id)
+	case !found:
+		return nil
+	case exists && bytes.Equal(NewHash(current.Value), version.Hash):
+		return nil
+	}
+
+	restored := &GenericObject{
+		ID:       id,
+		Value:    version.Value,
+		Modified: time.Now().UTC(),
+	}
+	// Descend from the object replaced, so causality sees the restore as a
+	// new edit rather than an old version
+	if exists {
+		restored.Version = current.Version.Copy()
+	}
+	fmt.Printf("Restore [%s] to %v\n", id, version.Written)
+	return s.Set(ctx, restored)
+}
+
+// RestoreAll will restore every versioned object to a time
+func (s *VersionedStorage) RestoreAll(ctx context.Context, at time.Time) error {
+	ids, err := s.versions.GetIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		err = s.Restore(ctx, id, at)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prune will forget the versions beyond the retention
+func (s *VersionedStorage) Prune(ctx context.Context) error {
+	ids, err := s.versions.GetIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, id := range ids {
+		versions, err := s.versions.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		err = s.versions.Set(ctx, id, s.retain(versions, now))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// record will add version to the versions of the object with id
+func (s *VersionedStorage) record(ctx context.Context, id string, version *ObjectVersion) error {
+	versions, err := s.versions.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	version.Origin = s.origin(ctx)
+	version.Written = time.Now().UTC()
+	versions = s.retain(append(versions, version), version.Written)
+	return s.versions.Set(ctx, id, versions)
+}
+
+// recordUnversioned will record the object stored with id as its first
+// version, if it was written before it was versioned.  It is taken as written
+// when modified, or now if that is not known.
+func (s *VersionedStorage) recordUnversioned(ctx context.Context, id string) error {
+	versions, err := s.versions.Get(ctx, id)
+	if err != nil || len(versions) > 0 {
+		return err
+	}
+
+	object, err := s.store.Get(ctx, id)
+	found, err := wasFound(err)
+	if err != nil || !found {
+		return err
+	}
+
+	written := object.Modified
+	if written.IsZero() {
+		written = time.Now().UTC()
+	}
+	return s.versions.Set(ctx, id, []*ObjectVersion{{
+		ID:       id,
+		Hash:     NewHash(object.Value),
+		Modified: object.Modified,
+		Value:    object.Value,
+		Version:  object.Version.Copy(),
+		Origin:   s.store.GetName(),
+		Written:  written,
+	}})
+}
+
+// newObjectVersion will return the version of an object written
+func newObjectVersion(object *GenericObject) *ObjectVersion {
+	return &ObjectVersion{
+		ID:       object.ID,
+		Hash:     NewHash(object.Value),
+		Modified: object.Modified,
+		Value:    object.Value,
+		Version:  object.Version.Copy(),
+	}
+}
+
+func (s *VersionedStorage) origin(ctx context.Context) string {
+	if origin, ok := OriginFromContext(ctx); ok {
+		return origin
+	}
+	return s.store.GetName()
+}
+
+// retain will return the versions to keep by the retention.  The last one is
+// always kept, as is the one current at the end of the retention.
+func (s *VersionedStorage) retain(versions []*ObjectVersion, now time.Time) []*ObjectVersion {
+	if s.retainCount > 0 && len(versions) > s.retainCount {
+		versions = versions[len(versions)-s.retainCount:]
+	}
+	if s.retainAge > 0 {
+		cutoff := now.Add(-s.retainAge)
+		for len(versions) > 1 && versions[1].Written.Before(cutoff) {
+			versions = versions[1:]
+		}
+		// Nothing is left to restore once a deletion is beyond the retention
+		if len(versions) == 1 && versions[0].Deleted && versions[0].Written.Before(cutoff) {
+			return nil
+		}
+	}
+	return versions
+}
@@ -0,0 +1,290 @@
+package objectsync
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Check the interfaces
+var _ Storage = &VersionedStorage{}
+var _ Lister = &VersionedStorage{}
+var _ BatchWriter = &VersionedStorage{}
+var _ TransactionalStorage = &VersionedStorage{}
+var _ TombstoneStorage = &VersionedStorage{}
+var _ VersionStorage = &InMemoryVersionStorage{}
+
+func TestVersioned(t *testing.T) {
+
+	ctx := context.TODO()
+
+	// now will return the time, after the writes made so far
+	now := func() time.Time {
+		time.Sleep(time.Millisecond)
+		at := time.Now().UTC()
+		time.Sleep(time.Millisecond)
+		return at
+	}
+
+	t.Run("History", func(t *testing.T) {
+		inner := NewInMemoryStorage("local")
+		inner.Set(ctx, &GenericObject{ID: "a", Value: "unversioned", Modified: time.Now().UTC()})
+		store := NewVersionedStorage(inner, NewInMemoryVersionStorage())
+		before := now()
+
+		store.Set(ctx, &GenericObject{ID: "a", Value: "first", Modified: time.Now().UTC()})
+		first := now()
+		err := store.Set(WithOrigin(ctx, "remote"), &GenericObject{ID: "a", Value: "second", Modified: time.Now().UTC()})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		second := now()
+		err = store.Delete(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		versions, err := store.Versions(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(versions) != 4 {
+			t.Fatalf("Incorrect len = %v, want 4", len(versions))
+		}
+		wantOrigins := []string{"local", "local", "remote", "local"}
+		for i, version := range versions {
+			if version.Origin != wantOrigins[i] {
+				t.Errorf("Unexpected origin of version %v = %s", i, version.Origin)
+			}
+		}
+		if !versions[3].Deleted || string(versions[2].Hash) != string(NewHash("second")) {
+			t.Errorf("Unexpected versions = %+v", versions)
+		}
+
+		for at, want := range map[time.Time]string{before: "unversioned", first: "first", second: "second"} {
+			version, err := store.GetVersion(ctx, "a", at)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if version.Value != want {
+				t.Errorf("Unexpected value at %v = %s, want %s", at, version.Value, want)
+			}
+		}
+		_, err = store.GetVersion(ctx, "a", now())
+		if err == nil || !IsNotFoundError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+
+	t.Run("Unmodified", func(t *testing.T) {
+		inner := NewInMemoryStorage("local")
+		inner.Set(ctx, &GenericObject{ID: "a", Value: "unversioned"})
+		store := NewVersionedStorage(inner, NewInMemoryVersionStorage(), WithRetention(0, time.Hour))
+
+		// Deleting what does not exist records nothing
+		err := store.Delete(ctx, "missing")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		ids, _ := store.versions.GetIDs(ctx)
+		if len(ids) != 0 {
+			t.Errorf("Unexpected ids = %v", ids)
+		}
+
+		// Without a modified time the first version is kept as written now
+		store.Set(ctx, &GenericObject{ID: "a", Value: "first"})
+		versions, _ := store.Versions(ctx, "a")
+		if len(versions) != 2 || versions[0].Value != "unversioned" || versions[0].Written.IsZero() {
+			t.Errorf("Unexpected versions = %+v", versions)
+		}
+	})
+
+	t.Run("RestoreAll", func(t *testing.T) {
+		store := NewVersionedStorage(NewInMemoryStorage("local"), NewInMemoryVersionStorage())
+		store.Set(ctx, &GenericObject{ID: "a", Value: "a", Modified: time.Now().UTC()})
+		store.Set(ctx, &GenericObject{ID: "b", Value: "b", Modified: time.Now().UTC()})
+		at := now()
+
+		store.Set(ctx, &GenericObject{ID: "a", Value: "changed", Modified: time.Now().UTC()})
+		store.Delete(ctx, "b")
+		store.Set(ctx, &GenericObject{ID: "c", Value: "c", Modified: time.Now().UTC()})
+
+		err := store.RestoreAll(ctx, at)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		all, err := store.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 2 {
+			t.Fatalf("Incorrect len = %v, want 2", len(all))
+		}
+		for _, id := range []string{"a", "b"} {
+			object, err := store.Get(ctx, id)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if object.Value != id {
+				t.Errorf("Unexpected value of [%s] = %s", id, object.Value)
+			}
+		}
+	})
+
+	t.Run("Retention", func(t *testing.T) {
+		versions := NewInMemoryVersionStorage()
+		store := NewVersionedStorage(NewInMemoryStorage("local"), versions, WithRetention(3, time.Hour))
+		for _, value := range []string{"1", "2", "3", "4"} {
+			store.Set(ctx, &GenericObject{ID: "a", Value: value, Modified: time.Now().UTC()})
+		}
+		kept, _ := store.Versions(ctx, "a")
+		if len(kept) != 3 || kept[0].Value != "2" {
+			t.Errorf("Unexpected versions = %+v", kept)
+		}
+
+		// Only the version current an hour ago is kept from before then
+		written := time.Now().UTC()
+		versions.Set(ctx, "a", []*ObjectVersion{
+			{ID: "a", Value: "old", Written: written.Add(-3 * time.Hour)},
+			{ID: "a", Value: "current", Written: written.Add(-2 * time.Hour)},
+			{ID: "a", Value: "new", Written: written.Add(-time.Minute)},
+		})
+		versions.Set(ctx, "b", []*ObjectVersion{
+			{ID: "b", Value: "old", Written: written.Add(-3 * time.Hour)},
+			{ID: "b", Deleted: true, Written: written.Add(-2 * time.Hour)},
+		})
+		err := store.Prune(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		kept, _ = store.Versions(ctx, "a")
+		if len(kept) != 2 || kept[0].Value != "current" {
+			t.Errorf("Unexpected versions = %+v", kept)
+		}
+		ids, _ := versions.GetIDs(ctx)
+		if len(ids) != 1 || ids[0] != "a" {
+			t.Errorf("Unexpected ids = %v", ids)
+		}
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		for _, causality := range []bool{false, true} {
+			var opts []Option
+			if causality {
+				opts = append(opts, WithCausality("local", "remote"))
+			}
+			store1 := NewVersionedStorage(NewInMemoryStorage("local"), NewInMemoryVersionStorage())
+			store2 := NewInMemoryStorage("remote")
+			status := NewInMemoryStatusStorage()
+
+			store1.Set(ctx, &GenericObject{ID: "a", Value: "base", Modified: time.Now().UTC()})
+			err := Sync(ctx, store1, store2, status, opts...)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+
+			// The local edit is lost to the later remote one
+			store1.Set(ctx, &GenericObject{ID: "a", Value: "local edit", Modified: time.Now().UTC()})
+			at := now()
+			store2.Set(ctx, &GenericObject{ID: "a", Value: "remote edit", Modified: time.Now().UTC().Add(time.Minute)})
+			err = Sync(ctx, store1, store2, status, opts...)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			object, _ := store1.Get(ctx, "a")
+			if object.Value != "remote edit" {
+				t.Fatalf("Unexpected value = %s", object.Value)
+			}
+			versions, _ := store1.Versions(ctx, "a")
+			if last := versions[len(versions)-1]; last.Origin != "remote" {
+				t.Errorf("Unexpected origin = %s", last.Origin)
+			}
+
+			// Restored, it reaches the other side
+			err = store1.Restore(ctx, "a", at)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			err = Sync(ctx, store1, store2, status, opts...)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			object, _ = store2.Get(ctx, "a")
+			if object.Value != "local edit" {
+				t.Errorf("Unexpected value with causality %v = %s", causality, object.Value)
+			}
+		}
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		store1 := NewInMemoryStorage("local")
+		inner := &batchingStorage{InMemoryStorage: NewInMemoryStorage("remote")}
+		store2 := NewVersionedStorage(inner, NewInMemoryVersionStorage())
+		status := NewInMemoryStatusStorage()
+		for i := 0; i < 10; i++ {
+			store1.Set(ctx, &GenericObject{ID: fmt.Sprintf("object%v", i), Value: fmt.Sprintf("value%v", i), Modified: time.Now().UTC()})
+		}
+		err := Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		for i := 0; i < 10; i++ {
+			store1.Delete(ctx, fmt.Sprintf("object%v", i))
+		}
+		err = Sync(ctx, store1, store2, status)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		if inner.batches != 2 || inner.writes != 0 {
+			t.Errorf("Unexpected batches = %v, writes = %v", inner.batches, inner.writes)
+		}
+		for i := 0; i < 10; i++ {
+			versions, _ := store2.Versions(ctx, fmt.Sprintf("object%v", i))
+			if len(versions) != 2 || versions[0].Value != fmt.Sprintf("value%v", i) || !versions[1].Deleted || versions[1].Origin != "local" {
+				t.Fatalf("Unexpected versions = %+v", versions)
+			}
+		}
+	})
+
+	t.Run("Tombstones", func(t *testing.T) {
+		store := NewVersionedStorage(NewInMemoryTombstoneStorage("local"), NewInMemoryVersionStorage())
+		store.Set(ctx, &GenericObject{ID: "a", Value: "value", Modified: time.Now().UTC()})
+		err := store.SetTombstone(ctx, &Tombstone{ID: "a", Hash: NewHash("value"), Deleted: time.Now().UTC(), Origin: "remote"})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		tombstone, err := store.GetTombstone(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if tombstone.Origin != "remote" {
+			t.Errorf("Unexpected origin = %s", tombstone.Origin)
+		}
+		versions, _ := store.Versions(ctx, "a")
+		if len(versions) != 2 || !versions[1].Deleted {
+			t.Errorf("Unexpected versions = %+v", versions)
+		}
+
+		// Without tombstones kept, a tombstone is a deletion
+		store = NewVersionedStorage(NewInMemoryStorage("local"), NewInMemoryVersionStorage())
+		store.Set(ctx, &GenericObject{ID: "a", Value: "value", Modified: time.Now().UTC()})
+		err = store.SetTombstone(ctx, &Tombstone{ID: "a", Hash: NewHash("value"), Deleted: time.Now().UTC(), Origin: "remote"})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = store.Get(ctx, "a")
+		if err == nil || !IsNotFoundError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+		_, err = store.GetTombstone(ctx, "a")
+		if err == nil || !IsNotFoundError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+		versions, _ = store.Versions(ctx, "a")
+		if len(versions) != 2 || !versions[1].Deleted {
+			t.Errorf("Unexpected versions = %+v", versions)
+		}
+	})
+}
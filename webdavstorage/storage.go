@@ -0,0 +1,380 @@
+// Package webdavstorage implements objectsync storage on a WebDAV collection.
+// Each object is a resource in the collection, named by its escaped ID.
+package webdavstorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keithballdotnet/objectsync"
+)
+
+// WebDAVStorage is an objectsync.Storage keeping objects in a WebDAV
+// collection.
+//
+// The Hash of an object is its ETag, so objects are listed with PROPFIND
+// without downloading them.  Writes are conditional on the ETag last read for
+// the object, and fail with objectsync.ErrorPreconditionFailed if it has
+// changed since.  The version and signature of an object are kept in dead
+// properties, if the server supports them, with the modified time a
+// signature covers, as the server keeps its own.
+type WebDAVStorage struct {
+	client     *http.Client
+	collection *url.URL
+
+	mu sync.Mutex
+	// etags are the ETags last read per ID, empty if it was read as missing
+	etags map[string]string
+}
+
+// NewWebDAVStorage will return a WebDAVStorage for the collection at
+// collectionURL.  Authentication is left to the transport of client.
+func NewWebDAVStorage(client *http.Client, collectionURL string) (*WebDAVStorage, error) {
+	collection, err := url.Parse(collectionURL)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(collection.Path, "/") {
+		collection.Path += "/"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &WebDAVStorage{
+		client:     client,
+		collection: collection,
+		etags:      make(map[string]string),
+	}, nil
+}
+
+// GetName will return the collection URL
+func (s *WebDAVStorage) GetName() string {
+	return s.collection.String()
+}
+
+// resource will return the URL of the object.  The resource is named by the
+// escaped ID, so IDs may contain slashes.
+func (s *WebDAVStorage) resource(id string) string {
+	return s.collection.ResolveReference(&url.URL{Path: url.PathEscape(id)}).String()
+}
+
+// Set ...
+func (s *WebDAVStorage) Set(ctx context.Context, object *objectsync.GenericObject) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.resource(object.ID), strings.NewReader(object.Value))
+	if err != nil {
+		return err
+	}
+	etag, seen := s.etag(object.ID)
+	switch {
+	case seen && etag == "":
+		req.Header.Set("If-None-Match", "*")
+	case seen:
+		req.Header.Set("If-Match", etag)
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	etag = resp.Header.Get("ETag")
+	if etag == "" {
+		props, err := s.propfind(ctx, s.resource(object.ID), "0")
+		if err != nil {
+			return err
+		}
+		etag = props[0].ETag
+	}
+	s.setETag(object.ID, etag)
+
+	// The version belongs to this content, whose hash is now the ETag
+	if object.Version != nil || object.Signature != nil {
+		if bytes.Equal(object.VersionHash, objectsync.NewHash(object.Value)) {
+			object.VersionHash = objectsync.Hash(etag)
+		}
+		err = s.setProps(ctx, object)
+		if err != nil {
+			return err
+		}
+	}
+
+	object.Hash = objectsync.Hash(etag)
+	return nil
+}
+
+// setProps will set the dead properties of the object.  Those of a signature
+// are removed if it has none, so one left by an earlier write is not read.
+func (s *WebDAVStorage) setProps(ctx context.Context, object *objectsync.GenericObject) error {
+	var props [][2]string
+	var remove []string
+	if object.Version != nil {
+		version, err := json.Marshal(object.Version)
+		if err != nil {
+			return err
+		}
+		props = append(props, [2]string{"version", string(version)}, [2]string{"version-hash", base64.StdEncoding.EncodeToString(object.VersionHash)})
+	}
+	if object.Signature != nil {
+		signature, err := json.Marshal(object.Signature)
+		if err != nil {
+			return err
+		}
+		props = append(props, [2]string{"signature", string(signature)}, [2]string{"modified", object.Modified.Format(time.RFC3339Nano)})
+	} else {
+		remove = []string{"signature", "modified"}
+	}
+	body := proppatchBody(props, remove)
+
+	req, err := http.NewRequestWithContext(ctx, "PROPPATCH", s.resource(object.ID), strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Get ...
+func (s *WebDAVStorage) Get(ctx context.Context, id string) (*objectsync.GenericObject, error) {
+	props, err := s.propfind(ctx, s.resource(id), "0")
+	if err != nil {
+		return nil, s.notFound(id, err)
+	}
+	object, err := decodeObject(id, &props[0])
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.resource(id), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, s.notFound(id, err)
+	}
+	defer resp.Body.Close()
+
+	value, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	object.Value = string(value)
+
+	// The value read is the one to write over
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		object.Hash = objectsync.Hash(etag)
+	}
+	s.setETag(id, string(object.Hash))
+	return object, nil
+}
+
+// List will return all objects without their values
+func (s *WebDAVStorage) List(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	props, err := s.propfind(ctx, s.collection.String(), "1")
+	if err != nil {
+		return nil, err
+	}
+
+	all := objectsync.GenericObjectCollection{}
+	for i := range props {
+		p := &props[i]
+		if p.ResourceType.Collection != nil {
+			continue
+		}
+		id, err := s.id(p.href)
+		if err != nil {
+			return nil, err
+		}
+		object, err := decodeObject(id, p)
+		if err != nil {
+			return nil, err
+		}
+		s.setETag(id, p.ETag)
+		all = append(all, object)
+	}
+	return all, nil
+}
+
+// GetAll will return all objects, downloading each of them
+func (s *WebDAVStorage) GetAll(ctx context.Context) (objectsync.GenericObjectCollection, error) {
+	listed, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	all := objectsync.GenericObjectCollection{}
+	for _, object := range listed {
+		object, err = s.Get(ctx, object.ID)
+		if err != nil && objectsync.IsNotFoundError(err) {
+			// Deleted since it was listed
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, object)
+	}
+	return all, nil
+}
+
+// Delete will remove a entry from the storage
+func (s *WebDAVStorage) Delete(ctx context.Context, id string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.resource(id), nil)
+	if err != nil {
+		return err
+	}
+	if etag, _ := s.etag(id); etag != "" {
+		req.Header.Set("If-Match", etag)
+	}
+
+	resp, err := s.do(req)
+	if err != nil && !objectsync.IsNotFoundError(err) {
+		return err
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+
+	s.setETag(id, "")
+	return nil
+}
+
+// propstatResult is the properties of a resource found by PROPFIND
+type propstatResult struct {
+	prop
+	href string
+}
+
+func (s *WebDAVStorage) propfind(ctx context.Context, target, depth string) ([]propstatResult, error) {
+	req, err := http.NewRequestWithContext(ctx, "PROPFIND", target, strings.NewReader(propfindBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Depth", depth)
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	ms := &multistatus{}
+	err = xml.NewDecoder(resp.Body).Decode(ms)
+	if err != nil {
+		return nil, err
+	}
+	if len(ms.Responses) == 0 {
+		return nil, objectsync.ErrorNotFound
+	}
+
+	results := make([]propstatResult, len(ms.Responses))
+	for i := range ms.Responses {
+		results[i] = propstatResult{prop: *ms.Responses[i].props(), href: ms.Responses[i].Href}
+	}
+	return results, nil
+}
+
+// do will send the request, mapping failed responses to errors
+func (s *WebDAVStorage) do(req *http.Request) (*http.Response, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, objectsync.ErrorNotFound
+	case http.StatusPreconditionFailed:
+		return nil, objectsync.ErrorPreconditionFailed
+	}
+	return nil, fmt.Errorf("webdav: %s %s: %s", req.Method, req.URL, resp.Status)
+}
+
+// id will return the ID of the object at href
+func (s *WebDAVStorage) id(href string) (string, error) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", err
+	}
+	return url.PathUnescape(path.Base(u.Path))
+}
+
+// notFound will record the object as missing if err says so, and return err
+func (s *WebDAVStorage) notFound(id string, err error) error {
+	if objectsync.IsNotFoundError(err) {
+		s.setETag(id, "")
+	}
+	return err
+}
+
+func (s *WebDAVStorage) etag(id string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	etag, ok := s.etags[id]
+	return etag, ok
+}
+
+func (s *WebDAVStorage) setETag(id, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.etags[id] = etag
+}
+
+func decodeObject(id string, p *propstatResult) (*objectsync.GenericObject, error) {
+	object := &objectsync.GenericObject{ID: id, Hash: objectsync.Hash(p.ETag)}
+
+	if p.LastModified != "" {
+		modified, err := http.ParseTime(p.LastModified)
+		if err != nil {
+			return nil, err
+		}
+		object.Modified = modified.UTC()
+	}
+
+	if p.Version != "" {
+		err := json.Unmarshal([]byte(p.Version), &object.Version)
+		if err != nil {
+			return nil, err
+		}
+		object.VersionHash, err = base64.StdEncoding.DecodeString(p.VersionHash)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.Signature != "" {
+		object.Signature = &objectsync.ObjectSignature{}
+		err := json.Unmarshal([]byte(p.Signature), object.Signature)
+		if err != nil {
+			return nil, err
+		}
+		if p.Modified != "" {
+			object.Modified, err = time.Parse(time.RFC3339Nano, p.Modified)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return object, nil
+}
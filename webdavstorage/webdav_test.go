@@ -0,0 +1,276 @@
+package webdavstorage
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/keithballdotnet/objectsync"
+	"golang.org/x/net/webdav"
+)
+
+// Check the interfaces
+var _ objectsync.Storage = &WebDAVStorage{}
+var _ objectsync.Lister = &WebDAVStorage{}
+
+// preconditions will enforce If-Match and If-None-Match on writes, which
+// webdav.Handler leaves to the application
+func preconditions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut || r.Method == http.MethodDelete {
+			head := httptest.NewRecorder()
+			next.ServeHTTP(head, httptest.NewRequest(http.MethodHead, r.URL.String(), nil))
+			etag := head.Header().Get("ETag")
+			exists := head.Code == http.StatusOK
+
+			ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+			if ifMatch != "" && (!exists || ifMatch != etag) || ifNoneMatch == "*" && exists {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// newServer will return the URL of a collection in a new WebDAV server
+func newServer(t *testing.T) string {
+	fs := webdav.NewMemFS()
+	err := fs.Mkdir(context.TODO(), "/objects", 0755)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	server := httptest.NewServer(preconditions(&webdav.Handler{
+		Prefix:     "/dav",
+		FileSystem: fs,
+		LockSystem: webdav.NewMemLS(),
+	}))
+	t.Cleanup(server.Close)
+	return server.URL + "/dav/objects"
+}
+
+func TestWebDAVStorage(t *testing.T) {
+
+	ctx := context.TODO()
+
+	t.Run("SetGet", func(t *testing.T) {
+		store, err := NewWebDAVStorage(nil, newServer(t))
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		object := &objectsync.GenericObject{
+			ID:          "a b/c",
+			Value:       "value",
+			Version:     objectsync.VersionVector{"local": 2},
+			VersionHash: objectsync.NewHash("value"),
+		}
+		err = store.Set(ctx, object)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		got, err := store.Get(ctx, "a b/c")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if got.Value != "value" || string(got.Hash) != string(object.Hash) || got.Version["local"] != 2 || string(got.VersionHash) != string(got.Hash) {
+			t.Errorf("Unexpected object = %+v", got)
+		}
+		if got.Modified.IsZero() {
+			t.Errorf("Expected Last-Modified as Modified")
+		}
+
+		listed, err := store.List(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(listed) != 1 || listed[0].ID != "a b/c" || listed[0].Value != "" || string(listed[0].Hash) != string(object.Hash) {
+			t.Errorf("Unexpected objects = %+v", listed)
+		}
+
+		_, err = store.Get(ctx, "missing")
+		if !objectsync.IsNotFoundError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+
+		err = store.Delete(ctx, "a b/c")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		all, err := store.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 0 {
+			t.Errorf("Incorrect len = %v, want 0", len(all))
+		}
+	})
+
+	t.Run("Conditional", func(t *testing.T) {
+		collection := newServer(t)
+		store, _ := NewWebDAVStorage(nil, collection)
+		someoneElse, _ := NewWebDAVStorage(nil, collection)
+
+		_, err := store.Get(ctx, "a")
+		if !objectsync.IsNotFoundError(err) {
+			t.Fatalf("Unexpected error = %v", err)
+		}
+		someoneElse.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "theirs"})
+
+		// Created since we found it missing
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "ours"})
+		if err != objectsync.ErrorPreconditionFailed {
+			t.Errorf("Unexpected error = %v", err)
+		}
+
+		_, err = store.List(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "ours"})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// Changed since we last read or wrote it
+		someoneElse.Get(ctx, "a")
+		someoneElse.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "theirs again"})
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "ours again"})
+		if err != objectsync.ErrorPreconditionFailed {
+			t.Errorf("Unexpected error = %v", err)
+		}
+		err = store.Delete(ctx, "a")
+		if err != objectsync.ErrorPreconditionFailed {
+			t.Errorf("Unexpected error = %v", err)
+		}
+
+		object, _ := someoneElse.Get(ctx, "a")
+		if object.Value != "theirs again" {
+			t.Errorf("Unexpected value = %s expected theirs again", object.Value)
+		}
+	})
+
+	for _, causality := range []bool{false, true} {
+		t.Run(fmt.Sprintf("Sync causality %v", causality), func(t *testing.T) {
+			store1 := objectsync.NewInMemoryStorage("local")
+			store2, _ := NewWebDAVStorage(nil, newServer(t))
+			status := objectsync.NewInMemoryStatusStorage()
+
+			for i := 0; i < 3; i++ {
+				store1.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("local%v", i), Value: fmt.Sprintf("Object%v", i), Modified: time.Now().UTC()})
+				err := store2.Set(ctx, &objectsync.GenericObject{ID: fmt.Sprintf("remote%v", i), Value: fmt.Sprintf("Object%v", i)})
+				if err != nil {
+					t.Fatalf("Error: %v", err)
+				}
+			}
+
+			opts := []objectsync.Option{}
+			if causality {
+				opts = append(opts, objectsync.WithCausality("local", "remote"))
+			}
+			err := objectsync.Sync(ctx, store1, store2, status, opts...)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+
+			store1.Delete(ctx, "remote0")
+			store1.Set(ctx, &objectsync.GenericObject{ID: "local1", Value: "changed", Modified: time.Now().UTC()})
+			err = objectsync.Sync(ctx, store1, store2, status, opts...)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+
+			all, err := store2.GetAll(ctx)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if len(all) != 5 {
+				t.Errorf("Incorrect len = %v, want 5", len(all))
+			}
+			object, err := store1.Get(ctx, "remote1")
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if object.Value != "Object1" {
+				t.Errorf("Unexpected value = %s expected Object1", object.Value)
+			}
+
+			// Nothing changes if we change nothing, although the
+			// storages hash differently
+			before, _ := store2.List(ctx)
+			local, _ := store1.GetAll(ctx)
+			err = objectsync.Sync(ctx, store1, store2, status, opts...)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			after, _ := store2.List(ctx)
+			hashes := map[string]string{}
+			for _, object := range before {
+				hashes[object.ID] = string(object.Hash)
+			}
+			for _, object := range after {
+				if hashes[object.ID] != string(object.Hash) {
+					t.Errorf("Unexpected write of [%s] to remote", object.ID)
+				}
+			}
+			for _, object := range local {
+				stored, _ := store1.Get(ctx, object.ID)
+				if object != stored {
+					t.Errorf("Unexpected write of [%s] to local", object.ID)
+				}
+			}
+		})
+	}
+
+	t.Run("Signed", func(t *testing.T) {
+		collection := newServer(t)
+		store, err := NewWebDAVStorage(nil, collection)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		public, key, _ := ed25519.GenerateKey(nil)
+		modified := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+		signer := objectsync.NewSignedStorage(store, "local", key, nil)
+		err = signer.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "value", Modified: modified, Version: objectsync.VersionVector{"local": 1}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		// The signature is kept, with the time it covers, so the object
+		// verifies when read again
+		verifier := func() *objectsync.SignedStorage {
+			reader, _ := NewWebDAVStorage(nil, collection)
+			return objectsync.NewSignedStorage(reader, "remote", nil, map[string]ed25519.PublicKey{"local": public})
+		}
+		got, err := verifier().Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if got.Signature == nil || got.Signature.Replica != "local" || !got.Modified.Equal(modified) {
+			t.Errorf("Unexpected object = %+v", got)
+		}
+		all, err := verifier().GetAll(ctx)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(all) != 1 {
+			t.Errorf("Incorrect len = %v, want 1", len(all))
+		}
+
+		// Written again without one, it no longer verifies
+		err = store.Set(ctx, &objectsync.GenericObject{ID: "a", Value: "unsigned", Modified: modified, Version: objectsync.VersionVector{"local": 2}})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, err = verifier().Get(ctx, "a")
+		if !objectsync.IsVerificationError(err) {
+			t.Errorf("Unexpected error = %v", err)
+		}
+	})
+}
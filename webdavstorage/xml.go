@@ -0,0 +1,113 @@
+package webdavstorage
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// namespace of the dead properties keeping the version and signature of an
+// object
+const namespace = "https://github.com/keithballdotnet/objectsync/"
+
+// propfindBody asks for the properties needed to list objects
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:" xmlns:O="` + namespace + `">
+<D:prop>
+<D:resourcetype/>
+<D:getetag/>
+<D:getlastmodified/>
+<O:version/>
+<O:version-hash/>
+<O:signature/>
+<O:modified/>
+</D:prop>
+</D:propfind>`
+
+// multistatus is the response to a PROPFIND
+type multistatus struct {
+	XMLName   xml.Name   `xml:"DAV: multistatus"`
+	Responses []response `xml:"DAV: response"`
+}
+
+type response struct {
+	Href     string     `xml:"DAV: href"`
+	Propstat []propstat `xml:"DAV: propstat"`
+}
+
+type propstat struct {
+	Prop   prop   `xml:"DAV: prop"`
+	Status string `xml:"DAV: status"`
+}
+
+type prop struct {
+	ResourceType struct {
+		Collection *struct{} `xml:"DAV: collection"`
+	} `xml:"DAV: resourcetype"`
+	ETag         string `xml:"DAV: getetag"`
+	LastModified string `xml:"DAV: getlastmodified"`
+	Version      string `xml:"https://github.com/keithballdotnet/objectsync/ version"`
+	VersionHash  string `xml:"https://github.com/keithballdotnet/objectsync/ version-hash"`
+	Signature    string `xml:"https://github.com/keithballdotnet/objectsync/ signature"`
+	Modified     string `xml:"https://github.com/keithballdotnet/objectsync/ modified"`
+}
+
+// props will return the properties found for the response
+func (r *response) props() *prop {
+	found := &prop{}
+	for _, ps := range r.Propstat {
+		if !strings.Contains(ps.Status, " 200 ") {
+			continue
+		}
+		p := ps.Prop
+		if p.ResourceType.Collection != nil {
+			found.ResourceType = p.ResourceType
+		}
+		if p.ETag != "" {
+			found.ETag = p.ETag
+		}
+		if p.LastModified != "" {
+			found.LastModified = p.LastModified
+		}
+		if p.Version != "" {
+			found.Version = p.Version
+		}
+		if p.VersionHash != "" {
+			found.VersionHash = p.VersionHash
+		}
+		if p.Signature != "" {
+			found.Signature = p.Signature
+		}
+		if p.Modified != "" {
+			found.Modified = p.Modified
+		}
+	}
+	return found
+}
+
+// proppatchBody will return a PROPPATCH setting the dead properties of an
+// object, as pairs of name and value, and removing the ones named in remove
+func proppatchBody(props [][2]string, remove []string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>
+<D:propertyupdate xmlns:D="DAV:" xmlns:O="` + namespace + `">
+<D:set>
+<D:prop>
+`)
+	for _, prop := range props {
+		b.WriteString("<O:" + prop[0] + ">")
+		xml.EscapeText(&b, []byte(prop[1]))
+		b.WriteString("</O:" + prop[0] + ">\n")
+	}
+	b.WriteString(`</D:prop>
+</D:set>
+`)
+	if len(remove) > 0 {
+		b.WriteString("<D:remove>\n<D:prop>\n")
+		for _, name := range remove {
+			b.WriteString("<O:" + name + "/>\n")
+		}
+		b.WriteString("</D:prop>\n</D:remove>\n")
+	}
+	b.WriteString(`</D:propertyupdate>`)
+	return b.String()
+}